@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Avisos a los clientes
+//
+// Se avisa al cliente cuando una incidencia pasa a "en proceso" y cuando se
+// termina la última línea de la orden de trabajo, quede lista para recoger o
+// se cierre directamente. Los avisos salen por cada canal configurado al
+// arrancar (correo, pasarela de SMS, webhook o un fichero local para
+// pruebas). El texto sale de las plantillas de plantillas/avisos.txt. Los
+// envíos se hacen en segundo plano, fuera del cerrojo, y los fallidos se
+// reintentan unas cuantas veces antes de darlos por perdidos. Los clientes
+// con SinAvisos no reciben nada.
+
+// reintentosAvisos son las esperas antes de cada reintento.
+var reintentosAvisos = []time.Duration{30 * time.Second, 2 * time.Minute, 10 * time.Minute}
+
+// errSinDestino indica que el cliente no tiene el dato que necesita el canal
+// (email o teléfono); no se reintenta.
+var errSinDestino = errors.New("el cliente no tiene a dónde enviarlo por este canal")
+
+type Aviso struct {
+	Fecha        time.Time        `json:"fecha"`
+	ClienteID    int              `json:"cliente_id"`
+	Nombre       string           `json:"nombre"`
+	Email        string           `json:"email,omitempty"`
+	Telefono     string           `json:"telefono,omitempty"`
+	Matricula    string           `json:"matricula"`
+	IncidenciaID int              `json:"incidencia_id"`
+	Estado       EstadoIncidencia `json:"estado"`
+	Asunto       string           `json:"asunto"`
+	Texto        string           `json:"texto"`
+}
+
+// CanalAvisos es una forma de hacer llegar el aviso al cliente.
+type CanalAvisos interface {
+	Nombre() string
+	Enviar(a *Aviso) error
+}
+
+// prepararAviso compone el aviso del cambio de estado desde anterior, o
+// devuelve nil si no hay que avisar. Supone que quien llama tiene el cerrojo.
+func prepararAviso(incidencia *Incidencia, anterior EstadoIncidencia) (*Aviso, error) {
+	v := almacen.Vehiculos().PorIncidencia(incidencia.ID)
+	if v == nil {
+		return nil, nil
+	}
+	estado := incidencia.Estado
+	switch {
+	case estado == estadoEnProceso:
+	case trabajoTerminado(incidencia) && !estadoTerminado(anterior):
+		// Se avisa una vez, cuando se termina la orden entera, y siempre
+		// con el aviso de listo para recoger aunque la línea se cierre.
+		if incidencia.Orden != v.Orden || !ordenTerminada(v) {
+			return nil, nil
+		}
+		estado = estadoListaParaRecoger
+	default:
+		return nil, nil
+	}
+	c := buscarPropietario(v)
+	if c == nil || c.SinAvisos {
+		return nil, nil
+	}
+
+	a := &Aviso{
+		Fecha:        time.Now(),
+		ClienteID:    c.ID,
+		Nombre:       c.Nombre,
+		Email:        c.Email,
+		Telefono:     c.Telefono,
+		Matricula:    v.Matricula,
+		IncidenciaID: incidencia.ID,
+		Estado:       estado,
+	}
+	datos := struct {
+		*Aviso
+		Marca, Modelo, Tipo, Descripcion string
+	}{a, v.Marca, v.Modelo, string(incidencia.Tipo), incidencia.Descripcion}
+	var asunto, texto bytes.Buffer
+	if err := plantillasTexto.ExecuteTemplate(&asunto, "asunto "+string(a.Estado), datos); err != nil {
+		return nil, err
+	}
+	if err := plantillasTexto.ExecuteTemplate(&texto, "texto "+string(a.Estado), datos); err != nil {
+		return nil, err
+	}
+	a.Asunto = strings.TrimSpace(asunto.String())
+	a.Texto = strings.TrimSpace(texto.String())
+	return a, nil
+}
+
+// Envío en segundo plano
+
+type envioAviso struct {
+	aviso    *Aviso
+	canal    CanalAvisos
+	intentos int
+}
+
+// registroAviso es el resultado final de un envío, para consultarlo desde
+// el menú.
+type registroAviso struct {
+	Fecha    time.Time
+	Canal    string
+	Aviso    *Aviso
+	Intentos int
+	Error    string // vacío si se envió
+}
+
+const maxRegistroAvisos = 100
+
+type avisador struct {
+	mu         sync.Mutex
+	canales    []CanalAvisos
+	pendientes int
+	registro   []registroAviso // los últimos maxRegistroAvisos, el más reciente al final
+	reintentos []time.Duration // ver reintentosAvisos
+}
+
+var avisos = &avisador{reintentos: reintentosAvisos}
+
+func (av *avisador) anadirCanal(c CanalAvisos) {
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	av.canales = append(av.canales, c)
+}
+
+// encolar envía el aviso por todos los canales sin esperar a que termine.
+func (av *avisador) encolar(a *Aviso) {
+	if a == nil {
+		return
+	}
+	av.mu.Lock()
+	canales := append([]CanalAvisos{}, av.canales...)
+	av.pendientes += len(canales)
+	av.mu.Unlock()
+	for _, c := range canales {
+		go av.intentar(&envioAviso{aviso: a, canal: c})
+	}
+}
+
+func (av *avisador) intentar(e *envioAviso) {
+	e.intentos++
+	err := e.canal.Enviar(e.aviso)
+	if err != nil && err != errSinDestino && e.intentos <= len(av.reintentos) {
+		time.AfterFunc(av.reintentos[e.intentos-1], func() { av.intentar(e) })
+		return
+	}
+
+	r := registroAviso{Fecha: time.Now(), Canal: e.canal.Nombre(), Aviso: e.aviso, Intentos: e.intentos}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	av.pendientes--
+	av.registro = append(av.registro, r)
+	if len(av.registro) > maxRegistroAvisos {
+		av.registro = av.registro[len(av.registro)-maxRegistroAvisos:]
+	}
+}
+
+// estado devuelve una copia de lo necesario para mostrar el menú.
+func (av *avisador) estado() (canales []string, pendientes int, registro []registroAviso) {
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	for _, c := range av.canales {
+		canales = append(canales, c.Nombre())
+	}
+	return canales, av.pendientes, append([]registroAviso{}, av.registro...)
+}
+
+// Canales
+
+var clienteHTTPAvisos = &http.Client{Timeout: 15 * time.Second}
+
+// canalSMTP envía el aviso por correo. Usuario y clave, si el servidor los
+// pide, se leen de TALLER_SMTP_USUARIO y TALLER_SMTP_CLAVE.
+type canalSMTP struct {
+	servidor  string // host:puerto
+	remitente string
+}
+
+func (c *canalSMTP) Nombre() string { return "correo (" + c.servidor + ")" }
+
+func (c *canalSMTP) Enviar(a *Aviso) error {
+	if a.Email == "" {
+		return errSinDestino
+	}
+	var auth smtp.Auth
+	if usuario := os.Getenv("TALLER_SMTP_USUARIO"); usuario != "" {
+		host := c.servidor
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", usuario, os.Getenv("TALLER_SMTP_CLAVE"), host)
+	}
+	// Los saltos de línea en las cabeceras permitirían añadir otras.
+	cabecera := strings.NewReplacer("\r", "", "\n", " ").Replace
+	mensaje := "From: " + cabecera(c.remitente) + "\r\n" +
+		"To: " + cabecera(a.Email) + "\r\n" +
+		"Subject: " + mime.BEncoding.Encode("utf-8", cabecera(a.Asunto)) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n\r\n" +
+		strings.ReplaceAll(a.Texto, "\n", "\r\n") + "\r\n"
+	return smtp.SendMail(c.servidor, auth, c.remitente, []string{a.Email}, []byte(mensaje))
+}
+
+// canalSMS manda el texto a una pasarela de SMS que acepta JSON
+// {"to": ..., "message": ...}. Si existe TALLER_SMS_TOKEN se envía como
+// token de portador.
+type canalSMS struct {
+	url string
+}
+
+func (c *canalSMS) Nombre() string { return "SMS (" + c.url + ")" }
+
+func (c *canalSMS) Enviar(a *Aviso) error {
+	if a.Telefono == "" {
+		return errSinDestino
+	}
+	cuerpo := map[string]string{"to": a.Telefono, "message": a.Asunto + ". " + a.Texto}
+	cabeceras := map[string]string{}
+	if token := os.Getenv("TALLER_SMS_TOKEN"); token != "" {
+		cabeceras["Authorization"] = "Bearer " + token
+	}
+	return enviarJSON(c.url, cuerpo, cabeceras)
+}
+
+// canalWebhookAvisos publica el aviso completo en JSON, para que otro
+// sistema decida cómo hacerlo llegar.
+type canalWebhookAvisos struct {
+	url string
+}
+
+func (c *canalWebhookAvisos) Nombre() string { return "webhook (" + c.url + ")" }
+
+func (c *canalWebhookAvisos) Enviar(a *Aviso) error { return enviarJSON(c.url, a, nil) }
+
+func enviarJSON(url string, cuerpo interface{}, cabeceras map[string]string) error {
+	datos, err := json.Marshal(cuerpo)
+	if err != nil {
+		return err
+	}
+	peticion, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(datos))
+	if err != nil {
+		return err
+	}
+	peticion.Header.Set("Content-Type", "application/json")
+	for nombre, valor := range cabeceras {
+		peticion.Header.Set(nombre, valor)
+	}
+	respuesta, err := clienteHTTPAvisos.Do(peticion)
+	if err != nil {
+		return err
+	}
+	respuesta.Body.Close()
+	if respuesta.StatusCode/100 != 2 {
+		return fmt.Errorf("respuesta %s", respuesta.Status)
+	}
+	return nil
+}
+
+// canalFichero añade cada aviso como una línea JSON al fichero. No envía
+// nada: sirve para probar las plantillas y el flujo sin molestar a nadie.
+type canalFichero struct {
+	mu   sync.Mutex
+	ruta string
+}
+
+func (c *canalFichero) Nombre() string { return "fichero (" + c.ruta + ")" }
+
+func (c *canalFichero) Enviar(a *Aviso) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	f, err := os.OpenFile(c.ruta, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(a); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Funciones de menú
+
+func menuAvisos() {
+	for {
+		limpiarPantalla()
+		fmt.Println("=== AVISOS A CLIENTES ===")
+		fmt.Println("1. Ver canales y últimos envíos")
+		fmt.Println("2. Activar/desactivar los avisos de un cliente")
+		fmt.Println("0. Volver al menú principal")
+
+		var opcion int
+		fmt.Print("\nSeleccione una opción: ")
+		fmt.Scanf("%d", &opcion)
+		fmt.Scanln()
+
+		switch opcion {
+		case 1:
+			verAvisos()
+		case 2:
+			cambiarAvisosCliente()
+		case 0:
+			return
+		default:
+			fmt.Println("Opción inválida")
+			pausar()
+		}
+	}
+}
+
+func verAvisos() {
+	limpiarPantalla()
+	fmt.Println("=== CANALES Y ÚLTIMOS ENVÍOS ===")
+
+	canales, pendientes, registro := avisos.estado()
+	if len(canales) == 0 {
+		fmt.Println("\nNo hay canales configurados: arranque con -smtp, -sms, -avisos-webhook o -avisos-fichero")
+	} else {
+		fmt.Println("\nCanales:")
+		for _, c := range canales {
+			fmt.Println(" -", c)
+		}
+	}
+	fmt.Printf("\nEnvíos en curso o esperando reintento: %d\n\n", pendientes)
+
+	if len(registro) == 0 {
+		fmt.Println("Todavía no se ha enviado ningún aviso")
+		pausar()
+		return
+	}
+	var filas [][]string
+	for i := len(registro) - 1; i >= 0; i-- {
+		r := registro[i]
+		resultado := "Enviado"
+		if r.Error != "" {
+			resultado = "Error: " + r.Error
+		}
+		filas = append(filas, []string{r.Fecha.Format("02/01/2006 15:04"), r.Canal, r.Aviso.Nombre,
+			fmt.Sprintf("#%d %s", r.Aviso.IncidenciaID, r.Aviso.Estado), strconv.Itoa(r.Intentos), resultado})
+	}
+	imprimirTabla(os.Stdout, []string{"Fecha", "Canal", "Cliente", "Incidencia", "Intentos", "Resultado"}, filas)
+	pausar()
+}
+
+func cambiarAvisosCliente() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== AVISOS DE UN CLIENTE ===")
+	id, err := strconv.Atoi(leerCriterio(reader, "ID del cliente: "))
+	if err != nil {
+		fmt.Println("Error: ID no válido")
+		pausar()
+		return
+	}
+	cliente := buscarCliente(id)
+	if cliente == nil {
+		fmt.Println("Error: Cliente no encontrado")
+		pausar()
+		return
+	}
+
+	var sinAvisos bool
+	err = operacion(func() error {
+		cliente.SinAvisos = !cliente.SinAvisos
+		sinAvisos = cliente.SinAvisos
+		return guardar(cliente)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		mostrarConflicto(err)
+		pausar()
+		return
+	}
+	if sinAvisos {
+		fmt.Println("El cliente ya no recibirá avisos")
+	} else {
+		fmt.Println("El cliente volverá a recibir avisos")
+	}
+	pausar()
+}
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// canalPrueba guarda los avisos que recibe. Falla las primeras veces que
+// se le pide si fallos es mayor que cero, con error si se indica.
+type canalPrueba struct {
+	mu       sync.Mutex
+	fallos   int
+	error    error // por defecto "canal caído"
+	intentos int
+	recibido chan *Aviso
+}
+
+func nuevoCanalPrueba(fallos int) *canalPrueba {
+	return &canalPrueba{fallos: fallos, recibido: make(chan *Aviso, 10)}
+}
+
+func (c *canalPrueba) Nombre() string { return "prueba" }
+
+func (c *canalPrueba) Enviar(a *Aviso) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.intentos++
+	if c.intentos <= c.fallos {
+		if c.error != nil {
+			return c.error
+		}
+		return errors.New("canal caído")
+	}
+	c.recibido <- a
+	return nil
+}
+
+// usarCanal deja c como único canal de avisos mientras dura la prueba.
+func usarCanal(t *testing.T, c CanalAvisos) {
+	anterior := avisos
+	avisos = &avisador{reintentos: reintentosAvisos}
+	avisos.anadirCanal(c)
+	t.Cleanup(func() { avisos = anterior })
+}
+
+// siguienteAviso espera el próximo aviso del canal; nil si no llega.
+func siguienteAviso(c *canalPrueba, espera time.Duration) *Aviso {
+	select {
+	case a := <-c.recibido:
+		return a
+	case <-time.After(espera):
+		return nil
+	}
+}
+
+// El cliente se entera de que el vehículo está listo cuando se termina la
+// última línea de la orden, esté lista para recoger o cerrada, y sólo una
+// vez.
+func TestAvisoOrdenTerminada(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	canal := nuevoCanalPrueba(0)
+	usarCanal(t, canal)
+
+	c, err := registrarCliente(0, "Marta", "600000000", "marta@ejemplo.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := registrarVehiculo(c, "1234BCD", "Seat", "Ibiza", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lineas []*Incidencia
+	for _, tipo := range []TipoIncidencia{tipoMecanica, tipoElectrica} {
+		inc, err := registrarIncidencia(0, v, string(tipo), string(prioridadBaja), "revisión", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		lineas = append(lineas, inc)
+	}
+
+	pasos := []struct {
+		nombre string
+		linea  int
+		estado EstadoIncidencia
+		aviso  EstadoIncidencia // vacío si no se avisa
+	}{
+		{"primera línea en proceso", 0, estadoEnProceso, estadoEnProceso},
+		{"primera línea cerrada, falta la otra", 0, estadoCerrada, ""},
+		{"última línea cerrada directamente", 1, estadoCerrada, estadoListaParaRecoger},
+		{"línea reabierta", 1, estadoAbierta, ""},
+		{"terminada otra vez", 1, estadoListaParaRecoger, estadoListaParaRecoger},
+		{"lista pasa a cerrada", 1, estadoCerrada, ""},
+	}
+	for _, paso := range pasos {
+		if err := cambiarEstado(lineas[paso.linea], string(paso.estado)); err != nil {
+			t.Fatalf("%s: %v", paso.nombre, err)
+		}
+		espera := time.Second
+		if paso.aviso == "" {
+			espera = 50 * time.Millisecond
+		}
+		a := siguienteAviso(canal, espera)
+		switch {
+		case paso.aviso == "" && a != nil:
+			t.Errorf("%s: aviso %q inesperado", paso.nombre, a.Estado)
+		case paso.aviso != "" && a == nil:
+			t.Errorf("%s: no llegó el aviso %q", paso.nombre, paso.aviso)
+		case a != nil && (a.Estado != paso.aviso || a.Matricula != "1234BCD" || a.Asunto == ""):
+			t.Errorf("%s: aviso %q de %s con asunto %q, se esperaba %q", paso.nombre, a.Estado, a.Matricula, a.Asunto, paso.aviso)
+		}
+	}
+}
+
+// esperarEnvios espera a que el avisador termine todos los envíos y
+// devuelve su registro.
+func esperarEnvios(t *testing.T, av *avisador) []registroAviso {
+	t.Helper()
+	limite := time.Now().Add(2 * time.Second)
+	for {
+		_, pendientes, registro := av.estado()
+		if pendientes == 0 {
+			return registro
+		}
+		if time.Now().After(limite) {
+			t.Fatalf("quedan %d envíos pendientes", pendientes)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// vehiculoConIncidencia da de alta un cliente con un vehículo y una
+// incidencia abierta.
+func vehiculoConIncidencia(t *testing.T, matricula string) (*Cliente, *Incidencia) {
+	t.Helper()
+	c, err := registrarCliente(0, "Cliente "+matricula, "600000000", "cliente@ejemplo.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := registrarVehiculo(c, matricula, "Seat", "Ibiza", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc, err := registrarIncidencia(0, v, string(tipoMecanica), string(prioridadBaja), "revisión", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, inc
+}
+
+// Un canal que falla se reintenta con las esperas configuradas hasta que
+// entrega el aviso o se agotan los reintentos; si el cliente no tiene a
+// dónde enviarlo no se reintenta.
+func TestAvisoReintentos(t *testing.T) {
+	espera := 20 * time.Millisecond
+	casos := []struct {
+		nombre   string
+		canal    *canalPrueba
+		intentos int
+		error    string // vacío si al final se entrega
+	}{
+		{"entregado al tercer intento", nuevoCanalPrueba(2), 3, ""},
+		{"reintentos agotados", nuevoCanalPrueba(10), 3, "canal caído"},
+		{"sin destino", &canalPrueba{fallos: 10, error: errSinDestino, recibido: make(chan *Aviso, 10)}, 1, errSinDestino.Error()},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			usarAlmacen(t, nuevoAlmacenMemoria())
+			usarCanal(t, caso.canal)
+			avisos.reintentos = []time.Duration{espera, espera}
+			_, inc := vehiculoConIncidencia(t, "1234BCD")
+
+			inicio := time.Now()
+			if err := cambiarEstado(inc, string(estadoEnProceso)); err != nil {
+				t.Fatal(err)
+			}
+			registro := esperarEnvios(t, avisos)
+			if len(registro) != 1 {
+				t.Fatalf("%d envíos en el registro, se esperaba 1", len(registro))
+			}
+			r := registro[0]
+			if r.Intentos != caso.intentos || r.Error != caso.error || r.Canal != "prueba" {
+				t.Errorf("%d intentos con error %q por %s, se esperaban %d con %q", r.Intentos, r.Error, r.Canal, caso.intentos, caso.error)
+			}
+			if minimo := time.Duration(caso.intentos-1) * espera; time.Since(inicio) < minimo {
+				t.Errorf("los %d intentos tardaron %v, menos que las esperas (%v)", r.Intentos, time.Since(inicio), minimo)
+			}
+			if n := len(caso.canal.recibido); (n == 1) != (caso.error == "") {
+				t.Errorf("el canal recibió %d avisos", n)
+			}
+		})
+	}
+}
+
+// Los clientes que renuncian a los avisos no reciben ninguno; los demás sí,
+// y el cliente puede volver a recibirlos.
+func TestAvisoClienteSinAvisos(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	canal := nuevoCanalPrueba(0)
+	usarCanal(t, canal)
+	sinAvisos, incSin := vehiculoConIncidencia(t, "1111AAA")
+	_, incCon := vehiculoConIncidencia(t, "2222BBB")
+	if err := operacion(func() error {
+		sinAvisos.SinAvisos = true
+		return guardar(sinAvisos)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, inc := range []*Incidencia{incSin, incCon} {
+		if err := cambiarEstado(inc, string(estadoEnProceso)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if a := siguienteAviso(canal, time.Second); a == nil || a.Matricula != "2222BBB" {
+		t.Fatalf("aviso %v, se esperaba el de 2222BBB", a)
+	}
+	if a := siguienteAviso(canal, 50*time.Millisecond); a != nil {
+		t.Errorf("aviso de %s, cuyo cliente no quiere avisos", a.Matricula)
+	}
+
+	if err := operacion(func() error {
+		sinAvisos.SinAvisos = false
+		return guardar(sinAvisos)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cambiarEstado(incSin, string(estadoListaParaRecoger)); err != nil {
+		t.Fatal(err)
+	}
+	if a := siguienteAviso(canal, time.Second); a == nil || a.Matricula != "1111AAA" || a.Estado != estadoListaParaRecoger {
+		t.Errorf("aviso %v, se esperaba que 1111AAA está lista para recoger", a)
+	}
+}
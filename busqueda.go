@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Búsqueda y filtros
+//
+// Cada filtro reúne los criterios que se pueden combinar para una entidad;
+// los campos vacíos no filtran. El texto libre se compara por fragmentos, sin
+// distinguir mayúsculas ni tildes, y si tiene varias palabras todas deben
+// aparecer en alguno de los campos. Como las demás funciones auxiliares,
+// filtrar* supone que quien llama ya tiene el cerrojo (ver concurrencia.go).
+
+type filtroClientes struct {
+	Texto string // nombre, teléfono, email o matrícula
+}
+
+type filtroVehiculos struct {
+	Texto        string // matrícula, marca, modelo o nombre del cliente
+	SoloEnTaller bool
+}
+
+type filtroIncidencias struct {
+	Texto     string // descripción o matrícula
+	Tipo      string
+	Prioridad string
+	Estado    string
+	Mecanico  string // ID o parte del nombre de un mecánico asignado
+}
+
+type filtroMecanicos struct {
+	Texto        string // nombre
+	Especialidad string
+	SoloActivos  bool
+}
+
+func normalizarBusqueda(texto string) string {
+	return quitarTildes(strings.ToLower(strings.TrimSpace(texto)))
+}
+
+// coincideTexto indica si cada palabra de texto aparece en alguno de los
+// campos.
+func coincideTexto(texto string, campos ...string) bool {
+	var normalizados []string
+	for _, campo := range campos {
+		normalizados = append(normalizados, normalizarBusqueda(campo))
+	}
+	for _, palabra := range strings.Fields(normalizarBusqueda(texto)) {
+		encontrada := false
+		for _, campo := range normalizados {
+			if strings.Contains(campo, palabra) {
+				encontrada = true
+				break
+			}
+		}
+		if !encontrada {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizar comprueba los valores de catálogo del filtro y los deja tal y
+// como están en el catálogo.
+func (f *filtroIncidencias) normalizar() error {
+	for _, c := range []struct {
+		valor    *string
+		error    string
+		catalogo []string
+	}{
+		{&f.Tipo, "tipo de incidencia %q no válido", textosCatalogo(tiposIncidencia)},
+		{&f.Prioridad, "prioridad %q no válida", textosCatalogo(prioridadesIncidencia)},
+		{&f.Estado, "estado %q no válido", textosCatalogo(estadosIncidencia)},
+	} {
+		if strings.TrimSpace(*c.valor) == "" {
+			*c.valor = ""
+			continue
+		}
+		valor, ok := normalizarValor(*c.valor, c.catalogo)
+		if !ok {
+			return fmt.Errorf(c.error, *c.valor)
+		}
+		*c.valor = valor
+	}
+	return nil
+}
+
+func (f *filtroMecanicos) normalizar() error {
+	if strings.TrimSpace(f.Especialidad) == "" {
+		f.Especialidad = ""
+		return nil
+	}
+	valor, ok := normalizarValor(f.Especialidad, tiposIncidencia)
+	if !ok {
+		return fmt.Errorf("especialidad %q no válida", f.Especialidad)
+	}
+	f.Especialidad = string(valor)
+	return nil
+}
+
+func filtrarClientes(f filtroClientes) []*Cliente {
+	var resultado []*Cliente
+	for _, c := range almacen.Clientes().Todos() {
+		matricula := ""
+		if c.Vehiculo != nil {
+			matricula = c.Vehiculo.Matricula
+		}
+		if coincideTexto(f.Texto, c.Nombre, c.Telefono, c.Email, matricula) {
+			resultado = append(resultado, c)
+		}
+	}
+	return resultado
+}
+
+func filtrarVehiculos(f filtroVehiculos) []*Vehiculo {
+	var resultado []*Vehiculo
+	for _, v := range almacen.Vehiculos().Todos() {
+		if f.SoloEnTaller && !v.EnTaller {
+			continue
+		}
+		cliente := ""
+		if c := buscarPropietario(v); c != nil {
+			cliente = c.Nombre
+		}
+		if coincideTexto(f.Texto, v.Matricula, v.Marca, v.Modelo, cliente) {
+			resultado = append(resultado, v)
+		}
+	}
+	return resultado
+}
+
+// filtrarIncidencias espera el filtro ya normalizado.
+func filtrarIncidencias(f filtroIncidencias) []*Incidencia {
+	var resultado []*Incidencia
+	for _, inc := range almacen.Incidencias().Todas() {
+		if (f.Tipo != "" && string(inc.Tipo) != f.Tipo) ||
+			(f.Prioridad != "" && string(inc.Prioridad) != f.Prioridad) ||
+			(f.Estado != "" && string(inc.Estado) != f.Estado) {
+			continue
+		}
+		if f.Mecanico != "" && !asignadaA(inc, f.Mecanico) {
+			continue
+		}
+		matricula := ""
+		if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+			matricula = v.Matricula
+		}
+		if coincideTexto(f.Texto, inc.Descripcion, matricula) {
+			resultado = append(resultado, inc)
+		}
+	}
+	return resultado
+}
+
+// asignadaA indica si alguno de los mecánicos de la incidencia tiene ese ID
+// o su nombre contiene el texto.
+func asignadaA(inc *Incidencia, mecanico string) bool {
+	id, esID := strconv.Atoi(strings.TrimSpace(mecanico))
+	for _, m := range inc.Mecanicos {
+		if (esID == nil && m.ID == id) || (esID != nil && coincideTexto(mecanico, m.Nombre)) {
+			return true
+		}
+	}
+	return false
+}
+
+// filtrarMecanicos espera el filtro ya normalizado.
+func filtrarMecanicos(f filtroMecanicos) []*Mecanico {
+	var resultado []*Mecanico
+	for _, m := range almacen.Mecanicos().Todos() {
+		if (f.SoloActivos && !m.Activo) || (f.Especialidad != "" && nivelMecanico(m, TipoIncidencia(f.Especialidad)) == "") {
+			continue
+		}
+		if coincideTexto(f.Texto, m.Nombre) {
+			resultado = append(resultado, m)
+		}
+	}
+	return resultado
+}
+
+// Funciones de menú
+
+func leerCriterio(reader *bufio.Reader, etiqueta string) string {
+	fmt.Print(etiqueta)
+	texto, _ := reader.ReadString('\n')
+	return strings.TrimSpace(texto)
+}
+
+func buscarClientes() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== BUSCAR CLIENTES ===")
+	f := filtroClientes{
+		Texto: leerCriterio(reader, "Nombre, teléfono, email o matrícula (vacío = todos): "),
+	}
+
+	var l *listado
+	consultar(func() { l = listadoClientes("CLIENTES ENCONTRADOS", filtrarClientes(f)) })
+	l.vacio = "Ningún cliente coincide con la búsqueda"
+	mostrarListado(l)
+}
+
+func buscarVehiculos() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== BUSCAR VEHÍCULOS ===")
+	f := filtroVehiculos{
+		Texto:        leerCriterio(reader, "Matrícula, marca, modelo o cliente (vacío = todos): "),
+		SoloEnTaller: strings.ToUpper(leerCriterio(reader, "¿Sólo los que están en el taller? (S/N): ")) == "S",
+	}
+
+	var l *listado
+	consultar(func() { l = listadoVehiculos("VEHÍCULOS ENCONTRADOS", filtrarVehiculos(f)) })
+	l.vacio = "Ningún vehículo coincide con la búsqueda"
+	mostrarListado(l)
+}
+
+func buscarIncidencias() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== BUSCAR INCIDENCIAS ===")
+	fmt.Println("Deje vacío cualquier criterio para no filtrar por él.")
+	f := filtroIncidencias{
+		Texto:     leerCriterio(reader, "Texto de la descripción o matrícula: "),
+		Tipo:      leerCriterio(reader, "Tipo ("+strings.Join(textosCatalogo(tiposIncidencia), ", ")+"): "),
+		Prioridad: leerCriterio(reader, "Prioridad ("+strings.Join(textosCatalogo(prioridadesIncidencia), ", ")+"): "),
+		Estado:    leerCriterio(reader, "Estado ("+strings.Join(textosCatalogo(estadosIncidencia), ", ")+"): "),
+		Mecanico:  leerCriterio(reader, "Mecánico asignado (ID o nombre): "),
+	}
+	if err := f.normalizar(); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	var l *listado
+	consultar(func() { l = listadoIncidencias("INCIDENCIAS ENCONTRADAS", filtrarIncidencias(f)) })
+	l.vacio = "Ninguna incidencia coincide con la búsqueda"
+	mostrarListado(l)
+}
+
+func buscarMecanicos() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== BUSCAR MECÁNICOS ===")
+	f := filtroMecanicos{
+		Texto:        leerCriterio(reader, "Nombre (vacío = todos): "),
+		Especialidad: leerCriterio(reader, "Especialidad ("+strings.Join(textosCatalogo(tiposIncidencia), ", ")+", vacío = todas): "),
+		SoloActivos:  strings.ToUpper(leerCriterio(reader, "¿Sólo los activos? (S/N): ")) == "S",
+	}
+	if err := f.normalizar(); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	var l *listado
+	consultar(func() { l = listadoMecanicos("MECÁNICOS ENCONTRADOS", filtrarMecanicos(f)) })
+	l.vacio = "Ningún mecánico coincide con la búsqueda"
+	mostrarListado(l)
+}
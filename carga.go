@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Carga de trabajo de los mecánicos
+//
+// Cada incidencia sin terminar pesa según su prioridad: 1 la más baja y uno
+// más por cada prioridad por encima (baja 1, media 2, alta 3). La carga de un
+// mecánico es la suma de los pesos de sus incidencias pendientes y no debería
+// pasar de cargaMaxima (opción -carga-maxima). Por defecto una asignación que
+// la supera sólo se avisa; con -carga-estricta se rechaza.
+//
+// El reparto sugerido pasa incidencias todavía abiertas (sin empezar) de los
+// mecánicos sobrecargados a los menos cargados que las pueden atender hoy.
+// Es sólo una propuesta: las asignaciones no cambian.
+
+var (
+	cargaMaxima   = 6
+	cargaEstricta = false
+)
+
+// pesoPrioridad es lo que cuenta una incidencia de esa prioridad en la carga.
+func pesoPrioridad(p Prioridad) int {
+	return rangoPrioridad(p) + 1
+}
+
+// cargaMecanico suma los pesos de las incidencias pendientes del mecánico.
+func cargaMecanico(m *Mecanico) int {
+	carga := 0
+	for _, inc := range m.Incidencias {
+		if !trabajoTerminado(inc) {
+			carga += pesoPrioridad(inc.Prioridad)
+		}
+	}
+	return carga
+}
+
+// textoCarga la presenta como "4/6".
+func textoCarga(carga int) string {
+	return fmt.Sprintf("%d/%d", carga, cargaMaxima)
+}
+
+// comprobarCarga devuelve un error si con la incidencia el mecánico pasaría
+// de la carga máxima.
+func comprobarCarga(incidencia *Incidencia, mecanico *Mecanico) error {
+	carga := cargaMecanico(mecanico) + pesoPrioridad(incidencia.Prioridad)
+	if carga > cargaMaxima {
+		return fmt.Errorf("el mecánico %d pasaría a tener carga %s", mecanico.ID, textoCarga(carga))
+	}
+	return nil
+}
+
+// avisoSobrecarga devuelve un aviso si el mecánico pasa de la carga máxima.
+func avisoSobrecarga(mecanico *Mecanico) string {
+	if carga := cargaMecanico(mecanico); carga > cargaMaxima {
+		return fmt.Sprintf("%s queda sobrecargado (carga %s)", mecanico.Nombre, textoCarga(carga))
+	}
+	return ""
+}
+
+// Reparto sugerido
+
+type movimientoCarga struct {
+	Incidencia *Incidencia
+	Desde      *Mecanico
+	Hacia      *Mecanico
+}
+
+// sugerirReparto propone, para cada mecánico sobrecargado, a quién pasar sus
+// incidencias abiertas (empezando por las últimas que se le asignaron) hasta
+// que deje de estarlo. Cada una va al mecánico con menos carga que puede
+// atenderla hoy sin pasar él de la máxima. También devuelve las incidencias
+// de los sobrecargados que nadie puede recibir.
+func sugerirReparto() ([]movimientoCarga, []*Incidencia) {
+	mecanicos := almacen.Mecanicos().Todos()
+	carga := map[*Mecanico]int{}
+	var sobrecargados []*Mecanico
+	for _, m := range mecanicos {
+		carga[m] = cargaMecanico(m)
+		if carga[m] > cargaMaxima {
+			sobrecargados = append(sobrecargados, m)
+		}
+	}
+	sort.SliceStable(sobrecargados, func(i, j int) bool { return carga[sobrecargados[i]] > carga[sobrecargados[j]] })
+
+	var movimientos []movimientoCarga
+	var sinDestino []*Incidencia
+	for _, origen := range sobrecargados {
+		for i := len(origen.Incidencias) - 1; i >= 0 && carga[origen] > cargaMaxima; i-- {
+			inc := origen.Incidencias[i]
+			if inc.Estado != estadoAbierta {
+				continue
+			}
+			peso := pesoPrioridad(inc.Prioridad)
+			var destino *Mecanico
+			if candidatos := candidatosPorCarga(inc, origen, carga); len(candidatos) > 0 && carga[candidatos[0]]+peso <= cargaMaxima {
+				destino = candidatos[0]
+			}
+			if destino == nil {
+				sinDestino = append(sinDestino, inc)
+				continue
+			}
+			carga[origen] -= peso
+			carga[destino] += peso
+			movimientos = append(movimientos, movimientoCarga{inc, origen, destino})
+		}
+	}
+	return movimientos, sinDestino
+}
+
+// candidatosPorCarga devuelve, de menos a más cargado según carga, los
+// mecánicos distintos de excluido a los que se puede asignar la incidencia.
+func candidatosPorCarga(inc *Incidencia, excluido *Mecanico, carga map[*Mecanico]int) []*Mecanico {
+	var candidatos []*Mecanico
+	for _, m := range almacen.Mecanicos().Todos() {
+		if m != excluido && validarAsignacion(inc, m) == nil {
+			candidatos = append(candidatos, m)
+		}
+	}
+	sort.SliceStable(candidatos, func(i, j int) bool { return carga[candidatos[i]] < carga[candidatos[j]] })
+	return candidatos
+}
+
+// reporteReparto muestra la carga de cada mecánico y el reparto sugerido.
+func reporteReparto() *reporte {
+	hoy := time.Now()
+	cargas := seccionReporte{
+		Titulo:   "Carga actual",
+		Columnas: []string{"ID", "Nombre", "Hoy", "Carga", "Pendientes"},
+		Vacio:    "No hay mecánicos en activo",
+	}
+	sobrecargados := 0
+	for _, m := range almacen.Mecanicos().Todos() {
+		if !m.Activo {
+			continue
+		}
+		carga := cargaMecanico(m)
+		if carga > cargaMaxima {
+			sobrecargados++
+		}
+		var pendientes []string
+		for _, inc := range m.Incidencias {
+			if !trabajoTerminado(inc) {
+				pendientes = append(pendientes, fmt.Sprintf("%d (%s)", inc.ID, inc.Prioridad))
+			}
+		}
+		cargas.Filas = append(cargas.Filas, []string{strconv.Itoa(m.ID), m.Nombre, situacionMecanico(m, hoy),
+			textoCarga(carga), strings.Join(pendientes, ", ")})
+	}
+
+	movimientos, sinDestino := sugerirReparto()
+	reparto := seccionReporte{
+		Titulo:   "Reparto sugerido",
+		Columnas: []string{"Incidencia", "Tipo", "Prioridad", "De", "A"},
+		Vacio:    "No hace falta mover ninguna incidencia",
+	}
+	if sobrecargados > 0 {
+		reparto.Vacio = "Nadie puede recibir las incidencias abiertas de los mecánicos sobrecargados"
+	}
+	for _, mov := range movimientos {
+		reparto.Filas = append(reparto.Filas, []string{strconv.Itoa(mov.Incidencia.ID), string(mov.Incidencia.Tipo),
+			string(mov.Incidencia.Prioridad), mov.Desde.Nombre, mov.Hacia.Nombre})
+	}
+
+	var pesos []string
+	for _, p := range prioridadesIncidencia {
+		pesos = append(pesos, fmt.Sprintf("%s %d", p, pesoPrioridad(p)))
+	}
+	resumen := fmt.Sprintf("Carga máxima por mecánico: %d (%s). %d mecánico(s) sobrecargado(s), %d movimiento(s) sugerido(s)",
+		cargaMaxima, strings.Join(pesos, ", "), sobrecargados, len(movimientos))
+	if len(sinDestino) > 0 {
+		var ids []string
+		for _, inc := range sinDestino {
+			ids = append(ids, strconv.Itoa(inc.ID))
+		}
+		resumen += fmt.Sprintf("; sin nadie que pueda recibir: %s", strings.Join(ids, ", "))
+	}
+	return &reporte{
+		Titulo:    "REPARTO DE LA CARGA DE TRABAJO",
+		Generado:  hoy,
+		Secciones: []seccionReporte{cargas, reparto},
+		Resumen:   resumen,
+	}
+}
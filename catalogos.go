@@ -0,0 +1,216 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Catálogos de las incidencias
+//
+// El tipo, la prioridad y el estado de una incidencia tienen tipos propios y
+// los valores de serie son constantes: el código sólo se apoya en ellos (el
+// estado "cerrada", la prioridad "alta"...). El taller puede añadir más en
+// un fichero JSON que se lee al arrancar (opción -catalogos), por ejemplo:
+//
+//	{
+//	  "tipos": ["neumáticos", "climatización"],
+//	  "prioridades": [{"nombre": "urgente", "despues": "alta", "nivel_minimo": "experto"}],
+//	  "estados": [{"nombre": "esperando piezas", "despues": "en proceso"}]
+//	}
+//
+// Las prioridades van de menos a más urgente y los estados en el orden en que
+// avanza la incidencia, así que las nuevas indican detrás de cuál van. Una
+// prioridad nueva pide, si no se dice otra cosa, el mismo nivel de los
+// mecánicos que la anterior; un estado nuevo cuenta como trabajo sin
+// terminar, así que va antes de "lista para recoger" y "cerrada", que
+// terminan la incidencia. Si se quita del fichero un valor que ya usan los
+// datos, éstos no se pueden cargar.
+
+type TipoIncidencia string
+
+type Prioridad string
+
+type EstadoIncidencia string
+
+const (
+	tipoMecanica   TipoIncidencia = "mecánica"
+	tipoElectrica  TipoIncidencia = "eléctrica"
+	tipoCarroceria TipoIncidencia = "carrocería"
+)
+
+const (
+	prioridadBaja  Prioridad = "baja"
+	prioridadMedia Prioridad = "media"
+	prioridadAlta  Prioridad = "alta"
+)
+
+const (
+	estadoAbierta          EstadoIncidencia = "abierta"
+	estadoEnProceso        EstadoIncidencia = "en proceso"
+	estadoListaParaRecoger EstadoIncidencia = "lista para recoger"
+	estadoCerrada          EstadoIncidencia = "cerrada"
+)
+
+var (
+	tiposIncidencia       = []TipoIncidencia{tipoMecanica, tipoElectrica, tipoCarroceria}
+	prioridadesIncidencia = []Prioridad{prioridadBaja, prioridadMedia, prioridadAlta}
+	estadosIncidencia     = []EstadoIncidencia{estadoAbierta, estadoEnProceso, estadoListaParaRecoger, estadoCerrada}
+)
+
+// nivelMinimo es el nivel que hace falta en la especialidad para atender una
+// incidencia de cada prioridad.
+var nivelMinimo = map[Prioridad]string{prioridadBaja: "básico", prioridadMedia: "intermedio", prioridadAlta: "experto"}
+
+// posicion devuelve el lugar del valor en el catálogo, o -1 si no está.
+func posicion[T comparable](catalogo []T, valor T) int {
+	for i, v := range catalogo {
+		if v == valor {
+			return i
+		}
+	}
+	return -1
+}
+
+// rangoPrioridad ordena las prioridades de menos a más urgente.
+func rangoPrioridad(p Prioridad) int { return posicion(prioridadesIncidencia, p) }
+
+// prioridadDeSerie devuelve la prioridad de serie más alta que no supera a
+// p; las añadidas toman así los colores de la que tienen debajo.
+func prioridadDeSerie(p Prioridad) Prioridad {
+	resultado := prioridadBaja
+	for _, serie := range []Prioridad{prioridadBaja, prioridadMedia, prioridadAlta} {
+		if rangoPrioridad(serie) <= rangoPrioridad(p) {
+			resultado = serie
+		}
+	}
+	return resultado
+}
+
+// textosCatalogo devuelve los valores del catálogo como texto, para las
+// opciones de los formularios y los mensajes.
+func textosCatalogo[T ~string](catalogo []T) []string {
+	textos := make([]string, len(catalogo))
+	for i, v := range catalogo {
+		textos[i] = string(v)
+	}
+	return textos
+}
+
+// Fichero de ampliación
+
+type catalogosJSON struct {
+	Tipos       []string `json:"tipos"`
+	Prioridades []struct {
+		Nombre      string `json:"nombre"`
+		Despues     string `json:"despues"`
+		NivelMinimo string `json:"nivel_minimo"`
+	} `json:"prioridades"`
+	Estados []struct {
+		Nombre  string `json:"nombre"`
+		Despues string `json:"despues"`
+	} `json:"estados"`
+}
+
+// cargarCatalogos añade a los catálogos los valores del fichero, si existe.
+// Se llama al arrancar, antes de cargar ningún dato.
+func cargarCatalogos(ruta string) error {
+	datos, err := os.ReadFile(ruta)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var c catalogosJSON
+	if err := json.Unmarshal(datos, &c); err != nil {
+		return err
+	}
+
+	tipos := append([]TipoIncidencia(nil), tiposIncidencia...)
+	for _, nombre := range c.Tipos {
+		if err := nombreNuevo(nombre, tipos); err != nil {
+			return fmt.Errorf("tipo: %v", err)
+		}
+		tipos = append(tipos, TipoIncidencia(strings.TrimSpace(nombre)))
+	}
+
+	prioridades := append([]Prioridad(nil), prioridadesIncidencia...)
+	niveles := map[Prioridad]string{}
+	for p, n := range nivelMinimo {
+		niveles[p] = n
+	}
+	for _, p := range c.Prioridades {
+		if err := nombreNuevo(p.Nombre, prioridades); err != nil {
+			return fmt.Errorf("prioridad: %v", err)
+		}
+		anterior, ok := normalizarValor(p.Despues, prioridades)
+		if !ok {
+			return fmt.Errorf("prioridad %s: no existe la prioridad %q", p.Nombre, p.Despues)
+		}
+		nivel := niveles[anterior]
+		if p.NivelMinimo != "" {
+			if nivel, ok = normalizarValor(p.NivelMinimo, nivelesEspecialidad); !ok {
+				return fmt.Errorf("prioridad %s: nivel %q no válido", p.Nombre, p.NivelMinimo)
+			}
+		}
+		nueva := Prioridad(strings.TrimSpace(p.Nombre))
+		prioridades = insertarDetras(prioridades, anterior, nueva)
+		niveles[nueva] = nivel
+	}
+
+	estados := append([]EstadoIncidencia(nil), estadosIncidencia...)
+	for _, e := range c.Estados {
+		if err := nombreNuevo(e.Nombre, estados); err != nil {
+			return fmt.Errorf("estado: %v", err)
+		}
+		anterior, ok := normalizarValor(e.Despues, estados)
+		if !ok {
+			return fmt.Errorf("estado %s: no existe el estado %q", e.Nombre, e.Despues)
+		}
+		if estadoTerminado(anterior) {
+			return fmt.Errorf("estado %s: no puede ir detrás de %q, que termina la incidencia", e.Nombre, anterior)
+		}
+		estados = insertarDetras(estados, anterior, EstadoIncidencia(strings.TrimSpace(e.Nombre)))
+	}
+
+	tiposIncidencia, prioridadesIncidencia, estadosIncidencia, nivelMinimo = tipos, prioridades, estados, niveles
+	return nil
+}
+
+// nombreNuevo comprueba que el nombre no está vacío ni ya en el catálogo
+// (tampoco escrito con otras mayúsculas o tildes).
+func nombreNuevo[T ~string](nombre string, catalogo []T) error {
+	if strings.TrimSpace(nombre) == "" {
+		return errors.New("el nombre no puede estar vacío")
+	}
+	if _, ok := normalizarValor(nombre, catalogo); ok {
+		return fmt.Errorf("%q ya existe", nombre)
+	}
+	return nil
+}
+
+func insertarDetras[T comparable](catalogo []T, anterior, nuevo T) []T {
+	i := posicion(catalogo, anterior) + 1
+	return append(catalogo[:i], append([]T{nuevo}, catalogo[i:]...)...)
+}
+
+// Funciones de menú
+
+// elegirDeCatalogo muestra los valores numerados y devuelve el elegido.
+func elegirDeCatalogo[T ~string](catalogo []T) (T, bool) {
+	for i, valor := range catalogo {
+		texto := []rune(string(valor))
+		fmt.Printf("%d. %s\n", i+1, strings.ToUpper(string(texto[:1]))+string(texto[1:]))
+	}
+	var opcion int
+	fmt.Print("Opción: ")
+	fmt.Scanf("%d", &opcion)
+	fmt.Scanln()
+	if opcion < 1 || opcion > len(catalogo) {
+		return "", false
+	}
+	return catalogo[opcion-1], true
+}
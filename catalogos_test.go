@@ -0,0 +1,64 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// usarCatalogos carga el fichero con ese contenido y deja los catálogos de
+// serie al terminar la prueba.
+func usarCatalogos(t *testing.T, contenido string) error {
+	t.Helper()
+	tipos, prioridades, estados, niveles := tiposIncidencia, prioridadesIncidencia, estadosIncidencia, nivelMinimo
+	t.Cleanup(func() {
+		tiposIncidencia, prioridadesIncidencia, estadosIncidencia, nivelMinimo = tipos, prioridades, estados, niveles
+	})
+	ruta := filepath.Join(t.TempDir(), "catalogos.json")
+	if err := os.WriteFile(ruta, []byte(contenido), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return cargarCatalogos(ruta)
+}
+
+// Los estados nuevos son trabajo sin terminar: van antes de los que terminan
+// la incidencia, nunca detrás.
+func TestCatalogosEstadosNuevos(t *testing.T) {
+	deSerie := slices.Clone(estadosIncidencia)
+	casos := []struct {
+		nombre  string
+		estados string
+		orden   []EstadoIncidencia // nil si se rechaza
+		error   string
+	}{
+		{"detrás de en proceso", `[{"nombre": "esperando piezas", "despues": "en proceso"},
+		                           {"nombre": "en pruebas", "despues": "esperando piezas"}]`,
+			[]EstadoIncidencia{estadoAbierta, estadoEnProceso, "esperando piezas", "en pruebas", estadoListaParaRecoger, estadoCerrada}, ""},
+		{"detrás de lista para recoger", `[{"nombre": "lavado", "despues": "lista para recoger"}]`, nil, "termina la incidencia"},
+		{"detrás de cerrada", `[{"nombre": "archivada", "despues": "Cerrada"}]`, nil, "termina la incidencia"},
+		{"detrás de uno que no existe", `[{"nombre": "lavado", "despues": "en el túnel"}]`, nil, "no existe el estado"},
+		{"repetido", `[{"nombre": "En Proceso", "despues": "abierta"}]`, nil, "ya existe"},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			err := usarCatalogos(t, `{"estados": `+caso.estados+`}`)
+			switch {
+			case caso.orden != nil && err != nil:
+				t.Fatal(err)
+			case caso.orden != nil && !slices.Equal(estadosIncidencia, caso.orden):
+				t.Errorf("estados %v, se esperaba %v", estadosIncidencia, caso.orden)
+			case caso.orden == nil && (err == nil || !strings.Contains(err.Error(), caso.error)):
+				t.Errorf("error %v, se esperaba uno que dijera %q", err, caso.error)
+			case caso.orden == nil && !slices.Equal(estadosIncidencia, deSerie):
+				t.Errorf("el fichero rechazado cambió los estados a %v", estadosIncidencia)
+			}
+			for _, e := range estadosIncidencia {
+				if i := posicion(estadosIncidencia, e); !estadoTerminado(e) && i > posicion(estadosIncidencia, estadoListaParaRecoger) {
+					t.Errorf("el estado %q, sin terminar, va detrás de los terminados", e)
+				}
+			}
+		})
+	}
+}
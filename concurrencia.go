@@ -0,0 +1,98 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Acceso concurrente al estado del taller
+//
+// Varios puestos (o peticiones HTTP) pueden trabajar a la vez sobre el mismo
+// taller. Todas las modificaciones pasan por operacion, que las serializa y
+// las ejecuta en una transacción del almacén, así que la comprobación de una
+// plaza libre y su ocupación no se pueden intercalar con otra operación. Las
+// lecturas que recorren varias entidades usan consultar, que admite varios
+// lectores a la vez. Cada operación que termina bien se anuncia en cambios
+// para que los paneles en directo se actualicen y se publican los webhooks
+// que haya anotado (ver webhooks.go).
+//
+// Dentro de operacion y consultar no se debe volver a llamar a ninguna de
+// las dos: el cerrojo no es reentrante. Las funciones auxiliares (buscar*,
+// guardar, calcularTotalPlazas...) suponen que quien las llama ya lo tiene.
+
+var cerrojo sync.RWMutex
+
+// operacion ejecuta fn en exclusiva y dentro de una transacción.
+func operacion(fn func() error) error {
+	cerrojo.Lock()
+	defer cerrojo.Unlock()
+	salientes = nil
+	err := almacen.Transaccion(fn)
+	if err == nil {
+		cambios.notificar()
+		webhooks.publicar(salientes)
+	}
+	salientes = nil
+	return err
+}
+
+// consultar ejecuta fn impidiendo que se modifique el estado mientras tanto.
+func consultar(fn func()) {
+	cerrojo.RLock()
+	defer cerrojo.RUnlock()
+	fn()
+}
+
+// avisoCambios avisa a quien espera de que el estado ha cambiado. Cada
+// espera recibe un canal que se cierra en el siguiente cambio, así que
+// cualquier número de paneles puede esperar a la vez sin bloquear a nadie.
+type avisoCambios struct {
+	mu    sync.Mutex
+	canal chan struct{}
+}
+
+var cambios = &avisoCambios{canal: make(chan struct{})}
+
+// esperar devuelve un canal que se cierra con el próximo cambio.
+func (a *avisoCambios) esperar() <-chan struct{} {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.canal
+}
+
+func (a *avisoCambios) notificar() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	close(a.canal)
+	a.canal = make(chan struct{})
+}
+
+// contadorID reparte IDs de forma atómica. Guarda el último ID usado, así
+// que el valor cero ya está listo para empezar en 1.
+type contadorID struct {
+	ultimo atomic.Int64
+}
+
+// asignar devuelve el ID pedido (o el siguiente si es 0) y deja el contador
+// siempre por encima del último ID usado.
+func (c *contadorID) asignar(id int) int {
+	if id <= 0 {
+		return int(c.ultimo.Add(1))
+	}
+	for {
+		actual := c.ultimo.Load()
+		if int64(id) <= actual || c.ultimo.CompareAndSwap(actual, int64(id)) {
+			return id
+		}
+	}
+}
+
+// siguiente devuelve el ID que se asignará a la próxima alta.
+func (c *contadorID) siguiente() int {
+	return int(c.ultimo.Load()) + 1
+}
+
+// fijar hace que la próxima alta reciba el ID indicado.
+func (c *contadorID) fijar(siguiente int) {
+	c.ultimo.Store(int64(siguiente - 1))
+}
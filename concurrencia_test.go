@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+// Estas pruebas lanzan muchas altas y entradas a la vez; con go test -race
+// comprueban además que nada se salta operacion.
+
+const puestosConcurrentes = 24
+
+// tallerConPlazas prepara un taller vacío en memoria con los mecánicos
+// necesarios para tener plazas todos los días de la semana.
+func tallerConPlazas(t *testing.T, mecanicos int) int {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	contadorCliente.fijar(1)
+	contadorIncidencia.fijar(1)
+	contadorMecanico.fijar(1)
+
+	var todaLaSemana []Turno
+	for _, dia := range semana {
+		todaLaSemana = append(todaLaSemana, Turno{dia, "00:00", "23:59"})
+	}
+	for i := 0; i < mecanicos; i++ {
+		_, err := registrarMecanico(0, fmt.Sprintf("Mecánico %d", i+1),
+			[]Especialidad{{Tipo: tipoMecanica, Nivel: "experto"}}, 5, todaLaSemana, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var plazas int
+	consultar(func() { plazas = calcularTotalPlazas() })
+	return plazas
+}
+
+// vehiculosConcurrentes da de alta n clientes, cada uno con su vehículo y
+// una incidencia, desde n goroutines a la vez.
+func vehiculosConcurrentes(t *testing.T, n int) []*Vehiculo {
+	vehiculos := make([]*Vehiculo, n)
+	var wg sync.WaitGroup
+	for i := range vehiculos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := registrarCliente(0, fmt.Sprintf("Cliente %d", i), "600000000", "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			v, err := registrarVehiculo(c, fmt.Sprintf("%04dBCD", i), "Seat", "Ibiza", "")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if _, err := registrarIncidencia(0, v, string(tipoMecanica), string(prioridadBaja), "revisión", string(estadoAbierta)); err != nil {
+				t.Error(err)
+				return
+			}
+			vehiculos[i] = v
+		}()
+	}
+	wg.Wait()
+	if t.Failed() {
+		t.FailNow()
+	}
+	return vehiculos
+}
+
+func TestIDsConcurrentesUnicos(t *testing.T) {
+	tallerConPlazas(t, 1)
+	vehiculosConcurrentes(t, puestosConcurrentes)
+
+	consultar(func() {
+		clientes := map[int]bool{}
+		for _, c := range almacen.Clientes().Todos() {
+			if clientes[c.ID] {
+				t.Errorf("ID de cliente %d repetido", c.ID)
+			}
+			clientes[c.ID] = true
+		}
+		incidencias := map[int]bool{}
+		for _, inc := range almacen.Incidencias().Todas() {
+			if incidencias[inc.ID] {
+				t.Errorf("ID de incidencia %d repetido", inc.ID)
+			}
+			incidencias[inc.ID] = true
+		}
+		for id := 1; id <= puestosConcurrentes; id++ {
+			if !clientes[id] || !incidencias[id] {
+				t.Errorf("falta el ID %d (clientes %v, incidencias %v)", id, clientes[id], incidencias[id])
+			}
+		}
+	})
+	if s := contadorCliente.siguiente(); s != puestosConcurrentes+1 {
+		t.Errorf("el siguiente cliente sería el %d, se esperaba el %d", s, puestosConcurrentes+1)
+	}
+}
+
+func TestContadorIDConcurrente(t *testing.T) {
+	var c contadorID
+	const porPuesto = 200
+	ids := make([][]int, puestosConcurrentes)
+	var wg sync.WaitGroup
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < porPuesto; j++ {
+				if j%50 == 0 {
+					// las importaciones fijan IDs explícitos por encima
+					c.asignar(c.siguiente() + 10)
+					continue
+				}
+				ids[i] = append(ids[i], c.asignar(0))
+			}
+		}()
+	}
+	wg.Wait()
+
+	vistos := map[int]bool{}
+	for _, lista := range ids {
+		for _, id := range lista {
+			if vistos[id] {
+				t.Fatalf("el ID %d se repartió dos veces", id)
+			}
+			vistos[id] = true
+		}
+	}
+}
+
+func TestIngresarVehiculoConcurrente(t *testing.T) {
+	plazas := tallerConPlazas(t, 3)
+	if plazas == 0 {
+		t.Fatal("el taller de prueba no tiene plazas")
+	}
+	vehiculos := vehiculosConcurrentes(t, puestosConcurrentes)
+
+	// Entran todos a la vez: sólo caben tantos como plazas.
+	asignadas := make([]int, len(vehiculos))
+	var wg sync.WaitGroup
+	for i, v := range vehiculos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			plaza, err := ingresarVehiculo(v)
+			if err == nil {
+				asignadas[i] = plaza
+			}
+		}()
+	}
+	wg.Wait()
+	comprobarPlazas(t, "entrada", vehiculos, asignadas, plazas, plazas)
+
+	// Salen los que han entrado mientras los demás intentan entrar.
+	for i, v := range vehiculos {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if asignadas[i] > 0 {
+				// fuera de operacion las entidades sólo se leen con consultar
+				var incidencias []*Incidencia
+				consultar(func() { incidencias = append(incidencias, v.Incidencias...) })
+				for _, inc := range incidencias {
+					if err := cambiarEstado(inc, string(estadoListaParaRecoger)); err != nil {
+						t.Error(err)
+					}
+				}
+				if err := entregarVehiculo(v, "pagado", "el cliente"); err != nil {
+					t.Error(err)
+					return
+				}
+				asignadas[i] = 0
+				return
+			}
+			if plaza, err := ingresarVehiculo(v); err == nil {
+				asignadas[i] = plaza
+			}
+		}()
+	}
+	wg.Wait()
+	var dentro int
+	consultar(func() { dentro = contarPlazasOcupadas() })
+	if dentro == 0 || dentro > plazas {
+		t.Fatalf("tras la rotación hay %d plazas ocupadas de %d", dentro, plazas)
+	}
+	comprobarPlazas(t, "rotación", vehiculos, asignadas, plazas, dentro)
+}
+
+// comprobarPlazas verifica que ninguna plaza tiene dos vehículos y que el
+// taller, los vehículos y lo que devolvió ingresarVehiculo coinciden.
+func comprobarPlazas(t *testing.T, fase string, vehiculos []*Vehiculo, asignadas []int, plazas, ocupadas int) {
+	t.Helper()
+	consultar(func() {
+		porPlaza := map[int]string{}
+		for i, v := range vehiculos {
+			if !v.EnTaller {
+				if asignadas[i] != 0 {
+					t.Errorf("%s: %s recibió la plaza %d pero no está en el taller", fase, v.Matricula, asignadas[i])
+				}
+				continue
+			}
+			if v.NumeroPlaza != asignadas[i] {
+				t.Errorf("%s: %s está en la plaza %d y se le asignó la %d", fase, v.Matricula, v.NumeroPlaza, asignadas[i])
+			}
+			if v.NumeroPlaza < 1 || v.NumeroPlaza > plazas {
+				t.Errorf("%s: %s en la plaza %d, fuera de 1-%d", fase, v.Matricula, v.NumeroPlaza, plazas)
+			}
+			if otro, ok := porPlaza[v.NumeroPlaza]; ok {
+				t.Errorf("%s: la plaza %d la ocupan %s y %s", fase, v.NumeroPlaza, otro, v.Matricula)
+			}
+			porPlaza[v.NumeroPlaza] = v.Matricula
+			if !taller.PlazasOcupadas[v.NumeroPlaza] {
+				t.Errorf("%s: la plaza %d de %s figura libre", fase, v.NumeroPlaza, v.Matricula)
+			}
+		}
+		if len(porPlaza) != ocupadas || contarPlazasOcupadas() != ocupadas {
+			t.Errorf("%s: %d vehículos en plaza y %d plazas ocupadas, se esperaban %d",
+				fase, len(porPlaza), contarPlazasOcupadas(), ocupadas)
+		}
+		if n := len(almacen.Vehiculos().EnTaller()); n != ocupadas {
+			t.Errorf("%s: EnTaller() devuelve %d vehículos, se esperaban %d", fase, n, ocupadas)
+		}
+	})
+}
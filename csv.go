@@ -0,0 +1,672 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Importación y exportación de datos en CSV
+
+// campoCSV describe una columna que entiende la importación: su nombre
+// canónico y los nombres de cabecera que se aceptan para ella.
+type campoCSV struct {
+	Nombre    string
+	Alias     []string
+	Requerido bool
+}
+
+var camposCSV = map[string][]campoCSV{
+	"clientes": {
+		{"id", []string{"id", "id_cliente", "cliente_id"}, false},
+		{"nombre", []string{"nombre", "cliente", "nombre_cliente", "name"}, true},
+		{"telefono", []string{"telefono", "tel", "movil", "phone"}, false},
+		{"email", []string{"email", "correo", "e_mail", "mail", "correo_electronico"}, false},
+	},
+	"vehiculos": {
+		{"matricula", []string{"matricula", "placa", "plate"}, true},
+		{"marca", []string{"marca", "brand"}, false},
+		{"modelo", []string{"modelo", "model"}, false},
+		{"cliente_id", []string{"cliente_id", "id_cliente", "cliente", "propietario"}, true},
+		{"fecha_entrada", []string{"fecha_entrada", "entrada"}, false},
+		{"fecha_salida", []string{"fecha_salida", "salida"}, false},
+	},
+	"incidencias": {
+		{"id", []string{"id", "id_incidencia", "incidencia_id"}, false},
+		{"matricula", []string{"matricula", "vehiculo", "placa"}, true},
+		{"tipo", []string{"tipo", "tipo_incidencia"}, true},
+		{"prioridad", []string{"prioridad"}, true},
+		{"estado", []string{"estado"}, false},
+		{"descripcion", []string{"descripcion", "detalle"}, false},
+		{"mecanicos", []string{"mecanicos", "mecanicos_id", "id_mecanicos"}, false},
+	},
+	"mecanicos": {
+		{"id", []string{"id", "id_mecanico", "mecanico_id"}, false},
+		{"nombre", []string{"nombre", "mecanico", "name"}, true},
+		{"especialidades", []string{"especialidades", "especialidad"}, true},
+		{"anios_exp", []string{"anios_exp", "anos_exp", "anios", "experiencia", "anios_experiencia"}, false},
+		{"activo", []string{"activo", "alta"}, false},
+		{"horario", []string{"horario", "turnos"}, false},
+	},
+}
+
+type errorFila struct {
+	Linea   int
+	Mensaje string
+}
+
+type informeImportacion struct {
+	Entidad    string
+	Simulacion bool
+	Mapeo      map[string]string // campo -> columna del fichero
+	Ignoradas  []string
+	Filas      int
+	Importadas int
+	Errores    []errorFila
+}
+
+// filaCSV da acceso a los valores de una fila por nombre de campo.
+type filaCSV struct {
+	Linea   int
+	valores []string
+	mapeo   map[string]int
+}
+
+func (f filaCSV) valor(campo string) string {
+	i, ok := f.mapeo[campo]
+	if !ok || i >= len(f.valores) {
+		return ""
+	}
+	return strings.TrimSpace(f.valores[i])
+}
+
+func (f filaCSV) entero(campo string) (int, error) {
+	texto := f.valor(campo)
+	if texto == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(texto)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q no es un número", campo, texto)
+	}
+	return n, nil
+}
+
+func normalizarCabecera(texto string) string {
+	texto = quitarTildes(strings.ToLower(strings.TrimSpace(texto)))
+	texto = strings.NewReplacer(" ", "_", "-", "_", ".", "", "ñ", "n").Replace(texto)
+	return texto
+}
+
+// mapearCabecera asocia cada campo conocido con la columna de la cabecera
+// que lo contiene. Las columnas que no se reconocen se devuelven aparte.
+func mapearCabecera(cabecera []string, campos []campoCSV) (map[string]int, []string, error) {
+	mapeo := map[string]int{}
+	var ignoradas []string
+
+	for i, columna := range cabecera {
+		clave := normalizarCabecera(columna)
+		reconocida := false
+		for _, campo := range campos {
+			if _, usado := mapeo[campo.Nombre]; usado {
+				continue
+			}
+			for _, alias := range campo.Alias {
+				if clave == alias {
+					mapeo[campo.Nombre] = i
+					reconocida = true
+					break
+				}
+			}
+			if reconocida {
+				break
+			}
+		}
+		if !reconocida {
+			ignoradas = append(ignoradas, columna)
+		}
+	}
+
+	var faltan []string
+	for _, campo := range campos {
+		if _, ok := mapeo[campo.Nombre]; campo.Requerido && !ok {
+			faltan = append(faltan, campo.Nombre)
+		}
+	}
+	if len(faltan) > 0 {
+		return nil, nil, fmt.Errorf("faltan columnas obligatorias: %s", strings.Join(faltan, ", "))
+	}
+	return mapeo, ignoradas, nil
+}
+
+// detectarSeparador distingue entre CSV con comas y el formato con punto y
+// coma que generan las hojas de cálculo en español.
+func detectarSeparador(datos []byte) rune {
+	primeraLinea := datos
+	if i := bytes.IndexByte(datos, '\n'); i >= 0 {
+		primeraLinea = datos[:i]
+	}
+	if bytes.Count(primeraLinea, []byte(";")) > bytes.Count(primeraLinea, []byte(",")) {
+		return ';'
+	}
+	return ','
+}
+
+func leerCSV(ruta string) ([][]string, error) {
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, err
+	}
+	datos = bytes.TrimPrefix(datos, []byte("\ufeff"))
+
+	lector := csv.NewReader(bytes.NewReader(datos))
+	lector.Comma = detectarSeparador(datos)
+	lector.FieldsPerRecord = -1
+	lector.TrimLeadingSpace = true
+
+	registros, err := lector.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(registros) == 0 {
+		return nil, errors.New("el fichero está vacío")
+	}
+	return registros, nil
+}
+
+func parsearBooleano(texto string, porDefecto bool) (bool, error) {
+	switch quitarTildes(strings.ToLower(strings.TrimSpace(texto))) {
+	case "":
+		return porDefecto, nil
+	case "si", "s", "true", "1", "activo", "alta":
+		return true, nil
+	case "no", "n", "false", "0", "inactivo", "baja":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q no es un valor sí/no", texto)
+}
+
+func formatearBooleano(valor bool) string {
+	if valor {
+		return "si"
+	}
+	return "no"
+}
+
+// importarCSV valida todas las filas del fichero y, salvo en simulación,
+// da de alta las que son correctas. Las filas con errores se informan y se
+// omiten sin afectar al resto. Cada fila se da de alta en una sola
+// operación: si algo falla no queda nada de ella.
+func importarCSV(entidad, ruta string, simulacion bool) (*informeImportacion, error) {
+	campos, ok := camposCSV[entidad]
+	if !ok {
+		return nil, fmt.Errorf("entidad %q desconocida", entidad)
+	}
+
+	registros, err := leerCSV(ruta)
+	if err != nil {
+		return nil, err
+	}
+
+	mapeo, ignoradas, err := mapearCabecera(registros[0], campos)
+	if err != nil {
+		return nil, err
+	}
+
+	informe := &informeImportacion{
+		Entidad:    entidad,
+		Simulacion: simulacion,
+		Mapeo:      map[string]string{},
+		Ignoradas:  ignoradas,
+	}
+	for campo, i := range mapeo {
+		informe.Mapeo[campo] = registros[0][i]
+	}
+
+	importador := nuevoImportador(entidad, simulacion)
+	for i, valores := range registros[1:] {
+		fila := filaCSV{Linea: i + 2, valores: valores, mapeo: mapeo}
+		if filaVacia(valores) {
+			continue
+		}
+		informe.Filas++
+		if err := importador(fila); err != nil {
+			informe.Errores = append(informe.Errores, errorFila{fila.Linea, err.Error()})
+			continue
+		}
+		informe.Importadas++
+	}
+
+	return informe, nil
+}
+
+func filaVacia(valores []string) bool {
+	for _, v := range valores {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// nuevoImportador devuelve la función que valida (y si procede, registra)
+// una fila de la entidad. Guarda las claves ya vistas en el fichero para
+// detectar duplicados también en simulación.
+func nuevoImportador(entidad string, simulacion bool) func(filaCSV) error {
+	idsVistos := map[int]bool{}
+	clavesVistas := map[string]bool{}
+
+	comprobarID := func(id int, existe bool) error {
+		if id < 0 {
+			return fmt.Errorf("ID %d no válido", id)
+		}
+		if id > 0 && (existe || idsVistos[id]) {
+			return fmt.Errorf("el ID %d ya está en uso", id)
+		}
+		if id > 0 {
+			idsVistos[id] = true
+		}
+		return nil
+	}
+
+	switch entidad {
+	case "clientes":
+		return func(fila filaCSV) error {
+			id, err := fila.entero("id")
+			if err != nil {
+				return err
+			}
+			nombre, telefono, email := fila.valor("nombre"), fila.valor("telefono"), fila.valor("email")
+			if err := validarCliente(nombre); err != nil {
+				return err
+			}
+			if err := comprobarEmail(email); err != nil {
+				return err
+			}
+			if err := comprobarID(id, buscarCliente(id) != nil); err != nil {
+				return err
+			}
+			if simulacion {
+				return nil
+			}
+			_, err = registrarCliente(id, nombre, telefono, email)
+			return err
+		}
+
+	case "vehiculos":
+		return func(fila filaCSV) error {
+			idCliente, err := fila.entero("cliente_id")
+			if err != nil {
+				return err
+			}
+			matricula := fila.valor("matricula")
+			cliente := buscarCliente(idCliente)
+			if err := validarVehiculo(cliente, matricula); err != nil {
+				return err
+			}
+			if clavesVistas[matricula] {
+				return fmt.Errorf("la matrícula %s está repetida en el fichero", matricula)
+			}
+			if idsVistos[idCliente] {
+				return fmt.Errorf("el cliente %d aparece en más de una fila", idCliente)
+			}
+			clavesVistas[matricula] = true
+			idsVistos[idCliente] = true
+			if simulacion {
+				return nil
+			}
+			vehiculo := &Vehiculo{
+				Matricula:    matricula,
+				Marca:        fila.valor("marca"),
+				Modelo:       fila.valor("modelo"),
+				FechaEntrada: fila.valor("fecha_entrada"),
+				FechaSalida:  fila.valor("fecha_salida"),
+				NumeroPlaza:  -1,
+			}
+			return operacion(func() error { return altaVehiculo(cliente, vehiculo) })
+		}
+
+	case "incidencias":
+		return func(fila filaCSV) error {
+			id, err := fila.entero("id")
+			if err != nil {
+				return err
+			}
+			matricula := fila.valor("matricula")
+			tipo, prioridad, estado := fila.valor("tipo"), fila.valor("prioridad"), fila.valor("estado")
+			if estado == "" {
+				estado = string(estadoAbierta)
+			}
+			if err := validarIncidencia(buscarVehiculo(matricula), tipo, prioridad, estado); err != nil {
+				return err
+			}
+			if err := comprobarID(id, buscarIncidencia(id) != nil); err != nil {
+				return err
+			}
+
+			tipoIncidencia, _ := normalizarValor(tipo, tiposIncidencia)
+			prioridadIncidencia, _ := normalizarValor(prioridad, prioridadesIncidencia)
+			asignados, err := mecanicosDeFila(fila.valor("mecanicos"), tipoIncidencia, prioridadIncidencia)
+			if err != nil {
+				return err
+			}
+			if simulacion {
+				return nil
+			}
+
+			return operacion(func() error {
+				incidencia, err := altaIncidencia(id, buscarVehiculo(matricula), tipo, prioridad,
+					fila.valor("descripcion"), estado)
+				if err != nil {
+					return err
+				}
+				for _, m := range asignados {
+					// lo mismo que en la simulación (ver mecanicosDeFila)
+					if err := validarEspecialidad(incidencia, m); err != nil {
+						return err
+					}
+					if err := enlazarMecanico(incidencia, m); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		}
+
+	case "mecanicos":
+		return func(fila filaCSV) error {
+			id, err := fila.entero("id")
+			if err != nil {
+				return err
+			}
+			anios, err := fila.entero("anios_exp")
+			if err != nil {
+				return err
+			}
+			activo, err := parsearBooleano(fila.valor("activo"), true)
+			if err != nil {
+				return err
+			}
+			nombre := fila.valor("nombre")
+			especialidades, err := leerEspecialidades(fila.valor("especialidades"))
+			if err != nil {
+				return err
+			}
+			if err := validarMecanico(nombre, especialidades); err != nil {
+				return err
+			}
+			if err := comprobarAnios(anios); err != nil {
+				return err
+			}
+			var horario []Turno // vacío: el habitual
+			if texto := fila.valor("horario"); texto != "" {
+				if horario, err = leerHorario(texto); err != nil {
+					return err
+				}
+			}
+			if err := comprobarID(id, buscarMecanico(id) != nil); err != nil {
+				return err
+			}
+			if simulacion {
+				return nil
+			}
+			_, err = registrarMecanico(id, nombre, especialidades, anios, horario, activo)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Los datos importados (CSV o instantánea) se comprueban algo más que lo que
+// se escribe en los menús, que lo guardan tal cual.
+
+func comprobarEmail(email string) error {
+	if email != "" && !strings.Contains(email, "@") {
+		return fmt.Errorf("el email %q no es válido", email)
+	}
+	return nil
+}
+
+func comprobarAnios(anios int) error {
+	if anios < 0 {
+		return errors.New("los años de experiencia no pueden ser negativos")
+	}
+	return nil
+}
+
+// mecanicosDeFila interpreta la lista de IDs de mecánicos de una incidencia
+// (separados por punto y coma, barra o espacios) y comprueba que tienen la
+// especialidad. No mira si trabajan hoy: la incidencia puede ser antigua.
+func mecanicosDeFila(texto string, tipo TipoIncidencia, prioridad Prioridad) ([]*Mecanico, error) {
+	var asignados []*Mecanico
+	ids := strings.FieldsFunc(texto, func(r rune) bool {
+		return r == ';' || r == '|' || r == ' ' || r == ','
+	})
+	for _, campo := range ids {
+		id, err := strconv.Atoi(campo)
+		if err != nil {
+			return nil, fmt.Errorf("mecánicos: %q no es un ID", campo)
+		}
+		m := buscarMecanico(id)
+		if m == nil {
+			return nil, fmt.Errorf("mecánico %d no encontrado", id)
+		}
+		if err := validarEspecialidad(&Incidencia{Tipo: tipo, Prioridad: prioridad, Mecanicos: asignados}, m); err != nil {
+			return nil, err
+		}
+		asignados = append(asignados, m)
+	}
+	return asignados, nil
+}
+
+// exportarCSV escribe un fichero por entidad en el directorio indicado,
+// con las claves de las relaciones entre ellas.
+func exportarCSV(directorio string) ([]string, error) {
+	if err := os.MkdirAll(directorio, 0755); err != nil {
+		return nil, err
+	}
+
+	tablas := map[string][][]string{
+		"clientes.csv":    {{"id", "nombre", "telefono", "email", "matricula"}},
+		"vehiculos.csv":   {{"matricula", "marca", "modelo", "cliente_id", "fecha_entrada", "fecha_salida", "en_taller", "plaza", "orden"}},
+		"incidencias.csv": {{"id", "matricula", "tipo", "prioridad", "estado", "descripcion", "mecanicos"}},
+		"mecanicos.csv":   {{"id", "nombre", "especialidades", "anios_exp", "activo", "horario", "incidencias"}},
+	}
+
+	for _, c := range almacen.Clientes().Todos() {
+		matricula := ""
+		if c.Vehiculo != nil {
+			matricula = c.Vehiculo.Matricula
+		}
+		tablas["clientes.csv"] = append(tablas["clientes.csv"],
+			[]string{strconv.Itoa(c.ID), c.Nombre, c.Telefono, c.Email, matricula})
+	}
+
+	for _, v := range almacen.Vehiculos().Todos() {
+		idCliente, orden, plaza := "", "", ""
+		if c := buscarPropietario(v); c != nil {
+			idCliente = strconv.Itoa(c.ID)
+		}
+		if v.Orden != 0 {
+			orden = strconv.Itoa(v.Orden)
+		}
+		if v.EnTaller {
+			plaza = strconv.Itoa(v.NumeroPlaza)
+		}
+		tablas["vehiculos.csv"] = append(tablas["vehiculos.csv"],
+			[]string{v.Matricula, v.Marca, v.Modelo, idCliente, v.FechaEntrada, v.FechaSalida,
+				formatearBooleano(v.EnTaller), plaza, orden})
+	}
+
+	for _, inc := range almacen.Incidencias().Todas() {
+		matricula := ""
+		if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+			matricula = v.Matricula
+		}
+		ids := []string{}
+		for _, m := range inc.Mecanicos {
+			ids = append(ids, strconv.Itoa(m.ID))
+		}
+		tablas["incidencias.csv"] = append(tablas["incidencias.csv"],
+			[]string{strconv.Itoa(inc.ID), matricula, string(inc.Tipo), string(inc.Prioridad), string(inc.Estado),
+				inc.Descripcion, strings.Join(ids, ";")})
+	}
+
+	for _, m := range almacen.Mecanicos().Todos() {
+		ids := []string{}
+		for _, inc := range m.Incidencias {
+			ids = append(ids, strconv.Itoa(inc.ID))
+		}
+		tablas["mecanicos.csv"] = append(tablas["mecanicos.csv"],
+			[]string{strconv.Itoa(m.ID), m.Nombre, formatearEspecialidades(m.Especialidades), strconv.Itoa(m.AniosExp),
+				formatearBooleano(m.Activo), formatearHorario(m.Horario), strings.Join(ids, ";")})
+	}
+
+	var escritos []string
+	for _, nombre := range []string{"clientes.csv", "vehiculos.csv", "incidencias.csv", "mecanicos.csv"} {
+		ruta := filepath.Join(directorio, nombre)
+		if err := escribirCSV(ruta, tablas[nombre]); err != nil {
+			return escritos, err
+		}
+		escritos = append(escritos, ruta)
+	}
+	return escritos, nil
+}
+
+func escribirCSV(ruta string, filas [][]string) error {
+	f, err := os.Create(ruta)
+	if err != nil {
+		return err
+	}
+	escritor := csv.NewWriter(f)
+	escritor.WriteAll(filas)
+	if err := escritor.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Funciones de menú
+
+func exportarDatosCSV() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== EXPORTAR DATOS A CSV ===")
+
+	fmt.Print("Directorio de destino (vacío para \"exportacion\"): ")
+	directorio, _ := reader.ReadString('\n')
+	directorio = strings.TrimSpace(directorio)
+	if directorio == "" {
+		directorio = "exportacion"
+	}
+
+	var escritos []string
+	var err error
+	consultar(func() { escritos, err = exportarCSV(directorio) })
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nFicheros generados:")
+	for _, ruta := range escritos {
+		fmt.Println(" -", ruta)
+	}
+	pausar()
+}
+
+func importarDatosCSV(entidad string) {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Printf("=== IMPORTAR %s DESDE CSV ===\n", strings.ToUpper(entidad))
+
+	fmt.Println("\nColumnas reconocidas:")
+	for _, campo := range camposCSV[entidad] {
+		obligatoria := ""
+		if campo.Requerido {
+			obligatoria = " (obligatoria)"
+		}
+		fmt.Printf(" - %s%s\n", strings.Join(campo.Alias, " / "), obligatoria)
+	}
+
+	fmt.Print("\nRuta del fichero CSV: ")
+	ruta, _ := reader.ReadString('\n')
+	ruta = strings.TrimSpace(ruta)
+	if ruta == "" {
+		fmt.Println("Error: La ruta no puede estar vacía")
+		pausar()
+		return
+	}
+
+	fmt.Print("¿Modo simulación, sin guardar cambios? (S/N): ")
+	var respuesta string
+	fmt.Scanln(&respuesta)
+	simulacion := strings.ToUpper(respuesta) == "S"
+
+	informe, err := importarCSV(entidad, ruta, simulacion)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	mostrarInformeImportacion(informe)
+
+	if simulacion && informe.Importadas > 0 {
+		fmt.Print("\n¿Importar ahora las filas válidas? (S/N): ")
+		fmt.Scanln(&respuesta)
+		if strings.ToUpper(respuesta) == "S" {
+			informe, err = importarCSV(entidad, ruta, false)
+			if err != nil {
+				fmt.Println("Error:", err)
+				pausar()
+				return
+			}
+			mostrarInformeImportacion(informe)
+		}
+	}
+
+	pausar()
+}
+
+func mostrarInformeImportacion(informe *informeImportacion) {
+	if informe.Simulacion {
+		fmt.Println("\n--- Informe de importación (SIMULACIÓN) ---")
+	} else {
+		fmt.Println("\n--- Informe de importación ---")
+	}
+
+	fmt.Println("Columnas asociadas:")
+	for _, campo := range camposCSV[informe.Entidad] {
+		if columna, ok := informe.Mapeo[campo.Nombre]; ok {
+			fmt.Printf("  %s <- %q\n", campo.Nombre, columna)
+		}
+	}
+	if len(informe.Ignoradas) > 0 {
+		fmt.Printf("Columnas ignoradas: %s\n", strings.Join(informe.Ignoradas, ", "))
+	}
+
+	if len(informe.Errores) > 0 {
+		fmt.Println("\nFilas con errores:")
+		for _, e := range informe.Errores {
+			fmt.Printf("  Línea %d: %s\n", e.Linea, e.Mensaje)
+		}
+	}
+
+	verbo := "importadas"
+	if informe.Simulacion {
+		verbo = "válidas"
+	}
+	fmt.Printf("\nFilas leídas: %d, %s: %d, con errores: %d\n",
+		informe.Filas, verbo, informe.Importadas, len(informe.Errores))
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Las incidencias importadas pueden ser antiguas: sus mecánicos no tienen
+// que trabajar hoy, pero sí tener la especialidad y el nivel.
+func TestMecanicosDeFilaNoDependeDelDia(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	contadorMecanico.fijar(1)
+	experto := []Especialidad{{Tipo: tipoMecanica, Nivel: "experto"}}
+	deBaja, err := registrarMecanico(0, "Ana", experto, 10, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ausente, err := registrarMecanico(0, "Luis", experto, 10, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	basico, err := registrarMecanico(0, "Eva", []Especialidad{{Tipo: tipoMecanica, Nivel: "básico"}}, 1, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hoy := time.Now().Format("02/01/2006")
+	if err := operacion(func() error {
+		ausente.Ausencias = []Ausencia{{Desde: hoy, Hasta: hoy, Motivo: "vacaciones"}}
+		return guardar(ausente)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	casos := []struct {
+		nombre    string
+		texto     string
+		tipo      TipoIncidencia
+		prioridad Prioridad
+		error     string // vacío si se acepta
+	}{
+		{"de baja y ausente", "1;2", tipoMecanica, prioridadAlta, ""},
+		{"sin la especialidad", "2", tipoElectrica, prioridadBaja, "no tiene la especialidad"},
+		{"nivel insuficiente", "3", tipoMecanica, prioridadAlta, "pide nivel"},
+		{"repetido", "1 1", tipoMecanica, prioridadBaja, "ya está asignado"},
+		{"inexistente", "9", tipoMecanica, prioridadBaja, "no encontrado"},
+	}
+	for _, caso := range casos {
+		var asignados []*Mecanico
+		var err error
+		consultar(func() { asignados, err = mecanicosDeFila(caso.texto, caso.tipo, caso.prioridad) })
+		switch {
+		case caso.error == "" && err != nil:
+			t.Errorf("%s: %v", caso.nombre, err)
+		case caso.error == "" && len(asignados) != len(strings.Fields(strings.ReplaceAll(caso.texto, ";", " "))):
+			t.Errorf("%s: %d mecánicos asignados", caso.nombre, len(asignados))
+		case caso.error != "" && (err == nil || !strings.Contains(err.Error(), caso.error)):
+			t.Errorf("%s: error %v, se esperaba uno que dijera %q", caso.nombre, err, caso.error)
+		}
+	}
+
+	// Las asignaciones de los menús siguen exigiendo que trabaje hoy.
+	consultar(func() {
+		inc := &Incidencia{Tipo: tipoMecanica, Prioridad: prioridadBaja}
+		for _, m := range []*Mecanico{deBaja, ausente} {
+			if err := validarAsignacion(inc, m); err == nil {
+				t.Errorf("validarAsignacion aceptó al mecánico %d, que no trabaja hoy", m.ID)
+			}
+		}
+		if err := validarAsignacion(inc, basico); err != nil && !strings.Contains(err.Error(), "no trabaja") {
+			t.Errorf("validarAsignacion(%d): %v", basico.ID, err)
+		}
+	})
+}
+
+// ficheroCSV deja el contenido en un fichero temporal y devuelve su ruta.
+func ficheroCSV(t *testing.T, nombre, contenido string) string {
+	t.Helper()
+	ruta := filepath.Join(t.TempDir(), nombre)
+	if err := os.WriteFile(ruta, []byte(contenido), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return ruta
+}
+
+// La simulación y la importación aceptan las mismas filas: los mecánicos de
+// baja o ausentes hoy se asignan, y una fila rechazada no deja nada.
+func TestImportarIncidenciasCSV(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	contadorIncidencia.fijar(1)
+	c, err := registrarCliente(0, "Marta", "600000000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := registrarVehiculo(c, "1234BCD", "Seat", "Ibiza", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := registrarMecanico(0, "Ana", []Especialidad{{Tipo: tipoMecanica, Nivel: "experto"}}, 10, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var eventos int
+	consultar(func() { eventos = len(almacen.Historial().Todos()) })
+
+	ruta := ficheroCSV(t, "incidencias.csv", fmt.Sprintf("id;matricula;tipo;prioridad;estado;mecanicos\n"+
+		"7;1234BCD;mecánica;alta;cerrada;%d\n"+
+		"8;1234BCD;eléctrica;baja;abierta;%d\n", m.ID, m.ID))
+	simulacion, err := importarCSV("incidencias", ruta, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	informe, err := importarCSV("incidencias", ruta, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, inf := range []*informeImportacion{simulacion, informe} {
+		if inf.Importadas != 1 || len(inf.Errores) != 1 || inf.Errores[0].Linea != 3 {
+			t.Errorf("simulación %v: %d importadas, errores %v; se esperaba rechazada sólo la línea 3",
+				inf.Simulacion, inf.Importadas, inf.Errores)
+		}
+	}
+
+	consultar(func() {
+		inc := buscarIncidencia(7)
+		if inc == nil {
+			t.Fatal("no se importó la incidencia 7")
+		}
+		if len(inc.Mecanicos) != 1 || inc.Mecanicos[0] != m || len(m.Incidencias) != 1 {
+			t.Errorf("la incidencia 7 tiene %d mecánicos y el mecánico %d incidencias", len(inc.Mecanicos), len(m.Incidencias))
+		}
+		if buscarIncidencia(8) != nil || len(v.Incidencias) != 1 {
+			t.Errorf("la fila rechazada dejó la incidencia 8 o el vehículo tiene %d incidencias", len(v.Incidencias))
+		}
+		// apertura y asignación de la incidencia 7
+		if n := len(almacen.Historial().Todos()); n != eventos+2 {
+			t.Errorf("el historial pasó de %d a %d eventos, se esperaban %d", eventos, n, eventos+2)
+		}
+	})
+}
+
+// La fecha de salida se guarda con el alta del vehículo, también en la base
+// de datos.
+func TestImportarVehiculoConFechaSalida(t *testing.T) {
+	for nombre, abrir := range almacenesDePrueba(t) {
+		t.Run(nombre, func(t *testing.T) {
+			usarAlmacen(t, abrir(t))
+			c, err := registrarCliente(0, "Marta", "600000000", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			ruta := ficheroCSV(t, "vehiculos.csv", fmt.Sprintf(
+				"matricula;marca;modelo;cliente_id;fecha_entrada;fecha_salida\n1234BCD;Seat;Ibiza;%d;01/02/2024;03/02/2024\n", c.ID))
+			informe, err := importarCSV("vehiculos", ruta, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if informe.Importadas != 1 {
+				t.Fatalf("%d importadas, errores %v", informe.Importadas, informe.Errores)
+			}
+			if a, ok := almacen.(*almacenSQL); ok {
+				if err := operacion(a.cargar); err != nil {
+					t.Fatal(err)
+				}
+			}
+			consultar(func() {
+				v := buscarVehiculo("1234BCD")
+				if v == nil {
+					t.Fatal("no se encuentra el vehículo importado")
+				}
+				if v.FechaEntrada != "01/02/2024" || v.FechaSalida != "03/02/2024" || v.Version != 1 {
+					t.Errorf("entrada %q, salida %q, versión %d", v.FechaEntrada, v.FechaSalida, v.Version)
+				}
+			})
+		})
+	}
+}
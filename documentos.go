@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Documentos para imprimir
+//
+// Justificante de entrada para el cliente, orden de trabajo para los
+// mecánicos e informe de cierre al recoger el vehículo, en PDF (ver pdf.go).
+// Se generan dentro de consultar, así que suponen que quien llama tiene el
+// cerrojo; el fichero se escribe o se envía después, ya sin él.
+
+// cabeceraDocumento escribe el título y la fecha de emisión.
+func cabeceraDocumento(d *documentoPDF, titulo string) {
+	d.titulo(titulo)
+	d.parrafo("Emitido el "+time.Now().Format("02/01/2006 15:04"), 9, false)
+}
+
+func seccionCliente(d *documentoPDF, c *Cliente) {
+	d.seccion("Cliente")
+	if c == nil {
+		d.parrafo("Vehículo sin cliente asociado", 10, false)
+		return
+	}
+	d.campo("Nombre", c.Nombre)
+	d.campo("Teléfono", c.Telefono)
+	d.campo("Email", c.Email)
+}
+
+func seccionVehiculo(d *documentoPDF, v *Vehiculo) {
+	d.seccion("Vehículo")
+	d.campo("Matrícula", v.Matricula)
+	d.campo("Marca y modelo", strings.TrimSpace(v.Marca+" "+v.Modelo))
+	d.campo("Fecha de entrada", v.FechaEntrada)
+	if v.EnTaller {
+		d.campo("Plaza", strconv.Itoa(v.NumeroPlaza))
+	}
+}
+
+func seccionIncidencia(d *documentoPDF, inc *Incidencia) {
+	d.seccion(fmt.Sprintf("Incidencia #%d", inc.ID))
+	d.campo("Tipo", string(inc.Tipo))
+	d.campo("Prioridad", string(inc.Prioridad))
+	d.campo("Estado", string(inc.Estado))
+	d.campo("Descripción", inc.Descripcion)
+}
+
+func firmas(d *documentoPDF, etiquetas ...string) {
+	d.espacio(50)
+	ancho := anchoUtilPDF / float64(len(etiquetas))
+	d.reservar(12)
+	for i, etiqueta := range etiquetas {
+		x := margenPDF + float64(i)*ancho
+		fmt.Fprintf(d.actual(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", x, d.y, x+ancho-20, d.y)
+		d.escribir(x, d.y-12, 9, false, etiqueta)
+	}
+	d.y -= 12
+}
+
+// justificanteEntrada es el resguardo que se entrega al dejar el vehículo.
+func justificanteEntrada(v *Vehiculo) []byte {
+	d := nuevoDocumentoPDF()
+	cabeceraDocumento(d, "JUSTIFICANTE DE ENTRADA")
+	seccionCliente(d, buscarPropietario(v))
+	seccionVehiculo(d, v)
+	if lineas := lineasOrden(v, v.Orden); len(lineas) > 0 {
+		d.seccion(fmt.Sprintf("Motivo de la visita (orden de trabajo #%d)", v.Orden))
+		var filas [][]string
+		for _, inc := range lineas {
+			filas = append(filas, []string{string(inc.Tipo), inc.Descripcion})
+		}
+		d.tabla([]string{"Tipo", "Descripción"}, []float64{0.2, 0.8}, filas)
+	}
+	d.espacio(10)
+	d.parrafo("Conserve este justificante: se le pedirá al recoger el vehículo.", 9, false)
+	firmas(d, "Firma del cliente", "Recepción del taller")
+	return d.bytes()
+}
+
+// ordenDe devuelve el número de la orden de trabajo de la incidencia, su
+// vehículo y todas sus líneas.
+func ordenDe(inc *Incidencia) (int, *Vehiculo, []*Incidencia) {
+	v := almacen.Vehiculos().PorIncidencia(inc.ID)
+	if v == nil || inc.Orden == 0 {
+		return inc.ID, v, []*Incidencia{inc}
+	}
+	return inc.Orden, v, lineasOrden(v, inc.Orden)
+}
+
+// ordenTrabajo es la hoja que acompaña al vehículo en el taller, con todas
+// las líneas de la orden a la que pertenece la incidencia.
+func ordenTrabajo(inc *Incidencia) []byte {
+	orden, v, lineas := ordenDe(inc)
+	d := nuevoDocumentoPDF()
+	cabeceraDocumento(d, fmt.Sprintf("ORDEN DE TRABAJO #%d", orden))
+	if v != nil {
+		seccionVehiculo(d, v)
+	}
+
+	for _, linea := range lineas {
+		seccionIncidencia(d, linea)
+		if len(linea.Mecanicos) == 0 {
+			d.campo("Mecánicos", "Sin asignar")
+			continue
+		}
+		d.espacio(4)
+		var filas [][]string
+		for _, m := range linea.Mecanicos {
+			filas = append(filas, []string{strconv.Itoa(m.ID), m.Nombre, nivelMecanico(m, linea.Tipo), fmt.Sprintf("%d años", m.AniosExp)})
+		}
+		d.tabla([]string{"ID", "Mecánico", "Nivel", "Experiencia"}, []float64{0.1, 0.45, 0.25, 0.2}, filas)
+	}
+
+	d.seccion("Trabajo realizado")
+	for i := 0; i < 6; i++ {
+		d.espacio(20)
+		fmt.Fprintf(d.actual(), "0.3 w %.2f %.2f m %.2f %.2f l S\n", margenPDF, d.y, anchoPaginaPDF-margenPDF, d.y)
+	}
+	firmas(d, "Mecánico", "Jefe de taller")
+	return d.bytes()
+}
+
+// informeCierre resume para el cliente la orden de trabajo de una incidencia
+// cerrada, con todas sus líneas y las fechas del historial.
+func informeCierre(inc *Incidencia) ([]byte, error) {
+	orden, v, lineas := ordenDe(inc)
+	if v == nil {
+		return nil, errors.New("la incidencia no tiene vehículo")
+	}
+	enOrden := map[int]bool{}
+	for _, linea := range lineas {
+		if linea.Estado != estadoCerrada {
+			return nil, fmt.Errorf("la incidencia %d no está cerrada", linea.ID)
+		}
+		enOrden[linea.ID] = true
+	}
+
+	d := nuevoDocumentoPDF()
+	cabeceraDocumento(d, fmt.Sprintf("INFORME DE CIERRE #%d", orden))
+	seccionCliente(d, buscarPropietario(v))
+	seccionVehiculo(d, v)
+	if v.RecogidoPor != "" && !v.EnTaller && v.Orden == 0 {
+		d.campo("Fecha de salida", v.FechaSalida)
+		d.campo("Recogido por", v.RecogidoPor)
+		d.campo("Pago", v.EstadoPago)
+	}
+	for _, linea := range lineas {
+		seccionIncidencia(d, linea)
+		if len(linea.Mecanicos) > 0 {
+			var nombres []string
+			for _, m := range linea.Mecanicos {
+				nombres = append(nombres, m.Nombre)
+			}
+			d.campo("Atendida por", strings.Join(nombres, ", "))
+		}
+	}
+
+	// Movimientos de las líneas de la orden y de las plazas del vehículo en
+	// esta visita: lo anterior a la última salida antes de abrir la orden y
+	// lo posterior a la salida que la termina es de otras visitas.
+	var filas [][]string
+	abierta := false
+	for _, e := range almacen.Historial().Todos() {
+		plaza := e.Matricula == v.Matricula && (e.Tipo == eventoEntradaPlaza || e.Tipo == eventoSalidaPlaza)
+		switch {
+		case enOrden[e.IncidenciaID]:
+			abierta = abierta || e.Tipo == eventoApertura
+		case !plaza:
+			continue
+		case !abierta && e.Tipo == eventoSalidaPlaza:
+			filas = nil
+			continue
+		}
+		filas = append(filas, []string{e.Fecha.Format("02/01/2006 15:04"), describirEvento(e)})
+		if abierta && e.Tipo == eventoSalidaPlaza {
+			break
+		}
+	}
+	if len(filas) > 0 {
+		d.seccion("Seguimiento")
+		d.tabla([]string{"Fecha", "Movimiento"}, []float64{0.25, 0.75}, filas)
+	}
+	firmas(d, "Recibí conforme (cliente)", "Taller")
+	return d.bytes(), nil
+}
+
+// describirEvento devuelve una frase legible para un evento del historial.
+func describirEvento(e *Evento) string {
+	switch e.Tipo {
+	case eventoApertura:
+		return "Apertura de la incidencia"
+	case eventoEstado:
+		return "Pasa a " + e.Detalle
+	case eventoAsignacion, eventoDesasignacion:
+		texto := "Asignada a "
+		if e.Tipo == eventoDesasignacion {
+			texto = "Se retira a "
+		}
+		if m := almacen.Mecanicos().PorID(e.MecanicoID); m != nil {
+			texto += m.Nombre
+		} else {
+			texto += fmt.Sprintf("el mecánico %d", e.MecanicoID)
+		}
+		if e.Detalle != "" {
+			texto += " (" + e.Detalle + ")"
+		}
+		return texto
+	case eventoEntradaPlaza:
+		return fmt.Sprintf("Entra en la plaza %d", e.Plaza)
+	case eventoSalidaPlaza:
+		if e.Detalle != "" {
+			return fmt.Sprintf("Deja la plaza %d, %s", e.Plaza, e.Detalle)
+		}
+		return fmt.Sprintf("Deja la plaza %d", e.Plaza)
+	}
+	return e.Tipo
+}
+
+// Web
+
+func enviarPDF(w http.ResponseWriter, nombre string, datos []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("inline; filename=%q", nombre))
+	w.Write(datos)
+}
+
+func justificanteWeb(w http.ResponseWriter, r *http.Request) {
+	matricula := r.PathValue("matricula")
+	var datos []byte
+	consultar(func() {
+		if v := buscarVehiculo(matricula); v != nil {
+			datos = justificanteEntrada(v)
+		}
+	})
+	if datos == nil {
+		http.NotFound(w, r)
+		return
+	}
+	enviarPDF(w, "justificante-"+matricula+".pdf", datos)
+}
+
+// documentoIncidenciaWeb sirve la orden de trabajo o, si cierre es true, el
+// informe de cierre.
+func documentoIncidenciaWeb(cierre bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		var datos []byte
+		var err error
+		encontrada := false
+		consultar(func() {
+			inc := buscarIncidencia(id)
+			if inc == nil {
+				return
+			}
+			encontrada = true
+			if cierre {
+				datos, err = informeCierre(inc)
+			} else {
+				datos = ordenTrabajo(inc)
+			}
+		})
+		nombre := "orden"
+		if cierre {
+			nombre = "cierre"
+		}
+		switch {
+		case !encontrada:
+			http.NotFound(w, r)
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			enviarPDF(w, fmt.Sprintf("incidencia-%d-%s.pdf", id, nombre), datos)
+		}
+	}
+}
+
+// Funciones de menú
+
+// guardarDocumento pide la ruta (con un nombre por defecto) y escribe los
+// datos del documento.
+func guardarDocumento(reader *bufio.Reader, porDefecto string, datos []byte) {
+	ruta := leerCriterio(reader, fmt.Sprintf("Fichero de destino (vacío para %q): ", porDefecto))
+	if ruta == "" {
+		ruta = porDefecto
+	}
+	if err := os.WriteFile(ruta, datos, 0644); err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Println("Documento guardado en", ruta)
+}
+
+func imprimirJustificante() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== JUSTIFICANTE DE ENTRADA ===")
+	matricula := leerCriterio(reader, "Matrícula del vehículo: ")
+
+	var datos []byte
+	consultar(func() {
+		if v := buscarVehiculo(matricula); v != nil {
+			datos = justificanteEntrada(v)
+		}
+	})
+	if datos == nil {
+		fmt.Println("Error: Vehículo no encontrado")
+		pausar()
+		return
+	}
+	guardarDocumento(reader, "justificante-"+matricula+".pdf", datos)
+	pausar()
+}
+
+// imprimirDocumentoIncidencia genera la orden de trabajo o, si cierre es
+// true, el informe de cierre.
+func imprimirDocumentoIncidencia(cierre bool) {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	titulo, nombre := "ORDEN DE TRABAJO", "orden"
+	if cierre {
+		titulo, nombre = "INFORME DE CIERRE", "cierre"
+	}
+	fmt.Printf("=== %s ===\n", titulo)
+	id, err := strconv.Atoi(leerCriterio(reader, "ID de la incidencia: "))
+	if err != nil {
+		fmt.Println("Error: ID no válido")
+		pausar()
+		return
+	}
+
+	var datos []byte
+	consultar(func() {
+		inc := buscarIncidencia(id)
+		switch {
+		case inc == nil:
+			err = errors.New("Incidencia no encontrada")
+		case cierre:
+			datos, err = informeCierre(inc)
+		default:
+			datos = ordenTrabajo(inc)
+		}
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	guardarDocumento(reader, fmt.Sprintf("incidencia-%d-%s.pdf", id, nombre), datos)
+	pausar()
+}
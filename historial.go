@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// Historial de movimientos del taller
+//
+// Las entidades sólo guardan su estado actual; para saber cuánto tardó en
+// cerrarse una incidencia o cuánto estuvo ocupada una plaza, las operaciones
+// anotan cada movimiento en el historial. Los eventos no se modifican nunca y
+// se guardan en la misma transacción que el cambio que describen, así que si
+// la operación falla tampoco queda el evento.
+
+// Tipos de evento
+const (
+	eventoApertura      = "apertura"      // alta de una incidencia
+	eventoEstado        = "estado"        // cambio de estado; Detalle es el nuevo
+	eventoAsignacion    = "asignacion"    // mecánico asignado a una incidencia; en un traspaso Detalle es el motivo
+	eventoDesasignacion = "desasignacion" // mecánico retirado de una incidencia; Detalle es el motivo
+	eventoEntradaPlaza  = "entrada_plaza" // un vehículo ocupa una plaza
+	eventoSalidaPlaza   = "salida_plaza"  // un vehículo deja su plaza; Detalle dice quién lo recoge
+)
+
+type Evento struct {
+	ID           int
+	Fecha        time.Time
+	Tipo         string
+	Matricula    string
+	IncidenciaID int
+	MecanicoID   int
+	Plaza        int
+	Detalle      string
+}
+
+// registrarEvento anota un movimiento con la fecha actual. Se llama dentro
+// de operacion, junto con el guardar del cambio, y también se anuncia a los
+// webhooks.
+func registrarEvento(e *Evento) error {
+	if e.Fecha.IsZero() {
+		e.Fecha = time.Now()
+	}
+	if err := almacen.Historial().Registrar(e); err != nil {
+		return err
+	}
+	emitirEvento(e)
+	return nil
+}
+
+func eventoAJSON(e *Evento) eventoJSON {
+	return eventoJSON{
+		ID:           e.ID,
+		Fecha:        e.Fecha.Format(time.RFC3339),
+		Tipo:         e.Tipo,
+		Matricula:    e.Matricula,
+		IncidenciaID: e.IncidenciaID,
+		MecanicoID:   e.MecanicoID,
+		Plaza:        e.Plaza,
+		Detalle:      e.Detalle,
+	}
+}
+
+func eventoDesdeJSON(ej eventoJSON) (*Evento, error) {
+	fecha, err := time.Parse(time.RFC3339, ej.Fecha)
+	if err != nil {
+		return nil, fmt.Errorf("fecha %q no válida", ej.Fecha)
+	}
+	return &Evento{
+		ID:           ej.ID,
+		Fecha:        fecha,
+		Tipo:         ej.Tipo,
+		Matricula:    ej.Matricula,
+		IncidenciaID: ej.IncidenciaID,
+		MecanicoID:   ej.MecanicoID,
+		Plaza:        ej.Plaza,
+		Detalle:      ej.Detalle,
+	}, nil
+}
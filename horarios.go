@@ -0,0 +1,564 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Horarios y ausencias de los mecánicos
+//
+// Cada mecánico tiene un horario semanal, con uno o varios turnos por día de
+// la semana, y una lista de ausencias previstas (vacaciones, bajas por
+// enfermedad...) entre dos fechas. Un mecánico en activo trabaja un día si
+// tiene turno ese día de la semana y no está ausente: sólo esos cuentan para
+// las plazas del taller (ver plazasEl) y sólo a ellos se les asignan
+// incidencias (ver validarAsignacion). Activo sigue indicando si el mecánico
+// está en la plantilla.
+//
+// Un día en que no trabaja nadie el taller está cerrado: tiene cero plazas,
+// así que no entran vehículos ni se asignan incidencias, pero los que ya
+// estaban siguen en su plaza hasta que se recogen.
+//
+// El horario se escribe por días de la semana, con las dos primeras letras
+// del día: "lu-vi 08:00-16:00; sa 09:00-13:00". Un día puede tener varios
+// turnos ("lu-vi 08:00-13:00; lu-vi 15:00-18:00"); los turnos no pasan de
+// medianoche.
+
+type Turno struct {
+	Dia     time.Weekday
+	Entrada string // "08:00"
+	Salida  string
+}
+
+// Ausencia prevista del mecánico; Desde y Hasta (dd/mm/aaaa) están incluidos.
+type Ausencia struct {
+	Desde  string
+	Hasta  string
+	Motivo string
+}
+
+var motivosAusencia = []string{"vacaciones", "enfermedad", "formación", "otros"}
+
+// Días de la semana en el orden en que se muestran, de lunes a domingo
+var semana = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+var nombresDias = map[time.Weekday]string{
+	time.Monday: "lunes", time.Tuesday: "martes", time.Wednesday: "miércoles", time.Thursday: "jueves",
+	time.Friday: "viernes", time.Saturday: "sábado", time.Sunday: "domingo",
+}
+
+// horarioHabitual es el que tienen los mecánicos nuevos si no se indica otro
+// y el que recibieron los que ya existían al añadir los horarios: todos los
+// días, como contaban hasta entonces. El taller ajusta después los reales.
+func horarioHabitual() []Turno {
+	var turnos []Turno
+	for _, dia := range semana {
+		turnos = append(turnos, Turno{dia, "08:00", "16:00"})
+	}
+	return turnos
+}
+
+// Disponibilidad
+
+// dia devuelve la fecha sin la hora, para comparar días.
+func dia(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+}
+
+func leerFecha(texto string) (time.Time, error) {
+	fecha, err := time.ParseInLocation("02/01/2006", strings.TrimSpace(texto), time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("fecha %q no válida (dd/mm/aaaa)", texto)
+	}
+	return fecha, nil
+}
+
+// turnosDia devuelve los turnos del mecánico ese día de la semana.
+func turnosDia(m *Mecanico, d time.Weekday) []Turno {
+	var turnos []Turno
+	for _, t := range m.Horario {
+		if t.Dia == d {
+			turnos = append(turnos, t)
+		}
+	}
+	return turnos
+}
+
+// ausenciaEl devuelve la ausencia del mecánico que cubre la fecha, o nil.
+func ausenciaEl(m *Mecanico, fecha time.Time) *Ausencia {
+	fecha = dia(fecha)
+	for i, a := range m.Ausencias {
+		desde, err1 := leerFecha(a.Desde)
+		hasta, err2 := leerFecha(a.Hasta)
+		if err1 == nil && err2 == nil && !fecha.Before(desde) && !fecha.After(hasta) {
+			return &m.Ausencias[i]
+		}
+	}
+	return nil
+}
+
+// motivoNoDisponible explica por qué el mecánico no trabaja esa fecha, o
+// devuelve "" si trabaja.
+func motivoNoDisponible(m *Mecanico, fecha time.Time) string {
+	if !m.Activo {
+		return "está de baja"
+	}
+	if a := ausenciaEl(m, fecha); a != nil {
+		return fmt.Sprintf("está ausente (%s) hasta el %s", a.Motivo, a.Hasta)
+	}
+	if len(turnosDia(m, fecha.Weekday())) == 0 {
+		return "no trabaja los " + plural(nombresDias[fecha.Weekday()])
+	}
+	return ""
+}
+
+func disponibleEl(m *Mecanico, fecha time.Time) bool { return motivoNoDisponible(m, fecha) == "" }
+
+// situacionMecanico resume para los listados si el mecánico trabaja ese día.
+func situacionMecanico(m *Mecanico, fecha time.Time) string {
+	switch {
+	case !m.Activo:
+		return "De baja"
+	case ausenciaEl(m, fecha) != nil:
+		return "Ausente"
+	case len(turnosDia(m, fecha.Weekday())) == 0:
+		return "Libre"
+	}
+	return "Activo"
+}
+
+// plazasEl calcula las plazas del taller en una fecha: las de los mecánicos
+// que trabajan ese día.
+func plazasEl(fecha time.Time) int {
+	total := 0
+	for _, m := range almacen.Mecanicos().Todos() {
+		if disponibleEl(m, fecha) {
+			total += taller.PlazasPorMecanico
+		}
+	}
+	return total
+}
+
+func plural(nombre string) string {
+	if strings.HasSuffix(nombre, "s") {
+		return nombre
+	}
+	return nombre + "s"
+}
+
+// Texto de los horarios
+
+// diaSemana busca el día por su nombre: "lunes", "miércoles"...
+func diaSemana(nombre string) (time.Weekday, bool) {
+	clave := quitarTildes(strings.ToLower(strings.TrimSpace(nombre)))
+	for _, d := range semana {
+		if quitarTildes(nombresDias[d]) == clave {
+			return d, true
+		}
+	}
+	return 0, false
+}
+
+// abreviaturaDia es como se escribe el día en los horarios: "lu", "ma"...
+func abreviaturaDia(d time.Weekday) string {
+	return string([]rune(quitarTildes(nombresDias[d]))[:2])
+}
+
+// leerDias interpreta "lu", "lu-vi" o "lu,mi,vi" (también con el nombre
+// entero del día).
+func leerDias(texto string) ([]time.Weekday, error) {
+	buscar := func(nombre string) (int, error) {
+		clave := quitarTildes(strings.ToLower(strings.TrimSpace(nombre)))
+		for i, d := range semana {
+			if len([]rune(clave)) >= 2 && strings.HasPrefix(quitarTildes(nombresDias[d]), clave) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("día %q no válido", nombre)
+	}
+
+	var dias []time.Weekday
+	for _, parte := range strings.Split(texto, ",") {
+		inicio, fin, rango := strings.Cut(parte, "-")
+		i, err := buscar(inicio)
+		if err != nil {
+			return nil, err
+		}
+		j := i
+		if rango {
+			if j, err = buscar(fin); err != nil {
+				return nil, err
+			}
+			if j < i {
+				return nil, fmt.Errorf("los días %q van de lunes a domingo", parte)
+			}
+		}
+		dias = append(dias, semana[i:j+1]...)
+	}
+	return dias, nil
+}
+
+// leerHora devuelve la hora como "hh:mm".
+func leerHora(texto string) (string, error) {
+	hora, err := time.Parse("15:04", strings.TrimSpace(texto))
+	if err != nil {
+		return "", fmt.Errorf("hora %q no válida (hh:mm)", texto)
+	}
+	return hora.Format("15:04"), nil
+}
+
+// leerHorario interpreta un horario como "lu-vi 08:00-16:00; sa 09:00-13:00".
+// Vacío es un horario sin turnos.
+func leerHorario(texto string) ([]Turno, error) {
+	var turnos []Turno
+	for _, parte := range strings.Split(texto, ";") {
+		campos := strings.Fields(parte)
+		if len(campos) == 0 {
+			continue
+		}
+		if len(campos) != 2 {
+			return nil, fmt.Errorf("turno %q no válido: se esperan los días y las horas, como \"lu-vi 08:00-16:00\"", strings.TrimSpace(parte))
+		}
+		dias, err := leerDias(campos[0])
+		if err != nil {
+			return nil, err
+		}
+		entrada, salida, _ := strings.Cut(campos[1], "-")
+		for _, d := range dias {
+			turnos = append(turnos, Turno{d, entrada, salida})
+		}
+	}
+	return normalizarHorario(turnos)
+}
+
+// normalizarHorario comprueba los turnos (horas válidas, la salida después
+// de la entrada, sin solaparse) y los ordena de lunes a domingo.
+func normalizarHorario(turnos []Turno) ([]Turno, error) {
+	normalizados := make([]Turno, 0, len(turnos))
+	for _, t := range turnos {
+		if t.Dia < time.Sunday || t.Dia > time.Saturday {
+			return nil, fmt.Errorf("día de la semana %d no válido", t.Dia)
+		}
+		entrada, err := leerHora(t.Entrada)
+		if err != nil {
+			return nil, err
+		}
+		salida, err := leerHora(t.Salida)
+		if err != nil {
+			return nil, err
+		}
+		if salida <= entrada {
+			return nil, fmt.Errorf("el turno del %s termina antes de empezar (%s-%s)", nombresDias[t.Dia], entrada, salida)
+		}
+		normalizados = append(normalizados, Turno{t.Dia, entrada, salida})
+	}
+	sort.SliceStable(normalizados, func(i, j int) bool {
+		a, b := normalizados[i], normalizados[j]
+		if a.Dia != b.Dia {
+			return posicion(semana, a.Dia) < posicion(semana, b.Dia)
+		}
+		return a.Entrada < b.Entrada
+	})
+	for i := 1; i < len(normalizados); i++ {
+		anterior, t := normalizados[i-1], normalizados[i]
+		if anterior.Dia == t.Dia && t.Entrada < anterior.Salida {
+			return nil, fmt.Errorf("los turnos del %s se solapan", nombresDias[t.Dia])
+		}
+	}
+	return normalizados, nil
+}
+
+// formatearHorario lo escribe como lo lee leerHorario, juntando los días
+// seguidos con las mismas horas.
+func formatearHorario(turnos []Turno) string {
+	var horas []string
+	dias := map[string][]int{}
+	for _, t := range turnos {
+		h := t.Entrada + "-" + t.Salida
+		if dias[h] == nil {
+			horas = append(horas, h)
+		}
+		dias[h] = append(dias[h], posicion(semana, t.Dia))
+	}
+
+	var partes []string
+	for _, h := range horas {
+		var grupos []string
+		lista := dias[h]
+		for i := 0; i < len(lista); {
+			j := i
+			for j+1 < len(lista) && lista[j+1] == lista[j]+1 {
+				j++
+			}
+			grupo := abreviaturaDia(semana[lista[i]])
+			if j > i {
+				grupo += "-" + abreviaturaDia(semana[lista[j]])
+			}
+			grupos = append(grupos, grupo)
+			i = j + 1
+		}
+		partes = append(partes, strings.Join(grupos, ",")+" "+h)
+	}
+	return strings.Join(partes, "; ")
+}
+
+// textoHorario lo presenta para los listados.
+func textoHorario(turnos []Turno) string {
+	if len(turnos) == 0 {
+		return "sin turnos"
+	}
+	return formatearHorario(turnos)
+}
+
+func textoAusencia(a Ausencia) string {
+	return fmt.Sprintf("%s: del %s al %s", a.Motivo, a.Desde, a.Hasta)
+}
+
+// validarAusencia comprueba las fechas y el motivo y devuelve la ausencia
+// con las fechas y el motivo escritos como se guardan.
+func validarAusencia(a Ausencia) (Ausencia, error) {
+	desde, err := leerFecha(a.Desde)
+	if err != nil {
+		return a, err
+	}
+	hasta, err := leerFecha(a.Hasta)
+	if err != nil {
+		return a, err
+	}
+	if hasta.Before(desde) {
+		return a, errors.New("la ausencia termina antes de empezar")
+	}
+	motivo, ok := normalizarValor(a.Motivo, motivosAusencia)
+	if !ok {
+		return a, fmt.Errorf("el motivo debe ser %s", strings.Join(motivosAusencia, ", "))
+	}
+	return Ausencia{desde.Format("02/01/2006"), hasta.Format("02/01/2006"), motivo}, nil
+}
+
+// Operaciones
+
+// cambiarHorario sustituye el horario del mecánico.
+func cambiarHorario(mecanico *Mecanico, turnos []Turno) error {
+	turnos, err := normalizarHorario(turnos)
+	if err != nil {
+		return err
+	}
+	return operacion(func() error {
+		mecanico.Horario = turnos
+		taller.TotalPlazas = calcularTotalPlazas()
+		return guardar(mecanico)
+	})
+}
+
+// anadirAusencia anota una ausencia que no se solape con las que ya tiene.
+// Las incidencias que tenga asignadas siguen siendo suyas.
+func anadirAusencia(mecanico *Mecanico, ausencia Ausencia) error {
+	ausencia, err := validarAusencia(ausencia)
+	if err != nil {
+		return err
+	}
+	desde, _ := leerFecha(ausencia.Desde)
+	hasta, _ := leerFecha(ausencia.Hasta)
+	return operacion(func() error {
+		for _, a := range mecanico.Ausencias {
+			inicio, _ := leerFecha(a.Desde)
+			fin, _ := leerFecha(a.Hasta)
+			if !desde.After(fin) && !hasta.Before(inicio) {
+				return fmt.Errorf("se solapa con la ausencia %s", textoAusencia(a))
+			}
+		}
+		// Lista nueva: si la operación falla se restaura la anterior (ver
+		// transaccion.go), que no se debe reordenar.
+		ausencias := append(append([]Ausencia{}, mecanico.Ausencias...), ausencia)
+		sort.SliceStable(ausencias, func(i, j int) bool {
+			a, _ := leerFecha(ausencias[i].Desde)
+			b, _ := leerFecha(ausencias[j].Desde)
+			return a.Before(b)
+		})
+		mecanico.Ausencias = ausencias
+		taller.TotalPlazas = calcularTotalPlazas()
+		return guardar(mecanico)
+	})
+}
+
+func quitarAusencia(mecanico *Mecanico, ausencia Ausencia) error {
+	return operacion(func() error {
+		for i, a := range mecanico.Ausencias {
+			if a == ausencia {
+				mecanico.Ausencias = append(mecanico.Ausencias[:i:i], mecanico.Ausencias[i+1:]...)
+				taller.TotalPlazas = calcularTotalPlazas()
+				return guardar(mecanico)
+			}
+		}
+		return errors.New("la ausencia ya no existe")
+	})
+}
+
+// Reporte de disponibilidad
+
+// reporteDisponibilidad muestra la semana que empieza en la fecha: los
+// turnos o la ausencia de cada mecánico de la plantilla y las plazas del
+// taller cada día.
+func reporteDisponibilidad(desde time.Time) *reporte {
+	desde = dia(desde)
+	s := seccionReporte{Columnas: []string{"Mecánico"}, Vacio: "No hay mecánicos en activo"}
+	plazas := []string{"Plazas"}
+	for i := 0; i < 7; i++ {
+		fecha := desde.AddDate(0, 0, i)
+		s.Columnas = append(s.Columnas, abreviaturaDia(fecha.Weekday())+" "+fecha.Format("02/01"))
+		plazas = append(plazas, strconv.Itoa(plazasEl(fecha)))
+	}
+	for _, m := range almacen.Mecanicos().Todos() {
+		if !m.Activo {
+			continue
+		}
+		fila := []string{m.Nombre}
+		for i := 0; i < 7; i++ {
+			fecha := desde.AddDate(0, 0, i)
+			celda := "-"
+			if a := ausenciaEl(m, fecha); a != nil {
+				celda = a.Motivo
+			} else if turnos := turnosDia(m, fecha.Weekday()); len(turnos) > 0 {
+				var horas []string
+				for _, t := range turnos {
+					horas = append(horas, t.Entrada+"-"+t.Salida)
+				}
+				celda = strings.Join(horas, ", ")
+			}
+			fila = append(fila, celda)
+		}
+		s.Filas = append(s.Filas, fila)
+	}
+	if len(s.Filas) > 0 {
+		s.Filas = append(s.Filas, plazas)
+	}
+	return &reporte{
+		Titulo:    "DISPONIBILIDAD DE LOS MECÁNICOS",
+		Generado:  time.Now(),
+		Secciones: []seccionReporte{s},
+		Resumen:   fmt.Sprintf("Del %s al %s", desde.Format("02/01/2006"), desde.AddDate(0, 0, 6).Format("02/01/2006")),
+	}
+}
+
+// Funciones de menú
+
+func gestionarHorarioMecanico() {
+	limpiarPantalla()
+	fmt.Println("=== HORARIO Y AUSENCIAS DE UN MECÁNICO ===")
+
+	var id int
+	fmt.Print("ID del mecánico: ")
+	fmt.Scanf("%d", &id)
+	fmt.Scanln()
+
+	mecanico := buscarMecanico(id)
+	if mecanico == nil {
+		fmt.Println("Error: Mecánico no encontrado")
+		pausar()
+		return
+	}
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		limpiarPantalla()
+		var nombre, horario string
+		var ausencias []Ausencia
+		consultar(func() {
+			nombre, horario = mecanico.Nombre, textoHorario(mecanico.Horario)
+			ausencias = append(ausencias, mecanico.Ausencias...)
+		})
+		fmt.Printf("=== HORARIO DE %s ===\n", strings.ToUpper(nombre))
+		fmt.Printf("\nHorario: %s\n", horario)
+		fmt.Println("Ausencias:")
+		if len(ausencias) == 0 {
+			fmt.Println("  (ninguna)")
+		}
+		for i, a := range ausencias {
+			fmt.Printf("  %d. %s\n", i+1, textoAusencia(a))
+		}
+
+		fmt.Println("\n1. Cambiar el horario")
+		fmt.Println("2. Añadir una ausencia")
+		fmt.Println("3. Quitar una ausencia")
+		fmt.Println("0. Volver")
+		var opcion int
+		fmt.Print("\nSeleccione una opción: ")
+		fmt.Scanf("%d", &opcion)
+		fmt.Scanln()
+
+		var err error
+		switch opcion {
+		case 1:
+			fmt.Println("\nTurnos por días de la semana, por ejemplo: lu-vi 08:00-16:00; sa 09:00-13:00")
+			texto := leerCriterio(reader, "Nuevo horario (vacío para no cambiar): ")
+			if texto == "" {
+				continue
+			}
+			var turnos []Turno
+			if turnos, err = leerHorario(texto); err == nil {
+				err = cambiarHorario(mecanico, turnos)
+			}
+		case 2:
+			var a Ausencia
+			a.Desde = leerCriterio(reader, "Desde (dd/mm/aaaa): ")
+			a.Hasta = leerCriterio(reader, "Hasta, incluido (vacío = el mismo día): ")
+			if a.Hasta == "" {
+				a.Hasta = a.Desde
+			}
+			a.Motivo = leerCriterio(reader, "Motivo ("+strings.Join(motivosAusencia, ", ")+"): ")
+			if err = anadirAusencia(mecanico, a); err != nil {
+				break
+			}
+			var pendientes int
+			consultar(func() { pendientes = pendientesMecanico(mecanico) })
+			if pendientes > 0 {
+				fmt.Printf("El mecánico tiene %d incidencia(s) pendiente(s).\n", pendientes)
+				if strings.ToUpper(leerCriterio(reader, "¿Traspasarlas ahora? (S/N): ")) == "S" {
+					motivo, _ := normalizarValor(a.Motivo, motivosAusencia)
+					err = pedirTraspasoPendientes(reader, mecanico, motivo)
+				}
+			}
+		case 3:
+			n, _ := strconv.Atoi(leerCriterio(reader, "Número de la ausencia: "))
+			if n < 1 || n > len(ausencias) {
+				err = errors.New("ausencia no válida")
+			} else {
+				err = quitarAusencia(mecanico, ausencias[n-1])
+			}
+		case 0:
+			return
+		default:
+			err = errors.New("opción inválida")
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+		} else {
+			fmt.Println("Cambios guardados")
+		}
+		pausar()
+	}
+}
+
+func mostrarDisponibilidad() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("=== DISPONIBILIDAD DE LOS MECÁNICOS ===")
+
+	desde := time.Now()
+	if texto := leerCriterio(reader, "Primer día (dd/mm/aaaa, vacío = hoy): "); texto != "" {
+		fecha, err := leerFecha(texto)
+		if err != nil {
+			fmt.Println("Error:", err)
+			pausar()
+			return
+		}
+		desde = fecha
+	}
+	mostrarReporte(func() *reporte { return reporteDisponibilidad(desde) })
+}
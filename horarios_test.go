@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Los mecánicos nuevos y los que vienen de antes de los horarios tienen el
+// mismo horario por defecto, así que el taller da las mismas plazas.
+func TestHorarioPorDefectoIgualAlMigrado(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	nuevo, err := registrarMecanico(0, "Ana", []Especialidad{{Tipo: tipoMecanica, Nivel: "experto"}}, 5, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	datos := map[string]interface{}{"mecanicos": []interface{}{map[string]interface{}{"id": 1}}}
+	if err := migrarHorarios(datos); err != nil {
+		t.Fatal(err)
+	}
+	texto, err := json.Marshal(datos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var migrado struct {
+		Mecanicos []struct {
+			Horario []turnoJSON `json:"horario"`
+		} `json:"mecanicos"`
+	}
+	if err := json.Unmarshal(texto, &migrado); err != nil {
+		t.Fatal(err)
+	}
+	var horario []Turno
+	for _, tj := range migrado.Mecanicos[0].Horario {
+		d, ok := diaSemana(tj.Dia)
+		if !ok {
+			t.Fatalf("día %q desconocido", tj.Dia)
+		}
+		horario = append(horario, Turno{d, tj.Entrada, tj.Salida})
+	}
+
+	if a, b := formatearHorario(nuevo.Horario), formatearHorario(horario); a != b {
+		t.Errorf("horario de un mecánico nuevo %q, de uno migrado %q", a, b)
+	}
+	if len(horario) != len(semana) {
+		t.Errorf("el horario por defecto tiene %d días, se esperaban los %d de la semana", len(horario), len(semana))
+	}
+}
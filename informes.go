@@ -0,0 +1,508 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Informes e indicadores del taller
+//
+// Los indicadores se calculan a partir del historial (ver historial.go) para
+// un periodo que acaba en el momento actual. Lo ocurrido antes de que
+// existiera el historial no se conoce: las incidencias sin apertura anotada
+// no cuentan en los tiempos de cierre y las asignaciones antiguas no cuentan
+// en la ocupación de los mecánicos. Tipo y prioridad son los actuales de
+// cada incidencia, así que las eliminadas no aparecen.
+
+type tiempoCierre struct {
+	Agrupacion string  `json:"agrupacion"` // "tipo" o "prioridad"
+	Valor      string  `json:"valor"`
+	Cerradas   int     `json:"cerradas"`
+	MediaHoras float64 `json:"media_horas"`
+	MinHoras   float64 `json:"min_horas"`
+	MaxHoras   float64 `json:"max_horas"`
+}
+
+type ocupacionDia struct {
+	Fecha         string  `json:"fecha"`
+	Plazas        int     `json:"plazas"`
+	HorasOcupadas float64 `json:"horas_ocupadas"`
+	Porcentaje    float64 `json:"porcentaje"`
+}
+
+type rendimientoMecanico struct {
+	ID          int     `json:"id"`
+	Nombre      string  `json:"nombre"`
+	Asignadas   int     `json:"asignadas"`   // asignaciones en el periodo
+	Cerradas    int     `json:"cerradas"`    // incidencias suyas terminadas en el periodo
+	Pendientes  int     `json:"pendientes"`  // asignadas ahora y sin terminar
+	Utilizacion float64 `json:"utilizacion"` // % del periodo con trabajo asignado
+}
+
+type tramoAntiguedad struct {
+	Tramo       string `json:"tramo"`
+	Incidencias int    `json:"incidencias"`
+}
+
+type vehiculoRepetido struct {
+	Matricula   string `json:"matricula"`
+	Incidencias int    `json:"incidencias"`
+}
+
+type indicadores struct {
+	Desde              time.Time             `json:"desde"`
+	Hasta              time.Time             `json:"hasta"`
+	TiemposCierre      []tiempoCierre        `json:"tiempos_cierre"`
+	Ocupacion          []ocupacionDia        `json:"ocupacion"`
+	OcupacionMedia     float64               `json:"ocupacion_media"`
+	Mecanicos          []rendimientoMecanico `json:"mecanicos"`
+	Antiguedad         []tramoAntiguedad     `json:"antiguedad_pendientes"`
+	VehiculosAtendidos int                   `json:"vehiculos_atendidos"`
+	Repetidos          []vehiculoRepetido    `json:"vehiculos_repetidos"`
+	TasaRepeticion     float64               `json:"tasa_repeticion"`
+}
+
+// tramosAntiguedad agrupan las incidencias sin cerrar por días desde su
+// apertura; el último recoge las que no tienen apertura anotada.
+var tramosAntiguedad = []struct {
+	nombre string
+	hasta  time.Duration
+}{
+	{"menos de 1 día", 24 * time.Hour},
+	{"1 a 3 días", 72 * time.Hour},
+	{"3 a 7 días", 7 * 24 * time.Hour},
+	{"más de 7 días", 1<<63 - 1},
+}
+
+const tramoSinFecha = "sin fecha de apertura"
+
+// intervalo es un tramo de tiempo; fin cero significa que sigue abierto.
+type intervalo struct{ inicio, fin time.Time }
+
+// solape devuelve lo que el intervalo coincide con [desde, hasta).
+func (iv intervalo) solape(desde, hasta time.Time) time.Duration {
+	inicio, fin := iv.inicio, iv.fin
+	if fin.IsZero() || fin.After(hasta) {
+		fin = hasta
+	}
+	if inicio.Before(desde) {
+		inicio = desde
+	}
+	if !fin.After(inicio) {
+		return 0
+	}
+	return fin.Sub(inicio)
+}
+
+// unirIntervalos funde los intervalos que se pisan, para no contar dos veces
+// el mismo tiempo. fin cero se trata como hasta.
+func unirIntervalos(lista []intervalo, hasta time.Time) []intervalo {
+	for i := range lista {
+		if lista[i].fin.IsZero() {
+			lista[i].fin = hasta
+		}
+	}
+	sort.Slice(lista, func(i, j int) bool { return lista[i].inicio.Before(lista[j].inicio) })
+	var unidos []intervalo
+	for _, iv := range lista {
+		if n := len(unidos); n > 0 && !iv.inicio.After(unidos[n-1].fin) {
+			if iv.fin.After(unidos[n-1].fin) {
+				unidos[n-1].fin = iv.fin
+			}
+			continue
+		}
+		unidos = append(unidos, iv)
+	}
+	return unidos
+}
+
+func horas(d time.Duration) float64 { return redondear(d.Hours()) }
+func redondear(x float64) float64   { return float64(int64(x*100+0.5)) / 100 }
+func porcentaje(parte, total float64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return redondear(parte / total * 100)
+}
+
+// calcularIndicadores supone que quien llama tiene el cerrojo.
+func calcularIndicadores(dias int) *indicadores {
+	hasta := time.Now()
+	desde := hasta.AddDate(0, 0, -dias)
+	ind := &indicadores{Desde: desde, Hasta: hasta}
+	enPeriodo := func(t time.Time) bool { return !t.Before(desde) && t.Before(hasta) }
+
+	eventos := almacen.Historial().Todos()
+	apertura := map[int]time.Time{}
+	estancias := map[string][]intervalo{} // por matrícula
+	asignaciones := map[int]map[int]time.Time{}
+	retiradas := map[int]map[int]time.Time{} // mecánico retirado de la incidencia
+	cierres := map[int][]time.Time{}
+	terminadas := map[int][]time.Time{} // listas para recoger o cerradas
+	aperturasVehiculo := map[string]int{}
+
+	for _, e := range eventos {
+		switch e.Tipo {
+		case eventoApertura:
+			apertura[e.IncidenciaID] = e.Fecha
+			if enPeriodo(e.Fecha) && e.Matricula != "" {
+				aperturasVehiculo[e.Matricula]++
+			}
+		case eventoEstado:
+			if EstadoIncidencia(e.Detalle) == estadoCerrada {
+				cierres[e.IncidenciaID] = append(cierres[e.IncidenciaID], e.Fecha)
+			}
+			if estadoTerminado(EstadoIncidencia(e.Detalle)) {
+				terminadas[e.IncidenciaID] = append(terminadas[e.IncidenciaID], e.Fecha)
+			}
+		case eventoAsignacion:
+			if asignaciones[e.MecanicoID] == nil {
+				asignaciones[e.MecanicoID] = map[int]time.Time{}
+			}
+			asignaciones[e.MecanicoID][e.IncidenciaID] = e.Fecha
+		case eventoDesasignacion:
+			if retiradas[e.MecanicoID] == nil {
+				retiradas[e.MecanicoID] = map[int]time.Time{}
+			}
+			retiradas[e.MecanicoID][e.IncidenciaID] = e.Fecha
+		case eventoEntradaPlaza:
+			estancias[e.Matricula] = append(estancias[e.Matricula], intervalo{inicio: e.Fecha})
+		case eventoSalidaPlaza:
+			if lista := estancias[e.Matricula]; len(lista) > 0 && lista[len(lista)-1].fin.IsZero() {
+				lista[len(lista)-1].fin = e.Fecha
+			}
+		}
+	}
+
+	// Tiempo hasta el cierre, por tipo y por prioridad
+	type acumulado struct {
+		n             int
+		suma, min, mx time.Duration
+	}
+	grupos := map[string]map[string]*acumulado{"tipo": {}, "prioridad": {}}
+	for id, fechas := range cierres {
+		inc := almacen.Incidencias().PorID(id)
+		inicio, ok := apertura[id]
+		if inc == nil || !ok {
+			continue
+		}
+		for _, fin := range fechas {
+			if !enPeriodo(fin) {
+				continue
+			}
+			d := fin.Sub(inicio)
+			for agrupacion, valor := range map[string]string{"tipo": string(inc.Tipo), "prioridad": string(inc.Prioridad)} {
+				a := grupos[agrupacion][valor]
+				if a == nil {
+					a = &acumulado{min: d, mx: d}
+					grupos[agrupacion][valor] = a
+				}
+				a.n++
+				a.suma += d
+				if d < a.min {
+					a.min = d
+				}
+				if d > a.mx {
+					a.mx = d
+				}
+			}
+		}
+	}
+	for _, c := range []struct {
+		agrupacion string
+		valores    []string
+	}{{"tipo", textosCatalogo(tiposIncidencia)}, {"prioridad", textosCatalogo(prioridadesIncidencia)}} {
+		for _, valor := range c.valores {
+			if a := grupos[c.agrupacion][valor]; a != nil {
+				ind.TiemposCierre = append(ind.TiemposCierre, tiempoCierre{
+					Agrupacion: c.agrupacion, Valor: valor, Cerradas: a.n,
+					MediaHoras: horas(a.suma / time.Duration(a.n)), MinHoras: horas(a.min), MaxHoras: horas(a.mx),
+				})
+			}
+		}
+	}
+
+	// Ocupación de plazas por día, sobre las plazas de los mecánicos que
+	// trabajaban ese día (ver plazasEl). Los vehículos que están en el taller
+	// sin entrada anotada cuentan desde EntradaPlaza.
+	for _, v := range almacen.Vehiculos().EnTaller() {
+		lista := estancias[v.Matricula]
+		if (len(lista) == 0 || !lista[len(lista)-1].fin.IsZero()) && !v.EntradaPlaza.IsZero() {
+			estancias[v.Matricula] = append(lista, intervalo{inicio: v.EntradaPlaza})
+		}
+	}
+	var ocupadas, capacidad float64
+	for dia := time.Date(desde.Year(), desde.Month(), desde.Day(), 0, 0, 0, 0, time.Local); dia.Before(hasta); dia = dia.AddDate(0, 0, 1) {
+		inicio, fin := dia, dia.AddDate(0, 0, 1)
+		if inicio.Before(desde) {
+			inicio = desde
+		}
+		if fin.After(hasta) {
+			fin = hasta
+		}
+		var total time.Duration
+		for _, lista := range estancias {
+			for _, iv := range lista {
+				total += iv.solape(inicio, fin)
+			}
+		}
+		plazas := plazasEl(dia)
+		disponible := fin.Sub(inicio).Hours() * float64(plazas)
+		ocupadas += total.Hours()
+		capacidad += disponible
+		ind.Ocupacion = append(ind.Ocupacion, ocupacionDia{
+			Fecha:         dia.Format("2006-01-02"),
+			Plazas:        plazas,
+			HorasOcupadas: horas(total),
+			Porcentaje:    porcentaje(total.Hours(), disponible),
+		})
+	}
+	ind.OcupacionMedia = porcentaje(ocupadas, capacidad)
+
+	// Rendimiento de los mecánicos: una asignación dura hasta que la
+	// incidencia queda lista para recoger o se cierra, o hasta que se retira
+	// al mecánico (entonces no cuenta como cerrada por él).
+	for _, m := range almacen.Mecanicos().Todos() {
+		r := rendimientoMecanico{ID: m.ID, Nombre: m.Nombre}
+		for _, inc := range m.Incidencias {
+			if !trabajoTerminado(inc) {
+				r.Pendientes++
+			}
+		}
+		var trabajo []intervalo
+		for id, asignada := range asignaciones[m.ID] {
+			iv := intervalo{inicio: asignada}
+			for _, fin := range terminadas[id] {
+				if !fin.Before(asignada) {
+					iv.fin = fin
+					break
+				}
+			}
+			cerrada := !iv.fin.IsZero()
+			if retirada, ok := retiradas[m.ID][id]; ok && !retirada.Before(asignada) && (!cerrada || retirada.Before(iv.fin)) {
+				iv.fin, cerrada = retirada, false
+			}
+			if enPeriodo(asignada) {
+				r.Asignadas++
+			}
+			if cerrada && enPeriodo(iv.fin) {
+				r.Cerradas++
+			}
+			trabajo = append(trabajo, iv)
+		}
+		var ocupado time.Duration
+		for _, iv := range unirIntervalos(trabajo, hasta) {
+			ocupado += iv.solape(desde, hasta)
+		}
+		r.Utilizacion = porcentaje(ocupado.Hours(), hasta.Sub(desde).Hours())
+		ind.Mecanicos = append(ind.Mecanicos, r)
+	}
+
+	// Antigüedad de las incidencias pendientes (con trabajo por hacer)
+	cuenta := map[string]int{}
+	for _, inc := range almacen.Incidencias().Todas() {
+		if trabajoTerminado(inc) {
+			continue
+		}
+		inicio, ok := apertura[inc.ID]
+		if !ok {
+			cuenta[tramoSinFecha]++
+			continue
+		}
+		for _, t := range tramosAntiguedad {
+			if hasta.Sub(inicio) < t.hasta {
+				cuenta[t.nombre]++
+				break
+			}
+		}
+	}
+	for _, t := range tramosAntiguedad {
+		ind.Antiguedad = append(ind.Antiguedad, tramoAntiguedad{t.nombre, cuenta[t.nombre]})
+	}
+	if cuenta[tramoSinFecha] > 0 {
+		ind.Antiguedad = append(ind.Antiguedad, tramoAntiguedad{tramoSinFecha, cuenta[tramoSinFecha]})
+	}
+
+	// Vehículos que han vuelto con otra incidencia en el periodo
+	ind.VehiculosAtendidos = len(aperturasVehiculo)
+	for matricula, n := range aperturasVehiculo {
+		if n > 1 {
+			ind.Repetidos = append(ind.Repetidos, vehiculoRepetido{matricula, n})
+		}
+	}
+	sort.Slice(ind.Repetidos, func(i, j int) bool {
+		if ind.Repetidos[i].Incidencias != ind.Repetidos[j].Incidencias {
+			return ind.Repetidos[i].Incidencias > ind.Repetidos[j].Incidencias
+		}
+		return ind.Repetidos[i].Matricula < ind.Repetidos[j].Matricula
+	})
+	ind.TasaRepeticion = porcentaje(float64(len(ind.Repetidos)), float64(ind.VehiculosAtendidos))
+	return ind
+}
+
+// tablas devuelve cada indicador como una tabla con cabecera, para la
+// consola y para los CSV.
+func (ind *indicadores) tablas() map[string][][]string {
+	decimal := func(x float64) string { return strconv.FormatFloat(x, 'f', 2, 64) }
+	t := map[string][][]string{
+		"cierre":       {{"agrupacion", "valor", "cerradas", "media_horas", "min_horas", "max_horas"}},
+		"ocupacion":    {{"fecha", "plazas", "horas_ocupadas", "porcentaje"}},
+		"mecanicos":    {{"id", "nombre", "asignadas", "cerradas", "pendientes", "utilizacion"}},
+		"antiguedad":   {{"tramo", "incidencias"}},
+		"repeticiones": {{"matricula", "incidencias"}},
+	}
+	for _, c := range ind.TiemposCierre {
+		t["cierre"] = append(t["cierre"], []string{c.Agrupacion, c.Valor, strconv.Itoa(c.Cerradas),
+			decimal(c.MediaHoras), decimal(c.MinHoras), decimal(c.MaxHoras)})
+	}
+	for _, o := range ind.Ocupacion {
+		t["ocupacion"] = append(t["ocupacion"], []string{o.Fecha, strconv.Itoa(o.Plazas),
+			decimal(o.HorasOcupadas), decimal(o.Porcentaje)})
+	}
+	for _, m := range ind.Mecanicos {
+		t["mecanicos"] = append(t["mecanicos"], []string{strconv.Itoa(m.ID), m.Nombre, strconv.Itoa(m.Asignadas),
+			strconv.Itoa(m.Cerradas), strconv.Itoa(m.Pendientes), decimal(m.Utilizacion)})
+	}
+	for _, a := range ind.Antiguedad {
+		t["antiguedad"] = append(t["antiguedad"], []string{a.Tramo, strconv.Itoa(a.Incidencias)})
+	}
+	for _, r := range ind.Repetidos {
+		t["repeticiones"] = append(t["repeticiones"], []string{r.Matricula, strconv.Itoa(r.Incidencias)})
+	}
+	return t
+}
+
+var ordenTablasIndicadores = []string{"cierre", "ocupacion", "mecanicos", "antiguedad", "repeticiones"}
+
+// exportarIndicadoresCSV escribe un fichero kpi_<tabla>.csv por indicador.
+func exportarIndicadoresCSV(ind *indicadores, directorio string) ([]string, error) {
+	if err := os.MkdirAll(directorio, 0755); err != nil {
+		return nil, err
+	}
+	tablas := ind.tablas()
+	var escritos []string
+	for _, nombre := range ordenTablasIndicadores {
+		ruta := filepath.Join(directorio, "kpi_"+nombre+".csv")
+		if err := escribirCSV(ruta, tablas[nombre]); err != nil {
+			return escritos, err
+		}
+		escritos = append(escritos, ruta)
+	}
+	return escritos, nil
+}
+
+func exportarIndicadoresJSON(ind *indicadores, ruta string) error {
+	datos, err := json.MarshalIndent(ind, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(ruta, datos, 0644)
+}
+
+// diasInforme lee el periodo en días; vacío es 30.
+func diasInforme(texto string) (int, error) {
+	if strings.TrimSpace(texto) == "" {
+		return 30, nil
+	}
+	dias, err := strconv.Atoi(strings.TrimSpace(texto))
+	if err != nil || dias < 1 {
+		return 0, fmt.Errorf("periodo %q no válido: debe ser un número de días mayor que 0", texto)
+	}
+	return dias, nil
+}
+
+// Web: GET /informes.json?dias=N
+
+func informeJSON(w http.ResponseWriter, r *http.Request) {
+	dias, err := diasInforme(r.URL.Query().Get("dias"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var ind *indicadores
+	consultar(func() { ind = calcularIndicadores(dias) })
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	codificador := json.NewEncoder(w)
+	codificador.SetIndent("", "  ")
+	codificador.Encode(ind)
+}
+
+// Funciones de menú
+
+func mostrarIndicadores(ind *indicadores) {
+	tablas := ind.tablas()
+	titulos := map[string]string{
+		"cierre":       "TIEMPO HASTA EL CIERRE (horas)",
+		"ocupacion":    "OCUPACIÓN DE PLAZAS POR DÍA",
+		"mecanicos":    "RENDIMIENTO DE LOS MECÁNICOS",
+		"antiguedad":   "ANTIGÜEDAD DE LAS INCIDENCIAS PENDIENTES",
+		"repeticiones": "VEHÍCULOS CON MÁS DE UNA INCIDENCIA",
+	}
+	for _, nombre := range ordenTablasIndicadores {
+		fmt.Printf("\n=== %s ===\n", titulos[nombre])
+		if len(tablas[nombre]) == 1 {
+			fmt.Println("Sin datos en el periodo")
+			continue
+		}
+		imprimirTabla(os.Stdout, tablas[nombre][0], tablas[nombre][1:])
+	}
+	fmt.Printf("\nOcupación media del periodo: %.2f%%\n", ind.OcupacionMedia)
+	fmt.Printf("Reincidencia: %d de %d vehículos atendidos (%.2f%%)\n",
+		len(ind.Repetidos), ind.VehiculosAtendidos, ind.TasaRepeticion)
+	fmt.Println("Ingresos: disponibles cuando el taller tenga facturación")
+}
+
+func informesTaller() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== INFORMES E INDICADORES ===")
+	dias, err := diasInforme(leerCriterio(reader, "Periodo en días (vacío = 30): "))
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	var ind *indicadores
+	consultar(func() { ind = calcularIndicadores(dias) })
+	fmt.Printf("\nDel %s al %s\n", ind.Desde.Format("02/01/2006 15:04"), ind.Hasta.Format("02/01/2006 15:04"))
+	mostrarIndicadores(ind)
+
+	fmt.Println("\n¿Exportar? [C] CSV  [J] JSON  [Enter] no")
+	switch strings.ToUpper(leerCriterio(reader, "Opción: ")) {
+	case "C":
+		directorio := leerCriterio(reader, "Directorio de destino (vacío para \"informes\"): ")
+		if directorio == "" {
+			directorio = "informes"
+		}
+		escritos, err := exportarIndicadoresCSV(ind, directorio)
+		if err != nil {
+			fmt.Println("Error:", err)
+			break
+		}
+		fmt.Println("\nFicheros generados:")
+		for _, ruta := range escritos {
+			fmt.Println(" -", ruta)
+		}
+	case "J":
+		ruta := leerCriterio(reader, "Fichero de destino (vacío para \"informe.json\"): ")
+		if ruta == "" {
+			ruta = "informe.json"
+		}
+		if err := exportarIndicadoresJSON(ind, ruta); err != nil {
+			fmt.Println("Error:", err)
+			break
+		}
+		fmt.Println("Informe guardado en", ruta)
+	}
+	pausar()
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// La ocupación de cada día se mide sobre las plazas de ese día: sin
+// mecánicos de turno el taller no tiene capacidad.
+func TestOcupacionConPlazasDelDia(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	entreSemana, err := leerHorario("lu-vi 08:00-16:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registrarMecanico(0, "Ana", []Especialidad{{Tipo: tipoMecanica, Nivel: "experto"}}, 5, entreSemana, true); err != nil {
+		t.Fatal(err)
+	}
+
+	var ind *indicadores
+	consultar(func() { ind = calcularIndicadores(7) })
+	if len(ind.Ocupacion) < 7 {
+		t.Fatalf("%d días de ocupación, se esperaban al menos 7", len(ind.Ocupacion))
+	}
+	for _, o := range ind.Ocupacion {
+		fecha, err := time.ParseInLocation("2006-01-02", o.Fecha, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		esperadas := taller.PlazasPorMecanico
+		if fecha.Weekday() == time.Saturday || fecha.Weekday() == time.Sunday {
+			esperadas = 0
+		}
+		if o.Plazas != esperadas {
+			t.Errorf("%s (%s): %d plazas, se esperaban %d", o.Fecha, fecha.Weekday(), o.Plazas, esperadas)
+		}
+	}
+}
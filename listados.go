@@ -0,0 +1,296 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Listados paginados
+//
+// Los listados de consola se muestran como una tabla compacta, una línea por
+// registro, que se puede ordenar por varios criterios y recorrer por páginas.
+// Las filas se preparan dentro de consultar y después se navega por ellas sin
+// el cerrojo, porque entre página y página se espera al usuario.
+
+// tamanoPagina es el número de filas por página; se cambia con -pagina o
+// desde cualquier listado y se mantiene durante la sesión.
+var tamanoPagina = 20
+
+// anchoMaximoColumna recorta las columnas largas (descripciones, emails...).
+const anchoMaximoColumna = 40
+
+type filaListado struct {
+	celdas   []string
+	claves   []interface{} // una por criterio de orden: int, string o time.Time
+	posicion int           // orden de alta, para deshacer empates
+}
+
+type listado struct {
+	titulo   string
+	vacio    string // mensaje si no hay filas
+	columnas []string
+	ordenes  []string // nombres de los criterios de orden
+	filas    []filaListado
+}
+
+func compararClaves(a, b interface{}) int {
+	switch x := a.(type) {
+	case int:
+		y := b.(int)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(normalizarBusqueda(x), normalizarBusqueda(b.(string)))
+	case time.Time:
+		return x.Compare(b.(time.Time))
+	}
+	return 0
+}
+
+// ordenar ordena las filas por el criterio indicado; el orden de alta
+// decide los empates.
+func (l *listado) ordenar(criterio int, descendente bool) {
+	sort.Slice(l.filas, func(i, j int) bool {
+		c := compararClaves(l.filas[i].claves[criterio], l.filas[j].claves[criterio])
+		if descendente {
+			c = -c
+		}
+		if c == 0 {
+			return l.filas[i].posicion < l.filas[j].posicion
+		}
+		return c < 0
+	})
+}
+
+// imprimirTabla escribe las filas en columnas alineadas.
+func imprimirTabla(w io.Writer, columnas []string, filas [][]string) {
+	anchos := make([]int, len(columnas))
+	for i, titulo := range columnas {
+		anchos[i] = utf8.RuneCountInString(titulo)
+	}
+	for _, fila := range filas {
+		for i, celda := range fila {
+			if n := utf8.RuneCountInString(celda); n > anchos[i] {
+				anchos[i] = n
+			}
+		}
+	}
+	for i := range anchos {
+		if anchos[i] > anchoMaximoColumna {
+			anchos[i] = anchoMaximoColumna
+		}
+	}
+
+	linea := func(celdas []string) {
+		partes := make([]string, len(celdas))
+		for i, celda := range celdas {
+			partes[i] = ajustar(celda, anchos[i])
+		}
+		fmt.Fprintln(w, strings.TrimRight(strings.Join(partes, "  "), " "))
+	}
+	linea(columnas)
+	separadores := make([]string, len(columnas))
+	for i := range columnas {
+		separadores[i] = strings.Repeat("-", anchos[i])
+	}
+	linea(separadores)
+	for _, fila := range filas {
+		linea(fila)
+	}
+}
+
+// mostrarListado enseña el listado por páginas hasta que el usuario vuelve
+// al menú.
+func mostrarListado(l *listado) {
+	reader := bufio.NewReader(os.Stdin)
+	criterio, descendente := 0, false
+	pagina := 0
+	aviso := ""
+	for i := range l.filas {
+		l.filas[i].posicion = i
+	}
+
+	for {
+		if len(l.ordenes) > 0 {
+			l.ordenar(criterio, descendente)
+		}
+		paginas := (len(l.filas) + tamanoPagina - 1) / tamanoPagina
+		if paginas == 0 {
+			paginas = 1
+		}
+		if pagina >= paginas {
+			pagina = paginas - 1
+		}
+
+		limpiarPantalla()
+		fmt.Printf("=== %s ===\n", l.titulo)
+		if len(l.filas) == 0 {
+			fmt.Println(l.vacio)
+			pausar()
+			return
+		}
+
+		sentido := "ascendente"
+		if descendente {
+			sentido = "descendente"
+		}
+		fmt.Printf("Ordenado por %s (%s) · Página %d de %d · %d registro(s)\n\n",
+			l.ordenes[criterio], sentido, pagina+1, paginas, len(l.filas))
+
+		inicio := pagina * tamanoPagina
+		fin := inicio + tamanoPagina
+		if fin > len(l.filas) {
+			fin = len(l.filas)
+		}
+		var celdas [][]string
+		for _, fila := range l.filas[inicio:fin] {
+			celdas = append(celdas, fila.celdas)
+		}
+		imprimirTabla(os.Stdout, l.columnas, celdas)
+
+		if aviso != "" {
+			fmt.Println("\n" + aviso)
+			aviso = ""
+		}
+		fmt.Println("\n[S] siguiente  [A] anterior  [nº] ir a página  [O] ordenar  [I] invertir orden  [T] filas por página  [Enter] volver")
+		opcion := strings.ToUpper(leerCriterio(reader, "Opción: "))
+
+		switch {
+		case opcion == "":
+			return
+		case opcion == "S":
+			if pagina < paginas-1 {
+				pagina++
+			}
+		case opcion == "A":
+			if pagina > 0 {
+				pagina--
+			}
+		case opcion == "I":
+			descendente = !descendente
+		case opcion == "O":
+			for i, nombre := range l.ordenes {
+				fmt.Printf("%d. %s\n", i+1, nombre)
+			}
+			n, err := strconv.Atoi(leerCriterio(reader, "Ordenar por: "))
+			if err != nil || n < 1 || n > len(l.ordenes) {
+				aviso = "Criterio de orden no válido"
+				break
+			}
+			criterio, descendente, pagina = n-1, false, 0
+		case opcion == "T":
+			n, err := strconv.Atoi(leerCriterio(reader, "Filas por página: "))
+			if err != nil || n < 1 {
+				aviso = "El número de filas debe ser mayor que 0"
+				break
+			}
+			tamanoPagina, pagina = n, 0
+		default:
+			n, err := strconv.Atoi(opcion)
+			if err != nil || n < 1 || n > paginas {
+				aviso = "Opción inválida"
+				break
+			}
+			pagina = n - 1
+		}
+	}
+}
+
+// Listados de cada entidad. Suponen que quien llama tiene el cerrojo.
+
+func listadoClientes(titulo string, clientes []*Cliente) *listado {
+	l := &listado{
+		titulo:   titulo,
+		vacio:    "No hay clientes registrados",
+		columnas: []string{"ID", "Nombre", "Teléfono", "Email", "Vehículo"},
+		ordenes:  []string{"ID", "nombre"},
+	}
+	for _, c := range clientes {
+		vehiculo := ""
+		if c.Vehiculo != nil {
+			vehiculo = fmt.Sprintf("%s (%s %s)", c.Vehiculo.Matricula, c.Vehiculo.Marca, c.Vehiculo.Modelo)
+		}
+		l.filas = append(l.filas, filaListado{
+			celdas: []string{strconv.Itoa(c.ID), c.Nombre, c.Telefono, c.Email, vehiculo},
+			claves: []interface{}{c.ID, c.Nombre},
+		})
+	}
+	return l
+}
+
+func listadoVehiculos(titulo string, vehiculos []*Vehiculo) *listado {
+	l := &listado{
+		titulo:   titulo,
+		vacio:    "No hay vehículos registrados",
+		columnas: []string{"Matrícula", "Marca", "Modelo", "Cliente", "Entrada", "Taller", "Incidencias"},
+		ordenes:  []string{"matrícula", "marca y modelo", "fecha de entrada", "cliente"},
+	}
+	for _, v := range vehiculos {
+		cliente, taller := "", "-"
+		if c := buscarPropietario(v); c != nil {
+			cliente = c.Nombre
+		}
+		if v.EnTaller {
+			taller = fmt.Sprintf("Plaza %d", v.NumeroPlaza)
+		}
+		incidencias := resumenOrden(lineasOrden(v, v.Orden))
+		// Las fechas escritas a mano que no se entiendan quedan al principio.
+		entrada, _ := time.Parse("02/01/2006", v.FechaEntrada)
+		l.filas = append(l.filas, filaListado{
+			celdas: []string{v.Matricula, v.Marca, v.Modelo, cliente, v.FechaEntrada, taller, incidencias},
+			claves: []interface{}{v.Matricula, v.Marca + " " + v.Modelo, entrada, cliente},
+		})
+	}
+	return l
+}
+
+func listadoIncidencias(titulo string, incidencias []*Incidencia) *listado {
+	l := &listado{
+		titulo:   titulo,
+		vacio:    "No hay incidencias registradas",
+		columnas: []string{"ID", "Vehículo", "Tipo", "Prioridad", "Estado", "Mecánicos", "Descripción"},
+		ordenes:  []string{"ID", "prioridad", "estado", "tipo", "vehículo"},
+	}
+	for _, inc := range incidencias {
+		matricula := ""
+		if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+			matricula = v.Matricula
+		}
+		l.filas = append(l.filas, filaListado{
+			celdas: []string{strconv.Itoa(inc.ID), matricula, string(inc.Tipo), string(inc.Prioridad), string(inc.Estado),
+				idsMecanicos(inc.Mecanicos), inc.Descripcion},
+			claves: []interface{}{inc.ID, rangoPrioridad(inc.Prioridad), posicion(estadosIncidencia, inc.Estado), string(inc.Tipo), matricula},
+		})
+	}
+	return l
+}
+
+func listadoMecanicos(titulo string, mecanicos []*Mecanico) *listado {
+	l := &listado{
+		titulo:   titulo,
+		vacio:    "No hay mecánicos registrados",
+		columnas: []string{"ID", "Nombre", "Especialidades", "Experiencia", "Estado", "Carga", "Incidencias"},
+		ordenes:  []string{"ID", "nombre", "experiencia", "carga de trabajo"},
+	}
+	for _, m := range mecanicos {
+		estado := situacionMecanico(m, time.Now())
+		l.filas = append(l.filas, filaListado{
+			celdas: []string{strconv.Itoa(m.ID), m.Nombre, textoEspecialidades(m.Especialidades), fmt.Sprintf("%d años", m.AniosExp),
+				estado, textoCarga(cargaMecanico(m)), strconv.Itoa(len(m.Incidencias))},
+			claves: []interface{}{m.ID, m.Nombre, m.AniosExp, cargaMecanico(m)},
+		})
+	}
+	return l
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// Versionado del esquema de los ficheros guardados y migraciones
+
+// versionEsquema es la versión con la que se escriben las instantáneas. Cada
+// cambio de formato la incrementa y añade su migración a la lista.
+const versionEsquema = 11
+
+// migracion convierte los datos de la versión Desde a la Desde+1. Trabaja
+// sobre el JSON genérico porque las estructuras antiguas ya no existen.
+type migracion struct {
+	Desde       int
+	Descripcion string
+	Aplicar     func(datos map[string]interface{}) error
+}
+
+// migraciones debe estar ordenada y sin huecos, de la versión 1 en adelante.
+var migraciones = []migracion{
+	{1, "la relación cliente-vehículo pasa a guardarse en el vehículo (cliente_id)", migrarClienteAVehiculo},
+	{2, "cada entidad guarda su número de versión", migrarVersionEntidades},
+	{3, "los vehículos en el taller guardan cuándo ocuparon su plaza", migrarEntradaPlaza},
+	{4, "se añade el historial de movimientos del taller", migrarHistorial},
+	{5, "los clientes pueden renunciar a los avisos", migrarSinAvisos},
+	{6, "los vehículos guardan quién los recogió y el pago", migrarRecogida},
+	{7, "cada visita tiene una orden de trabajo con varias incidencias", migrarOrdenesTrabajo},
+	{8, "los mecánicos tienen varias especialidades, cada una con su nivel", migrarEspecialidades},
+	{9, "los mecánicos tienen horario semanal y ausencias previstas", migrarHorarios},
+	{10, "las incidencias tienen notas y ficheros adjuntos", migrarNotas},
+}
+
+// versionDatos lee el campo "version" de un fichero ya decodificado.
+func versionDatos(datos map[string]interface{}) (int, error) {
+	valor, ok := datos["version"].(float64)
+	if !ok || valor < 1 || valor != float64(int(valor)) {
+		return 0, errors.New("el fichero no indica una versión de esquema válida")
+	}
+	return int(valor), nil
+}
+
+// migracionesPendientes devuelve, en orden, las migraciones que llevan un
+// fichero de la versión indicada a la actual.
+func migracionesPendientes(version int) ([]migracion, error) {
+	if version > versionEsquema {
+		return nil, fmt.Errorf("el fichero es de la versión %d, más reciente que la soportada (%d)", version, versionEsquema)
+	}
+
+	var pendientes []migracion
+	for v := version; v < versionEsquema; v++ {
+		encontrada := false
+		for _, m := range migraciones {
+			if m.Desde == v {
+				pendientes = append(pendientes, m)
+				encontrada = true
+				break
+			}
+		}
+		if !encontrada {
+			return nil, fmt.Errorf("no hay migración desde la versión %d", v)
+		}
+	}
+	return pendientes, nil
+}
+
+// migrarDatos actualiza un fichero JSON a la versión actual del esquema y
+// devuelve los datos resultantes junto con las migraciones aplicadas.
+func migrarDatos(datos []byte) ([]byte, []migracion, error) {
+	var generico map[string]interface{}
+	if err := json.Unmarshal(datos, &generico); err != nil {
+		return nil, nil, fmt.Errorf("el fichero no es un JSON válido: %v", err)
+	}
+
+	version, err := versionDatos(generico)
+	if err != nil {
+		return nil, nil, err
+	}
+	pendientes, err := migracionesPendientes(version)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(pendientes) == 0 {
+		return datos, nil, nil
+	}
+
+	for _, m := range pendientes {
+		if err := m.Aplicar(generico); err != nil {
+			return nil, nil, fmt.Errorf("migración %d -> %d: %v", m.Desde, m.Desde+1, err)
+		}
+		generico["version"] = m.Desde + 1
+	}
+
+	datos, err = json.Marshal(generico)
+	if err != nil {
+		return nil, nil, err
+	}
+	return datos, pendientes, nil
+}
+
+// listaJSON devuelve los elementos de una lista de objetos del fichero.
+func listaJSON(datos map[string]interface{}, clave string) []map[string]interface{} {
+	var objetos []map[string]interface{}
+	lista, _ := datos[clave].([]interface{})
+	for _, elemento := range lista {
+		if objeto, ok := elemento.(map[string]interface{}); ok {
+			objetos = append(objetos, objeto)
+		}
+	}
+	return objetos
+}
+
+// Versión 1 -> 2: cada cliente guardaba la matrícula de su vehículo; ahora
+// es el vehículo quien guarda el ID de su cliente.
+func migrarClienteAVehiculo(datos map[string]interface{}) error {
+	vehiculosPorMatricula := map[string]map[string]interface{}{}
+	for _, v := range listaJSON(datos, "vehiculos") {
+		if matricula, ok := v["matricula"].(string); ok {
+			vehiculosPorMatricula[matricula] = v
+		}
+	}
+
+	for _, c := range listaJSON(datos, "clientes") {
+		matricula, _ := c["matricula"].(string)
+		delete(c, "matricula")
+		if matricula == "" {
+			continue
+		}
+		v, ok := vehiculosPorMatricula[matricula]
+		if !ok {
+			return fmt.Errorf("cliente %v: vehículo %s no existe", c["id"], matricula)
+		}
+		v["cliente_id"] = c["id"]
+	}
+	return nil
+}
+
+// Versión 2 -> 3: las entidades llevan un número de versión para detectar
+// modificaciones simultáneas. Las existentes empiezan en la 1.
+func migrarVersionEntidades(datos map[string]interface{}) error {
+	for _, lista := range []string{"clientes", "vehiculos", "incidencias", "mecanicos"} {
+		for _, entidad := range listaJSON(datos, lista) {
+			entidad["version"] = 1
+		}
+	}
+	return nil
+}
+
+// Versión 3 -> 4: se guarda el momento en que cada vehículo ocupó su plaza.
+// Para los que ya están en el taller se toma su fecha de entrada.
+func migrarEntradaPlaza(datos map[string]interface{}) error {
+	for _, v := range listaJSON(datos, "vehiculos") {
+		enTaller, _ := v["en_taller"].(bool)
+		fecha, _ := v["fecha_entrada"].(string)
+		if !enTaller || fecha == "" {
+			continue
+		}
+		entrada, err := time.ParseInLocation("02/01/2006", fecha, time.Local)
+		if err != nil {
+			continue // fecha escrita a mano: se deja sin hora de entrada
+		}
+		v["entrada_plaza"] = entrada.Format(time.RFC3339)
+	}
+	return nil
+}
+
+// Versión 4 -> 5: se añade el historial de movimientos. Del pasado sólo se
+// conoce la entrada de los vehículos que siguen en su plaza.
+func migrarHistorial(datos map[string]interface{}) error {
+	historial := []interface{}{}
+	for _, v := range listaJSON(datos, "vehiculos") {
+		entrada, _ := v["entrada_plaza"].(string)
+		if entrada == "" {
+			continue
+		}
+		historial = append(historial, map[string]interface{}{
+			"id":        len(historial) + 1,
+			"fecha":     entrada,
+			"tipo":      eventoEntradaPlaza,
+			"matricula": v["matricula"],
+			"plaza":     v["numero_plaza"],
+		})
+	}
+	datos["historial"] = historial
+	return nil
+}
+
+// Versión 5 -> 6: los clientes pueden pedir no recibir avisos. Hasta ahora
+// no se enviaba ninguno, así que todos empiezan recibiéndolos.
+func migrarSinAvisos(datos map[string]interface{}) error {
+	for _, c := range listaJSON(datos, "clientes") {
+		c["sin_avisos"] = false
+	}
+	return nil
+}
+
+// Versión 6 -> 7: la salida del vehículo se separa del cierre de la
+// incidencia y anota quién lo recoge y el pago. De las salidas anteriores
+// no se sabe, así que se dejan en blanco.
+func migrarRecogida(datos map[string]interface{}) error {
+	for _, v := range listaJSON(datos, "vehiculos") {
+		v["estado_pago"] = ""
+		v["recogido_por"] = ""
+	}
+	return nil
+}
+
+// Versión 7 -> 8: un vehículo puede tener varias incidencias, agrupadas en
+// una orden de trabajo por visita. La incidencia de cada vehículo pasa a ser
+// una orden de una sola línea, que sigue en curso salvo que ya se cerrara y
+// el vehículo saliera del taller.
+func migrarOrdenesTrabajo(datos map[string]interface{}) error {
+	incidencias := map[float64]map[string]interface{}{}
+	for _, inc := range listaJSON(datos, "incidencias") {
+		if id, ok := inc["id"].(float64); ok {
+			incidencias[id] = inc
+		}
+	}
+	for _, v := range listaJSON(datos, "vehiculos") {
+		id, _ := v["incidencia_id"].(float64)
+		delete(v, "incidencia_id")
+		v["incidencias"] = []interface{}{}
+		inc := incidencias[id]
+		if inc == nil {
+			continue
+		}
+		v["incidencias"] = []interface{}{id}
+		inc["orden"] = id
+		if inc["estado"] != "cerrada" || v["en_taller"] == true {
+			v["orden"] = id
+		}
+	}
+	return nil
+}
+
+// Versión 8 -> 9: los mecánicos pueden tener varias especialidades con un
+// nivel en cada una, y la prioridad de la incidencia pide un nivel mínimo.
+// La especialidad que tenían pasa con el nivel más alto, para que sigan
+// pudiendo atender lo mismo que hasta ahora; conviene revisarlo después.
+func migrarEspecialidades(datos map[string]interface{}) error {
+	for _, m := range listaJSON(datos, "mecanicos") {
+		m["especialidades"] = []interface{}{map[string]interface{}{
+			"tipo":  m["especialidad"],
+			"nivel": nivelesEspecialidad[len(nivelesEspecialidad)-1],
+		}}
+		delete(m, "especialidad")
+	}
+	return nil
+}
+
+// Versión 9 -> 10: los mecánicos tienen horario y ausencias. Hasta ahora un
+// mecánico en activo contaba todos los días, así que se le pone el horario
+// habitual, de lunes a domingo; el taller ajusta después los horarios reales.
+func migrarHorarios(datos map[string]interface{}) error {
+	for _, m := range listaJSON(datos, "mecanicos") {
+		var horario []interface{}
+		for _, t := range horarioHabitual() {
+			horario = append(horario, map[string]interface{}{"dia": nombresDias[t.Dia], "entrada": t.Entrada, "salida": t.Salida})
+		}
+		m["horario"] = horario
+		m["ausencias"] = []interface{}{}
+	}
+	return nil
+}
+
+// Versión 10 -> 11: las incidencias llevan notas con fecha y autor y
+// ficheros adjuntos. Las existentes empiezan sin ninguno; lo que se había
+// escrito hasta ahora sigue en su descripción.
+func migrarNotas(datos map[string]interface{}) error {
+	for _, inc := range listaJSON(datos, "incidencias") {
+		inc["notas"] = []interface{}{}
+		inc["adjuntos"] = []interface{}{}
+	}
+	return nil
+}
+
+// Funciones de menú
+
+func comprobarMigraciones() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== COMPROBAR MIGRACIONES DE UN FICHERO ===")
+
+	fmt.Print("Fichero a comprobar: ")
+	ruta, _ := reader.ReadString('\n')
+	ruta = strings.TrimSpace(ruta)
+
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	var generico map[string]interface{}
+	if err := json.Unmarshal(datos, &generico); err != nil {
+		fmt.Println("Error: el fichero no es un JSON válido:", err)
+		pausar()
+		return
+	}
+	version, err := versionDatos(generico)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Printf("\nVersión del fichero: %d\n", version)
+	fmt.Printf("Versión actual del esquema: %d\n", versionEsquema)
+
+	pendientes, err := migracionesPendientes(version)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	if len(pendientes) == 0 {
+		fmt.Println("\nEl fichero está al día, no hay migraciones pendientes")
+		pausar()
+		return
+	}
+
+	fmt.Println("\nMigraciones que se aplicarían al cargarlo:")
+	for _, m := range pendientes {
+		fmt.Printf("  %d -> %d: %s\n", m.Desde, m.Desde+1, m.Descripcion)
+	}
+
+	fmt.Print("\n¿Actualizar el fichero en disco? Se guardará una copia del original (S/N): ")
+	var respuesta string
+	fmt.Scanln(&respuesta)
+	if strings.ToUpper(respuesta) != "S" {
+		pausar()
+		return
+	}
+
+	if err := migrarFichero(ruta, datos, version); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nFichero actualizado a la versión", versionEsquema)
+	pausar()
+}
+
+// migrarFichero reescribe el fichero en la versión actual, conservando el
+// original con la versión como sufijo.
+func migrarFichero(ruta string, datos []byte, version int) error {
+	s, err := leerSnapshot(ruta)
+	if err != nil {
+		return err
+	}
+	if _, err := s.construir(); err != nil {
+		return fmt.Errorf("el fichero migrado no es válido: %v", err)
+	}
+
+	copia := fmt.Sprintf("%s.v%d", ruta, version)
+	if err := os.WriteFile(copia, datos, 0644); err != nil {
+		return err
+	}
+	return escribirSnapshot(s, ruta)
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// jsonGenerico decodifica un texto JSON para comparar datos migrados.
+func jsonGenerico(t *testing.T, texto string) map[string]interface{} {
+	t.Helper()
+	var datos map[string]interface{}
+	if err := json.Unmarshal([]byte(texto), &datos); err != nil {
+		t.Fatalf("JSON de prueba no válido: %v\n%s", err, texto)
+	}
+	return datos
+}
+
+// Cada migración, aplicada por separado, deja los datos como se espera.
+func TestMigracionesPorPaso(t *testing.T) {
+	entrada, err := time.ParseInLocation("02/01/2006", "01/02/2024", time.Local)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaza := entrada.Format(time.RFC3339)
+
+	pasos := map[int]struct{ antes, despues string }{
+		1: {
+			`{"clientes": [{"id": 1, "matricula": "1234BCD"}, {"id": 2, "matricula": ""}],
+			  "vehiculos": [{"matricula": "1234BCD"}]}`,
+			`{"clientes": [{"id": 1}, {"id": 2}],
+			  "vehiculos": [{"matricula": "1234BCD", "cliente_id": 1}]}`,
+		},
+		2: {
+			`{"clientes": [{"id": 1}], "vehiculos": [{"matricula": "1234BCD"}],
+			  "incidencias": [{"id": 1}], "mecanicos": [{"id": 1}]}`,
+			`{"clientes": [{"id": 1, "version": 1}], "vehiculos": [{"matricula": "1234BCD", "version": 1}],
+			  "incidencias": [{"id": 1, "version": 1}], "mecanicos": [{"id": 1, "version": 1}]}`,
+		},
+		3: {
+			`{"vehiculos": [{"matricula": "A", "en_taller": true, "fecha_entrada": "01/02/2024"},
+			                {"matricula": "B", "en_taller": false, "fecha_entrada": "01/02/2024"},
+			                {"matricula": "C", "en_taller": true, "fecha_entrada": "ayer"}]}`,
+			fmt.Sprintf(`{"vehiculos": [{"matricula": "A", "en_taller": true, "fecha_entrada": "01/02/2024", "entrada_plaza": %q},
+			                {"matricula": "B", "en_taller": false, "fecha_entrada": "01/02/2024"},
+			                {"matricula": "C", "en_taller": true, "fecha_entrada": "ayer"}]}`, plaza),
+		},
+		4: {
+			fmt.Sprintf(`{"vehiculos": [{"matricula": "A", "entrada_plaza": %q, "numero_plaza": 2}, {"matricula": "B"}]}`, plaza),
+			fmt.Sprintf(`{"vehiculos": [{"matricula": "A", "entrada_plaza": %q, "numero_plaza": 2}, {"matricula": "B"}],
+			  "historial": [{"id": 1, "fecha": %q, "tipo": %q, "matricula": "A", "plaza": 2}]}`, plaza, plaza, eventoEntradaPlaza),
+		},
+		5: {
+			`{"clientes": [{"id": 1}]}`,
+			`{"clientes": [{"id": 1, "sin_avisos": false}]}`,
+		},
+		6: {
+			`{"vehiculos": [{"matricula": "A"}]}`,
+			`{"vehiculos": [{"matricula": "A", "estado_pago": "", "recogido_por": ""}]}`,
+		},
+		7: {
+			// A ya salió con su incidencia cerrada; B y C siguen en el taller.
+			`{"incidencias": [{"id": 1, "estado": "cerrada"}, {"id": 2, "estado": "abierta"}, {"id": 3, "estado": "cerrada"}],
+			  "vehiculos": [{"matricula": "A", "incidencia_id": 1, "en_taller": false},
+			                {"matricula": "B", "incidencia_id": 2, "en_taller": true},
+			                {"matricula": "C", "incidencia_id": 3, "en_taller": true},
+			                {"matricula": "D"}]}`,
+			`{"incidencias": [{"id": 1, "estado": "cerrada", "orden": 1}, {"id": 2, "estado": "abierta", "orden": 2},
+			                  {"id": 3, "estado": "cerrada", "orden": 3}],
+			  "vehiculos": [{"matricula": "A", "incidencias": [1], "en_taller": false},
+			                {"matricula": "B", "incidencias": [2], "orden": 2, "en_taller": true},
+			                {"matricula": "C", "incidencias": [3], "orden": 3, "en_taller": true},
+			                {"matricula": "D", "incidencias": []}]}`,
+		},
+		8: {
+			`{"mecanicos": [{"id": 1, "especialidad": "mecánica"}]}`,
+			`{"mecanicos": [{"id": 1, "especialidades": [{"tipo": "mecánica", "nivel": "experto"}]}]}`,
+		},
+		9: {
+			`{"mecanicos": [{"id": 1}]}`,
+			`{"mecanicos": [{"id": 1, "ausencias": [], "horario": [
+				{"dia": "lunes", "entrada": "08:00", "salida": "16:00"},
+				{"dia": "martes", "entrada": "08:00", "salida": "16:00"},
+				{"dia": "miércoles", "entrada": "08:00", "salida": "16:00"},
+				{"dia": "jueves", "entrada": "08:00", "salida": "16:00"},
+				{"dia": "viernes", "entrada": "08:00", "salida": "16:00"},
+				{"dia": "sábado", "entrada": "08:00", "salida": "16:00"},
+				{"dia": "domingo", "entrada": "08:00", "salida": "16:00"}]}]}`,
+		},
+		10: {
+			`{"incidencias": [{"id": 1, "descripcion": "frenos"}]}`,
+			`{"incidencias": [{"id": 1, "descripcion": "frenos", "notas": [], "adjuntos": []}]}`,
+		},
+	}
+
+	if len(migraciones) != versionEsquema-1 {
+		t.Errorf("%d migraciones para llegar a la versión %d", len(migraciones), versionEsquema)
+	}
+	for i, m := range migraciones {
+		if m.Desde != i+1 {
+			t.Errorf("la migración %d parte de la versión %d", i, m.Desde)
+		}
+		paso, ok := pasos[m.Desde]
+		if !ok {
+			t.Errorf("migración %d -> %d sin caso de prueba", m.Desde, m.Desde+1)
+			continue
+		}
+		datos := jsonGenerico(t, paso.antes)
+		if err := m.Aplicar(datos); err != nil {
+			t.Errorf("migración %d -> %d: %v", m.Desde, m.Desde+1, err)
+			continue
+		}
+		texto, err := json.Marshal(datos)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if obtenido, esperado := jsonGenerico(t, string(texto)), jsonGenerico(t, paso.despues); !reflect.DeepEqual(obtenido, esperado) {
+			t.Errorf("migración %d -> %d:\n obtenido %s\n esperado %s", m.Desde, m.Desde+1, texto, paso.despues)
+		}
+	}
+}
+
+// Una instantánea de la versión 1 pasa por todas las migraciones y se
+// importa con los datos que tenía.
+func TestMigrarInstantaneaVersion1(t *testing.T) {
+	v1 := `{
+		"version": 1, "fecha": "2024-02-01T10:00:00Z",
+		"contadores": {"cliente": 2, "incidencia": 2, "mecanico": 2},
+		"taller": {"plazas_por_mecanico": 2, "plazas_ocupadas": [1]},
+		"clientes": [{"id": 1, "nombre": "Marta", "telefono": "600000000", "email": "", "matricula": "1234BCD"}],
+		"vehiculos": [{"matricula": "1234BCD", "marca": "Seat", "modelo": "Ibiza", "fecha_entrada": "01/02/2024",
+		               "fecha_salida": "", "incidencia_id": 1, "en_taller": true, "numero_plaza": 1}],
+		"incidencias": [{"id": 1, "mecanicos": [1], "tipo": "mecánica", "prioridad": "alta",
+		                 "descripcion": "frenos", "estado": "en proceso"}],
+		"mecanicos": [{"id": 1, "nombre": "Ana", "especialidad": "mecánica", "anios_exp": 5, "activo": true}]
+	}`
+	ruta := filepath.Join(t.TempDir(), "v1.json")
+	if err := os.WriteFile(ruta, []byte(v1), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := leerSnapshot(ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Version != versionEsquema {
+		t.Errorf("versión %d tras migrar, se esperaba %d", s.Version, versionEsquema)
+	}
+	e, err := s.construir()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(e.clientes) != 1 || len(e.vehiculos) != 1 || len(e.incidencias) != 1 || len(e.mecanicos) != 1 {
+		t.Fatalf("%d clientes, %d vehículos, %d incidencias, %d mecánicos",
+			len(e.clientes), len(e.vehiculos), len(e.incidencias), len(e.mecanicos))
+	}
+	c, v, inc, m := e.clientes[0], e.vehiculos[0], e.incidencias[0], e.mecanicos[0]
+	if c.Vehiculo != v || c.Version != 1 || c.SinAvisos {
+		t.Errorf("cliente: vehículo %v, versión %d, sin avisos %v", c.Vehiculo, c.Version, c.SinAvisos)
+	}
+	if len(v.Incidencias) != 1 || v.Incidencias[0] != inc || v.Orden != 1 || !v.EnTaller || v.EntradaPlaza.IsZero() {
+		t.Errorf("vehículo: %d incidencias, orden %d, en taller %v, entrada en plaza %v",
+			len(v.Incidencias), v.Orden, v.EnTaller, v.EntradaPlaza)
+	}
+	if len(inc.Mecanicos) != 1 || inc.Mecanicos[0] != m || inc.Estado != estadoEnProceso || len(inc.Notas) != 0 {
+		t.Errorf("incidencia: %d mecánicos, estado %q, %d notas", len(inc.Mecanicos), inc.Estado, len(inc.Notas))
+	}
+	if len(m.Especialidades) != 1 || m.Especialidades[0] != (Especialidad{tipoMecanica, "experto"}) || len(m.Horario) != len(semana) {
+		t.Errorf("mecánico: especialidades %v, horario %s", m.Especialidades, formatearHorario(m.Horario))
+	}
+	if len(e.historial) != 1 || e.historial[0].Tipo != eventoEntradaPlaza || e.historial[0].Matricula != "1234BCD" {
+		t.Errorf("historial %v, se esperaba la entrada de 1234BCD", e.historial)
+	}
+}
+
+func TestMigrarDatosErrores(t *testing.T) {
+	casos := []struct {
+		nombre string
+		texto  string
+		error  string
+	}{
+		{"sin versión", `{"clientes": []}`, "versión de esquema válida"},
+		{"versión futura", fmt.Sprintf(`{"version": %d}`, versionEsquema+1), "más reciente"},
+		{"vehículo del cliente inexistente", `{"version": 1, "clientes": [{"id": 1, "matricula": "9999ZZZ"}], "vehiculos": []}`,
+			"migración 1 -> 2: cliente 1: vehículo 9999ZZZ no existe"},
+	}
+	for _, caso := range casos {
+		if _, _, err := migrarDatos([]byte(caso.texto)); err == nil || !strings.Contains(err.Error(), caso.error) {
+			t.Errorf("%s: error %v, se esperaba uno que dijera %q", caso.nombre, err, caso.error)
+		}
+	}
+}
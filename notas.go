@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Notas y ficheros adjuntos de las incidencias
+//
+// La descripción resume la avería; lo que va pasando (lo que dice el
+// cliente, lo que se ha probado, las piezas pedidas...) se anota en notas
+// con fecha y autor, que no se modifican ni se borran. Los adjuntos (fotos
+// de los daños, registros de la diagnosis...) se copian en un directorio
+// por incidencia dentro de directorioAdjuntos (opción -adjuntos); los datos
+// guardan sólo el nombre del fichero, su tipo, tamaño, quién lo subió y
+// cuándo. Las instantáneas y copias de seguridad no incluyen los ficheros.
+
+var (
+	directorioAdjuntos  = "adjuntos"
+	tamanoMaximoAdjunto = int64(10 << 20) // 10 MB
+)
+
+type Nota struct {
+	Fecha time.Time
+	Autor string
+	Texto string
+}
+
+type Adjunto struct {
+	Fichero     string // nombre en el directorio de la incidencia
+	Nombre      string // nombre original
+	Tipo        string // tipo MIME
+	Tamano      int64
+	Fecha       time.Time
+	Autor       string
+	Descripcion string
+}
+
+// textoNota la presenta como "19/10/2026 10:30, Juan: texto".
+func textoNota(n Nota) string {
+	return fmt.Sprintf("%s, %s: %s", n.Fecha.Format("02/01/2006 15:04"), n.Autor, n.Texto)
+}
+
+func textoAdjunto(a Adjunto) string {
+	texto := fmt.Sprintf("%s (%s, %s), %s, %s", a.Nombre, a.Tipo, textoTamano(a.Tamano), a.Autor, a.Fecha.Format("02/01/2006 15:04"))
+	if a.Descripcion != "" {
+		texto += ": " + a.Descripcion
+	}
+	return texto
+}
+
+func textoTamano(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// rutaAdjunto es donde está el fichero en el disco.
+func rutaAdjunto(inc *Incidencia, a Adjunto) string {
+	return filepath.Join(directorioAdjuntos, strconv.Itoa(inc.ID), a.Fichero)
+}
+
+// nombreFichero deja sólo el nombre, sin directorios ni caracteres que den
+// problemas en el disco.
+func nombreFichero(nombre string) string {
+	nombre = filepath.Base(strings.ReplaceAll(nombre, "\\", "/"))
+	nombre = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, nombre)
+	if nombre == "." || nombre == ".." || strings.TrimSpace(nombre) == "" {
+		return "adjunto"
+	}
+	return nombre
+}
+
+// adjuntoValido comprueba que el nombre en el disco no sale del directorio
+// de la incidencia (los datos pueden venir de una instantánea editada).
+func adjuntoValido(a Adjunto) error {
+	if a.Fichero == "" || a.Fichero != nombreFichero(a.Fichero) {
+		return fmt.Errorf("nombre de fichero %q no válido", a.Fichero)
+	}
+	if a.Nombre == "" || a.Autor == "" {
+		return errors.New("falta el nombre o el autor")
+	}
+	return nil
+}
+
+// Operaciones
+
+// anadirNota anota un texto en la incidencia con la fecha actual.
+func anadirNota(incidencia *Incidencia, autor, texto string) error {
+	autor, texto = strings.TrimSpace(autor), strings.TrimSpace(texto)
+	if autor == "" {
+		return errors.New("indique quién escribe la nota")
+	}
+	if texto == "" {
+		return errors.New("la nota no puede estar vacía")
+	}
+	return operacion(func() error {
+		// Lista nueva: si la operación falla se restaura la anterior.
+		incidencia.Notas = append(append([]Nota{}, incidencia.Notas...), Nota{time.Now(), autor, texto})
+		return guardar(incidencia)
+	})
+}
+
+// adjuntarArchivo copia el contenido en el directorio de la incidencia y
+// anota sus datos. El fichero se escribe antes de tomar el cerrojo y sólo
+// se le da su nombre definitivo dentro de la operación.
+func adjuntarArchivo(incidencia *Incidencia, autor, nombre, descripcion string, contenido io.Reader) (Adjunto, error) {
+	autor, descripcion = strings.TrimSpace(autor), strings.TrimSpace(descripcion)
+	if autor == "" {
+		return Adjunto{}, errors.New("indique quién adjunta el fichero")
+	}
+	directorio := filepath.Join(directorioAdjuntos, strconv.Itoa(incidencia.ID))
+	if err := os.MkdirAll(directorio, 0755); err != nil {
+		return Adjunto{}, err
+	}
+	temporal, err := os.CreateTemp(directorio, ".subida-*")
+	if err != nil {
+		return Adjunto{}, err
+	}
+	defer os.Remove(temporal.Name()) // no hace nada si ya se ha renombrado
+
+	var inicio [512]byte
+	leidos, _ := io.ReadFull(contenido, inicio[:])
+	tamano, err := io.Copy(temporal, io.MultiReader(
+		bytes.NewReader(inicio[:leidos]), io.LimitReader(contenido, tamanoMaximoAdjunto+1-int64(leidos))))
+	if cerrar := temporal.Close(); err == nil {
+		err = cerrar
+	}
+	switch {
+	case err != nil:
+		return Adjunto{}, err
+	case tamano == 0:
+		return Adjunto{}, errors.New("el fichero está vacío")
+	case tamano > tamanoMaximoAdjunto:
+		return Adjunto{}, fmt.Errorf("el fichero pasa del máximo de %s", textoTamano(tamanoMaximoAdjunto))
+	}
+
+	a := Adjunto{
+		Nombre:      nombreFichero(nombre),
+		Tipo:        http.DetectContentType(inicio[:leidos]),
+		Tamano:      tamano,
+		Fecha:       time.Now(),
+		Autor:       autor,
+		Descripcion: descripcion,
+	}
+	err = operacion(func() error {
+		if buscarIncidencia(incidencia.ID) != incidencia {
+			return errors.New("la incidencia ya no existe")
+		}
+		// Puede haber ficheros de adjuntos que ya no constan (por ejemplo,
+		// tras restaurar una copia anterior): no se sobrescriben.
+		for n := len(incidencia.Adjuntos) + 1; ; n++ {
+			a.Fichero = fmt.Sprintf("%d-%s", n, a.Nombre)
+			if _, err := os.Stat(rutaAdjunto(incidencia, a)); errors.Is(err, os.ErrNotExist) {
+				break
+			}
+		}
+		if err := os.Rename(temporal.Name(), rutaAdjunto(incidencia, a)); err != nil {
+			return err
+		}
+		incidencia.Adjuntos = append(append([]Adjunto{}, incidencia.Adjuntos...), a)
+		if err := guardar(incidencia); err != nil {
+			os.Remove(rutaAdjunto(incidencia, a))
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return Adjunto{}, err
+	}
+	return a, nil
+}
+
+// adjuntarFichero adjunta un fichero del disco local.
+func adjuntarFichero(incidencia *Incidencia, autor, ruta, descripcion string) (Adjunto, error) {
+	f, err := os.Open(ruta)
+	if err != nil {
+		return Adjunto{}, err
+	}
+	defer f.Close()
+	return adjuntarArchivo(incidencia, autor, filepath.Base(ruta), descripcion, f)
+}
+
+// borrarAdjuntos quita del disco los ficheros de una incidencia eliminada.
+func borrarAdjuntos(id int) error {
+	return os.RemoveAll(filepath.Join(directorioAdjuntos, strconv.Itoa(id)))
+}
+
+// adjuntoIncidencia devuelve el adjunto n (desde 1) de la incidencia.
+func adjuntoIncidencia(incidencia *Incidencia, n int) (Adjunto, error) {
+	if n < 1 || n > len(incidencia.Adjuntos) {
+		return Adjunto{}, errors.New("adjunto no encontrado")
+	}
+	return incidencia.Adjuntos[n-1], nil
+}
+
+// Páginas web
+
+type adjuntoWeb struct {
+	Adjunto
+	Numero      int
+	TextoTamano string
+	Imagen      bool
+}
+
+type paginaIncidenciaWeb struct {
+	paginaWeb
+	ID           int
+	Matricula    string
+	Tipo         TipoIncidencia
+	Prioridad    Prioridad
+	Estado       EstadoIncidencia
+	Descripcion  string
+	Mecanicos    string
+	Notas        []Nota
+	Adjuntos     []adjuntoWeb
+	TamanoMaximo string
+}
+
+func paginaIncidencia(w http.ResponseWriter, r *http.Request) {
+	mostrarIncidencia(w, r, nuevaPagina(r, "", "incidencias"))
+}
+
+func mostrarIncidencia(w http.ResponseWriter, r *http.Request, base paginaWeb) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	p := paginaIncidenciaWeb{paginaWeb: base, TamanoMaximo: textoTamano(tamanoMaximoAdjunto)}
+	p.Titulo = fmt.Sprintf("Incidencia %d", inc.ID)
+	consultar(func() {
+		p.ID, p.Tipo, p.Prioridad, p.Estado, p.Descripcion = inc.ID, inc.Tipo, inc.Prioridad, inc.Estado, inc.Descripcion
+		p.Mecanicos = idsMecanicos(inc.Mecanicos)
+		if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+			p.Matricula = v.Matricula
+		}
+		p.Notas = append(p.Notas, inc.Notas...)
+		for i, a := range inc.Adjuntos {
+			p.Adjuntos = append(p.Adjuntos, adjuntoWeb{a, i + 1, textoTamano(a.Tamano), strings.HasPrefix(a.Tipo, "image/")})
+		}
+	})
+	renderizar(w, "incidencia.html", p)
+}
+
+func anadirNotaWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		redirigir(w, r, "/incidencias", "", err)
+		return
+	}
+	if err := anadirNota(inc, campoFormulario(r, "autor"), campoFormulario(r, "texto")); err != nil {
+		rechazar(w, r, mostrarIncidencia, nuevaPagina(r, "", "incidencias"), err)
+		return
+	}
+	redirigir(w, r, fmt.Sprintf("/incidencias/%d", inc.ID), "Nota añadida", nil)
+}
+
+func adjuntarWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		redirigir(w, r, "/incidencias", "", err)
+		return
+	}
+	ruta := fmt.Sprintf("/incidencias/%d", inc.ID)
+	// Margen para el resto de campos del formulario
+	r.Body = http.MaxBytesReader(w, r.Body, tamanoMaximoAdjunto+64<<10)
+	fichero, cabecera, err := r.FormFile("fichero")
+	if err != nil {
+		var demasiado *http.MaxBytesError
+		if errors.As(err, &demasiado) {
+			err = fmt.Errorf("el fichero pasa del máximo de %s", textoTamano(tamanoMaximoAdjunto))
+		} else {
+			err = errors.New("no se ha recibido ningún fichero")
+		}
+		redirigir(w, r, ruta, "", err)
+		return
+	}
+	defer fichero.Close()
+	a, err := adjuntarArchivo(inc, campoFormulario(r, "autor"), cabecera.Filename, campoFormulario(r, "descripcion"), fichero)
+	redirigir(w, r, ruta, fmt.Sprintf("Adjuntado %s (%s)", a.Nombre, textoTamano(a.Tamano)), err)
+}
+
+// descargarAdjuntoWeb envía el fichero. Sólo se muestran en el navegador
+// las imágenes, los PDF y el texto; el resto se descarga, para que un HTML
+// subido como adjunto no se ejecute dentro de la aplicación.
+func descargarAdjuntoWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	n, _ := strconv.Atoi(r.PathValue("n"))
+	var a Adjunto
+	var ruta string
+	consultar(func() {
+		if a, err = adjuntoIncidencia(inc, n); err == nil {
+			ruta = rutaAdjunto(inc, a)
+		}
+	})
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(ruta)
+	if err != nil {
+		http.Error(w, "no se puede leer el fichero: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	disposicion := "attachment"
+	if strings.HasPrefix(a.Tipo, "image/") || strings.HasPrefix(a.Tipo, "text/plain") || a.Tipo == "application/pdf" {
+		disposicion = "inline"
+	}
+	w.Header().Set("Content-Type", a.Tipo)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposicion, a.Nombre))
+	http.ServeContent(w, r, a.Nombre, a.Fecha, f)
+}
+
+// Funciones de menú
+
+func notasIncidencia() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("=== NOTAS Y ADJUNTOS DE UNA INCIDENCIA ===")
+
+	id, _ := strconv.Atoi(leerCriterio(reader, "ID de la incidencia: "))
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		fmt.Println("Error: Incidencia no encontrada")
+		pausar()
+		return
+	}
+
+	for {
+		limpiarPantalla()
+		var numAdjuntos int
+		consultar(func() {
+			fmt.Printf("=== INCIDENCIA %d ===\n", incidencia.ID)
+			fmt.Printf("%s, %s, %s: %s\n", incidencia.Tipo, incidencia.Prioridad, incidencia.Estado, incidencia.Descripcion)
+			fmt.Println("\n--- Notas ---")
+			if len(incidencia.Notas) == 0 {
+				fmt.Println("Sin notas")
+			}
+			for _, n := range incidencia.Notas {
+				fmt.Println(textoNota(n))
+			}
+			fmt.Println("\n--- Adjuntos ---")
+			if len(incidencia.Adjuntos) == 0 {
+				fmt.Println("Sin adjuntos")
+			}
+			for i, a := range incidencia.Adjuntos {
+				fmt.Printf("%d. %s\n", i+1, textoAdjunto(a))
+			}
+			numAdjuntos = len(incidencia.Adjuntos)
+		})
+
+		fmt.Println("\n1. Añadir nota")
+		fmt.Println("2. Adjuntar fichero")
+		fmt.Println("3. Copiar un adjunto a otro fichero")
+		fmt.Println("0. Volver")
+		var opcion int
+		fmt.Print("\nSeleccione una opción: ")
+		fmt.Scanf("%d", &opcion)
+		fmt.Scanln()
+
+		var err error
+		switch opcion {
+		case 1:
+			autor := leerCriterio(reader, "Autor: ")
+			err = anadirNota(incidencia, autor, leerCriterio(reader, "Nota: "))
+		case 2:
+			autor := leerCriterio(reader, "Autor: ")
+			ruta := leerCriterio(reader, "Fichero a adjuntar: ")
+			var a Adjunto
+			if a, err = adjuntarFichero(incidencia, autor, ruta, leerCriterio(reader, "Descripción (opcional): ")); err == nil {
+				fmt.Printf("Adjuntado %s (%s)\n", a.Nombre, textoTamano(a.Tamano))
+				pausar()
+			}
+		case 3:
+			n, _ := strconv.Atoi(leerCriterio(reader, "Número del adjunto: "))
+			if n < 1 || n > numAdjuntos {
+				err = errors.New("adjunto no válido")
+				break
+			}
+			var origen string
+			var a Adjunto
+			consultar(func() {
+				if a, err = adjuntoIncidencia(incidencia, n); err == nil {
+					origen = rutaAdjunto(incidencia, a)
+				}
+			})
+			var datos []byte
+			if err == nil {
+				datos, err = os.ReadFile(origen)
+			}
+			if err == nil {
+				guardarDocumento(reader, a.Nombre, datos)
+				pausar()
+			}
+		case 0:
+			return
+		default:
+			err = errors.New("opción inválida")
+		}
+		if err != nil {
+			fmt.Println("Error:", err)
+			pausar()
+		}
+	}
+}
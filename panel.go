@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Panel en directo del taller
+//
+// Mapa de plazas pensado para dejarlo en una pantalla de la nave: cada plaza
+// muestra el vehículo, el tipo y la prioridad de su incidencia, los mecánicos
+// asignados y cuánto tiempo lleva dentro. Se redibuja cada vez que una
+// operación cambia el estado (ver cambios en concurrencia.go) y cada cierto
+// tiempo para que avance el tiempo en plaza. Hay versión de terminal (aquí) y
+// web (web.go).
+
+// refrescoPanel es cada cuánto se redibuja el panel aunque no haya cambios.
+const refrescoPanel = 30 * time.Second
+
+type plazaPanel struct {
+	Numero    int
+	Ocupada   bool
+	Matricula string
+	Vehiculo  string
+	Tipo      string
+	Prioridad Prioridad
+	Urgencia  Prioridad // prioridad de serie equivalente, para los colores
+	Estado    EstadoIncidencia
+	Mecanicos []string
+	Tiempo    string // tiempo en plaza, vacío si no se sabe
+}
+
+type mecanicoPanel struct {
+	Nombre         string
+	Especialidades string
+	Incidencias    int
+}
+
+type estadoPanel struct {
+	Generado  time.Time
+	Total     int
+	Ocupadas  int
+	Plazas    []plazaPanel
+	Mecanicos []mecanicoPanel // sólo los que trabajan hoy
+}
+
+// datosPanel recoge el estado del taller para dibujar el panel.
+func datosPanel() *estadoPanel {
+	e := &estadoPanel{Generado: time.Now()}
+	consultar(func() {
+		e.Total = calcularTotalPlazas()
+		e.Ocupadas = contarPlazasOcupadas()
+
+		ocupantes := map[int]*Vehiculo{}
+		for _, v := range almacen.Vehiculos().EnTaller() {
+			ocupantes[v.NumeroPlaza] = v
+		}
+		for i := 1; i <= ultimaPlaza(); i++ {
+			plaza := plazaPanel{Numero: i}
+			if v := ocupantes[i]; v != nil {
+				plaza.Ocupada = true
+				plaza.Matricula = v.Matricula
+				plaza.Vehiculo = v.Marca + " " + v.Modelo
+				if !v.EntradaPlaza.IsZero() {
+					plaza.Tiempo = formatearDuracion(e.Generado.Sub(v.EntradaPlaza))
+				}
+				if lineas := lineasOrden(v, v.Orden); len(lineas) > 0 {
+					var tipos []string
+					for _, inc := range lineas {
+						tipos = append(tipos, string(inc.Tipo))
+						for _, m := range inc.Mecanicos {
+							plaza.Mecanicos = append(plaza.Mecanicos, m.Nombre)
+						}
+					}
+					plaza.Tipo = strings.Join(tipos, ", ")
+					plaza.Prioridad, plaza.Estado = prioridadOrden(lineas), estadoOrden(lineas)
+					plaza.Urgencia = prioridadDeSerie(plaza.Prioridad)
+				}
+			}
+			e.Plazas = append(e.Plazas, plaza)
+		}
+
+		for _, m := range almacen.Mecanicos().Todos() {
+			if disponibleEl(m, e.Generado) {
+				e.Mecanicos = append(e.Mecanicos, mecanicoPanel{m.Nombre, textoEspecialidades(m.Especialidades), len(m.Incidencias)})
+			}
+		}
+	})
+	return e
+}
+
+// formatearDuracion da el tiempo en plaza con la precisión que interesa en
+// la nave: minutos el primer día, horas a partir de ahí.
+func formatearDuracion(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "menos de 1 min"
+	case d < time.Hour:
+		return fmt.Sprintf("%d min", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%d h %d min", int(d.Hours()), int(d.Minutes())%60)
+	default:
+		return fmt.Sprintf("%d d %d h", int(d.Hours())/24, int(d.Hours())%24)
+	}
+}
+
+// Versión de terminal
+
+const anchoCasilla = 28
+
+func colorPrioridad(prioridad Prioridad) string {
+	switch prioridadDeSerie(prioridad) {
+	case prioridadAlta:
+		return ansiRojo
+	case prioridadMedia:
+		return ansiAmarillo
+	}
+	return ansiVerde
+}
+
+// casillaPlaza devuelve las líneas de la casilla de una plaza, ya con el
+// ancho de anchoCasilla.
+func casillaPlaza(p plazaPanel) []string {
+	interior := anchoCasilla - 4
+	linea := func(texto, color string) string {
+		if color == "" {
+			return "│ " + ajustar(texto, interior) + " │"
+		}
+		return "│ " + color + ajustar(texto, interior) + ansiNormal + " │"
+	}
+
+	titulo := fmt.Sprintf(" Plaza %d ", p.Numero)
+	lineas := []string{"┌" + titulo + strings.Repeat("─", anchoCasilla-2-utf8.RuneCountInString(titulo)) + "┐"}
+	if !p.Ocupada {
+		lineas = append(lineas,
+			linea("Libre", ansiTenue), linea("", ""), linea("", ""), linea("", ""))
+	} else {
+		incidencia, color := "Sin incidencia", ansiTenue
+		if p.Tipo != "" {
+			incidencia = fmt.Sprintf("%s · %s · %s", p.Tipo, p.Prioridad, p.Estado)
+			color = colorPrioridad(p.Prioridad)
+		}
+		mecanicos := strings.Join(p.Mecanicos, ", ")
+		if mecanicos == "" {
+			mecanicos = "Sin mecánicos"
+		}
+		tiempo := "Tiempo en plaza desconocido"
+		if p.Tiempo != "" {
+			tiempo = p.Tiempo + " en plaza"
+		}
+		lineas = append(lineas,
+			linea(p.Matricula+" "+p.Vehiculo, ansiNegrita),
+			linea(incidencia, color),
+			linea(mecanicos, ""),
+			linea(tiempo, ansiTenue))
+	}
+	return append(lineas, "└"+strings.Repeat("─", anchoCasilla-2)+"┘")
+}
+
+// dibujarPanel escribe el panel completo ajustado a filas x columnas.
+func dibujarPanel(w io.Writer, e *estadoPanel, filas, columnas int) {
+	var lineas []string
+	cabecera := fmt.Sprintf(" PANEL DEL TALLER   %s   Plazas ocupadas: %d de %d",
+		e.Generado.Format("15:04:05"), e.Ocupadas, e.Total)
+	lineas = append(lineas, ansiInverso+ajustar(cabecera, columnas)+ansiNormal, "")
+
+	porFila := columnas / (anchoCasilla + 1)
+	if porFila < 1 {
+		porFila = 1
+	}
+	for inicio := 0; inicio < len(e.Plazas); inicio += porFila {
+		fin := inicio + porFila
+		if fin > len(e.Plazas) {
+			fin = len(e.Plazas)
+		}
+		var casillas [][]string
+		for _, p := range e.Plazas[inicio:fin] {
+			casillas = append(casillas, casillaPlaza(p))
+		}
+		for i := range casillas[0] {
+			var partes []string
+			for _, c := range casillas {
+				partes = append(partes, c[i])
+			}
+			lineas = append(lineas, strings.Join(partes, " "))
+		}
+	}
+	if len(e.Plazas) == 0 {
+		lineas = append(lineas, " No hay plazas hoy: ningún mecánico en activo tiene turno")
+	}
+
+	var mecanicos []string
+	for _, m := range e.Mecanicos {
+		mecanicos = append(mecanicos, fmt.Sprintf("%s (%s; %d)", m.Nombre, m.Especialidades, m.Incidencias))
+	}
+	if len(mecanicos) > 0 {
+		lineas = append(lineas, "", " Mecánicos de turno hoy: "+strings.Join(mecanicos, "  "))
+	}
+
+	// Se reserva la última fila para la ayuda.
+	if len(lineas) > filas-1 {
+		lineas = lineas[:filas-1]
+	}
+	var b strings.Builder
+	b.WriteString(ansiInicio)
+	for _, l := range lineas {
+		b.WriteString(l + ansiBorrarFin + "\r\n")
+	}
+	for i := len(lineas); i < filas-1; i++ {
+		b.WriteString(ansiBorrarFin + "\r\n")
+	}
+	b.WriteString(ansiInverso + ajustar(" Se actualiza automáticamente   q salir", columnas) + ansiNormal + ansiBorrarFin)
+	io.WriteString(w, b.String())
+}
+
+// mostrarPanelTerminal muestra el panel hasta que se pulsa q, Esc o Ctrl+C.
+func mostrarPanelTerminal() error {
+	terminal, err := abrirTerminal()
+	if err != nil {
+		return err
+	}
+	defer terminal.cerrar()
+	// Las lecturas vuelven cada medio segundo aunque no se pulse nada, para
+	// poder atender a los cambios sin dejar una lectura pendiente al salir.
+	if _, err := stty("min", "0", "time", "5"); err != nil {
+		return err
+	}
+
+	for {
+		aviso := cambios.esperar()
+		filas, columnas := terminal.tamano()
+		dibujarPanel(os.Stdout, datosPanel(), filas, columnas)
+
+		limite := time.Now().Add(refrescoPanel)
+		for redibujar := false; !redibujar; {
+			teclas, err := terminal.leerTeclas()
+			if err != nil && err != io.EOF {
+				return err
+			}
+			for _, t := range teclas {
+				if t.codigo == teclaEsc || t.codigo == teclaCtrlC ||
+					(t.codigo == teclaCaracter && (t.caracter == 'q' || t.caracter == 'Q')) {
+					return nil
+				}
+			}
+			select {
+			case <-aviso:
+				redibujar = true
+			default:
+				redibujar = time.Now().After(limite)
+			}
+		}
+	}
+}
+
+func visualizarPanelTaller() {
+	if err := mostrarPanelTerminal(); err != nil {
+		limpiarPantalla()
+		fmt.Println("Error:", err)
+		pausar()
+	}
+}
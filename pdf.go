@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Generación de PDF
+//
+// Escritor mínimo de PDF, sin dependencias: páginas A4 con texto en las
+// fuentes estándar Helvetica y Helvetica-Bold (que cualquier visor tiene, así
+// que no hace falta incrustarlas) y líneas horizontales. Es todo lo que
+// necesitan los documentos del taller (ver documentos.go). El texto se
+// escribe en WinAnsiEncoding, que cubre las tildes, la ñ y el símbolo del
+// euro; lo que no cabe en esa codificación sale como "?".
+
+const (
+	anchoPaginaPDF = 595.0 // A4 en puntos
+	altoPaginaPDF  = 842.0
+	margenPDF      = 50.0
+	anchoUtilPDF   = anchoPaginaPDF - 2*margenPDF
+	// anchoLetraPDF es el ancho medio de un carácter de Helvetica en
+	// proporción al tamaño de letra; basta para partir líneas y columnas.
+	anchoLetraPDF = 0.5
+)
+
+type documentoPDF struct {
+	paginas []*bytes.Buffer
+	y       float64 // línea base de la siguiente línea de texto
+}
+
+func nuevoDocumentoPDF() *documentoPDF {
+	d := &documentoPDF{}
+	d.nuevaPagina()
+	return d
+}
+
+func (d *documentoPDF) nuevaPagina() {
+	d.paginas = append(d.paginas, &bytes.Buffer{})
+	d.y = altoPaginaPDF - margenPDF
+}
+
+func (d *documentoPDF) actual() *bytes.Buffer { return d.paginas[len(d.paginas)-1] }
+
+// reservar pasa a una página nueva si no quedan alto puntos en la actual.
+func (d *documentoPDF) reservar(alto float64) {
+	if d.y-alto < margenPDF {
+		d.nuevaPagina()
+	}
+}
+
+// escribir pone el texto en la posición indicada sin mover la línea actual.
+func (d *documentoPDF) escribir(x, y, tamano float64, negrita bool, texto string) {
+	fuente := "F1"
+	if negrita {
+		fuente = "F2"
+	}
+	fmt.Fprintf(d.actual(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", fuente, tamano, x, y, textoPDF(texto))
+}
+
+// parrafo escribe el texto partido en líneas que caben en el ancho útil.
+func (d *documentoPDF) parrafo(texto string, tamano float64, negrita bool) {
+	for _, linea := range partirTexto(texto, caracteresEnAncho(anchoUtilPDF, tamano)) {
+		d.reservar(tamano * 1.4)
+		d.y -= tamano * 1.4
+		d.escribir(margenPDF, d.y, tamano, negrita, linea)
+	}
+}
+
+func (d *documentoPDF) titulo(texto string) {
+	d.parrafo(texto, 16, true)
+	d.espacio(4)
+}
+
+func (d *documentoPDF) seccion(texto string) {
+	d.espacio(8)
+	d.parrafo(texto, 12, true)
+	d.separador()
+}
+
+// campo escribe "etiqueta: valor" con la etiqueta en negrita; si el valor
+// es largo continúa debajo, sangrado.
+func (d *documentoPDF) campo(etiqueta, valor string) {
+	const tamano, sangria = 10.0, 130.0
+	lineas := partirTexto(valor, caracteresEnAncho(anchoUtilPDF-sangria, tamano))
+	if len(lineas) == 0 {
+		lineas = []string{""}
+	}
+	for i, linea := range lineas {
+		d.reservar(tamano * 1.4)
+		d.y -= tamano * 1.4
+		if i == 0 {
+			d.escribir(margenPDF, d.y, tamano, true, etiqueta)
+		}
+		d.escribir(margenPDF+sangria, d.y, tamano, false, linea)
+	}
+}
+
+// tabla escribe una fila por línea; anchos son proporciones del ancho útil.
+// Las celdas que no caben se recortan.
+func (d *documentoPDF) tabla(columnas []string, anchos []float64, filas [][]string) {
+	const tamano = 9.0
+	fila := func(celdas []string, negrita bool) {
+		d.reservar(tamano * 1.5)
+		d.y -= tamano * 1.5
+		x := margenPDF
+		for i, celda := range celdas {
+			ancho := anchos[i] * anchoUtilPDF
+			d.escribir(x, d.y, tamano, negrita, recortar(celda, caracteresEnAncho(ancho-6, tamano)))
+			x += ancho
+		}
+	}
+	fila(columnas, true)
+	d.separador()
+	for _, celdas := range filas {
+		fila(celdas, false)
+	}
+}
+
+func (d *documentoPDF) separador() {
+	d.reservar(6)
+	d.y -= 4
+	fmt.Fprintf(d.actual(), "0.5 w %.2f %.2f m %.2f %.2f l S\n", margenPDF, d.y, anchoPaginaPDF-margenPDF, d.y)
+	d.y -= 2
+}
+
+func (d *documentoPDF) espacio(alto float64) {
+	d.reservar(alto)
+	d.y -= alto
+}
+
+// bytes devuelve el fichero PDF completo, con el número de página al pie.
+func (d *documentoPDF) bytes() []byte {
+	var b bytes.Buffer
+	var desplazamientos []int
+	objeto := func(contenido string) {
+		desplazamientos = append(desplazamientos, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", len(desplazamientos), contenido)
+	}
+
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1 catálogo, 2 árbol de páginas, 3 y 4 fuentes; después, por cada
+	// página, el objeto página y su contenido.
+	var hijos []string
+	for i := range d.paginas {
+		hijos = append(hijos, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	objeto("<< /Type /Catalog /Pages 2 0 R >>")
+	objeto(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(hijos, " "), len(d.paginas)))
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	objeto("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, pagina := range d.paginas {
+		contenido := pagina.String() + fmt.Sprintf("BT /F1 8.0 Tf %.2f %.2f Td (%s) Tj ET\n",
+			anchoPaginaPDF-margenPDF-60, margenPDF/2, textoPDF(fmt.Sprintf("Página %d de %d", i+1, len(d.paginas))))
+		objeto(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			anchoPaginaPDF, altoPaginaPDF, 6+2*i))
+		objeto(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(contenido), contenido))
+	}
+
+	inicioXref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(desplazamientos)+1)
+	for _, desplazamiento := range desplazamientos {
+		fmt.Fprintf(&b, "%010d 00000 n \n", desplazamiento)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(desplazamientos)+1, inicioXref)
+	return b.Bytes()
+}
+
+// textoPDF convierte el texto a WinAnsiEncoding y escapa los caracteres
+// especiales de las cadenas PDF.
+func textoPDF(texto string) string {
+	var b strings.Builder
+	for _, r := range texto {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '€':
+			b.WriteByte(0x80)
+		case r == '…':
+			b.WriteByte(0x85)
+		case r == '\t' || r == '\n':
+			b.WriteByte(' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func caracteresEnAncho(ancho, tamano float64) int {
+	return int(ancho / (tamano * anchoLetraPDF))
+}
+
+// partirTexto reparte las palabras en líneas de como mucho max caracteres;
+// las palabras más largas se cortan.
+func partirTexto(texto string, max int) []string {
+	if max < 1 {
+		max = 1
+	}
+	var lineas []string
+	for _, parrafo := range strings.Split(texto, "\n") {
+		linea := ""
+		for _, palabra := range strings.Fields(parrafo) {
+			for len([]rune(palabra)) > max {
+				if linea != "" {
+					lineas = append(lineas, linea)
+					linea = ""
+				}
+				lineas = append(lineas, string([]rune(palabra)[:max]))
+				palabra = string([]rune(palabra)[max:])
+			}
+			switch {
+			case linea == "":
+				linea = palabra
+			case len([]rune(linea))+1+len([]rune(palabra)) <= max:
+				linea += " " + palabra
+			default:
+				lineas = append(lineas, linea)
+				linea = palabra
+			}
+		}
+		if linea != "" {
+			lineas = append(lineas, linea)
+		}
+	}
+	return lineas
+}
+
+func recortar(texto string, max int) string {
+	runas := []rune(texto)
+	if len(runas) <= max {
+		return texto
+	}
+	if max < 1 {
+		return ""
+	}
+	return string(runas[:max-1]) + "…"
+}
@@ -2,10 +2,14 @@ package main
 
 import (
 	"bufio"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"os/exec"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -13,11 +17,13 @@ import (
 // Estructuras del sistema
 
 type Cliente struct {
-	ID       int
-	Nombre   string
-	Telefono string
-	Email    string
-	Vehiculo *Vehiculo
+	ID        int
+	Nombre    string
+	Telefono  string
+	Email     string
+	Vehiculo  *Vehiculo
+	SinAvisos bool // no quiere recibir avisos (ver avisos.go)
+	Version   int  // ver versiones.go
 }
 
 type Vehiculo struct {
@@ -26,26 +32,45 @@ type Vehiculo struct {
 	Modelo       string
 	FechaEntrada string
 	FechaSalida  string
-	Incidencia   *Incidencia
+	Incidencias  []*Incidencia // todas las del vehículo, de la más antigua a la más nueva
+	Orden        int           // orden de trabajo de la visita en curso (0 si no hay)
 	EnTaller     bool
 	NumeroPlaza  int
+	EntradaPlaza time.Time // cuándo ocupó la plaza actual (cero si no se sabe)
+	EstadoPago   string    // de la última recogida (ver entregarVehiculo)
+	RecogidoPor  string
+	Version      int
 }
 
 type Incidencia struct {
 	ID          int
 	Mecanicos   []*Mecanico
-	Tipo        string
-	Prioridad   string
+	Tipo        TipoIncidencia
+	Prioridad   Prioridad
 	Descripcion string
-	Estado      string
+	Estado      EstadoIncidencia
+	Orden       int // orden de trabajo a la que pertenece (ver lineasOrden)
+	Notas       []Nota
+	Adjuntos    []Adjunto // ver notas.go
+	Version     int
 }
 type Mecanico struct {
-	ID           int
-	Nombre       string
-	Especialidad string
-	AniosExp     int
-	Activo       bool
-	Incidencias  []*Incidencia
+	ID             int
+	Nombre         string
+	Especialidades []Especialidad
+	AniosExp       int
+	Activo         bool       // en la plantilla; qué días trabaja, ver horarios.go
+	Horario        []Turno    // de lunes a domingo
+	Ausencias      []Ausencia // por fecha de inicio
+	Incidencias    []*Incidencia
+	Version        int
+}
+
+// Especialidad es un tipo de incidencia que atiende el mecánico y su nivel
+// en él (ver nivelesEspecialidad).
+type Especialidad struct {
+	Tipo  TipoIncidencia
+	Nivel string
 }
 
 type Taller struct {
@@ -55,17 +80,14 @@ type Taller struct {
 	TotalPlazas       int
 }
 
-// Variables globales
+// Variables globales (las entidades se guardan en el almacén, ver
+// repositorio.go). Se modifican sólo dentro de operacion (ver concurrencia.go).
 var (
-	clientes    []*Cliente
-	vehiculos   []*Vehiculo
-	incidencias []*Incidencia
-	mecanicos   []*Mecanico
-	taller      Taller
-
-	contadorCliente    = 1
-	contadorIncidencia = 1
-	contadorMecanico   = 1
+	taller Taller
+
+	contadorCliente    contadorID
+	contadorIncidencia contadorID
+	contadorMecanico   contadorID
 )
 
 // Funciones auxiliares
@@ -90,14 +112,21 @@ func obtenerFechaActual() string {
 	return time.Now().Format("02/01/2006")
 }
 
+// calcularTotalPlazas devuelve las plazas de hoy (ver plazasEl).
 func calcularTotalPlazas() int {
-	total := 0
-	for _, m := range mecanicos {
-		if m.Activo {
-			total += taller.PlazasPorMecanico
+	return plazasEl(time.Now())
+}
+
+// ultimaPlaza es hasta dónde hay que mostrar las plazas: las de hoy y, si
+// hoy trabajan menos mecánicos, las que siguen ocupadas por encima.
+func ultimaPlaza() int {
+	ultima := calcularTotalPlazas()
+	for plaza, ocupada := range taller.PlazasOcupadas {
+		if ocupada && plaza > ultima {
+			ultima = plaza
 		}
 	}
-	return total
+	return ultima
 }
 
 func contarPlazasOcupadas() int {
@@ -110,6 +139,786 @@ func contarPlazasOcupadas() int {
 	return contador
 }
 
+// Catálogos de valores válidos (los de las incidencias están en catalogos.go)
+
+var (
+	estadosPago         = []string{"pendiente", "pagado", "sin cargo"}
+	nivelesEspecialidad = []string{"básico", "intermedio", "experto"}
+)
+
+// trabajoTerminado indica si los mecánicos ya han acabado con la incidencia,
+// aunque el cliente todavía no haya recogido el vehículo.
+func trabajoTerminado(inc *Incidencia) bool { return estadoTerminado(inc.Estado) }
+
+func estadoTerminado(estado EstadoIncidencia) bool {
+	return estado == estadoListaParaRecoger || estado == estadoCerrada
+}
+
+// Órdenes de trabajo
+//
+// Cada visita de un vehículo tiene una orden de trabajo con una o varias
+// incidencias (las líneas de la orden), cada una con su tipo, sus mecánicos
+// y su estado. La orden se numera con el ID de su primera incidencia. El
+// vehículo guarda la de la visita en curso hasta que el cliente lo recoge, y
+// no se puede entregar mientras quede alguna línea sin terminar.
+
+// lineasOrden devuelve las incidencias del vehículo que forman la orden.
+func lineasOrden(v *Vehiculo, orden int) []*Incidencia {
+	var lineas []*Incidencia
+	for _, inc := range v.Incidencias {
+		if orden != 0 && inc.Orden == orden {
+			lineas = append(lineas, inc)
+		}
+	}
+	return lineas
+}
+
+// estadoOrden es el estado de la línea más atrasada.
+func estadoOrden(lineas []*Incidencia) EstadoIncidencia {
+	menor := len(estadosIncidencia) - 1
+	for _, inc := range lineas {
+		for i, e := range estadosIncidencia {
+			if e == inc.Estado && i < menor {
+				menor = i
+			}
+		}
+	}
+	return estadosIncidencia[menor]
+}
+
+// prioridadOrden es la prioridad más alta de las líneas.
+func prioridadOrden(lineas []*Incidencia) Prioridad {
+	var prioridad Prioridad
+	for _, inc := range lineas {
+		if prioridad == "" || rangoPrioridad(inc.Prioridad) > rangoPrioridad(prioridad) {
+			prioridad = inc.Prioridad
+		}
+	}
+	return prioridad
+}
+
+// resumenOrden describe las líneas en una sola línea de texto.
+func resumenOrden(lineas []*Incidencia) string {
+	var partes []string
+	for _, inc := range lineas {
+		partes = append(partes, fmt.Sprintf("#%d %s (%s)", inc.ID, inc.Tipo, inc.Estado))
+	}
+	return strings.Join(partes, ", ")
+}
+
+// ordenTerminada indica si ya no queda ninguna línea de la orden en curso
+// por terminar, es decir, si el vehículo se puede entregar.
+func ordenTerminada(v *Vehiculo) bool {
+	for _, inc := range lineasOrden(v, v.Orden) {
+		if !trabajoTerminado(inc) {
+			return false
+		}
+	}
+	return true
+}
+
+// Especialidades de los mecánicos
+
+// nivelMecanico devuelve el nivel del mecánico en el tipo de incidencia, o
+// "" si no tiene esa especialidad.
+func nivelMecanico(m *Mecanico, tipo TipoIncidencia) string {
+	for _, e := range m.Especialidades {
+		if e.Tipo == tipo {
+			return e.Nivel
+		}
+	}
+	return ""
+}
+
+// rangoNivel ordena los niveles de menor a mayor; sin nivel es -1.
+func rangoNivel(nivel string) int {
+	for i, n := range nivelesEspecialidad {
+		if n == nivel {
+			return i
+		}
+	}
+	return -1
+}
+
+// cualificado indica si el mecánico tiene la especialidad de la incidencia
+// con el nivel que pide su prioridad.
+func cualificado(m *Mecanico, inc *Incidencia) bool {
+	nivel := nivelMecanico(m, inc.Tipo)
+	return nivel != "" && rangoNivel(nivel) >= rangoNivel(nivelMinimo[inc.Prioridad])
+}
+
+// textoEspecialidades las presenta para los listados: "mecánica (experto), ...".
+func textoEspecialidades(especialidades []Especialidad) string {
+	var partes []string
+	for _, e := range especialidades {
+		partes = append(partes, fmt.Sprintf("%s (%s)", e.Tipo, e.Nivel))
+	}
+	return strings.Join(partes, ", ")
+}
+
+// formatearEspecialidades las escribe como las lee leerEspecialidades.
+func formatearEspecialidades(especialidades []Especialidad) string {
+	var partes []string
+	for _, e := range especialidades {
+		partes = append(partes, string(e.Tipo)+":"+e.Nivel)
+	}
+	return strings.Join(partes, "; ")
+}
+
+// leerEspecialidades interpreta una lista como "mecánica:experto; eléctrica".
+// Si falta el nivel se entiende el más bajo.
+func leerEspecialidades(texto string) ([]Especialidad, error) {
+	var especialidades []Especialidad
+	for _, parte := range strings.FieldsFunc(texto, func(r rune) bool { return r == ';' || r == ',' }) {
+		tipo, nivel, _ := strings.Cut(parte, ":")
+		if strings.TrimSpace(nivel) == "" {
+			nivel = nivelesEspecialidad[0]
+		}
+		especialidades = append(especialidades, Especialidad{TipoIncidencia(strings.TrimSpace(tipo)), strings.TrimSpace(nivel)})
+	}
+	return normalizarEspecialidades(especialidades)
+}
+
+// normalizarEspecialidades comprueba la lista y devuelve los valores tal y
+// como están en los catálogos.
+func normalizarEspecialidades(especialidades []Especialidad) ([]Especialidad, error) {
+	if len(especialidades) == 0 {
+		return nil, errors.New("el mecánico debe tener al menos una especialidad")
+	}
+	normalizadas := make([]Especialidad, 0, len(especialidades))
+	for _, e := range especialidades {
+		tipo, ok := normalizarValor(string(e.Tipo), tiposIncidencia)
+		if !ok {
+			return nil, fmt.Errorf("especialidad %q no válida", e.Tipo)
+		}
+		nivel, ok := normalizarValor(e.Nivel, nivelesEspecialidad)
+		if !ok {
+			return nil, fmt.Errorf("nivel %q no válido (válidos: %s)", e.Nivel, strings.Join(nivelesEspecialidad, ", "))
+		}
+		for _, otra := range normalizadas {
+			if otra.Tipo == tipo {
+				return nil, fmt.Errorf("la especialidad %s está repetida", tipo)
+			}
+		}
+		normalizadas = append(normalizadas, Especialidad{tipo, nivel})
+	}
+	return normalizadas, nil
+}
+
+// normalizarValor busca el texto en el catálogo sin distinguir mayúsculas
+// ni tildes, y devuelve el valor tal y como está en el catálogo.
+func normalizarValor[T ~string](texto string, catalogo []T) (T, bool) {
+	clave := quitarTildes(strings.ToLower(strings.TrimSpace(texto)))
+	for _, valor := range catalogo {
+		if quitarTildes(strings.ToLower(string(valor))) == clave {
+			return valor, true
+		}
+	}
+	return "", false
+}
+
+func quitarTildes(texto string) string {
+	return strings.NewReplacer(
+		"á", "a", "é", "e", "í", "i", "ó", "o", "ú", "u", "ü", "u",
+		"Á", "A", "É", "E", "Í", "I", "Ó", "O", "Ú", "U", "Ü", "U",
+	).Replace(texto)
+}
+
+// Búsquedas por clave
+
+func buscarCliente(id int) *Cliente {
+	return almacen.Clientes().PorID(id)
+}
+
+func buscarVehiculo(matricula string) *Vehiculo {
+	return almacen.Vehiculos().PorMatricula(matricula)
+}
+
+func buscarIncidencia(id int) *Incidencia {
+	return almacen.Incidencias().PorID(id)
+}
+
+func buscarMecanico(id int) *Mecanico {
+	return almacen.Mecanicos().PorID(id)
+}
+
+func buscarPropietario(vehiculo *Vehiculo) *Cliente {
+	return almacen.Clientes().PorVehiculo(vehiculo.Matricula)
+}
+
+// guardar persiste en una sola transacción las entidades que ha modificado
+// una operación, junto con el estado del taller (plazas y contadores).
+func guardar(entidades ...interface{}) error {
+	return almacen.Transaccion(func() error {
+		for _, entidad := range entidades {
+			incrementarVersion(entidad)
+			var err error
+			switch e := entidad.(type) {
+			case *Cliente:
+				err = almacen.Clientes().Guardar(e)
+			case *Vehiculo:
+				err = almacen.Vehiculos().Guardar(e)
+			case *Incidencia:
+				err = almacen.Incidencias().Guardar(e)
+			case *Mecanico:
+				err = almacen.Mecanicos().Guardar(e)
+			default:
+				err = fmt.Errorf("no se puede guardar un %T", entidad)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return almacen.GuardarTaller()
+	})
+}
+
+// Validaciones y altas comunes (menús e importación)
+
+func validarCliente(nombre string) error {
+	if nombre == "" {
+		return errors.New("el nombre no puede estar vacío")
+	}
+	return nil
+}
+
+func registrarCliente(id int, nombre, telefono, email string) (*Cliente, error) {
+	if err := validarCliente(nombre); err != nil {
+		return nil, err
+	}
+
+	var cliente *Cliente
+	err := operacion(func() error {
+		if id > 0 && buscarCliente(id) != nil {
+			return fmt.Errorf("ya existe un cliente con ID %d", id)
+		}
+		cliente = &Cliente{
+			ID:       contadorCliente.asignar(id),
+			Nombre:   nombre,
+			Telefono: telefono,
+			Email:    email,
+			Vehiculo: nil,
+		}
+		if err := guardar(cliente); err != nil {
+			return err
+		}
+		emitirWebhook(webhookClienteCreado, map[string]interface{}{"cliente": clienteAJSON(cliente)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cliente, nil
+}
+
+func validarVehiculo(cliente *Cliente, matricula string) error {
+	if cliente == nil {
+		return errors.New("cliente no encontrado")
+	}
+	if cliente.Vehiculo != nil {
+		return errors.New("el cliente ya tiene un vehículo asociado")
+	}
+	if matricula == "" {
+		return errors.New("la matrícula no puede estar vacía")
+	}
+	if buscarVehiculo(matricula) != nil {
+		return errors.New("ya existe un vehículo con esa matrícula")
+	}
+	return nil
+}
+
+func registrarVehiculo(cliente *Cliente, matricula, marca, modelo, fechaEntrada string) (*Vehiculo, error) {
+	vehiculo := &Vehiculo{
+		Matricula:    matricula,
+		Marca:        marca,
+		Modelo:       modelo,
+		FechaEntrada: fechaEntrada,
+		FechaSalida:  "",
+		EnTaller:     false,
+		NumeroPlaza:  -1,
+	}
+	if err := operacion(func() error { return altaVehiculo(cliente, vehiculo) }); err != nil {
+		return nil, err
+	}
+	return vehiculo, nil
+}
+
+// altaVehiculo asocia el vehículo nuevo al cliente; sin fecha de entrada
+// entra hoy. Se llama dentro de operacion.
+func altaVehiculo(cliente *Cliente, vehiculo *Vehiculo) error {
+	if err := validarVehiculo(cliente, vehiculo.Matricula); err != nil {
+		return err
+	}
+	if vehiculo.FechaEntrada == "" {
+		vehiculo.FechaEntrada = obtenerFechaActual()
+	}
+	cliente.Vehiculo = vehiculo
+	// el propietario primero: la fila del vehículo lo busca por matrícula
+	return guardar(cliente, vehiculo)
+}
+
+func validarIncidencia(vehiculo *Vehiculo, tipo, prioridad, estado string) error {
+	if vehiculo == nil {
+		return errors.New("vehículo no encontrado")
+	}
+	if _, ok := normalizarValor(tipo, tiposIncidencia); !ok {
+		return fmt.Errorf("tipo de incidencia %q no válido", tipo)
+	}
+	if _, ok := normalizarValor(prioridad, prioridadesIncidencia); !ok {
+		return fmt.Errorf("prioridad %q no válida", prioridad)
+	}
+	if _, ok := normalizarValor(estado, estadosIncidencia); !ok {
+		return fmt.Errorf("estado %q no válido", estado)
+	}
+	return nil
+}
+
+func registrarIncidencia(id int, vehiculo *Vehiculo, tipo, prioridad, descripcion, estado string) (*Incidencia, error) {
+	var incidencia *Incidencia
+	err := operacion(func() error {
+		var err error
+		incidencia, err = altaIncidencia(id, vehiculo, tipo, prioridad, descripcion, estado)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return incidencia, nil
+}
+
+// altaIncidencia crea la incidencia en la orden de trabajo en curso del
+// vehículo. Se llama dentro de operacion.
+func altaIncidencia(id int, vehiculo *Vehiculo, tipo, prioridad, descripcion, estado string) (*Incidencia, error) {
+	if estado == "" {
+		estado = string(estadoAbierta)
+	}
+	if err := validarIncidencia(vehiculo, tipo, prioridad, estado); err != nil {
+		return nil, err
+	}
+	if id > 0 && buscarIncidencia(id) != nil {
+		return nil, fmt.Errorf("ya existe una incidencia con ID %d", id)
+	}
+
+	incidencia := &Incidencia{
+		ID:          contadorIncidencia.asignar(id),
+		Mecanicos:   []*Mecanico{},
+		Descripcion: descripcion,
+	}
+	incidencia.Tipo, _ = normalizarValor(tipo, tiposIncidencia)
+	incidencia.Prioridad, _ = normalizarValor(prioridad, prioridadesIncidencia)
+	incidencia.Estado, _ = normalizarValor(estado, estadosIncidencia)
+	// La primera incidencia de la visita abre la orden de trabajo
+	if vehiculo.Orden == 0 {
+		vehiculo.Orden = incidencia.ID
+	}
+	incidencia.Orden = vehiculo.Orden
+	vehiculo.Incidencias = append(vehiculo.Incidencias, incidencia)
+	if err := guardar(incidencia, vehiculo); err != nil {
+		return nil, err
+	}
+	err := registrarEvento(&Evento{Tipo: eventoApertura, Matricula: vehiculo.Matricula,
+		IncidenciaID: incidencia.ID, Detalle: string(incidencia.Estado)})
+	if err != nil {
+		return nil, err
+	}
+	return incidencia, nil
+}
+
+func validarMecanico(nombre string, especialidades []Especialidad) error {
+	if nombre == "" {
+		return errors.New("el nombre no puede estar vacío")
+	}
+	if _, err := normalizarEspecialidades(especialidades); err != nil {
+		return err
+	}
+	return nil
+}
+
+// registrarMecanico da de alta al mecánico; sin horario tiene el habitual.
+func registrarMecanico(id int, nombre string, especialidades []Especialidad, anios int, horario []Turno, activo bool) (*Mecanico, error) {
+	if err := validarMecanico(nombre, especialidades); err != nil {
+		return nil, err
+	}
+	especialidades, _ = normalizarEspecialidades(especialidades)
+	if horario == nil {
+		horario = horarioHabitual()
+	}
+	horario, err := normalizarHorario(horario)
+	if err != nil {
+		return nil, err
+	}
+
+	var mecanico *Mecanico
+	err = operacion(func() error {
+		if id > 0 && buscarMecanico(id) != nil {
+			return fmt.Errorf("ya existe un mecánico con ID %d", id)
+		}
+		mecanico = &Mecanico{
+			ID:             contadorMecanico.asignar(id),
+			Nombre:         nombre,
+			Especialidades: especialidades,
+			AniosExp:       anios,
+			Activo:         activo,
+			Horario:        horario,
+			Incidencias:    []*Incidencia{},
+		}
+		taller.Mecanicos = append(taller.Mecanicos, mecanico)
+		taller.TotalPlazas = calcularTotalPlazas()
+		return guardar(mecanico)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mecanico, nil
+}
+
+// validarAsignacion comprueba que el mecánico puede trabajar hoy en la
+// incidencia: tiene que trabajar hoy y cumplir validarEspecialidad. Con
+// -carga-estricta tampoco puede pasar de la carga máxima.
+func validarAsignacion(incidencia *Incidencia, mecanico *Mecanico) error {
+	if motivo := motivoNoDisponible(mecanico, time.Now()); motivo != "" {
+		return fmt.Errorf("el mecánico %d %s", mecanico.ID, motivo)
+	}
+	if err := validarEspecialidad(incidencia, mecanico); err != nil {
+		return err
+	}
+	if cargaEstricta {
+		return comprobarCarga(incidencia, mecanico)
+	}
+	return nil
+}
+
+// validarEspecialidad comprueba lo que no depende del día: que el mecánico
+// tiene la especialidad con el nivel mínimo para la prioridad y no está ya
+// asignado. Es lo único que se pide a las incidencias importadas, que pueden
+// ser de cualquier fecha.
+func validarEspecialidad(incidencia *Incidencia, mecanico *Mecanico) error {
+	nivel := nivelMecanico(mecanico, incidencia.Tipo)
+	if nivel == "" {
+		return fmt.Errorf("el mecánico %d no tiene la especialidad %s", mecanico.ID, incidencia.Tipo)
+	}
+	if !cualificado(mecanico, incidencia) {
+		return fmt.Errorf("el mecánico %d tiene nivel %s en %s y la prioridad %s pide nivel %s",
+			mecanico.ID, nivel, incidencia.Tipo, incidencia.Prioridad, nivelMinimo[incidencia.Prioridad])
+	}
+	for _, m := range incidencia.Mecanicos {
+		if m.ID == mecanico.ID {
+			return errors.New("el mecánico ya está asignado a esta incidencia")
+		}
+	}
+	return nil
+}
+
+func asignarMecanico(incidencia *Incidencia, mecanico *Mecanico) error {
+	return operacion(func() error {
+		if err := validarAsignacion(incidencia, mecanico); err != nil {
+			return err
+		}
+		return enlazarMecanico(incidencia, mecanico)
+	})
+}
+
+// enlazarMecanico asigna el mecánico ya validado a la incidencia por los dos
+// lados y lo anota en el historial. Se llama dentro de operacion.
+func enlazarMecanico(incidencia *Incidencia, mecanico *Mecanico) error {
+	incidencia.Mecanicos = append(incidencia.Mecanicos, mecanico)
+	mecanico.Incidencias = append(mecanico.Incidencias, incidencia)
+	if err := guardar(incidencia, mecanico); err != nil {
+		return err
+	}
+	return registrarEvento(&Evento{Tipo: eventoAsignacion, IncidenciaID: incidencia.ID, MecanicoID: mecanico.ID})
+}
+
+// quitarAsignacion deshace el enlace entre la incidencia y el mecánico por
+// los dos lados. Devuelve false si no estaba asignado.
+func quitarAsignacion(incidencia *Incidencia, mecanico *Mecanico) bool {
+	i := posicion(incidencia.Mecanicos, mecanico)
+	if i < 0 {
+		return false
+	}
+	incidencia.Mecanicos = append(incidencia.Mecanicos[:i:i], incidencia.Mecanicos[i+1:]...)
+	if j := posicion(mecanico.Incidencias, incidencia); j >= 0 {
+		mecanico.Incidencias = append(mecanico.Incidencias[:j:j], mecanico.Incidencias[j+1:]...)
+	}
+	return true
+}
+
+// desasignarMecanico retira al mecánico de la incidencia; el motivo queda en
+// el historial.
+func desasignarMecanico(incidencia *Incidencia, mecanico *Mecanico, motivo string) error {
+	motivo = strings.TrimSpace(motivo)
+	if motivo == "" {
+		return errors.New("indique el motivo")
+	}
+	return operacion(func() error {
+		if !quitarAsignacion(incidencia, mecanico) {
+			return fmt.Errorf("el mecánico %d no está asignado a la incidencia %d", mecanico.ID, incidencia.ID)
+		}
+		if err := guardar(incidencia, mecanico); err != nil {
+			return err
+		}
+		return registrarEvento(&Evento{Tipo: eventoDesasignacion, IncidenciaID: incidencia.ID, MecanicoID: mecanico.ID, Detalle: motivo})
+	})
+}
+
+// traspasar pasa la incidencia de un mecánico a otro, que tiene que poder
+// atenderla. Se llama dentro de operacion.
+func traspasar(incidencia *Incidencia, desde, hacia *Mecanico, motivo string) error {
+	if desde == hacia {
+		return errors.New("el mecánico de destino es el mismo")
+	}
+	if !quitarAsignacion(incidencia, desde) {
+		return fmt.Errorf("el mecánico %d no está asignado a la incidencia %d", desde.ID, incidencia.ID)
+	}
+	if err := validarAsignacion(incidencia, hacia); err != nil {
+		return err
+	}
+	incidencia.Mecanicos = append(incidencia.Mecanicos, hacia)
+	hacia.Incidencias = append(hacia.Incidencias, incidencia)
+	if err := guardar(incidencia, desde, hacia); err != nil {
+		return err
+	}
+	err := registrarEvento(&Evento{Tipo: eventoDesasignacion, IncidenciaID: incidencia.ID, MecanicoID: desde.ID,
+		Detalle: fmt.Sprintf("traspasada a %s: %s", hacia.Nombre, motivo)})
+	if err != nil {
+		return err
+	}
+	return registrarEvento(&Evento{Tipo: eventoAsignacion, IncidenciaID: incidencia.ID, MecanicoID: hacia.ID, Detalle: motivo})
+}
+
+func traspasarIncidencia(incidencia *Incidencia, desde, hacia *Mecanico, motivo string) error {
+	motivo = strings.TrimSpace(motivo)
+	if motivo == "" {
+		return errors.New("indique el motivo")
+	}
+	return operacion(func() error { return traspasar(incidencia, desde, hacia, motivo) })
+}
+
+// traspasarPendientes pasa todas las incidencias sin terminar del mecánico,
+// por ejemplo antes de una baja o unas vacaciones. Sin destino, cada una va
+// al mecánico con menos carga que puede atenderla hoy. O se traspasan todas
+// o ninguna. Las terminadas se quedan con él.
+func traspasarPendientes(mecanico, destino *Mecanico, motivo string) ([]movimientoCarga, error) {
+	motivo = strings.TrimSpace(motivo)
+	if motivo == "" {
+		return nil, errors.New("indique el motivo")
+	}
+	var movimientos []movimientoCarga
+	err := operacion(func() error {
+		carga := map[*Mecanico]int{}
+		for _, m := range almacen.Mecanicos().Todos() {
+			carga[m] = cargaMecanico(m)
+		}
+		pendientes := []*Incidencia{}
+		for _, inc := range mecanico.Incidencias {
+			if !trabajoTerminado(inc) {
+				pendientes = append(pendientes, inc)
+			}
+		}
+		if len(pendientes) == 0 {
+			return errors.New("el mecánico no tiene incidencias pendientes")
+		}
+		for _, inc := range pendientes {
+			hacia := destino
+			if hacia == nil {
+				candidatos := candidatosPorCarga(inc, mecanico, carga)
+				if len(candidatos) == 0 {
+					return fmt.Errorf("nadie más puede atender hoy la incidencia %d (%s, %s)", inc.ID, inc.Tipo, inc.Prioridad)
+				}
+				hacia = candidatos[0]
+			}
+			if err := traspasar(inc, mecanico, hacia, motivo); err != nil {
+				return fmt.Errorf("incidencia %d: %v", inc.ID, err)
+			}
+			carga[hacia] += pesoPrioridad(inc.Prioridad)
+			movimientos = append(movimientos, movimientoCarga{inc, mecanico, hacia})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return movimientos, nil
+}
+
+// pendientesMecanico cuenta las incidencias sin terminar del mecánico.
+func pendientesMecanico(m *Mecanico) int {
+	n := 0
+	for _, inc := range m.Incidencias {
+		if !trabajoTerminado(inc) {
+			n++
+		}
+	}
+	return n
+}
+
+// Operaciones del taller (menús y demás interfaces)
+
+// ingresarVehiculo ocupa con el vehículo la primera plaza libre del taller.
+func ingresarVehiculo(vehiculo *Vehiculo) (int, error) {
+	plazaAsignada := -1
+	err := operacion(func() error {
+		if vehiculo.EnTaller {
+			return errors.New("el vehículo ya está en el taller")
+		}
+
+		// Verificar plazas disponibles
+		totalPlazas := calcularTotalPlazas()
+		if contarPlazasOcupadas() >= totalPlazas {
+			return errors.New("no hay plazas disponibles en el taller")
+		}
+
+		// Buscar primera plaza libre
+		for i := 1; i <= totalPlazas; i++ {
+			if !taller.PlazasOcupadas[i] {
+				plazaAsignada = i
+				break
+			}
+		}
+
+		if vehiculo.RecogidoPor != "" {
+			// La salida y el pago son de la visita anterior
+			vehiculo.FechaSalida, vehiculo.EstadoPago, vehiculo.RecogidoPor = "", "", ""
+		}
+		vehiculo.EnTaller = true
+		vehiculo.NumeroPlaza = plazaAsignada
+		vehiculo.EntradaPlaza = time.Now()
+		taller.PlazasOcupadas[plazaAsignada] = true
+		if err := guardar(vehiculo); err != nil {
+			return err
+		}
+		return registrarEvento(&Evento{Tipo: eventoEntradaPlaza, Matricula: vehiculo.Matricula, Plaza: plazaAsignada})
+	})
+	if err != nil {
+		return 0, err
+	}
+	return plazaAsignada, nil
+}
+
+// cambiarEstado pasa la incidencia al estado indicado. El vehículo sigue
+// ocupando su plaza hasta que el cliente lo recoge (ver entregarVehiculo).
+func cambiarEstado(incidencia *Incidencia, estado string) error {
+	nuevo, ok := normalizarValor(estado, estadosIncidencia)
+	if !ok {
+		return fmt.Errorf("estado %q no válido", estado)
+	}
+
+	var aviso *Aviso
+	err := operacion(func() error {
+		if incidencia.Estado == nuevo {
+			// sin cambio no hay nada que anotar, avisar ni publicar
+			return fmt.Errorf("la incidencia %d ya está %s", incidencia.ID, nuevo)
+		}
+		anterior := incidencia.Estado
+		incidencia.Estado = nuevo
+		if err := guardar(incidencia); err != nil {
+			return err
+		}
+		err := registrarEvento(&Evento{Tipo: eventoEstado, IncidenciaID: incidencia.ID, Detalle: string(nuevo)})
+		if err != nil {
+			return err
+		}
+		aviso, err = prepararAviso(incidencia, anterior)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	avisos.encolar(aviso)
+	return nil
+}
+
+// entregarVehiculo da salida al vehículo cuando el cliente lo recoge: anota
+// la fecha, el pago y quién se lo lleva, libera la plaza y cierra las líneas
+// de la orden de trabajo que estaban listas para recoger.
+func entregarVehiculo(vehiculo *Vehiculo, pago, recogidoPor string) error {
+	pago, ok := normalizarValor(pago, estadosPago)
+	if !ok {
+		return fmt.Errorf("el pago debe ser %s", strings.Join(estadosPago, ", "))
+	}
+	recogidoPor = strings.TrimSpace(recogidoPor)
+	if recogidoPor == "" {
+		return errors.New("indique quién recoge el vehículo")
+	}
+
+	return operacion(func() error {
+		if !vehiculo.EnTaller {
+			return errors.New("el vehículo no está en el taller")
+		}
+		lineas := lineasOrden(vehiculo, vehiculo.Orden)
+		for _, inc := range lineas {
+			if !trabajoTerminado(inc) {
+				return fmt.Errorf("la incidencia %d está %s: el vehículo todavía no se puede entregar", inc.ID, inc.Estado)
+			}
+		}
+
+		eventos := []*Evento{{Tipo: eventoSalidaPlaza, Matricula: vehiculo.Matricula, Plaza: vehiculo.NumeroPlaza,
+			IncidenciaID: vehiculo.Orden, Detalle: fmt.Sprintf("recogido por %s; pago %s", recogidoPor, pago)}}
+		modificados := []interface{}{vehiculo}
+		for _, inc := range lineas {
+			if inc.Estado != estadoCerrada {
+				inc.Estado = estadoCerrada
+				eventos = append(eventos, &Evento{Tipo: eventoEstado, IncidenciaID: inc.ID, Detalle: string(estadoCerrada)})
+				modificados = append(modificados, inc)
+			}
+		}
+
+		taller.PlazasOcupadas[vehiculo.NumeroPlaza] = false
+		vehiculo.EnTaller = false
+		vehiculo.NumeroPlaza = -1
+		vehiculo.EntradaPlaza = time.Time{}
+		vehiculo.FechaSalida = time.Now().Format("02/01/2006")
+		vehiculo.EstadoPago = pago
+		vehiculo.RecogidoPor = recogidoPor
+		vehiculo.Orden = 0
+		if err := guardar(modificados...); err != nil {
+			return err
+		}
+		for _, e := range eventos {
+			if err := registrarEvento(e); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// cambiarAltaMecanico da de baja al mecánico si está activo y de alta si no.
+// Antes de la baja hay que traspasar sus incidencias pendientes (ver
+// traspasarPendientes); las terminadas se quedan con él.
+func cambiarAltaMecanico(mecanico *Mecanico) error {
+	return operacion(func() error {
+		if mecanico.Activo && pendientesMecanico(mecanico) > 0 {
+			return errors.New("no se puede dar de baja a un mecánico con incidencias pendientes: traspáselas antes")
+		}
+		mecanico.Activo = !mecanico.Activo
+		taller.TotalPlazas = calcularTotalPlazas()
+		return guardar(mecanico)
+	})
+}
+
+// darDeBajaMecanico elimina al mecánico del sistema y de la plantilla.
+func darDeBajaMecanico(mecanico *Mecanico) error {
+	return operacion(func() error {
+		if len(mecanico.Incidencias) > 0 {
+			return errors.New("no se puede eliminar un mecánico con incidencias asignadas")
+		}
+		if err := almacen.Mecanicos().Eliminar(mecanico); err != nil {
+			return err
+		}
+
+		// Actualizar taller
+		for j, mecTaller := range taller.Mecanicos {
+			if mecTaller == mecanico {
+				taller.Mecanicos = append(taller.Mecanicos[:j], taller.Mecanicos[j+1:]...)
+				break
+			}
+		}
+		taller.TotalPlazas = calcularTotalPlazas()
+		return almacen.GuardarTaller()
+	})
+}
+
 // 1. Funciones CRUD - Gestion de Clientes
 
 func crearCliente() {
@@ -136,46 +945,21 @@ func crearCliente() {
 	fmt.Print("Email: ")
 	fmt.Scanln(&email)
 
-	cliente := &Cliente{
-		ID:       contadorCliente,
-		Nombre:   nombre,
-		Telefono: telefono,
-		Email:    email,
-		Vehiculo: nil,
+	cliente, err := registrarCliente(0, nombre, telefono, email)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
 
-	clientes = append(clientes, cliente)
-	contadorCliente++
-
 	fmt.Println("\nCliente creado exitosamente con ID:", cliente.ID)
 	pausar()
 }
 
 func visualizarClientes() {
-	limpiarPantalla()
-	fmt.Println("=== LISTA DE CLIENTES ===")
-
-	if len(clientes) == 0 {
-		fmt.Println("No hay clientes registrados")
-		pausar()
-		return
-	}
-
-	for _, c := range clientes {
-		fmt.Printf("\nID: %d\n", c.ID)
-		fmt.Printf("Nombre: %s\n", c.Nombre)
-		fmt.Printf("Teléfono: %s\n", c.Telefono)
-		fmt.Printf("Email: %s\n", c.Email)
-		if c.Vehiculo != nil {
-			fmt.Printf("Vehículo asociado: %s (Matrícula: %s)\n",
-				c.Vehiculo.Marca+" "+c.Vehiculo.Modelo, c.Vehiculo.Matricula)
-		} else {
-			fmt.Println("Sin vehículo asociado")
-		}
-		fmt.Println("---")
-	}
-
-	pausar()
+	var l *listado
+	consultar(func() { l = listadoClientes("LISTA DE CLIENTES", almacen.Clientes().Todos()) })
+	mostrarListado(l)
 }
 
 func modificarCliente() {
@@ -189,40 +973,56 @@ func modificarCliente() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var cliente *Cliente
-	for _, c := range clientes {
-		if c.ID == id {
-			cliente = c
-			break
-		}
-	}
+	cliente := buscarCliente(id)
 
 	if cliente == nil {
 		fmt.Println("Error: Cliente no encontrado")
 		pausar()
 		return
 	}
+	var leido Cliente // copia para detectar cambios de otros puestos
+	consultar(func() { leido = *cliente })
 
-	fmt.Printf("\nCliente actual: %s\n", cliente.Nombre)
+	fmt.Printf("\nCliente actual: %s\n", leido.Nombre)
 	fmt.Print("Nuevo nombre (dejar vacío para no cambiar): ")
 	nombre, _ := reader.ReadString('\n')
 	nombre = strings.TrimSpace(nombre)
-	if nombre != "" {
-		cliente.Nombre = nombre
-	}
 
 	fmt.Print("Nuevo teléfono (dejar vacío para no cambiar): ")
 	var telefono string
 	fmt.Scanln(&telefono)
-	if telefono != "" {
-		cliente.Telefono = telefono
-	}
 
 	fmt.Print("Nuevo email (dejar vacío para no cambiar): ")
 	var email string
 	fmt.Scanln(&email)
-	if email != "" {
-		cliente.Email = email
+
+	fmt.Print("¿Recibir avisos de sus incidencias? (S/N, dejar vacío para no cambiar): ")
+	var recibir string
+	fmt.Scanln(&recibir)
+
+	err := operacion(func() error {
+		if err := comprobarVersion(&leido, cliente); err != nil {
+			return err
+		}
+		if nombre != "" {
+			cliente.Nombre = nombre
+		}
+		if telefono != "" {
+			cliente.Telefono = telefono
+		}
+		if email != "" {
+			cliente.Email = email
+		}
+		if recibir != "" {
+			cliente.SinAvisos = strings.ToUpper(recibir) != "S"
+		}
+		return guardar(cliente)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		mostrarConflicto(err)
+		pausar()
+		return
 	}
 
 	fmt.Println("\nCliente modificado exitosamente")
@@ -238,22 +1038,40 @@ func eliminarCliente() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	for i, c := range clientes {
-		// Si se encuentra el cliente
-		if c.ID == id {
-			// Si tiene vehículo, liberarlo del taller
-			if c.Vehiculo != nil && c.Vehiculo.EnTaller {
-				taller.PlazasOcupadas[c.Vehiculo.NumeroPlaza] = false
+	c := buscarCliente(id)
+	if c == nil {
+		fmt.Println("Error: Cliente no encontrado")
+		pausar()
+		return
+	}
+
+	err := operacion(func() error {
+		// Si tiene vehículo, liberarlo del taller
+		if c.Vehiculo != nil && c.Vehiculo.EnTaller {
+			taller.PlazasOcupadas[c.Vehiculo.NumeroPlaza] = false
+			err := registrarEvento(&Evento{Tipo: eventoSalidaPlaza, Matricula: c.Vehiculo.Matricula,
+				Plaza: c.Vehiculo.NumeroPlaza})
+			if err != nil {
+				return err
 			}
-			// Eliminar el cliente
-			clientes = append(clientes[:i], clientes[i+1:]...)
-			fmt.Println("Cliente eliminado exitosamente")
-			pausar()
-			return
 		}
+		// Eliminar el cliente
+		vehiculo := c.Vehiculo
+		if err := almacen.Clientes().Eliminar(c); err != nil {
+			return err
+		}
+		if vehiculo != nil {
+			return guardar(vehiculo)
+		}
+		return almacen.GuardarTaller()
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
 
-	fmt.Println("Error: Cliente no encontrado")
+	fmt.Println("Cliente eliminado exitosamente")
 	pausar()
 }
 
@@ -270,13 +1088,7 @@ func crearVehiculo() {
 	fmt.Scanf("%d", &idCliente)
 	fmt.Scanln()
 
-	var cliente *Cliente
-	for _, c := range clientes {
-		if c.ID == idCliente {
-			cliente = c
-			break
-		}
-	}
+	cliente := buscarCliente(idCliente)
 
 	if cliente == nil {
 		fmt.Println("Error: Cliente no encontrado")
@@ -301,12 +1113,10 @@ func crearVehiculo() {
 	}
 
 	// Verificar que la matrícula no exista
-	for _, v := range vehiculos {
-		if v.Matricula == matricula {
-			fmt.Println("Error: Ya existe un vehículo con esa matrícula")
-			pausar()
-			return
-		}
+	if buscarVehiculo(matricula) != nil {
+		fmt.Println("Error: Ya existe un vehículo con esa matrícula")
+		pausar()
+		return
 	}
 
 	fmt.Print("Marca: ")
@@ -317,55 +1127,20 @@ func crearVehiculo() {
 	modelo, _ := reader.ReadString('\n')
 	modelo = strings.TrimSpace(modelo)
 
-	vehiculo := &Vehiculo{
-		Matricula:    matricula,
-		Marca:        marca,
-		Modelo:       modelo,
-		FechaEntrada: obtenerFechaActual(),
-		FechaSalida:  "",
-		Incidencia:   nil,
-		EnTaller:     false,
-		NumeroPlaza:  -1,
+	if _, err := registrarVehiculo(cliente, matricula, marca, modelo, ""); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
 
-	vehiculos = append(vehiculos, vehiculo)
-	cliente.Vehiculo = vehiculo
-
 	fmt.Println("\nVehículo creado exitosamente y asociado al cliente")
 	pausar()
 }
 
 func visualizarVehiculos() {
-	limpiarPantalla()
-	fmt.Println("=== LISTA DE VEHÍCULOS ===")
-
-	if len(vehiculos) == 0 {
-		fmt.Println("No hay vehículos registrados")
-		pausar()
-		return
-	}
-
-	for _, v := range vehiculos {
-		fmt.Printf("\nMatrícula: %s\n", v.Matricula)
-		fmt.Printf("Marca: %s\n", v.Marca)
-		fmt.Printf("Modelo: %s\n", v.Modelo)
-		fmt.Printf("Fecha entrada: %s\n", v.FechaEntrada)
-		if v.FechaSalida != "" {
-			fmt.Printf("Fecha salida estimada: %s\n", v.FechaSalida)
-		}
-		if v.EnTaller {
-			fmt.Printf("En taller: Sí (Plaza %d)\n", v.NumeroPlaza)
-		} else {
-			fmt.Println("En taller: No")
-		}
-		if v.Incidencia != nil {
-			fmt.Printf("Incidencia: ID %d - %s (%s)\n",
-				v.Incidencia.ID, v.Incidencia.Tipo, v.Incidencia.Estado)
-		}
-		fmt.Println("---")
-	}
-
-	pausar()
+	var l *listado
+	consultar(func() { l = listadoVehiculos("LISTA DE VEHÍCULOS", almacen.Vehiculos().Todos()) })
+	mostrarListado(l)
 }
 
 func modificarVehiculo() {
@@ -376,41 +1151,50 @@ func modificarVehiculo() {
 	fmt.Print("Matrícula del vehículo a modificar: ")
 	fmt.Scanln(&matricula)
 
-	var vehiculo *Vehiculo
-	for _, v := range vehiculos {
-		if v.Matricula == matricula {
-			vehiculo = v
-			break
-		}
-	}
+	vehiculo := buscarVehiculo(matricula)
 
 	if vehiculo == nil {
 		fmt.Println("Error: Vehículo no encontrado")
 		pausar()
 		return
 	}
+	var leido Vehiculo // copia para detectar cambios de otros puestos
+	consultar(func() { leido = *vehiculo })
 
-	fmt.Printf("\nVehículo actual: %s %s\n", vehiculo.Marca, vehiculo.Modelo)
+	fmt.Printf("\nVehículo actual: %s %s\n", leido.Marca, leido.Modelo)
 
 	fmt.Print("Nueva marca (dejar vacío para no cambiar): ")
 	var marca string
 	fmt.Scanln(&marca)
-	if marca != "" {
-		vehiculo.Marca = marca
-	}
 
 	fmt.Print("Nuevo modelo (dejar vacío para no cambiar): ")
 	var modelo string
 	fmt.Scanln(&modelo)
-	if modelo != "" {
-		vehiculo.Modelo = modelo
-	}
 
 	fmt.Print("Nueva fecha salida estimada (DD/MM/AAAA, vacío para no cambiar): ")
 	var fecha string
 	fmt.Scanln(&fecha)
-	if fecha != "" {
-		vehiculo.FechaSalida = fecha
+
+	err := operacion(func() error {
+		if err := comprobarVersion(&leido, vehiculo); err != nil {
+			return err
+		}
+		if marca != "" {
+			vehiculo.Marca = marca
+		}
+		if modelo != "" {
+			vehiculo.Modelo = modelo
+		}
+		if fecha != "" {
+			vehiculo.FechaSalida = fecha
+		}
+		return guardar(vehiculo)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		mostrarConflicto(err)
+		pausar()
+		return
 	}
 
 	fmt.Println("\nVehículo modificado exitosamente")
@@ -425,29 +1209,40 @@ func eliminarVehiculo() {
 	fmt.Print("Matrícula del vehículo a eliminar: ")
 	fmt.Scanln(&matricula)
 
-	for i, v := range vehiculos {
-		if v.Matricula == matricula {
-			// Liberar plaza si está en taller
-			if v.EnTaller {
-				taller.PlazasOcupadas[v.NumeroPlaza] = false
-			}
+	v := buscarVehiculo(matricula)
+	if v == nil {
+		fmt.Println("Error: Vehículo no encontrado")
+		pausar()
+		return
+	}
 
-			// Desvincular del cliente
-			for _, c := range clientes {
-				if c.Vehiculo == v {
-					c.Vehiculo = nil
-					break
-				}
+	err := operacion(func() error {
+		// Liberar plaza si está en taller
+		if v.EnTaller {
+			taller.PlazasOcupadas[v.NumeroPlaza] = false
+			err := registrarEvento(&Evento{Tipo: eventoSalidaPlaza, Matricula: v.Matricula, Plaza: v.NumeroPlaza})
+			if err != nil {
+				return err
 			}
+		}
 
-			vehiculos = append(vehiculos[:i], vehiculos[i+1:]...)
-			fmt.Println("Vehículo eliminado exitosamente")
-			pausar()
-			return
+		// Desvincular del cliente
+		if c := buscarPropietario(v); c != nil {
+			c.Vehiculo = nil
+		}
+
+		if err := almacen.Vehiculos().Eliminar(v); err != nil {
+			return err
 		}
+		return almacen.GuardarTaller()
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
 
-	fmt.Println("Error: Vehículo no encontrado")
+	fmt.Println("Vehículo eliminado exitosamente")
 	pausar()
 }
 
@@ -463,13 +1258,7 @@ func crearIncidencia() {
 	matricula, _ := reader.ReadString('\n')
 	matricula = strings.TrimSpace(matricula)
 
-	var vehiculo *Vehiculo
-	for _, v := range vehiculos {
-		if v.Matricula == matricula {
-			vehiculo = v
-			break
-		}
-	}
+	vehiculo := buscarVehiculo(matricula)
 
 	if vehiculo == nil {
 		fmt.Println("Error: Vehículo no encontrado")
@@ -477,52 +1266,27 @@ func crearIncidencia() {
 		return
 	}
 
-	if vehiculo.Incidencia != nil {
-		fmt.Println("Error: El vehículo ya tiene una incidencia asignada")
-		pausar()
-		return
+	var lineas []*Incidencia
+	var orden int
+	consultar(func() {
+		orden = vehiculo.Orden
+		lineas = lineasOrden(vehiculo, orden)
+	})
+	if len(lineas) > 0 {
+		fmt.Printf("La incidencia se añadirá a la orden de trabajo #%d: %s\n", orden, resumenOrden(lineas))
 	}
 
-	var tipo, prioridad string
-
 	fmt.Println("\nTipo de incidencia:")
-	fmt.Println("1. Mecánica")
-	fmt.Println("2. Eléctrica")
-	fmt.Println("3. Carrocería")
-	var opcion int
-	fmt.Print("Opción: ")
-	fmt.Scanf("%d", &opcion)
-	fmt.Scanln()
-
-	switch opcion {
-	case 1:
-		tipo = "mecánica"
-	case 2:
-		tipo = "eléctrica"
-	case 3:
-		tipo = "carrocería"
-	default:
+	tipo, ok := elegirDeCatalogo(tiposIncidencia)
+	if !ok {
 		fmt.Println("Opción inválida")
 		pausar()
 		return
 	}
 
 	fmt.Println("\nPrioridad:")
-	fmt.Println("1. Baja")
-	fmt.Println("2. Media")
-	fmt.Println("3. Alta")
-	fmt.Print("Opción: ")
-	fmt.Scanf("%d", &opcion)
-	fmt.Scanln()
-
-	switch opcion {
-	case 1:
-		prioridad = "baja"
-	case 2:
-		prioridad = "media"
-	case 3:
-		prioridad = "alta"
-	default:
+	prioridad, ok := elegirDeCatalogo(prioridadesIncidencia)
+	if !ok {
 		fmt.Println("Opción inválida")
 		pausar()
 		return
@@ -532,56 +1296,21 @@ func crearIncidencia() {
 	descripcion, _ := reader.ReadString('\n')
 	descripcion = strings.TrimSpace(descripcion)
 
-	incidencia := &Incidencia{
-		ID:          contadorIncidencia,
-		Mecanicos:   []*Mecanico{},
-		Tipo:        tipo,
-		Prioridad:   prioridad,
-		Descripcion: descripcion,
-		Estado:      "abierta",
+	incidencia, err := registrarIncidencia(0, vehiculo, string(tipo), string(prioridad), descripcion, string(estadoAbierta))
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
 
-	incidencias = append(incidencias, incidencia)
-	vehiculo.Incidencia = incidencia
-	contadorIncidencia++
-
 	fmt.Println("\nIncidencia creada exitosamente con ID:", incidencia.ID)
 	pausar()
 }
 
 func visualizarIncidencias() {
-	limpiarPantalla()
-	fmt.Println("=== LISTA DE INCIDENCIAS ===")
-
-	if len(incidencias) == 0 {
-		fmt.Println("No hay incidencias registradas")
-		pausar()
-		return
-	}
-
-	for _, inc := range incidencias {
-		fmt.Printf("\nID: %d\n", inc.ID)
-		fmt.Printf("Tipo: %s\n", inc.Tipo)
-		fmt.Printf("Prioridad: %s\n", inc.Prioridad)
-		fmt.Printf("Estado: %s\n", inc.Estado)
-		fmt.Printf("Descripción: %s\n", inc.Descripcion)
-
-		if len(inc.Mecanicos) > 0 {
-			fmt.Print("Mecánicos asignados: ")
-			for i, m := range inc.Mecanicos {
-				if i > 0 {
-					fmt.Print(", ")
-				}
-				fmt.Printf("%s", m.Nombre)
-			}
-			fmt.Println()
-		} else {
-			fmt.Println("Sin mecánicos asignados")
-		}
-		fmt.Println("---")
-	}
-
-	pausar()
+	var l *listado
+	consultar(func() { l = listadoIncidencias("LISTA DE INCIDENCIAS", almacen.Incidencias().Todas()) })
+	mostrarListado(l)
 }
 
 func modificarIncidencia() {
@@ -595,49 +1324,47 @@ func modificarIncidencia() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var incidencia *Incidencia
-	for _, inc := range incidencias {
-		if inc.ID == id {
-			incidencia = inc
-			break
-		}
-	}
+	incidencia := buscarIncidencia(id)
 
 	if incidencia == nil {
 		fmt.Println("Error: Incidencia no encontrada")
 		pausar()
 		return
 	}
+	var leido Incidencia // copia para detectar cambios de otros puestos
+	consultar(func() { leido = *incidencia })
 
-	fmt.Printf("\nIncidencia actual: %s (%s)\n", incidencia.Tipo, incidencia.Estado)
+	fmt.Printf("\nIncidencia actual: %s (%s)\n", leido.Tipo, leido.Estado)
 
 	fmt.Print("Nueva descripción (dejar vacío para no cambiar): ")
 	descripcion, _ := reader.ReadString('\n')
 	descripcion = strings.TrimSpace(descripcion)
-	if descripcion != "" {
-		incidencia.Descripcion = descripcion
-	}
 
 	fmt.Println("\nCambiar prioridad? (S/N): ")
 	var cambiar string
+	var prioridad Prioridad
 	fmt.Scanln(&cambiar)
 	if strings.ToUpper(cambiar) == "S" {
-		fmt.Println("1. Baja")
-		fmt.Println("2. Media")
-		fmt.Println("3. Alta")
-		var opcion int
-		fmt.Print("Opción: ")
-		fmt.Scanf("%d", &opcion)
-		fmt.Scanln()
+		prioridad, _ = elegirDeCatalogo(prioridadesIncidencia)
+	}
 
-		switch opcion {
-		case 1:
-			incidencia.Prioridad = "baja"
-		case 2:
-			incidencia.Prioridad = "media"
-		case 3:
-			incidencia.Prioridad = "alta"
+	err := operacion(func() error {
+		if err := comprobarVersion(&leido, incidencia); err != nil {
+			return err
+		}
+		if descripcion != "" {
+			incidencia.Descripcion = descripcion
 		}
+		if prioridad != "" {
+			incidencia.Prioridad = prioridad
+		}
+		return guardar(incidencia)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		mostrarConflicto(err)
+		pausar()
+		return
 	}
 
 	fmt.Println("\nIncidencia modificada exitosamente")
@@ -653,34 +1380,52 @@ func eliminarIncidencia() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	for i, inc := range incidencias {
-		if inc.ID == id {
-			// Desvincular de vehículo
-			for _, v := range vehiculos {
-				if v.Incidencia == inc {
-					v.Incidencia = nil
+	inc := buscarIncidencia(id)
+	if inc == nil {
+		fmt.Println("Error: Incidencia no encontrada")
+		pausar()
+		return
+	}
+
+	err := operacion(func() error {
+		// Desvincular de vehículo
+		if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+			for i, otra := range v.Incidencias {
+				if otra == inc {
+					v.Incidencias = append(v.Incidencias[:i:i], v.Incidencias[i+1:]...)
 					break
 				}
 			}
+			if v.Orden != 0 && len(lineasOrden(v, v.Orden)) == 0 {
+				v.Orden = 0
+			}
+			if err := guardar(v); err != nil {
+				return err
+			}
+		}
 
-			// Desvincular de mecánicos
-			for _, m := range inc.Mecanicos {
-				for j, incAsig := range m.Incidencias {
-					if incAsig == inc {
-						m.Incidencias = append(m.Incidencias[:j], m.Incidencias[j+1:]...)
-						break
-					}
+		// Desvincular de mecánicos
+		for _, m := range inc.Mecanicos {
+			for j, incAsig := range m.Incidencias {
+				if incAsig == inc {
+					m.Incidencias = append(m.Incidencias[:j], m.Incidencias[j+1:]...)
+					break
 				}
 			}
-
-			incidencias = append(incidencias[:i], incidencias[i+1:]...)
-			fmt.Println("Incidencia eliminada exitosamente")
-			pausar()
-			return
 		}
+
+		return almacen.Incidencias().Eliminar(inc)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	if err := borrarAdjuntos(inc.ID); err != nil {
+		fmt.Println("Aviso: no se pudieron borrar los adjuntos:", err)
 	}
 
-	fmt.Println("Error: Incidencia no encontrada")
+	fmt.Println("Incidencia eliminada exitosamente")
 	pausar()
 }
 
@@ -692,7 +1437,6 @@ func crearMecanico() {
 
 	fmt.Println("=== CREAR MECÁNICO ===")
 
-	var especialidad string
 	var anios int
 
 	fmt.Print("Nombre del mecánico: ")
@@ -705,24 +1449,9 @@ func crearMecanico() {
 		return
 	}
 
-	fmt.Println("\nEspecialidad:")
-	fmt.Println("1. Mecánica")
-	fmt.Println("2. Eléctrica")
-	fmt.Println("3. Carrocería")
-	var opcion int
-	fmt.Print("Opción: ")
-	fmt.Scanf("%d", &opcion)
-	fmt.Scanln()
-
-	switch opcion {
-	case 1:
-		especialidad = "mecánica"
-	case 2:
-		especialidad = "eléctrica"
-	case 3:
-		especialidad = "carrocería"
-	default:
-		fmt.Println("Opción inválida")
+	especialidades, err := leerNivelesEspecialidad(reader)
+	if err != nil {
+		fmt.Println("Error:", err)
 		pausar()
 		return
 	}
@@ -731,49 +1460,46 @@ func crearMecanico() {
 	fmt.Scanf("%d", &anios)
 	fmt.Scanln()
 
-	mecanico := &Mecanico{
-		ID:           contadorMecanico,
-		Nombre:       nombre,
-		Especialidad: especialidad,
-		AniosExp:     anios,
-		Activo:       true,
-		Incidencias:  []*Incidencia{},
+	var horario []Turno
+	texto := leerCriterio(reader, fmt.Sprintf("Horario (vacío = %s): ", formatearHorario(horarioHabitual())))
+	if texto != "" {
+		if horario, err = leerHorario(texto); err != nil {
+			fmt.Println("Error:", err)
+			pausar()
+			return
+		}
 	}
 
-	mecanicos = append(mecanicos, mecanico)
-	taller.Mecanicos = append(taller.Mecanicos, mecanico)
-	taller.TotalPlazas = calcularTotalPlazas()
-	contadorMecanico++
+	mecanico, err := registrarMecanico(0, nombre, especialidades, anios, horario, true)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
 
 	fmt.Println("\nMecánico creado exitosamente con ID:", mecanico.ID)
 	pausar()
 }
 
-func visualizarMecanicos() {
-	limpiarPantalla()
-	fmt.Println("=== LISTA DE MECÁNICOS ===")
-
-	if len(mecanicos) == 0 {
-		fmt.Println("No hay mecánicos registrados")
-		pausar()
-		return
-	}
-
-	for _, m := range mecanicos {
-		fmt.Printf("\nID: %d\n", m.ID)
-		fmt.Printf("Nombre: %s\n", m.Nombre)
-		fmt.Printf("Especialidad: %s\n", m.Especialidad)
-		fmt.Printf("Años de experiencia: %d\n", m.AniosExp)
-		if m.Activo {
-			fmt.Println("Estado: Activo")
-		} else {
-			fmt.Println("Estado: De baja")
+// leerNivelesEspecialidad pregunta el nivel del mecánico en cada tipo de
+// incidencia; los que se dejan vacíos no son especialidad suya.
+func leerNivelesEspecialidad(reader *bufio.Reader) ([]Especialidad, error) {
+	fmt.Printf("\nNivel en cada especialidad (%s; vacío si no la tiene)\n", strings.Join(nivelesEspecialidad, ", "))
+	var especialidades []Especialidad
+	for _, tipo := range tiposIncidencia {
+		fmt.Printf("%s: ", tipo)
+		nivel, _ := reader.ReadString('\n')
+		if nivel = strings.TrimSpace(nivel); nivel != "" {
+			especialidades = append(especialidades, Especialidad{tipo, nivel})
 		}
-		fmt.Printf("Incidencias asignadas: %d\n", len(m.Incidencias))
-		fmt.Println("---")
 	}
+	return normalizarEspecialidades(especialidades)
+}
 
-	pausar()
+func visualizarMecanicos() {
+	var l *listado
+	consultar(func() { l = listadoMecanicos("LISTA DE MECÁNICOS", almacen.Mecanicos().Todos()) })
+	mostrarListado(l)
 }
 
 func modificarMecanico() {
@@ -787,35 +1513,60 @@ func modificarMecanico() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var mecanico *Mecanico
-	for _, m := range mecanicos {
-		if m.ID == id {
-			mecanico = m
-			break
-		}
-	}
+	mecanico := buscarMecanico(id)
 
 	if mecanico == nil {
 		fmt.Println("Error: Mecánico no encontrado")
 		pausar()
 		return
 	}
+	var leido Mecanico // copia para detectar cambios de otros puestos
+	consultar(func() { leido = *mecanico })
 
-	fmt.Printf("\nMecánico actual: %s\n", mecanico.Nombre)
+	fmt.Printf("\nMecánico actual: %s\n", leido.Nombre)
+	fmt.Printf("Especialidades: %s\n", textoEspecialidades(leido.Especialidades))
 
 	fmt.Print("Nuevo nombre (dejar vacío para no cambiar): ")
 	nombre, _ := reader.ReadString('\n')
 	nombre = strings.TrimSpace(nombre)
-	if nombre != "" {
-		mecanico.Nombre = nombre
-	}
 
 	fmt.Print("Nuevos años de experiencia (0 para no cambiar): ")
 	var anios int
 	fmt.Scanf("%d", &anios)
 	fmt.Scanln()
-	if anios > 0 {
-		mecanico.AniosExp = anios
+
+	var especialidades []Especialidad
+	fmt.Print("¿Cambiar las especialidades? (S/N): ")
+	respuesta, _ := reader.ReadString('\n')
+	if strings.ToUpper(strings.TrimSpace(respuesta)) == "S" {
+		var err error
+		if especialidades, err = leerNivelesEspecialidad(reader); err != nil {
+			fmt.Println("Error:", err)
+			pausar()
+			return
+		}
+	}
+
+	err := operacion(func() error {
+		if err := comprobarVersion(&leido, mecanico); err != nil {
+			return err
+		}
+		if nombre != "" {
+			mecanico.Nombre = nombre
+		}
+		if anios > 0 {
+			mecanico.AniosExp = anios
+		}
+		if especialidades != nil {
+			mecanico.Especialidades = especialidades
+		}
+		return guardar(mecanico)
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		mostrarConflicto(err)
+		pausar()
+		return
 	}
 
 	fmt.Println("\nMecánico modificado exitosamente")
@@ -831,33 +1582,20 @@ func eliminarMecanico() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	for i, m := range mecanicos {
-		if m.ID == id {
-			if len(m.Incidencias) > 0 {
-				fmt.Println("Error: No se puede eliminar un mecánico con incidencias asignadas")
-				pausar()
-				return
-			}
-
-			mecanicos = append(mecanicos[:i], mecanicos[i+1:]...)
-
-			// Actualizar taller
-			for j, mecTaller := range taller.Mecanicos {
-				if mecTaller == m {
-					taller.Mecanicos = append(taller.Mecanicos[:j], taller.Mecanicos[j+1:]...)
-					break
-				}
-			}
-
-			taller.TotalPlazas = calcularTotalPlazas()
+	m := buscarMecanico(id)
+	if m == nil {
+		fmt.Println("Error: Mecánico no encontrado")
+		pausar()
+		return
+	}
 
-			fmt.Println("Mecánico eliminado exitosamente")
-			pausar()
-			return
-		}
+	if err := darDeBajaMecanico(m); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
 
-	fmt.Println("Error: Mecánico no encontrado")
+	fmt.Println("Mecánico eliminado exitosamente")
 	pausar()
 }
 
@@ -871,13 +1609,7 @@ func asignarVehiculoATaller() {
 	fmt.Print("Matrícula del vehículo: ")
 	fmt.Scanln(&matricula)
 
-	var vehiculo *Vehiculo
-	for _, v := range vehiculos {
-		if v.Matricula == matricula {
-			vehiculo = v
-			break
-		}
-	}
+	vehiculo := buscarVehiculo(matricula)
 
 	if vehiculo == nil {
 		fmt.Println("Error: Vehículo no encontrado")
@@ -885,36 +1617,49 @@ func asignarVehiculoATaller() {
 		return
 	}
 
-	if vehiculo.EnTaller {
-		fmt.Println("Error: El vehículo ya está en el taller")
+	plazaAsignada, err := ingresarVehiculo(vehiculo)
+	if err != nil {
+		fmt.Println("Error:", err)
 		pausar()
 		return
 	}
 
-	// Verificar plazas disponibles
-	plazasOcupadas := contarPlazasOcupadas()
-	totalPlazas := calcularTotalPlazas()
+	fmt.Printf("\nVehículo asignado exitosamente a la plaza %d\n", plazaAsignada)
+	pausar()
+}
+
+func entregarVehiculoCliente() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("=== ENTREGAR VEHÍCULO AL CLIENTE ===")
 
-	if plazasOcupadas >= totalPlazas {
-		fmt.Println("Error: No hay plazas disponibles en el taller")
+	matricula := leerCriterio(reader, "Matrícula del vehículo: ")
+	vehiculo := buscarVehiculo(matricula)
+	if vehiculo == nil {
+		fmt.Println("Error: Vehículo no encontrado")
 		pausar()
 		return
 	}
 
-	// Buscar primera plaza libre
-	plazaAsignada := -1
-	for i := 1; i <= totalPlazas; i++ {
-		if !taller.PlazasOcupadas[i] {
-			plazaAsignada = i
-			break
+	propietario := ""
+	consultar(func() {
+		if c := buscarPropietario(vehiculo); c != nil {
+			propietario = c.Nombre
 		}
+	})
+	recogidoPor := leerCriterio(reader, fmt.Sprintf("Recogido por (vacío para %q): ", propietario))
+	if recogidoPor == "" {
+		recogidoPor = propietario
 	}
+	pago := leerCriterio(reader, "Pago ("+strings.Join(estadosPago, ", ")+"): ")
 
-	vehiculo.EnTaller = true
-	vehiculo.NumeroPlaza = plazaAsignada
-	taller.PlazasOcupadas[plazaAsignada] = true
+	if err := entregarVehiculo(vehiculo, pago, recogidoPor); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
 
-	fmt.Printf("\nVehículo asignado exitosamente a la plaza %d\n", plazaAsignada)
+	fmt.Println("\nVehículo entregado; la plaza queda libre")
 	pausar()
 }
 
@@ -922,35 +1667,37 @@ func visualizarEstadoTaller() {
 	limpiarPantalla()
 	fmt.Println("=== ESTADO DEL TALLER ===")
 
-	totalPlazas := calcularTotalPlazas()
-	plazasOcupadas := contarPlazasOcupadas()
-	plazasLibres := totalPlazas - plazasOcupadas
-
-	fmt.Printf("\nTotal de plazas: %d\n", totalPlazas)
-	fmt.Printf("Plazas ocupadas: %d\n", plazasOcupadas)
-	fmt.Printf("Plazas libres: %d\n", plazasLibres)
-
-	fmt.Println("\n--- Detalle de plazas ocupadas ---")
-	for i := 1; i <= totalPlazas; i++ {
-		if taller.PlazasOcupadas[i] {
-			for _, v := range vehiculos {
-				if v.NumeroPlaza == i {
-					fmt.Printf("Plaza %d: %s %s (Matrícula: %s)\n",
-						i, v.Marca, v.Modelo, v.Matricula)
-					break
+	consultar(func() {
+		totalPlazas := calcularTotalPlazas()
+		plazasOcupadas := contarPlazasOcupadas()
+		plazasLibres := max(totalPlazas-plazasOcupadas, 0)
+
+		fmt.Printf("\nTotal de plazas hoy: %d\n", totalPlazas)
+		fmt.Printf("Plazas ocupadas: %d\n", plazasOcupadas)
+		fmt.Printf("Plazas libres: %d\n", plazasLibres)
+
+		fmt.Println("\n--- Detalle de plazas ocupadas ---")
+		for i := 1; i <= ultimaPlaza(); i++ {
+			if taller.PlazasOcupadas[i] {
+				for _, v := range almacen.Vehiculos().EnTaller() {
+					if v.NumeroPlaza == i {
+						fmt.Printf("Plaza %d: %s %s (Matrícula: %s)\n",
+							i, v.Marca, v.Modelo, v.Matricula)
+						break
+					}
 				}
 			}
 		}
-	}
 
-	fmt.Println("\n--- Mecánicos activos ---")
-	for _, m := range mecanicos {
-		if m.Activo {
-			fmt.Printf("%s (%s) - %d incidencias asignadas\n",
-				m.Nombre, m.Especialidad, len(m.Incidencias))
+		fmt.Println("\n--- Mecánicos que trabajan hoy ---")
+		hoy := time.Now()
+		for _, m := range almacen.Mecanicos().Todos() {
+			if disponibleEl(m, hoy) {
+				fmt.Printf("%s (%s) - %s - %d incidencias asignadas\n",
+					m.Nombre, textoEspecialidades(m.Especialidades), textoHorario(turnosDia(m, hoy.Weekday())), len(m.Incidencias))
+			}
 		}
-	}
-
+	})
 	pausar()
 }
 
@@ -963,13 +1710,7 @@ func darAltaBajaMecanico() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var mecanico *Mecanico
-	for _, m := range mecanicos {
-		if m.ID == id {
-			mecanico = m
-			break
-		}
-	}
+	mecanico := buscarMecanico(id)
 
 	if mecanico == nil {
 		fmt.Println("Error: Mecánico no encontrado")
@@ -977,20 +1718,35 @@ func darAltaBajaMecanico() {
 		return
 	}
 
-	if mecanico.Activo {
-		if len(mecanico.Incidencias) > 0 {
-			fmt.Println("Error: No se puede dar de baja a un mecánico con incidencias asignadas")
+	var activo bool
+	var pendientes int
+	consultar(func() { activo, pendientes = mecanico.Activo, pendientesMecanico(mecanico) })
+	if activo && pendientes > 0 {
+		fmt.Printf("El mecánico tiene %d incidencia(s) pendiente(s).\n", pendientes)
+		fmt.Print("¿Traspasarlas ahora para darle de baja? (S/N): ")
+		var respuesta string
+		fmt.Scanln(&respuesta)
+		if strings.ToUpper(respuesta) != "S" {
+			return
+		}
+		if err := pedirTraspasoPendientes(bufio.NewReader(os.Stdin), mecanico, "baja del mecánico"); err != nil {
+			fmt.Println("Error:", err)
 			pausar()
 			return
 		}
-		mecanico.Activo = false
-		fmt.Println("Mecánico dado de baja exitosamente")
-	} else {
-		mecanico.Activo = true
-		fmt.Println("Mecánico dado de alta exitosamente")
 	}
 
-	taller.TotalPlazas = calcularTotalPlazas()
+	if err := cambiarAltaMecanico(mecanico); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	if mecanico.Activo {
+		fmt.Println("Mecánico dado de alta exitosamente")
+	} else {
+		fmt.Println("Mecánico dado de baja exitosamente")
+	}
 	pausar()
 }
 
@@ -1003,13 +1759,7 @@ func cambiarEstadoIncidencia() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var incidencia *Incidencia
-	for _, inc := range incidencias {
-		if inc.ID == id {
-			incidencia = inc
-			break
-		}
-	}
+	incidencia := buscarIncidencia(id)
 
 	if incidencia == nil {
 		fmt.Println("Error: Incidencia no encontrada")
@@ -1018,38 +1768,21 @@ func cambiarEstadoIncidencia() {
 	}
 
 	fmt.Printf("\nEstado actual: %s\n", incidencia.Estado)
+	// La plaza no se libera al cerrar, sino cuando el cliente recoge el vehículo
 	fmt.Println("\nNuevo estado:")
-	fmt.Println("1. Abierta")
-	fmt.Println("2. En proceso")
-	fmt.Println("3. Cerrada")
-
-	var opcion int
-	fmt.Print("Opción: ")
-	fmt.Scanf("%d", &opcion)
-	fmt.Scanln()
-
-	switch opcion {
-	case 1:
-		incidencia.Estado = "abierta"
-	case 2:
-		incidencia.Estado = "en proceso"
-	case 3:
-		incidencia.Estado = "cerrada"
-		// Si se cierra, liberar el vehículo del taller
-		for _, v := range vehiculos {
-			if v.Incidencia == incidencia && v.EnTaller {
-				v.EnTaller = false
-				taller.PlazasOcupadas[v.NumeroPlaza] = false
-				v.NumeroPlaza = -1
-				fmt.Println("El vehículo ha sido liberado del taller")
-			}
-		}
-	default:
+	estado, ok := elegirDeCatalogo(estadosIncidencia)
+	if !ok {
 		fmt.Println("Opción inválida")
 		pausar()
 		return
 	}
 
+	if err := cambiarEstado(incidencia, string(estado)); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
 	fmt.Println("\nEstado de incidencia cambiado exitosamente")
 	pausar()
 }
@@ -1063,68 +1796,248 @@ func asignarMecanicoAIncidencia() {
 	fmt.Scanf("%d", &idIncidencia)
 	fmt.Scanln()
 
-	var incidencia *Incidencia
-	for _, inc := range incidencias {
-		if inc.ID == idIncidencia {
-			incidencia = inc
+	incidencia := buscarIncidencia(idIncidencia)
+
+	if incidencia == nil {
+		fmt.Println("Error: Incidencia no encontrada")
+		pausar()
+		return
+	}
+
+	fmt.Printf("\n--- Mecánicos disponibles (%s, nivel %s o superior) ---\n", incidencia.Tipo, nivelMinimo[incidencia.Prioridad])
+	mecanicosDisponibles := []*Mecanico{}
+	consultar(func() {
+		for _, m := range almacen.Mecanicos().PorEspecialidad(incidencia.Tipo) {
+			if validarAsignacion(incidencia, m) == nil {
+				mecanicosDisponibles = append(mecanicosDisponibles, m)
+				fmt.Printf("ID: %d - %s (%s, %d años exp, carga %s)\n",
+					m.ID, m.Nombre, nivelMecanico(m, incidencia.Tipo), m.AniosExp, textoCarga(cargaMecanico(m)))
+			}
+		}
+	})
+
+	if len(mecanicosDisponibles) == 0 {
+		fmt.Println("No hay mecánicos disponibles con la especialidad y el nivel requeridos")
+		pausar()
+		return
+	}
+
+	var idMecanico int
+	fmt.Print("\nID del mecánico a asignar: ")
+	fmt.Scanf("%d", &idMecanico)
+	fmt.Scanln()
+
+	var mecanico *Mecanico
+	for _, m := range mecanicosDisponibles {
+		if m.ID == idMecanico {
+			mecanico = m
 			break
 		}
 	}
 
+	if mecanico == nil {
+		fmt.Println("Error: Mecánico no encontrado o no disponible")
+		pausar()
+		return
+	}
+
+	if err := asignarMecanico(incidencia, mecanico); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nMecánico asignado exitosamente")
+	consultar(func() {
+		if aviso := avisoSobrecarga(mecanico); aviso != "" {
+			fmt.Println("Aviso:", aviso)
+		}
+	})
+	pausar()
+}
+
+// mecanicoDeIncidencia pide uno de los mecánicos asignados a la incidencia;
+// si sólo tiene uno no pregunta.
+func mecanicoDeIncidencia(incidencia *Incidencia, pregunta string) (*Mecanico, error) {
+	var asignados []*Mecanico
+	consultar(func() { asignados = append(asignados, incidencia.Mecanicos...) })
+	if len(asignados) == 0 {
+		return nil, errors.New("la incidencia no tiene mecánicos asignados")
+	}
+	if len(asignados) == 1 {
+		fmt.Printf("Mecánico asignado: %d - %s\n", asignados[0].ID, asignados[0].Nombre)
+		return asignados[0], nil
+	}
+	fmt.Println("\n--- Mecánicos asignados ---")
+	for _, m := range asignados {
+		fmt.Printf("ID: %d - %s\n", m.ID, m.Nombre)
+	}
+	var id int
+	fmt.Print(pregunta)
+	fmt.Scanf("%d", &id)
+	fmt.Scanln()
+	for _, m := range asignados {
+		if m.ID == id {
+			return m, nil
+		}
+	}
+	return nil, errors.New("ese mecánico no está asignado a la incidencia")
+}
+
+func retirarMecanicoDeIncidencia() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("=== RETIRAR MECÁNICO DE INCIDENCIA ===")
+
+	var idIncidencia int
+	fmt.Print("ID de la incidencia: ")
+	fmt.Scanf("%d", &idIncidencia)
+	fmt.Scanln()
+
+	incidencia := buscarIncidencia(idIncidencia)
 	if incidencia == nil {
 		fmt.Println("Error: Incidencia no encontrada")
 		pausar()
 		return
 	}
+	mecanico, err := mecanicoDeIncidencia(incidencia, "ID del mecánico a retirar: ")
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	motivo := leerCriterio(reader, "Motivo: ")
 
-	fmt.Println("\n--- Mecánicos disponibles ---")
-	mecanicosDisponibles := []*Mecanico{}
-	for _, m := range mecanicos {
-		if m.Activo && m.Especialidad == incidencia.Tipo {
-			mecanicosDisponibles = append(mecanicosDisponibles, m)
-			fmt.Printf("ID: %d - %s (%d años exp, %d incidencias)\n",
-				m.ID, m.Nombre, m.AniosExp, len(m.Incidencias))
+	if err := desasignarMecanico(incidencia, mecanico, motivo); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	fmt.Println("\nMecánico retirado de la incidencia")
+	pausar()
+}
+
+func traspasarIncidenciaMecanico() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("=== TRASPASAR INCIDENCIA A OTRO MECÁNICO ===")
+
+	var idIncidencia int
+	fmt.Print("ID de la incidencia: ")
+	fmt.Scanf("%d", &idIncidencia)
+	fmt.Scanln()
+
+	incidencia := buscarIncidencia(idIncidencia)
+	if incidencia == nil {
+		fmt.Println("Error: Incidencia no encontrada")
+		pausar()
+		return
+	}
+	desde, err := mecanicoDeIncidencia(incidencia, "ID del mecánico que la deja: ")
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\n--- Mecánicos que pueden recibirla ---")
+	var candidatos []*Mecanico
+	consultar(func() {
+		carga := map[*Mecanico]int{}
+		for _, m := range almacen.Mecanicos().Todos() {
+			carga[m] = cargaMecanico(m)
+		}
+		candidatos = candidatosPorCarga(incidencia, desde, carga)
+		for _, m := range candidatos {
+			fmt.Printf("ID: %d - %s (%s, carga %s)\n", m.ID, m.Nombre, nivelMecanico(m, incidencia.Tipo), textoCarga(carga[m]))
+		}
+	})
+	if len(candidatos) == 0 {
+		fmt.Println("Nadie más puede atender hoy esta incidencia")
+		pausar()
+		return
+	}
+
+	id, _ := strconv.Atoi(leerCriterio(reader, "\nID del mecánico que la recibe: "))
+	hacia := buscarMecanico(id)
+	if hacia == nil {
+		fmt.Println("Error: Mecánico no encontrado")
+		pausar()
+		return
+	}
+	motivo := leerCriterio(reader, "Motivo: ")
+
+	if err := traspasarIncidencia(incidencia, desde, hacia, motivo); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	fmt.Printf("\nIncidencia %d traspasada a %s\n", incidencia.ID, hacia.Nombre)
+	consultar(func() {
+		if aviso := avisoSobrecarga(hacia); aviso != "" {
+			fmt.Println("Aviso:", aviso)
+		}
+	})
+	pausar()
+}
+
+// pedirTraspasoPendientes pregunta a quién pasar las incidencias pendientes
+// del mecánico (o si se reparten solas) y por qué, y las traspasa.
+func pedirTraspasoPendientes(reader *bufio.Reader, mecanico *Mecanico, motivoPorDefecto string) error {
+	fmt.Println("\n--- Incidencias pendientes ---")
+	consultar(func() {
+		for _, inc := range mecanico.Incidencias {
+			if !trabajoTerminado(inc) {
+				fmt.Printf("%d: %s, %s, %s - %s\n", inc.ID, inc.Tipo, inc.Prioridad, inc.Estado, inc.Descripcion)
+			}
+		}
+	})
+
+	var destino *Mecanico
+	if texto := leerCriterio(reader, "ID del mecánico que las recibe (vacío = repartirlas entre los menos cargados): "); texto != "" {
+		id, _ := strconv.Atoi(texto)
+		if destino = buscarMecanico(id); destino == nil {
+			return errors.New("mecánico no encontrado")
 		}
 	}
+	pregunta := "Motivo: "
+	if motivoPorDefecto != "" {
+		pregunta = fmt.Sprintf("Motivo (vacío = %s): ", motivoPorDefecto)
+	}
+	motivo := leerCriterio(reader, pregunta)
+	if motivo == "" {
+		motivo = motivoPorDefecto
+	}
 
-	if len(mecanicosDisponibles) == 0 {
-		fmt.Println("No hay mecánicos disponibles con la especialidad requerida")
-		pausar()
-		return
+	movimientos, err := traspasarPendientes(mecanico, destino, motivo)
+	if err != nil {
+		return err
+	}
+	for _, mov := range movimientos {
+		fmt.Printf("Incidencia %d traspasada a %s\n", mov.Incidencia.ID, mov.Hacia.Nombre)
 	}
+	return nil
+}
 
-	var idMecanico int
-	fmt.Print("\nID del mecánico a asignar: ")
-	fmt.Scanf("%d", &idMecanico)
-	fmt.Scanln()
+func traspasarIncidenciasMecanico() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+	fmt.Println("=== TRASPASAR LAS INCIDENCIAS DE UN MECÁNICO ===")
 
-	var mecanico *Mecanico
-	for _, m := range mecanicosDisponibles {
-		if m.ID == idMecanico {
-			mecanico = m
-			break
-		}
-	}
+	var id int
+	fmt.Print("ID del mecánico: ")
+	fmt.Scanf("%d", &id)
+	fmt.Scanln()
 
+	mecanico := buscarMecanico(id)
 	if mecanico == nil {
-		fmt.Println("Error: Mecánico no encontrado o no disponible")
+		fmt.Println("Error: Mecánico no encontrado")
 		pausar()
 		return
 	}
-
-	// Verificar que no esté ya asignado
-	for _, m := range incidencia.Mecanicos {
-		if m.ID == mecanico.ID {
-			fmt.Println("Error: El mecánico ya está asignado a esta incidencia")
-			pausar()
-			return
-		}
+	if err := pedirTraspasoPendientes(reader, mecanico, ""); err != nil {
+		fmt.Println("Error:", err)
 	}
-
-	incidencia.Mecanicos = append(incidencia.Mecanicos, mecanico)
-	mecanico.Incidencias = append(mecanico.Incidencias, incidencia)
-
-	fmt.Println("\nMecánico asignado exitosamente")
 	pausar()
 }
 
@@ -1138,45 +2051,48 @@ func listarIncidenciasVehiculo() {
 	fmt.Print("Matrícula del vehículo: ")
 	fmt.Scanln(&matricula)
 
-	var vehiculo *Vehiculo
-	for _, v := range vehiculos {
-		if v.Matricula == matricula {
-			vehiculo = v
-			break
+	consultar(func() {
+		vehiculo := buscarVehiculo(matricula)
+
+		if vehiculo == nil {
+			fmt.Println("Error: Vehículo no encontrado")
+			return
 		}
-	}
 
-	if vehiculo == nil {
-		fmt.Println("Error: Vehículo no encontrado")
-		pausar()
-		return
-	}
+		fmt.Printf("\nVehículo: %s %s (Matrícula: %s)\n",
+			vehiculo.Marca, vehiculo.Modelo, vehiculo.Matricula)
 
-	fmt.Printf("\nVehículo: %s %s (Matrícula: %s)\n",
-		vehiculo.Marca, vehiculo.Modelo, vehiculo.Matricula)
+		if len(vehiculo.Incidencias) == 0 {
+			fmt.Println("Este vehículo no tiene incidencias")
+		}
+		orden := -1
+		for _, inc := range vehiculo.Incidencias {
+			if inc.Orden != orden {
+				orden = inc.Orden
+				if orden == vehiculo.Orden {
+					fmt.Printf("\n--- Orden de trabajo #%d (en curso) ---\n", orden)
+				} else {
+					fmt.Printf("\n--- Orden de trabajo #%d ---\n", orden)
+				}
+			}
+			fmt.Printf("\nID: %d\n", inc.ID)
+			fmt.Printf("Tipo: %s\n", inc.Tipo)
+			fmt.Printf("Prioridad: %s\n", inc.Prioridad)
+			fmt.Printf("Estado: %s\n", inc.Estado)
+			fmt.Printf("Descripción: %s\n", inc.Descripcion)
 
-	if vehiculo.Incidencia == nil {
-		fmt.Println("Este vehículo no tiene incidencias")
-	} else {
-		inc := vehiculo.Incidencia
-		fmt.Printf("\nID: %d\n", inc.ID)
-		fmt.Printf("Tipo: %s\n", inc.Tipo)
-		fmt.Printf("Prioridad: %s\n", inc.Prioridad)
-		fmt.Printf("Estado: %s\n", inc.Estado)
-		fmt.Printf("Descripción: %s\n", inc.Descripcion)
-
-		if len(inc.Mecanicos) > 0 {
-			fmt.Print("Mecánicos asignados: ")
-			for i, m := range inc.Mecanicos {
-				if i > 0 {
-					fmt.Print(", ")
+			if len(inc.Mecanicos) > 0 {
+				fmt.Print("Mecánicos asignados: ")
+				for i, m := range inc.Mecanicos {
+					if i > 0 {
+						fmt.Print(", ")
+					}
+					fmt.Print(m.Nombre)
 				}
-				fmt.Print(m.Nombre)
+				fmt.Println()
 			}
-			fmt.Println()
 		}
-	}
-
+	})
 	pausar()
 }
 
@@ -1189,39 +2105,33 @@ func listarVehiculosCliente() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var cliente *Cliente
-	for _, c := range clientes {
-		if c.ID == id {
-			cliente = c
-			break
-		}
-	}
+	consultar(func() {
+		cliente := buscarCliente(id)
 
-	if cliente == nil {
-		fmt.Println("Error: Cliente no encontrado")
-		pausar()
-		return
-	}
+		if cliente == nil {
+			fmt.Println("Error: Cliente no encontrado")
+			return
+		}
 
-	fmt.Printf("\nCliente: %s\n", cliente.Nombre)
-	fmt.Printf("Teléfono: %s\n", cliente.Telefono)
-	fmt.Printf("Email: %s\n", cliente.Email)
+		fmt.Printf("\nCliente: %s\n", cliente.Nombre)
+		fmt.Printf("Teléfono: %s\n", cliente.Telefono)
+		fmt.Printf("Email: %s\n", cliente.Email)
 
-	if cliente.Vehiculo == nil {
-		fmt.Println("\nEste cliente no tiene vehículos registrados")
-	} else {
-		v := cliente.Vehiculo
-		fmt.Printf("\n--- Vehículo ---\n")
-		fmt.Printf("Matrícula: %s\n", v.Matricula)
-		fmt.Printf("Marca: %s\n", v.Marca)
-		fmt.Printf("Modelo: %s\n", v.Modelo)
-		if v.EnTaller {
-			fmt.Printf("Estado: En taller (Plaza %d)\n", v.NumeroPlaza)
+		if cliente.Vehiculo == nil {
+			fmt.Println("\nEste cliente no tiene vehículos registrados")
 		} else {
-			fmt.Println("Estado: Fuera del taller")
+			v := cliente.Vehiculo
+			fmt.Printf("\n--- Vehículo ---\n")
+			fmt.Printf("Matrícula: %s\n", v.Matricula)
+			fmt.Printf("Marca: %s\n", v.Marca)
+			fmt.Printf("Modelo: %s\n", v.Modelo)
+			if v.EnTaller {
+				fmt.Printf("Estado: En taller (Plaza %d)\n", v.NumeroPlaza)
+			} else {
+				fmt.Println("Estado: Fuera del taller")
+			}
 		}
-	}
-
+	})
 	pausar()
 }
 
@@ -1229,22 +2139,29 @@ func listarMecanicosDisponibles() {
 	limpiarPantalla()
 	fmt.Println("=== MECÁNICOS DISPONIBLES ===")
 
-	disponibles := false
-	for _, m := range mecanicos {
-		if m.Activo && len(m.Incidencias) == 0 {
-			disponibles = true
+	consultar(func() {
+		// Los que trabajan hoy y no llegan a la carga máxima, de menos a más cargado
+		var disponibles []*Mecanico
+		for _, m := range almacen.Mecanicos().Todos() {
+			if disponibleEl(m, time.Now()) && cargaMecanico(m) < cargaMaxima {
+				disponibles = append(disponibles, m)
+			}
+		}
+		sort.SliceStable(disponibles, func(i, j int) bool { return cargaMecanico(disponibles[i]) < cargaMecanico(disponibles[j]) })
+
+		for _, m := range disponibles {
 			fmt.Printf("\nID: %d\n", m.ID)
 			fmt.Printf("Nombre: %s\n", m.Nombre)
-			fmt.Printf("Especialidad: %s\n", m.Especialidad)
+			fmt.Printf("Especialidades: %s\n", textoEspecialidades(m.Especialidades))
 			fmt.Printf("Años de experiencia: %d\n", m.AniosExp)
+			fmt.Printf("Carga: %s\n", textoCarga(cargaMecanico(m)))
 			fmt.Println("---")
 		}
-	}
-
-	if !disponibles {
-		fmt.Println("No hay mecánicos disponibles sin incidencias asignadas")
-	}
 
+		if len(disponibles) == 0 {
+			fmt.Println("No hay mecánicos que trabajen hoy con capacidad libre")
+		}
+	})
 	pausar()
 }
 
@@ -1257,132 +2174,38 @@ func listarIncidenciasMecanico() {
 	fmt.Scanf("%d", &id)
 	fmt.Scanln()
 
-	var mecanico *Mecanico
-	for _, m := range mecanicos {
-		if m.ID == id {
-			mecanico = m
-			break
-		}
-	}
+	consultar(func() {
+		mecanico := buscarMecanico(id)
 
-	if mecanico == nil {
-		fmt.Println("Error: Mecánico no encontrado")
-		pausar()
-		return
-	}
+		if mecanico == nil {
+			fmt.Println("Error: Mecánico no encontrado")
+			return
+		}
 
-	fmt.Printf("\nMecánico: %s (%s)\n", mecanico.Nombre, mecanico.Especialidad)
+		fmt.Printf("\nMecánico: %s (%s)\n", mecanico.Nombre, textoEspecialidades(mecanico.Especialidades))
 
-	if len(mecanico.Incidencias) == 0 {
-		fmt.Println("Este mecánico no tiene incidencias asignadas")
-	} else {
-		fmt.Printf("\nTotal de incidencias: %d\n", len(mecanico.Incidencias))
-		for _, inc := range mecanico.Incidencias {
-			fmt.Printf("\n--- Incidencia ID: %d ---\n", inc.ID)
-			fmt.Printf("Tipo: %s\n", inc.Tipo)
-			fmt.Printf("Prioridad: %s\n", inc.Prioridad)
-			fmt.Printf("Estado: %s\n", inc.Estado)
-			fmt.Printf("Descripción: %s\n", inc.Descripcion)
+		if len(mecanico.Incidencias) == 0 {
+			fmt.Println("Este mecánico no tiene incidencias asignadas")
+		} else {
+			fmt.Printf("\nTotal de incidencias: %d\n", len(mecanico.Incidencias))
+			for _, inc := range mecanico.Incidencias {
+				fmt.Printf("\n--- Incidencia ID: %d ---\n", inc.ID)
+				fmt.Printf("Tipo: %s\n", inc.Tipo)
+				fmt.Printf("Prioridad: %s\n", inc.Prioridad)
+				fmt.Printf("Estado: %s\n", inc.Estado)
+				fmt.Printf("Descripción: %s\n", inc.Descripcion)
+			}
 		}
-	}
-
+	})
 	pausar()
 }
 
 func listarClientesConVehiculosEnTaller() {
-	limpiarPantalla()
-	fmt.Println("=== CLIENTES CON VEHÍCULOS EN TALLER ===")
-
-	encontrados := false
-	for _, c := range clientes {
-		if c.Vehiculo != nil && c.Vehiculo.EnTaller {
-			encontrados = true
-			fmt.Printf("\n--- Cliente ---\n")
-			fmt.Printf("ID: %d\n", c.ID)
-			fmt.Printf("Nombre: %s\n", c.Nombre)
-			fmt.Printf("Teléfono: %s\n", c.Telefono)
-			fmt.Printf("Email: %s\n", c.Email)
-
-			v := c.Vehiculo
-			fmt.Printf("\nVehículo: %s %s\n", v.Marca, v.Modelo)
-			fmt.Printf("Matrícula: %s\n", v.Matricula)
-			fmt.Printf("Plaza: %d\n", v.NumeroPlaza)
-
-			if v.Incidencia != nil {
-				fmt.Printf("Incidencia: %s (%s)\n",
-					v.Incidencia.Tipo, v.Incidencia.Estado)
-			}
-			fmt.Println("---")
-		}
-	}
-
-	if !encontrados {
-		fmt.Println("No hay clientes con vehículos en el taller actualmente")
-	}
-
-	pausar()
+	mostrarReporte(reporteClientesEnTaller)
 }
 
 func listarTodasIncidenciasTaller() {
-	limpiarPantalla()
-	fmt.Println("=== TODAS LAS INCIDENCIAS DEL TALLER ===")
-
-	if len(incidencias) == 0 {
-		fmt.Println("No hay incidencias registradas en el taller")
-		pausar()
-		return
-	}
-
-	// Agrupar por estado
-	abiertas := []*Incidencia{}
-	enProceso := []*Incidencia{}
-	cerradas := []*Incidencia{}
-
-	for _, inc := range incidencias {
-		switch inc.Estado {
-		case "abierta":
-			abiertas = append(abiertas, inc)
-		case "en proceso":
-			enProceso = append(enProceso, inc)
-		case "cerrada":
-			cerradas = append(cerradas, inc)
-		}
-	}
-
-	fmt.Println("\n=== INCIDENCIAS ABIERTAS ===")
-	if len(abiertas) == 0 {
-		fmt.Println("Ninguna")
-	} else {
-		for _, inc := range abiertas {
-			fmt.Printf("ID: %d - %s (%s) - %s\n",
-				inc.ID, inc.Tipo, inc.Prioridad, inc.Descripcion)
-		}
-	}
-
-	fmt.Println("\n=== INCIDENCIAS EN PROCESO ===")
-	if len(enProceso) == 0 {
-		fmt.Println("Ninguna")
-	} else {
-		for _, inc := range enProceso {
-			fmt.Printf("ID: %d - %s (%s) - %s\n",
-				inc.ID, inc.Tipo, inc.Prioridad, inc.Descripcion)
-		}
-	}
-
-	fmt.Println("\n=== INCIDENCIAS CERRADAS ===")
-	if len(cerradas) == 0 {
-		fmt.Println("Ninguna")
-	} else {
-		for _, inc := range cerradas {
-			fmt.Printf("ID: %d - %s (%s) - %s\n",
-				inc.ID, inc.Tipo, inc.Prioridad, inc.Descripcion)
-		}
-	}
-
-	fmt.Printf("\nTotal: %d incidencias (%d abiertas, %d en proceso, %d cerradas)\n",
-		len(incidencias), len(abiertas), len(enProceso), len(cerradas))
-
-	pausar()
+	mostrarReporte(reporteIncidenciasPorEstado)
 }
 
 // Menús
@@ -1396,6 +2219,7 @@ func menuClientes() {
 		fmt.Println("3. Modificar cliente")
 		fmt.Println("4. Eliminar cliente")
 		fmt.Println("5. Listar vehículos de un cliente")
+		fmt.Println("6. Buscar clientes")
 		fmt.Println("0. Volver al menú principal")
 
 		var opcion int
@@ -1414,6 +2238,8 @@ func menuClientes() {
 			eliminarCliente()
 		case 5:
 			listarVehiculosCliente()
+		case 6:
+			buscarClientes()
 		case 0:
 			return
 		default:
@@ -1432,6 +2258,8 @@ func menuVehiculos() {
 		fmt.Println("3. Modificar vehículo")
 		fmt.Println("4. Eliminar vehículo")
 		fmt.Println("5. Listar incidencias de un vehículo")
+		fmt.Println("6. Buscar vehículos")
+		fmt.Println("7. Imprimir justificante de entrada (PDF)")
 		fmt.Println("0. Volver al menú principal")
 
 		var opcion int
@@ -1450,6 +2278,10 @@ func menuVehiculos() {
 			eliminarVehiculo()
 		case 5:
 			listarIncidenciasVehiculo()
+		case 6:
+			buscarVehiculos()
+		case 7:
+			imprimirJustificante()
 		case 0:
 			return
 		default:
@@ -1470,6 +2302,12 @@ func menuIncidencias() {
 		fmt.Println("5. Cambiar estado de incidencia")
 		fmt.Println("6. Asignar mecánico a incidencia")
 		fmt.Println("7. Listar todas las incidencias del taller")
+		fmt.Println("8. Buscar incidencias")
+		fmt.Println("9. Imprimir orden de trabajo (PDF)")
+		fmt.Println("10. Imprimir informe de cierre (PDF)")
+		fmt.Println("11. Retirar mecánico de incidencia")
+		fmt.Println("12. Traspasar incidencia a otro mecánico")
+		fmt.Println("13. Notas y adjuntos de una incidencia")
 		fmt.Println("0. Volver al menú principal")
 
 		var opcion int
@@ -1492,6 +2330,18 @@ func menuIncidencias() {
 			asignarMecanicoAIncidencia()
 		case 7:
 			listarTodasIncidenciasTaller()
+		case 8:
+			buscarIncidencias()
+		case 9:
+			imprimirDocumentoIncidencia(false)
+		case 10:
+			imprimirDocumentoIncidencia(true)
+		case 11:
+			retirarMecanicoDeIncidencia()
+		case 12:
+			traspasarIncidenciaMecanico()
+		case 13:
+			notasIncidencia()
 		case 0:
 			return
 		default:
@@ -1512,6 +2362,12 @@ func menuMecanicos() {
 		fmt.Println("5. Dar alta/baja a mecánico")
 		fmt.Println("6. Listar mecánicos disponibles")
 		fmt.Println("7. Listar incidencias de un mecánico")
+		fmt.Println("8. Buscar mecánicos")
+		fmt.Println("9. Cobertura de especialidades")
+		fmt.Println("10. Horario y ausencias de un mecánico")
+		fmt.Println("11. Disponibilidad de los mecánicos")
+		fmt.Println("12. Reparto de la carga de trabajo")
+		fmt.Println("13. Traspasar las incidencias de un mecánico")
 		fmt.Println("0. Volver al menú principal")
 
 		var opcion int
@@ -1534,6 +2390,18 @@ func menuMecanicos() {
 			listarMecanicosDisponibles()
 		case 7:
 			listarIncidenciasMecanico()
+		case 8:
+			buscarMecanicos()
+		case 9:
+			mostrarReporte(reporteCoberturaEspecialidades)
+		case 10:
+			gestionarHorarioMecanico()
+		case 11:
+			mostrarDisponibilidad()
+		case 12:
+			mostrarReporte(reporteReparto)
+		case 13:
+			traspasarIncidenciasMecanico()
 		case 0:
 			return
 		default:
@@ -1550,6 +2418,10 @@ func menuTaller() {
 		fmt.Println("1. Asignar vehículo a taller")
 		fmt.Println("2. Visualizar estado del taller")
 		fmt.Println("3. Listar clientes con vehículos en taller")
+		fmt.Println("4. Panel en directo")
+		fmt.Println("5. Informes e indicadores")
+		fmt.Println("6. Generar informe (texto, Markdown o HTML)")
+		fmt.Println("7. Entregar vehículo al cliente")
 		fmt.Println("0. Volver al menú principal")
 
 		var opcion int
@@ -1564,6 +2436,89 @@ func menuTaller() {
 			visualizarEstadoTaller()
 		case 3:
 			listarClientesConVehiculosEnTaller()
+		case 4:
+			visualizarPanelTaller()
+		case 5:
+			informesTaller()
+		case 6:
+			generarReporte()
+		case 7:
+			entregarVehiculoCliente()
+		case 0:
+			return
+		default:
+			fmt.Println("Opción inválida")
+			pausar()
+		}
+	}
+}
+
+func menuImportarExportar() {
+	for {
+		limpiarPantalla()
+		fmt.Println("=== IMPORTAR / EXPORTAR CSV ===")
+		fmt.Println("1. Exportar todos los datos a CSV")
+		fmt.Println("2. Importar clientes")
+		fmt.Println("3. Importar vehículos")
+		fmt.Println("4. Importar mecánicos")
+		fmt.Println("5. Importar incidencias")
+		fmt.Println("0. Volver al menú principal")
+
+		var opcion int
+		fmt.Print("\nSeleccione una opción: ")
+		fmt.Scanf("%d", &opcion)
+		fmt.Scanln()
+
+		switch opcion {
+		case 1:
+			exportarDatosCSV()
+		case 2:
+			importarDatosCSV("clientes")
+		case 3:
+			importarDatosCSV("vehiculos")
+		case 4:
+			importarDatosCSV("mecanicos")
+		case 5:
+			importarDatosCSV("incidencias")
+		case 0:
+			return
+		default:
+			fmt.Println("Opción inválida")
+			pausar()
+		}
+	}
+}
+
+func menuCopiasSeguridad() {
+	for {
+		limpiarPantalla()
+		fmt.Println("=== INSTANTÁNEAS Y COPIAS DE SEGURIDAD ===")
+		fmt.Println("1. Exportar instantánea JSON")
+		fmt.Println("2. Importar instantánea JSON")
+		fmt.Println("3. Crear copia de seguridad ahora")
+		fmt.Println("4. Listar copias de seguridad")
+		fmt.Println("5. Configurar retención de copias")
+		fmt.Println("6. Comprobar migraciones de un fichero")
+		fmt.Println("0. Volver al menú principal")
+
+		var opcion int
+		fmt.Print("\nSeleccione una opción: ")
+		fmt.Scanf("%d", &opcion)
+		fmt.Scanln()
+
+		switch opcion {
+		case 1:
+			exportarSnapshot()
+		case 2:
+			importarSnapshot()
+		case 3:
+			crearBackupManual()
+		case 4:
+			visualizarBackups()
+		case 5:
+			configurarRetencionBackups()
+		case 6:
+			comprobarMigraciones()
 		case 0:
 			return
 		default:
@@ -1578,231 +2533,283 @@ func menuTaller() {
 // *******************************************************************************
 
 func cargarDatosPrueba() {
-	// Reiniciar datos para prueba reproducible
-	clientes = []*Cliente{}
-	vehiculos = []*Vehiculo{}
-	incidencias = []*Incidencia{}
-	mecanicos = []*Mecanico{}
-	taller.Mecanicos = []*Mecanico{}
-	taller.PlazasOcupadas = make(map[int]bool)
-
-	contadorCliente = 1
-	contadorMecanico = 1
-	contadorIncidencia = 1
-
-	// Crear mecánicos (3 activos + 1 de baja)
-	mec1 := &Mecanico{
-		ID:           contadorMecanico,
-		Nombre:       "Juan Pérez",
-		Especialidad: "mecánica",
-		AniosExp:     10,
-		Activo:       true,
-		Incidencias:  []*Incidencia{},
-	}
-	mecanicos = append(mecanicos, mec1)
-	taller.Mecanicos = append(taller.Mecanicos, mec1)
-	contadorMecanico++
-
-	mec2 := &Mecanico{
-		ID:           contadorMecanico,
-		Nombre:       "María García",
-		Especialidad: "eléctrica",
-		AniosExp:     8,
-		Activo:       true,
-		Incidencias:  []*Incidencia{},
-	}
-	mecanicos = append(mecanicos, mec2)
-	taller.Mecanicos = append(taller.Mecanicos, mec2)
-	contadorMecanico++
-
-	mec3 := &Mecanico{
-		ID:           contadorMecanico,
-		Nombre:       "Carlos López",
-		Especialidad: "carrocería",
-		AniosExp:     5,
-		Activo:       true,
-		Incidencias:  []*Incidencia{},
-	}
-	mecanicos = append(mecanicos, mec3)
-	taller.Mecanicos = append(taller.Mecanicos, mec3)
-	contadorMecanico++
-
-	// mecánico de baja (para demostrar altas/bajas)
-	mec4 := &Mecanico{
-		ID:           contadorMecanico,
-		Nombre:       "Luis Díaz",
-		Especialidad: "mecánica",
-		AniosExp:     3,
-		Activo:       false,
-		Incidencias:  []*Incidencia{},
-	}
-	mecanicos = append(mecanicos, mec4)
-	taller.Mecanicos = append(taller.Mecanicos, mec4)
-	contadorMecanico++
-
-	// Actualizar total de plazas según mecánicos activos
-	taller.TotalPlazas = calcularTotalPlazas()
-
-	// Crear clientes
-	cliente1 := &Cliente{
-		ID:       contadorCliente,
-		Nombre:   "Ana Martínez",
-		Telefono: "600111222",
-		Email:    "ana@email.com",
-		Vehiculo: nil,
-	}
-	clientes = append(clientes, cliente1)
-	contadorCliente++
-
-	cliente2 := &Cliente{
-		ID:       contadorCliente,
-		Nombre:   "Pedro Sánchez",
-		Telefono: "600333444",
-		Email:    "pedro@email.com",
-		Vehiculo: nil,
-	}
-	clientes = append(clientes, cliente2)
-	contadorCliente++
-
-	cliente3 := &Cliente{
-		ID:       contadorCliente,
-		Nombre:   "Laura Gómez",
-		Telefono: "600555666",
-		Email:    "laura@email.com",
-		Vehiculo: nil,
-	}
-	clientes = append(clientes, cliente3)
-	contadorCliente++
-
-	cliente4 := &Cliente{
-		ID:       contadorCliente,
-		Nombre:   "Martín Ruiz",
-		Telefono: "600777888",
-		Email:    "martin@email.com",
-		Vehiculo: nil,
-	}
-	clientes = append(clientes, cliente4)
-	contadorCliente++
-
-	cliente5 := &Cliente{
-		ID:       contadorCliente,
-		Nombre:   "Jorge Ramírez",
-		Telefono: "600111333",
-		Email:    "jorge@email.com",
-		Vehiculo: nil,
-	}
-	clientes = append(clientes, cliente5)
-	contadorCliente++
-
-	// Crear vehículos y asociar a clientes
-	veh1 := &Vehiculo{
-		Matricula:    "1234ABC",
-		Marca:        "Seat",
-		Modelo:       "León",
-		FechaEntrada: obtenerFechaActual(),
-		FechaSalida:  "",
-		Incidencia:   nil,
-		EnTaller:     true,
-		NumeroPlaza:  1,
-	}
-	vehiculos = append(vehiculos, veh1)
-	cliente1.Vehiculo = veh1
-	taller.PlazasOcupadas[1] = true
-
-	veh2 := &Vehiculo{
-		Matricula:    "5678XYZ",
-		Marca:        "Volkswagen",
-		Modelo:       "Golf",
-		FechaEntrada: obtenerFechaActual(),
-		FechaSalida:  "",
-		Incidencia:   nil,
-		EnTaller:     true,
-		NumeroPlaza:  2,
-	}
-	vehiculos = append(vehiculos, veh2)
-	cliente2.Vehiculo = veh2
-	taller.PlazasOcupadas[2] = true
-
-	veh3 := &Vehiculo{
-		Matricula:    "9999QWE",
-		Marca:        "Toyota",
-		Modelo:       "Yaris",
-		FechaEntrada: obtenerFechaActual(),
-		FechaSalida:  "",
-		Incidencia:   nil,
-		EnTaller:     false,
-		NumeroPlaza:  -1,
-	}
-	vehiculos = append(vehiculos, veh3)
-	cliente3.Vehiculo = veh3
+	// Guardar los datos actuales antes de sobrescribirlos
+	crearBackupAutomatico()
+
+	err := operacion(func() error {
+		// Reiniciar datos para prueba reproducible
+		clientes := []*Cliente{}
+		vehiculos := []*Vehiculo{}
+		incidencias := []*Incidencia{}
+		mecanicos := []*Mecanico{}
+		taller.Mecanicos = []*Mecanico{}
+		taller.PlazasOcupadas = make(map[int]bool)
+
+		contadorCliente.fijar(1)
+		contadorMecanico.fijar(1)
+		contadorIncidencia.fijar(1)
+
+		// Crear mecánicos (3 activos + 1 de baja), con horarios distintos
+		horarioMaria, _ := leerHorario("lu-vi 07:00-15:00")
+		horarioCarlos, _ := leerHorario("ma-vi 10:00-18:00; sa 09:00-14:00")
+		mec1 := &Mecanico{
+			ID:             contadorMecanico.asignar(0),
+			Nombre:         "Juan Pérez",
+			Especialidades: []Especialidad{{tipoMecanica, "experto"}, {tipoElectrica, "básico"}},
+			AniosExp:       10,
+			Activo:         true,
+			Horario:        horarioHabitual(),
+			Incidencias:    []*Incidencia{},
+		}
+		mecanicos = append(mecanicos, mec1)
+		taller.Mecanicos = append(taller.Mecanicos, mec1)
+
+		mec2 := &Mecanico{
+			ID:             contadorMecanico.asignar(0),
+			Nombre:         "María García",
+			Especialidades: []Especialidad{{tipoElectrica, "experto"}},
+			AniosExp:       8,
+			Activo:         true,
+			Horario:        horarioMaria,
+			Ausencias: []Ausencia{{time.Now().AddDate(0, 0, 14).Format("02/01/2006"),
+				time.Now().AddDate(0, 0, 20).Format("02/01/2006"), "vacaciones"}},
+			Incidencias: []*Incidencia{},
+		}
+		mecanicos = append(mecanicos, mec2)
+		taller.Mecanicos = append(taller.Mecanicos, mec2)
+
+		mec3 := &Mecanico{
+			ID:             contadorMecanico.asignar(0),
+			Nombre:         "Carlos López",
+			Especialidades: []Especialidad{{tipoCarroceria, "intermedio"}, {tipoMecanica, "básico"}},
+			AniosExp:       5,
+			Activo:         true,
+			Horario:        horarioCarlos,
+			Incidencias:    []*Incidencia{},
+		}
+		mecanicos = append(mecanicos, mec3)
+		taller.Mecanicos = append(taller.Mecanicos, mec3)
+
+		// mecánico de baja (para demostrar altas/bajas)
+		mec4 := &Mecanico{
+			ID:             contadorMecanico.asignar(0),
+			Nombre:         "Luis Díaz",
+			Especialidades: []Especialidad{{tipoMecanica, "intermedio"}},
+			AniosExp:       3,
+			Activo:         false,
+			Horario:        horarioHabitual(),
+			Incidencias:    []*Incidencia{},
+		}
+		mecanicos = append(mecanicos, mec4)
+		taller.Mecanicos = append(taller.Mecanicos, mec4)
+
+		// Crear clientes
+		cliente1 := &Cliente{
+			ID:       contadorCliente.asignar(0),
+			Nombre:   "Ana Martínez",
+			Telefono: "600111222",
+			Email:    "ana@email.com",
+			Vehiculo: nil,
+		}
+		clientes = append(clientes, cliente1)
+
+		cliente2 := &Cliente{
+			ID:       contadorCliente.asignar(0),
+			Nombre:   "Pedro Sánchez",
+			Telefono: "600333444",
+			Email:    "pedro@email.com",
+			Vehiculo: nil,
+		}
+		clientes = append(clientes, cliente2)
+
+		cliente3 := &Cliente{
+			ID:       contadorCliente.asignar(0),
+			Nombre:   "Laura Gómez",
+			Telefono: "600555666",
+			Email:    "laura@email.com",
+			Vehiculo: nil,
+		}
+		clientes = append(clientes, cliente3)
+
+		cliente4 := &Cliente{
+			ID:       contadorCliente.asignar(0),
+			Nombre:   "Martín Ruiz",
+			Telefono: "600777888",
+			Email:    "martin@email.com",
+			Vehiculo: nil,
+		}
+		clientes = append(clientes, cliente4)
+
+		cliente5 := &Cliente{
+			ID:       contadorCliente.asignar(0),
+			Nombre:   "Jorge Ramírez",
+			Telefono: "600111333",
+			Email:    "jorge@email.com",
+			Vehiculo: nil,
+		}
+		clientes = append(clientes, cliente5)
+
+		// Crear vehículos y asociar a clientes
+		veh1 := &Vehiculo{
+			Matricula:    "1234ABC",
+			Marca:        "Seat",
+			Modelo:       "León",
+			FechaEntrada: obtenerFechaActual(),
+			FechaSalida:  "",
+			EnTaller:     true,
+			NumeroPlaza:  1,
+			EntradaPlaza: time.Now().Add(-5 * time.Hour),
+		}
+		vehiculos = append(vehiculos, veh1)
+		cliente1.Vehiculo = veh1
+		taller.PlazasOcupadas[1] = true
+
+		veh2 := &Vehiculo{
+			Matricula:    "5678XYZ",
+			Marca:        "Volkswagen",
+			Modelo:       "Golf",
+			FechaEntrada: obtenerFechaActual(),
+			FechaSalida:  "",
+			EnTaller:     true,
+			NumeroPlaza:  2,
+			EntradaPlaza: time.Now().Add(-45 * time.Minute),
+		}
+		vehiculos = append(vehiculos, veh2)
+		cliente2.Vehiculo = veh2
+		taller.PlazasOcupadas[2] = true
+
+		veh3 := &Vehiculo{
+			Matricula:    "9999QWE",
+			Marca:        "Toyota",
+			Modelo:       "Yaris",
+			FechaEntrada: obtenerFechaActual(),
+			FechaSalida:  "",
+			EnTaller:     false,
+			NumeroPlaza:  -1,
+		}
+		vehiculos = append(vehiculos, veh3)
+		cliente3.Vehiculo = veh3
+
+		veh4 := &Vehiculo{
+			Matricula:    "4444ZZZ",
+			Marca:        "Ford",
+			Modelo:       "Focus",
+			FechaEntrada: obtenerFechaActual(),
+			FechaSalida:  time.Now().Add(-26 * time.Hour).Format("02/01/2006"),
+			EnTaller:     false,
+			NumeroPlaza:  -1,
+			EstadoPago:   "pagado",
+			RecogidoPor:  "Martín Ruiz",
+		}
+		vehiculos = append(vehiculos, veh4)
+		cliente4.Vehiculo = veh4
+
+		// Crear incidencias con distintos estados y asignaciones
+		inc1 := &Incidencia{
+			ID:          contadorIncidencia.asignar(0),
+			Mecanicos:   []*Mecanico{mec1}, // asignado
+			Tipo:        tipoMecanica,
+			Prioridad:   prioridadAlta,
+			Descripcion: "Cambio de correa de distribución",
+			Estado:      estadoAbierta,
+		}
+		incidencias = append(incidencias, inc1)
+		veh1.Incidencias = []*Incidencia{inc1}
+		inc1.Orden, veh1.Orden = inc1.ID, inc1.ID
+		mec1.Incidencias = append(mec1.Incidencias, inc1)
+
+		inc2 := &Incidencia{
+			ID:          contadorIncidencia.asignar(0),
+			Mecanicos:   []*Mecanico{mec2}, // asignado
+			Tipo:        tipoElectrica,
+			Prioridad:   prioridadMedia,
+			Descripcion: "Fallo en centralita eléctrica",
+			Estado:      estadoEnProceso,
+		}
+		incidencias = append(incidencias, inc2)
+		veh2.Incidencias = []*Incidencia{inc2}
+		inc2.Orden, veh2.Orden = inc2.ID, inc2.ID
+		mec2.Incidencias = append(mec2.Incidencias, inc2)
+
+		inc3 := &Incidencia{
+			ID:          contadorIncidencia.asignar(0),
+			Mecanicos:   []*Mecanico{}, // sin asignar
+			Tipo:        tipoCarroceria,
+			Prioridad:   prioridadBaja,
+			Descripcion: "Pequeño golpe en paragolpes",
+			Estado:      estadoAbierta,
+		}
+		incidencias = append(incidencias, inc3)
+		veh3.Incidencias = []*Incidencia{inc3}
+		inc3.Orden, veh3.Orden = inc3.ID, inc3.ID
+
+		inc4 := &Incidencia{
+			ID:          contadorIncidencia.asignar(0),
+			Mecanicos:   []*Mecanico{mec1}, // mec1 puede tener varias incidencias
+			Tipo:        tipoMecanica,
+			Prioridad:   prioridadMedia,
+			Descripcion: "Revisión y ajuste de frenos",
+			Estado:      estadoCerrada,
+		}
+		incidencias = append(incidencias, inc4)
+		veh4.Incidencias = []*Incidencia{inc4}
+		inc4.Orden = inc4.ID // ya recogido: la orden no sigue abierta
+		mec1.Incidencias = append(mec1.Incidencias, inc4)
+
+		// Segunda línea en la orden del primer vehículo
+		inc5 := &Incidencia{
+			ID:          contadorIncidencia.asignar(0),
+			Mecanicos:   []*Mecanico{},
+			Tipo:        tipoElectrica,
+			Prioridad:   prioridadMedia,
+			Descripcion: "Testigo de batería encendido",
+			Estado:      estadoAbierta,
+			Orden:       inc1.ID,
+		}
+		incidencias = append(incidencias, inc5)
+		veh1.Incidencias = append(veh1.Incidencias, inc5)
+
+		// Historial coherente con lo anterior, para que los informes tengan datos
+		hace := func(d time.Duration) time.Time { return time.Now().Add(-d) }
+		historial := []*Evento{
+			{Fecha: hace(72 * time.Hour), Tipo: eventoApertura, Matricula: veh4.Matricula, IncidenciaID: inc4.ID, Detalle: "abierta"},
+			{Fecha: hace(72 * time.Hour), Tipo: eventoEntradaPlaza, Matricula: veh4.Matricula, Plaza: 1},
+			{Fecha: hace(71 * time.Hour), Tipo: eventoAsignacion, IncidenciaID: inc4.ID, MecanicoID: mec1.ID},
+			{Fecha: hace(28 * time.Hour), Tipo: eventoEstado, IncidenciaID: inc4.ID, Detalle: "lista para recoger"},
+			{Fecha: hace(26 * time.Hour), Tipo: eventoSalidaPlaza, Matricula: veh4.Matricula, IncidenciaID: inc4.ID, Plaza: 1,
+				Detalle: "recogido por Martín Ruiz; pago pagado"},
+			{Fecha: hace(26 * time.Hour), Tipo: eventoEstado, IncidenciaID: inc4.ID, Detalle: "cerrada"},
+			{Fecha: hace(5 * time.Hour), Tipo: eventoApertura, Matricula: veh1.Matricula, IncidenciaID: inc1.ID, Detalle: "abierta"},
+			{Fecha: hace(5 * time.Hour), Tipo: eventoApertura, Matricula: veh1.Matricula, IncidenciaID: inc5.ID, Detalle: "abierta"},
+			{Fecha: hace(5 * time.Hour), Tipo: eventoEntradaPlaza, Matricula: veh1.Matricula, Plaza: 1},
+			{Fecha: hace(4 * time.Hour), Tipo: eventoAsignacion, IncidenciaID: inc1.ID, MecanicoID: mec1.ID},
+			{Fecha: hace(2 * time.Hour), Tipo: eventoApertura, Matricula: veh3.Matricula, IncidenciaID: inc3.ID, Detalle: "abierta"},
+			{Fecha: hace(45 * time.Minute), Tipo: eventoApertura, Matricula: veh2.Matricula, IncidenciaID: inc2.ID, Detalle: "abierta"},
+			{Fecha: hace(45 * time.Minute), Tipo: eventoEntradaPlaza, Matricula: veh2.Matricula, Plaza: 2},
+			{Fecha: hace(40 * time.Minute), Tipo: eventoAsignacion, IncidenciaID: inc2.ID, MecanicoID: mec2.ID},
+			{Fecha: hace(30 * time.Minute), Tipo: eventoEstado, IncidenciaID: inc2.ID, Detalle: "en proceso"},
+		}
 
-	veh4 := &Vehiculo{
-		Matricula:    "4444ZZZ",
-		Marca:        "Ford",
-		Modelo:       "Focus",
-		FechaEntrada: obtenerFechaActual(),
-		FechaSalida:  "",
-		Incidencia:   nil,
-		EnTaller:     false,
-		NumeroPlaza:  -1,
+		err := almacen.Reemplazar(&estadoTaller{
+			clientes:    clientes,
+			vehiculos:   vehiculos,
+			incidencias: incidencias,
+			mecanicos:   mecanicos,
+			historial:   historial,
+		})
+		if err != nil {
+			return err
+		}
+
+		// Actualizar total de plazas según mecánicos activos
+		taller.TotalPlazas = calcularTotalPlazas()
+		return nil
+	})
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
 	}
-	vehiculos = append(vehiculos, veh4)
-	cliente4.Vehiculo = veh4
-
-	// Crear incidencias con distintos estados y asignaciones
-	inc1 := &Incidencia{
-		ID:          contadorIncidencia,
-		Mecanicos:   []*Mecanico{mec1}, // asignado
-		Tipo:        "mecánica",
-		Prioridad:   "alta",
-		Descripcion: "Cambio de correa de distribución",
-		Estado:      "abierta",
-	}
-	incidencias = append(incidencias, inc1)
-	veh1.Incidencia = inc1
-	mec1.Incidencias = append(mec1.Incidencias, inc1)
-	contadorIncidencia++
-
-	inc2 := &Incidencia{
-		ID:          contadorIncidencia,
-		Mecanicos:   []*Mecanico{mec2}, // asignado
-		Tipo:        "eléctrica",
-		Prioridad:   "media",
-		Descripcion: "Fallo en centralita eléctrica",
-		Estado:      "en proceso",
-	}
-	incidencias = append(incidencias, inc2)
-	veh2.Incidencia = inc2
-	mec2.Incidencias = append(mec2.Incidencias, inc2)
-	contadorIncidencia++
-
-	inc3 := &Incidencia{
-		ID:          contadorIncidencia,
-		Mecanicos:   []*Mecanico{}, // sin asignar
-		Tipo:        "carrocería",
-		Prioridad:   "baja",
-		Descripcion: "Pequeño golpe en paragolpes",
-		Estado:      "abierta",
-	}
-	incidencias = append(incidencias, inc3)
-	veh3.Incidencia = inc3
-	contadorIncidencia++
-
-	inc4 := &Incidencia{
-		ID:          contadorIncidencia,
-		Mecanicos:   []*Mecanico{mec1}, // mec1 puede tener varias incidencias
-		Tipo:        "mecánica",
-		Prioridad:   "media",
-		Descripcion: "Revisión y ajuste de frenos",
-		Estado:      "cerrada",
-	}
-	incidencias = append(incidencias, inc4)
-	veh4.Incidencia = inc4
-	mec1.Incidencias = append(mec1.Incidencias, inc4)
-	contadorIncidencia++
-
-	// Actualizar total de plazas por si cambió el estado de mecánicos
-	taller.TotalPlazas = calcularTotalPlazas()
 
 	fmt.Println("Datos de prueba cargados exitosamente")
 	pausar()
@@ -1820,8 +2827,79 @@ func inicializarSistema() {
 }
 
 func main() {
+	rutaBD := flag.String("bd", "", "fichero de base de datos SQLite; requiere compilar con -tags sqlite (por defecto los datos sólo están en memoria)")
+	direccionWeb := flag.String("web", "", "dirección en la que servir la interfaz web, por ejemplo :8080")
+	flag.IntVar(&retencionBackups, "copias", retencionBackups, "copias de seguridad automáticas que se conservan (0 para no borrar nunca)")
+	flag.IntVar(&tamanoPagina, "pagina", tamanoPagina, "filas por página en los listados")
+	pantallaCompleta := flag.Bool("tui", false, "arrancar directamente en el modo de pantalla completa")
+	servidorSMTP := flag.String("smtp", "", "servidor de correo para los avisos a clientes, por ejemplo smtp.ejemplo.com:587")
+	remitenteSMTP := flag.String("smtp-remitente", "taller@localhost", "dirección desde la que se envían los avisos por correo")
+	pasarelaSMS := flag.String("sms", "", "URL de la pasarela de SMS para los avisos a clientes")
+	webhookAvisos := flag.String("avisos-webhook", "", "URL a la que publicar los avisos a clientes en JSON")
+	ficheroAvisos := flag.String("avisos-fichero", "", "fichero en el que anotar los avisos en lugar de enviarlos (pruebas)")
+	ficheroWebhooks := flag.String("webhooks", "webhooks.json", "fichero con las suscripciones a los eventos del taller")
+	flag.IntVar(&cargaMaxima, "carga-maxima", cargaMaxima, "carga de trabajo máxima por mecánico (ver carga.go)")
+	flag.BoolVar(&cargaEstricta, "carga-estricta", cargaEstricta, "rechazar las asignaciones que superan la carga máxima en lugar de avisar")
+	flag.StringVar(&directorioAdjuntos, "adjuntos", directorioAdjuntos, "directorio en el que se guardan los ficheros adjuntos a las incidencias")
+	ficheroCatalogos := flag.String("catalogos", "catalogos.json", "fichero con los tipos, prioridades y estados de incidencia propios del taller")
+	flag.Parse()
+	if tamanoPagina < 1 {
+		tamanoPagina = 20
+	}
+	if cargaMaxima < 1 {
+		cargaMaxima = 6
+	}
+	if err := cargarCatalogos(*ficheroCatalogos); err != nil {
+		fmt.Println("Error al leer los catálogos:", err)
+		return
+	}
+
 	inicializarSistema()
 
+	if *servidorSMTP != "" {
+		avisos.anadirCanal(&canalSMTP{servidor: *servidorSMTP, remitente: *remitenteSMTP})
+	}
+	if *pasarelaSMS != "" {
+		avisos.anadirCanal(&canalSMS{url: *pasarelaSMS})
+	}
+	if *webhookAvisos != "" {
+		avisos.anadirCanal(&canalWebhookAvisos{url: *webhookAvisos})
+	}
+	if *ficheroAvisos != "" {
+		avisos.anadirCanal(&canalFichero{ruta: *ficheroAvisos})
+	}
+	if err := webhooks.cargar(*ficheroWebhooks); err != nil {
+		fmt.Println("Error al leer las suscripciones a webhooks:", err)
+		return
+	}
+
+	if *rutaBD != "" {
+		a, err := abrirAlmacenSQL(*rutaBD)
+		if err != nil {
+			fmt.Println("Error al abrir la base de datos:", err)
+			return
+		}
+		almacen = a
+		defer almacen.Cerrar()
+	}
+
+	if *direccionWeb != "" {
+		direccion, err := iniciarServidorWeb(*direccionWeb)
+		if err != nil {
+			fmt.Println("Error al iniciar el servidor web:", err)
+			return
+		}
+		fmt.Printf("Interfaz web disponible en http://%s/ (panel del taller en /panel)\n", direccion)
+		pausar()
+	}
+
+	if *pantallaCompleta {
+		if err := ejecutarTUI(); err != nil {
+			fmt.Println("Error:", err)
+		}
+		return
+	}
+
 	for {
 		limpiarPantalla()
 		fmt.Println("╔════════════════════════════════════════╗")
@@ -1835,6 +2913,11 @@ func main() {
 		fmt.Println("4. Gestión de Mecánicos")
 		fmt.Println("5. Gestión del Taller")
 		fmt.Println("6. Cargar datos de prueba")
+		fmt.Println("7. Importar/Exportar CSV")
+		fmt.Println("8. Instantáneas y copias de seguridad")
+		fmt.Println("9. Modo pantalla completa")
+		fmt.Println("10. Avisos a clientes")
+		fmt.Println("11. Webhooks")
 		fmt.Println("0. Salir")
 
 		var opcion int
@@ -1855,6 +2938,19 @@ func main() {
 			menuTaller()
 		case 6:
 			cargarDatosPrueba()
+		case 7:
+			menuImportarExportar()
+		case 8:
+			menuCopiasSeguridad()
+		case 9:
+			if err := ejecutarTUI(); err != nil {
+				fmt.Println("Error:", err)
+				pausar()
+			}
+		case 10:
+			menuAvisos()
+		case 11:
+			menuWebhooks()
 		case 0:
 			limpiarPantalla()
 			fmt.Println("Gracias por usar el sistema. ¡Hasta pronto!")
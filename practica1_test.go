@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestCambiarEstadoAlMismoEstado(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	c, err := registrarCliente(0, "Marta", "600000000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := registrarVehiculo(c, "1234BCD", "Seat", "Ibiza", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc, err := registrarIncidencia(0, v, string(tipoMecanica), string(prioridadBaja), "revisión", string(estadoAbierta))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	estado := func() (EstadoIncidencia, int, int) {
+		var e EstadoIncidencia
+		var version, eventos int
+		consultar(func() { e, version, eventos = inc.Estado, inc.Version, len(almacen.Historial().Todos()) })
+		return e, version, eventos
+	}
+	_, version, eventos := estado()
+
+	if err := cambiarEstado(inc, string(estadoAbierta)); err == nil {
+		t.Error("se esperaba un error al dejar la incidencia en el mismo estado")
+	}
+	if e, v, n := estado(); e != estadoAbierta || v != version || n != eventos {
+		t.Errorf("sin cambio de estado: estado %q, versión %d, %d eventos; antes versión %d, %d eventos", e, v, n, version, eventos)
+	}
+
+	if err := cambiarEstado(inc, string(estadoEnProceso)); err != nil {
+		t.Fatal(err)
+	}
+	if e, v, n := estado(); e != estadoEnProceso || v != version+1 || n != eventos+1 {
+		t.Errorf("tras el cambio: estado %q, versión %d, %d eventos; antes versión %d, %d eventos", e, v, n, version, eventos)
+	}
+}
@@ -0,0 +1,413 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Interfaz web de recepción
+//
+// Páginas para dar de alta clientes, vehículos e incidencias, meter
+// vehículos en el taller, asignar mecánicos y consultar el estado, con las
+// mismas operaciones que los menús de consola. Cada formulario se envía por
+// POST; si va bien se redirige a la lista con un aviso y si no se vuelve a
+// mostrar con el error y los valores escritos.
+//
+// Las listas admiten los criterios de búsqueda.go como parámetros de la
+// consulta (?q=...&tipo=...), así que cualquier búsqueda se puede enlazar.
+//
+// Las plantillas se ejecutan fuera del cerrojo, así que los datos se copian
+// a estructuras propias dentro de consultar.
+
+func registrarRutasRecepcion(mux *http.ServeMux) {
+	mux.HandleFunc("GET /{$}", paginaInicio)
+	mux.HandleFunc("GET /clientes", paginaClientes)
+	mux.HandleFunc("POST /clientes", altaClienteWeb)
+	mux.HandleFunc("GET /vehiculos", paginaVehiculos)
+	mux.HandleFunc("POST /vehiculos", altaVehiculoWeb)
+	mux.HandleFunc("POST /vehiculos/{matricula}/taller", ingresarVehiculoWeb)
+	mux.HandleFunc("POST /vehiculos/{matricula}/salida", entregarVehiculoWeb)
+	mux.HandleFunc("GET /vehiculos/{matricula}/justificante.pdf", justificanteWeb)
+	mux.HandleFunc("GET /incidencias", paginaIncidencias)
+	mux.HandleFunc("POST /incidencias", altaIncidenciaWeb)
+	mux.HandleFunc("POST /incidencias/{id}/mecanicos", asignarMecanicoWeb)
+	mux.HandleFunc("POST /incidencias/{id}/mecanicos/quitar", retirarMecanicoWeb)
+	mux.HandleFunc("POST /incidencias/{id}/estado", cambiarEstadoWeb)
+	mux.HandleFunc("GET /incidencias/{id}", paginaIncidencia)
+	mux.HandleFunc("POST /incidencias/{id}/notas", anadirNotaWeb)
+	mux.HandleFunc("POST /incidencias/{id}/adjuntos", adjuntarWeb)
+	mux.HandleFunc("GET /incidencias/{id}/adjuntos/{n}", descargarAdjuntoWeb)
+	mux.HandleFunc("GET /incidencias/{id}/orden.pdf", documentoIncidenciaWeb(false))
+	mux.HandleFunc("GET /incidencias/{id}/cierre.pdf", documentoIncidenciaWeb(true))
+}
+
+// paginaWeb son los datos comunes a todas las páginas.
+type paginaWeb struct {
+	Titulo  string
+	Seccion string
+	Aviso   string
+	Error   string
+	Valores url.Values // lo escrito en un formulario rechazado
+}
+
+func nuevaPagina(r *http.Request, titulo, seccion string) paginaWeb {
+	return paginaWeb{
+		Titulo:  titulo,
+		Seccion: seccion,
+		Aviso:   r.URL.Query().Get("aviso"),
+		Error:   r.URL.Query().Get("error"),
+	}
+}
+
+// opcionWeb es una entrada de un desplegable.
+type opcionWeb struct {
+	Valor string
+	Texto string
+}
+
+// redirigir vuelve a la página indicada mostrando un aviso o un error.
+func redirigir(w http.ResponseWriter, r *http.Request, ruta, aviso string, err error) {
+	consulta := url.Values{}
+	if err != nil {
+		consulta.Set("error", err.Error())
+	} else if aviso != "" {
+		consulta.Set("aviso", aviso)
+	}
+	if len(consulta) > 0 {
+		ruta += "?" + consulta.Encode()
+	}
+	http.Redirect(w, r, ruta, http.StatusSeeOther)
+}
+
+// rechazar vuelve a mostrar el formulario con el error.
+func rechazar(w http.ResponseWriter, r *http.Request, pagina func(http.ResponseWriter, *http.Request, paginaWeb), p paginaWeb, err error) {
+	p.Aviso, p.Error, p.Valores = "", err.Error(), r.PostForm
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	pagina(w, r, p)
+}
+
+func campoFormulario(r *http.Request, nombre string) string {
+	return strings.TrimSpace(r.PostFormValue(nombre))
+}
+
+// Inicio: resumen del taller
+
+type paginaInicioWeb struct {
+	paginaWeb
+	Taller      *estadoPanel
+	PorEstado   []opcionWeb // estado y número de incidencias
+	SinMecanico int
+}
+
+func paginaInicio(w http.ResponseWriter, r *http.Request) {
+	p := paginaInicioWeb{paginaWeb: nuevaPagina(r, "Estado del taller", "inicio"), Taller: datosPanel()}
+	consultar(func() {
+		cuenta := map[EstadoIncidencia]int{}
+		for _, inc := range almacen.Incidencias().Todas() {
+			cuenta[inc.Estado]++
+			if !trabajoTerminado(inc) && len(inc.Mecanicos) == 0 {
+				p.SinMecanico++
+			}
+		}
+		for _, estado := range estadosIncidencia {
+			p.PorEstado = append(p.PorEstado, opcionWeb{string(estado), strconv.Itoa(cuenta[estado])})
+		}
+	})
+	renderizar(w, "inicio.html", p)
+}
+
+// Clientes
+
+type filaClienteWeb struct {
+	ID        int
+	Nombre    string
+	Telefono  string
+	Email     string
+	Matricula string
+}
+
+type paginaClientesWeb struct {
+	paginaWeb
+	Filtro   filtroClientes
+	Clientes []filaClienteWeb
+}
+
+func paginaClientes(w http.ResponseWriter, r *http.Request) {
+	mostrarClientes(w, r, nuevaPagina(r, "Clientes", "clientes"))
+}
+
+func mostrarClientes(w http.ResponseWriter, r *http.Request, base paginaWeb) {
+	p := paginaClientesWeb{paginaWeb: base, Filtro: filtroClientes{Texto: r.URL.Query().Get("q")}}
+	consultar(func() {
+		for _, c := range filtrarClientes(p.Filtro) {
+			fila := filaClienteWeb{ID: c.ID, Nombre: c.Nombre, Telefono: c.Telefono, Email: c.Email}
+			if c.Vehiculo != nil {
+				fila.Matricula = c.Vehiculo.Matricula
+			}
+			p.Clientes = append(p.Clientes, fila)
+		}
+	})
+	renderizar(w, "clientes.html", p)
+}
+
+func altaClienteWeb(w http.ResponseWriter, r *http.Request) {
+	c, err := registrarCliente(0, campoFormulario(r, "nombre"), campoFormulario(r, "telefono"), campoFormulario(r, "email"))
+	if err != nil {
+		rechazar(w, r, mostrarClientes, nuevaPagina(r, "Clientes", "clientes"), err)
+		return
+	}
+	redirigir(w, r, "/clientes", fmt.Sprintf("Cliente %s creado con ID %d", c.Nombre, c.ID), nil)
+}
+
+// Vehículos
+
+type filaVehiculoWeb struct {
+	Matricula  string
+	Marca      string
+	Modelo     string
+	Cliente    string
+	Entrada    string
+	EnTaller   bool
+	Plaza      int
+	Incidencia string
+	Entregable bool   // en el taller y con el trabajo terminado
+	Salida     string // fecha, quién lo recogió y pago de la última salida
+}
+
+type paginaVehiculosWeb struct {
+	paginaWeb
+	Filtro        filtroVehiculos
+	Vehiculos     []filaVehiculoWeb
+	Clientes      []opcionWeb // clientes sin vehículo
+	EstadosPago   []string
+	PlazasLibres  int
+	PlazasTotales int
+}
+
+func paginaVehiculos(w http.ResponseWriter, r *http.Request) {
+	mostrarVehiculos(w, r, nuevaPagina(r, "Vehículos", "vehiculos"))
+}
+
+func mostrarVehiculos(w http.ResponseWriter, r *http.Request, base paginaWeb) {
+	consulta := r.URL.Query()
+	p := paginaVehiculosWeb{paginaWeb: base, EstadosPago: estadosPago, Filtro: filtroVehiculos{
+		Texto:        consulta.Get("q"),
+		SoloEnTaller: consulta.Get("en_taller") != "",
+	}}
+	consultar(func() {
+		for _, v := range filtrarVehiculos(p.Filtro) {
+			fila := filaVehiculoWeb{
+				Matricula: v.Matricula, Marca: v.Marca, Modelo: v.Modelo,
+				Entrada: v.FechaEntrada, EnTaller: v.EnTaller, Plaza: v.NumeroPlaza,
+			}
+			if c := buscarPropietario(v); c != nil {
+				fila.Cliente = c.Nombre
+			}
+			fila.Incidencia = resumenOrden(lineasOrden(v, v.Orden))
+			fila.Entregable = v.EnTaller && ordenTerminada(v)
+			if v.RecogidoPor != "" && !v.EnTaller {
+				fila.Salida = fmt.Sprintf("Recogido el %s por %s (%s)", v.FechaSalida, v.RecogidoPor, v.EstadoPago)
+			}
+			p.Vehiculos = append(p.Vehiculos, fila)
+		}
+		for _, c := range almacen.Clientes().Todos() {
+			if c.Vehiculo == nil {
+				p.Clientes = append(p.Clientes, opcionWeb{strconv.Itoa(c.ID), fmt.Sprintf("%d - %s", c.ID, c.Nombre)})
+			}
+		}
+		p.PlazasTotales = calcularTotalPlazas()
+		p.PlazasLibres = p.PlazasTotales - contarPlazasOcupadas()
+	})
+	renderizar(w, "vehiculos.html", p)
+}
+
+func altaVehiculoWeb(w http.ResponseWriter, r *http.Request) {
+	matricula := campoFormulario(r, "matricula")
+	id, err := strconv.Atoi(campoFormulario(r, "cliente"))
+	if err == nil {
+		_, err = registrarVehiculo(buscarCliente(id), matricula, campoFormulario(r, "marca"), campoFormulario(r, "modelo"), "")
+	} else {
+		err = errors.New("seleccione un cliente")
+	}
+	if err != nil {
+		rechazar(w, r, mostrarVehiculos, nuevaPagina(r, "Vehículos", "vehiculos"), err)
+		return
+	}
+	redirigir(w, r, "/vehiculos", fmt.Sprintf("Vehículo %s creado", matricula), nil)
+}
+
+func ingresarVehiculoWeb(w http.ResponseWriter, r *http.Request) {
+	matricula := r.PathValue("matricula")
+	v := buscarVehiculo(matricula)
+	if v == nil {
+		redirigir(w, r, "/vehiculos", "", errors.New("vehículo no encontrado"))
+		return
+	}
+	plaza, err := ingresarVehiculo(v)
+	redirigir(w, r, "/vehiculos", fmt.Sprintf("Vehículo %s asignado a la plaza %d", matricula, plaza), err)
+}
+
+func entregarVehiculoWeb(w http.ResponseWriter, r *http.Request) {
+	matricula := r.PathValue("matricula")
+	v := buscarVehiculo(matricula)
+	if v == nil {
+		redirigir(w, r, "/vehiculos", "", errors.New("vehículo no encontrado"))
+		return
+	}
+	err := entregarVehiculo(v, campoFormulario(r, "pago"), campoFormulario(r, "recogido_por"))
+	redirigir(w, r, "/vehiculos", fmt.Sprintf("Vehículo %s entregado; la plaza queda libre", matricula), err)
+}
+
+// Incidencias
+
+type filaIncidenciaWeb struct {
+	ID          int
+	Matricula   string
+	Tipo        TipoIncidencia
+	Prioridad   Prioridad
+	Estado      EstadoIncidencia
+	Descripcion string
+	Mecanicos   string
+	Disponibles []opcionWeb // mecánicos que se le pueden asignar
+	Asignados   []opcionWeb // mecánicos que se le pueden retirar
+}
+
+type paginaIncidenciasWeb struct {
+	paginaWeb
+	Filtro      filtroIncidencias
+	Incidencias []filaIncidenciaWeb
+	Vehiculos   []opcionWeb // vehículos a los que abrir una incidencia
+	Tipos       []TipoIncidencia
+	Prioridades []Prioridad
+	Estados     []EstadoIncidencia
+}
+
+func paginaIncidencias(w http.ResponseWriter, r *http.Request) {
+	mostrarIncidencias(w, r, nuevaPagina(r, "Incidencias", "incidencias"))
+}
+
+func mostrarIncidencias(w http.ResponseWriter, r *http.Request, base paginaWeb) {
+	consulta := r.URL.Query()
+	p := paginaIncidenciasWeb{
+		paginaWeb: base,
+		Filtro: filtroIncidencias{
+			Texto:     consulta.Get("q"),
+			Tipo:      consulta.Get("tipo"),
+			Prioridad: consulta.Get("prioridad"),
+			Estado:    consulta.Get("estado"),
+			Mecanico:  consulta.Get("mecanico"),
+		},
+		Tipos:       tiposIncidencia,
+		Prioridades: prioridadesIncidencia,
+		Estados:     estadosIncidencia,
+	}
+	if err := p.Filtro.normalizar(); err != nil {
+		p.Error = err.Error()
+		p.Filtro = filtroIncidencias{}
+	}
+	consultar(func() {
+		mecanicos := almacen.Mecanicos().Todos()
+		for _, inc := range filtrarIncidencias(p.Filtro) {
+			fila := filaIncidenciaWeb{
+				ID: inc.ID, Tipo: inc.Tipo, Prioridad: inc.Prioridad, Estado: inc.Estado,
+				Descripcion: inc.Descripcion, Mecanicos: idsMecanicos(inc.Mecanicos),
+			}
+			if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+				fila.Matricula = v.Matricula
+			}
+			for _, m := range inc.Mecanicos {
+				fila.Asignados = append(fila.Asignados, opcionWeb{strconv.Itoa(m.ID), m.Nombre})
+			}
+			for _, m := range mecanicos {
+				if validarAsignacion(inc, m) == nil {
+					fila.Disponibles = append(fila.Disponibles,
+						opcionWeb{strconv.Itoa(m.ID), fmt.Sprintf("%s (carga %s)", m.Nombre, textoCarga(cargaMecanico(m)))})
+				}
+			}
+			p.Incidencias = append(p.Incidencias, fila)
+		}
+		for _, v := range almacen.Vehiculos().Todos() {
+			texto := fmt.Sprintf("%s - %s %s", v.Matricula, v.Marca, v.Modelo)
+			if v.Orden != 0 {
+				texto += fmt.Sprintf(" (orden #%d)", v.Orden)
+			}
+			p.Vehiculos = append(p.Vehiculos, opcionWeb{v.Matricula, texto})
+		}
+	})
+	renderizar(w, "incidencias.html", p)
+}
+
+func altaIncidenciaWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := registrarIncidencia(0, buscarVehiculo(campoFormulario(r, "vehiculo")),
+		campoFormulario(r, "tipo"), campoFormulario(r, "prioridad"), campoFormulario(r, "descripcion"), string(estadoAbierta))
+	if err != nil {
+		rechazar(w, r, mostrarIncidencias, nuevaPagina(r, "Incidencias", "incidencias"), err)
+		return
+	}
+	redirigir(w, r, "/incidencias", fmt.Sprintf("Incidencia creada con ID %d", inc.ID), nil)
+}
+
+// incidenciaDeRuta busca la incidencia cuyo ID va en la ruta.
+func incidenciaDeRuta(r *http.Request) (*Incidencia, error) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		return nil, errors.New("ID de incidencia no válido")
+	}
+	inc := buscarIncidencia(id)
+	if inc == nil {
+		return nil, errors.New("incidencia no encontrada")
+	}
+	return inc, nil
+}
+
+func asignarMecanicoWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		redirigir(w, r, "/incidencias", "", err)
+		return
+	}
+	id, _ := strconv.Atoi(campoFormulario(r, "mecanico"))
+	m := buscarMecanico(id)
+	if m == nil {
+		redirigir(w, r, "/incidencias", "", errors.New("mecánico no encontrado"))
+		return
+	}
+	err = asignarMecanico(inc, m)
+	mensaje := fmt.Sprintf("%s asignado a la incidencia %d", m.Nombre, inc.ID)
+	consultar(func() {
+		if aviso := avisoSobrecarga(m); aviso != "" {
+			mensaje += "; " + aviso
+		}
+	})
+	redirigir(w, r, "/incidencias", mensaje, err)
+}
+
+func retirarMecanicoWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		redirigir(w, r, "/incidencias", "", err)
+		return
+	}
+	id, _ := strconv.Atoi(campoFormulario(r, "mecanico"))
+	m := buscarMecanico(id)
+	if m == nil {
+		redirigir(w, r, "/incidencias", "", errors.New("mecánico no encontrado"))
+		return
+	}
+	err = desasignarMecanico(inc, m, campoFormulario(r, "motivo"))
+	redirigir(w, r, "/incidencias", fmt.Sprintf("%s retirado de la incidencia %d", m.Nombre, inc.ID), err)
+}
+
+func cambiarEstadoWeb(w http.ResponseWriter, r *http.Request) {
+	inc, err := incidenciaDeRuta(r)
+	if err != nil {
+		redirigir(w, r, "/incidencias", "", err)
+		return
+	}
+	err = cambiarEstado(inc, campoFormulario(r, "estado"))
+	redirigir(w, r, "/incidencias", fmt.Sprintf("Incidencia %d actualizada", inc.ID), err)
+}
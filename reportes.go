@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+// Informes de listados
+//
+// Los listados que se archivan o se envían por correo se preparan primero
+// como datos (un reporte con una o varias secciones en forma de tabla) y
+// después se presentan con una plantilla: texto plano para la consola,
+// Markdown o una página HTML autónoma. Las plantillas están en plantillas/
+// junto a las de la interfaz web.
+
+type seccionReporte struct {
+	Titulo   string
+	Columnas []string
+	Filas    [][]string
+	Vacio    string // texto si no hay filas
+}
+
+type reporte struct {
+	Titulo    string
+	Generado  time.Time
+	Secciones []seccionReporte
+	Resumen   string
+}
+
+// Formatos de salida, con la extensión y el tipo MIME de cada uno
+var formatosReporte = []struct {
+	nombre, extension, tipoMIME string
+}{
+	{"texto", "txt", "text/plain; charset=utf-8"},
+	{"markdown", "md", "text/markdown; charset=utf-8"},
+	{"html", "html", "text/html; charset=utf-8"},
+}
+
+var plantillasTexto = texttemplate.Must(texttemplate.New("").Funcs(texttemplate.FuncMap{
+	"md": escaparMarkdown,
+	"tabla": func(columnas []string, filas [][]string) string {
+		var b bytes.Buffer
+		imprimirTabla(&b, columnas, filas)
+		return b.String()
+	},
+}).ParseFS(ficherosPlantillas, "plantillas/reporte.md", "plantillas/reporte.txt", "plantillas/avisos.txt"))
+
+// escaparMarkdown evita que el contenido rompa las tablas o se interprete
+// como formato.
+func escaparMarkdown(texto string) string {
+	texto = strings.NewReplacer("\\", "\\\\", "|", "\\|", "*", "\\*", "_", "\\_", "`", "\\`").Replace(texto)
+	return strings.Join(strings.Fields(texto), " ")
+}
+
+// escribirReporte presenta el reporte en el formato indicado.
+func escribirReporte(w io.Writer, r *reporte, formato string) error {
+	switch formato {
+	case "texto":
+		return plantillasTexto.ExecuteTemplate(w, "reporte.txt", r)
+	case "markdown":
+		return plantillasTexto.ExecuteTemplate(w, "reporte.md", r)
+	case "html":
+		return plantillas.ExecuteTemplate(w, "reporte.html", r)
+	}
+	return fmt.Errorf("formato %q no válido", formato)
+}
+
+// Reportes disponibles. Suponen que quien llama tiene el cerrojo.
+
+var reportes = []struct {
+	nombre, titulo string
+	generar        func() *reporte
+}{
+	{"clientes-en-taller", "Clientes con vehículos en el taller", reporteClientesEnTaller},
+	{"incidencias", "Incidencias por estado", reporteIncidenciasPorEstado},
+	{"carga-mecanicos", "Carga de trabajo de los mecánicos", reporteCargaMecanicos},
+	{"cobertura-especialidades", "Cobertura de especialidades", reporteCoberturaEspecialidades},
+	{"reparto-carga", "Reparto de la carga de trabajo", reporteReparto},
+	{"disponibilidad", "Disponibilidad de los mecánicos esta semana", func() *reporte { return reporteDisponibilidad(time.Now()) }},
+}
+
+func reporteClientesEnTaller() *reporte {
+	s := seccionReporte{
+		Columnas: []string{"ID", "Cliente", "Teléfono", "Email", "Vehículo", "Matrícula", "Plaza", "Incidencias"},
+		Vacio:    "No hay clientes con vehículos en el taller actualmente",
+	}
+	for _, c := range almacen.Clientes().Todos() {
+		v := c.Vehiculo
+		if v == nil || !v.EnTaller {
+			continue
+		}
+		s.Filas = append(s.Filas, []string{strconv.Itoa(c.ID), c.Nombre, c.Telefono, c.Email,
+			v.Marca + " " + v.Modelo, v.Matricula, strconv.Itoa(v.NumeroPlaza), resumenOrden(lineasOrden(v, v.Orden))})
+	}
+	return &reporte{
+		Titulo:    "CLIENTES CON VEHÍCULOS EN TALLER",
+		Generado:  time.Now(),
+		Secciones: []seccionReporte{s},
+		Resumen:   fmt.Sprintf("Total: %d cliente(s)", len(s.Filas)),
+	}
+}
+
+func reporteIncidenciasPorEstado() *reporte {
+	r := &reporte{Titulo: "TODAS LAS INCIDENCIAS DEL TALLER", Generado: time.Now()}
+	total := 0
+	var cuentas []string
+	for _, estado := range estadosIncidencia {
+		s := seccionReporte{
+			Titulo:   "Estado: " + string(estado),
+			Columnas: []string{"ID", "Vehículo", "Tipo", "Prioridad", "Mecánicos", "Descripción"},
+			Vacio:    "Ninguna",
+		}
+		for _, inc := range almacen.Incidencias().PorEstado(estado) {
+			matricula := ""
+			if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+				matricula = v.Matricula
+			}
+			s.Filas = append(s.Filas, []string{strconv.Itoa(inc.ID), matricula, string(inc.Tipo), string(inc.Prioridad),
+				idsMecanicos(inc.Mecanicos), inc.Descripcion})
+		}
+		total += len(s.Filas)
+		cuentas = append(cuentas, fmt.Sprintf("%s: %d", estado, len(s.Filas)))
+		r.Secciones = append(r.Secciones, s)
+	}
+	r.Resumen = fmt.Sprintf("Total: %d incidencias (%s)", total, strings.Join(cuentas, ", "))
+	return r
+}
+
+func reporteCargaMecanicos() *reporte {
+	s := seccionReporte{
+		Columnas: []string{"ID", "Nombre", "Especialidades", "Estado", "Pendientes", "Carga", "Cerradas", "Incidencias"},
+		Vacio:    "No hay mecánicos registrados",
+	}
+	pendientesTotal := 0 // las listas para recoger cuentan como cerradas
+	for _, m := range almacen.Mecanicos().Todos() {
+		estado := situacionMecanico(m, time.Now())
+		pendientes, cerradas := 0, 0
+		var ids []string
+		for _, inc := range m.Incidencias {
+			if trabajoTerminado(inc) {
+				cerradas++
+			} else {
+				pendientes++
+			}
+			ids = append(ids, strconv.Itoa(inc.ID))
+		}
+		pendientesTotal += pendientes
+		s.Filas = append(s.Filas, []string{strconv.Itoa(m.ID), m.Nombre, textoEspecialidades(m.Especialidades), estado,
+			strconv.Itoa(pendientes), textoCarga(cargaMecanico(m)), strconv.Itoa(cerradas), strings.Join(ids, ", ")})
+	}
+	return &reporte{
+		Titulo:    "CARGA DE TRABAJO DE LOS MECÁNICOS",
+		Generado:  time.Now(),
+		Secciones: []seccionReporte{s},
+		Resumen:   fmt.Sprintf("Incidencias pendientes asignadas: %d", pendientesTotal),
+	}
+}
+
+// reporteCoberturaEspecialidades cuenta, por especialidad, los mecánicos
+// activos que pueden atender cada prioridad, y señala las incidencias
+// pendientes que ningún mecánico activo puede atender.
+func reporteCoberturaEspecialidades() *reporte {
+	cobertura := seccionReporte{
+		Titulo:   "Mecánicos activos con el nivel que pide cada prioridad",
+		Columnas: []string{"Especialidad"},
+	}
+	for _, prioridad := range prioridadesIncidencia {
+		cobertura.Columnas = append(cobertura.Columnas, fmt.Sprintf("%s (%s)", prioridad, nivelMinimo[prioridad]))
+	}
+	var activos []*Mecanico
+	for _, m := range almacen.Mecanicos().Todos() {
+		if m.Activo {
+			activos = append(activos, m)
+		}
+	}
+	huecos := 0
+	for _, tipo := range tiposIncidencia {
+		fila := []string{string(tipo)}
+		for _, prioridad := range prioridadesIncidencia {
+			n := 0
+			for _, m := range activos {
+				if cualificado(m, &Incidencia{Tipo: tipo, Prioridad: prioridad}) {
+					n++
+				}
+			}
+			if n == 0 {
+				huecos++
+			}
+			fila = append(fila, strconv.Itoa(n))
+		}
+		cobertura.Filas = append(cobertura.Filas, fila)
+	}
+
+	sinCubrir := seccionReporte{
+		Titulo:   "Incidencias pendientes sin mecánico cualificado",
+		Columnas: []string{"ID", "Vehículo", "Tipo", "Prioridad", "Nivel requerido", "Mejor nivel disponible"},
+		Vacio:    "Ninguna",
+	}
+	for _, inc := range almacen.Incidencias().Todas() {
+		if trabajoTerminado(inc) {
+			continue
+		}
+		mejor := ""
+		cubierta := false
+		for _, m := range activos {
+			cubierta = cubierta || cualificado(m, inc)
+			if nivel := nivelMecanico(m, inc.Tipo); rangoNivel(nivel) > rangoNivel(mejor) {
+				mejor = nivel
+			}
+		}
+		if cubierta {
+			continue
+		}
+		matricula := ""
+		if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+			matricula = v.Matricula
+		}
+		if mejor == "" {
+			mejor = "ninguno"
+		}
+		sinCubrir.Filas = append(sinCubrir.Filas, []string{strconv.Itoa(inc.ID), matricula, string(inc.Tipo), string(inc.Prioridad),
+			nivelMinimo[inc.Prioridad], mejor})
+	}
+
+	return &reporte{
+		Titulo:    "COBERTURA DE ESPECIALIDADES",
+		Generado:  time.Now(),
+		Secciones: []seccionReporte{cobertura, sinCubrir},
+		Resumen: fmt.Sprintf("%d combinación(es) de especialidad y prioridad sin ningún mecánico; %d incidencia(s) pendiente(s) sin cubrir",
+			huecos, len(sinCubrir.Filas)),
+	}
+}
+
+// Web: GET /reportes/{nombre}?formato=html|markdown|texto
+
+func reporteWeb(w http.ResponseWriter, r *http.Request) {
+	formato := r.URL.Query().Get("formato")
+	if formato == "" {
+		formato = "html"
+	}
+	for _, rep := range reportes {
+		if rep.nombre != r.PathValue("nombre") {
+			continue
+		}
+		var datos *reporte
+		consultar(func() { datos = rep.generar() })
+		var b bytes.Buffer
+		if err := escribirReporte(&b, datos, formato); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, f := range formatosReporte {
+			if f.nombre == formato {
+				w.Header().Set("Content-Type", f.tipoMIME)
+			}
+		}
+		b.WriteTo(w)
+		return
+	}
+	http.NotFound(w, r)
+}
+
+// Funciones de menú
+
+func generarReporte() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== GENERAR INFORME ===")
+	for i, rep := range reportes {
+		fmt.Printf("%d. %s\n", i+1, rep.titulo)
+	}
+	n, err := strconv.Atoi(leerCriterio(reader, "Informe: "))
+	if err != nil || n < 1 || n > len(reportes) {
+		fmt.Println("Opción inválida")
+		pausar()
+		return
+	}
+	rep := reportes[n-1]
+
+	var nombres []string
+	for _, f := range formatosReporte {
+		nombres = append(nombres, f.nombre)
+	}
+	formato := strings.ToLower(leerCriterio(reader, "Formato ("+strings.Join(nombres, ", ")+"; vacío = texto): "))
+	if formato == "" {
+		formato = "texto"
+	}
+	extension := ""
+	for _, f := range formatosReporte {
+		if f.nombre == formato {
+			extension = f.extension
+		}
+	}
+	if extension == "" {
+		fmt.Printf("Error: formato %q no válido\n", formato)
+		pausar()
+		return
+	}
+	porDefecto := rep.nombre + "." + extension
+	ruta := leerCriterio(reader, fmt.Sprintf("Fichero de destino (vacío para %q): ", porDefecto))
+	if ruta == "" {
+		ruta = porDefecto
+	}
+
+	var datos *reporte
+	consultar(func() { datos = rep.generar() })
+	var b bytes.Buffer
+	if err := escribirReporte(&b, datos, formato); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	if err := os.WriteFile(ruta, b.Bytes(), 0644); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	fmt.Println("Informe guardado en", ruta)
+	pausar()
+}
+
+// mostrarReporte enseña el reporte en texto plano en la consola.
+func mostrarReporte(generar func() *reporte) {
+	limpiarPantalla()
+	var datos *reporte
+	consultar(func() { datos = generar() })
+	if err := escribirReporte(os.Stdout, datos, "texto"); err != nil {
+		fmt.Println("Error:", err)
+	}
+	pausar()
+}
@@ -0,0 +1,590 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"sync"
+)
+
+// Repositorios de datos
+//
+// Cada entidad se consulta y se guarda a través de su repositorio. Los
+// repositorios devuelven siempre el mismo puntero para una misma entidad, así
+// que tras modificar un objeto basta con llamar a Guardar para persistirlo.
+
+type RepositorioClientes interface {
+	Todos() []*Cliente
+	PorID(id int) *Cliente
+	PorVehiculo(matricula string) *Cliente
+	Guardar(c *Cliente) error
+	Eliminar(c *Cliente) error
+}
+
+type RepositorioVehiculos interface {
+	Todos() []*Vehiculo
+	PorMatricula(matricula string) *Vehiculo
+	PorIncidencia(id int) *Vehiculo
+	EnTaller() []*Vehiculo
+	Guardar(v *Vehiculo) error
+	Eliminar(v *Vehiculo) error
+}
+
+type RepositorioIncidencias interface {
+	Todas() []*Incidencia
+	PorID(id int) *Incidencia
+	PorEstado(estado EstadoIncidencia) []*Incidencia
+	PorMecanico(id int) []*Incidencia
+	Guardar(inc *Incidencia) error
+	Eliminar(inc *Incidencia) error
+}
+
+type RepositorioMecanicos interface {
+	Todos() []*Mecanico
+	PorID(id int) *Mecanico
+	PorEspecialidad(especialidad TipoIncidencia) []*Mecanico
+	Guardar(m *Mecanico) error
+	Eliminar(m *Mecanico) error
+}
+
+// RepositorioHistorial guarda los eventos en orden; no se modifican ni se
+// borran (ver historial.go).
+type RepositorioHistorial interface {
+	Todos() []*Evento
+	Registrar(e *Evento) error
+}
+
+// Almacen agrupa los repositorios de un mismo origen de datos.
+type Almacen interface {
+	Clientes() RepositorioClientes
+	Vehiculos() RepositorioVehiculos
+	Incidencias() RepositorioIncidencias
+	Mecanicos() RepositorioMecanicos
+	Historial() RepositorioHistorial
+
+	// GuardarTaller persiste la configuración del taller, el mapa de plazas
+	// y los contadores de IDs.
+	GuardarTaller() error
+	// Transaccion ejecuta fn y confirma sus cambios sólo si no devuelve error.
+	// Si falla, se deshacen tanto los datos guardados como los cambios hechos
+	// en memoria a las entidades, al taller y a los contadores. Las llamadas
+	// anidadas forman parte de la transacción exterior.
+	Transaccion(fn func() error) error
+	// Reemplazar sustituye todos los datos por los del estado indicado.
+	Reemplazar(e *estadoTaller) error
+	Cerrar() error
+}
+
+var errYaExiste = errors.New("ya existe otro registro con la misma clave")
+
+var almacen Almacen = nuevoAlmacenMemoria()
+
+// Implementación en memoria
+//
+// Cada repositorio protege su lista y sus índices con un cerrojo propio, de
+// modo que buscar una entidad es seguro desde cualquier puesto. La
+// coherencia entre entidades la garantizan operacion y consultar.
+//
+// Las entidades se modifican en memoria y luego se guardan, así que los
+// índices se ponen al día en cada Guardar con los valores de ese momento.
+
+// indice relaciona cada valor de un campo con las entidades que lo tienen,
+// en el orden en que se dieron de alta (el mismo que Todos).
+type indice[K comparable, T any] struct {
+	claves    func(*T) []K
+	porClave  map[K][]*T
+	actuales  map[*T][]K // claves con las que está indexada cada entidad
+	alta      map[*T]int
+	siguiente int
+}
+
+func nuevoIndice[K comparable, T any](claves func(*T) []K) *indice[K, T] {
+	return &indice[K, T]{claves: claves, porClave: map[K][]*T{}, actuales: map[*T][]K{}, alta: map[*T]int{}}
+}
+
+// actualizar indexa la entidad con sus valores actuales.
+func (ix *indice[K, T]) actualizar(e *T) {
+	if _, ok := ix.alta[e]; !ok {
+		ix.alta[e] = ix.siguiente
+		ix.siguiente++
+	}
+	var claves []K
+	for _, k := range ix.claves(e) {
+		if !slices.Contains(claves, k) {
+			claves = append(claves, k)
+		}
+	}
+	if actuales, ok := ix.actuales[e]; ok && slices.Equal(actuales, claves) {
+		return
+	}
+	ix.quitarClaves(e)
+	for _, k := range claves {
+		lista := ix.porClave[k]
+		i, _ := slices.BinarySearchFunc(lista, ix.alta[e], func(otra *T, alta int) int { return ix.alta[otra] - alta })
+		ix.porClave[k] = slices.Insert(lista, i, e)
+	}
+	ix.actuales[e] = claves
+}
+
+func (ix *indice[K, T]) quitar(e *T) {
+	ix.quitarClaves(e)
+	delete(ix.actuales, e)
+	delete(ix.alta, e)
+}
+
+func (ix *indice[K, T]) quitarClaves(e *T) {
+	for _, k := range ix.actuales[e] {
+		lista := slices.DeleteFunc(ix.porClave[k], func(otra *T) bool { return otra == e })
+		if len(lista) == 0 {
+			delete(ix.porClave, k)
+		} else {
+			ix.porClave[k] = lista
+		}
+	}
+}
+
+// buscar devuelve las entidades con esa clave. Descarta las que la han
+// cambiado en memoria sin guardarse todavía.
+func (ix *indice[K, T]) buscar(k K) []*T {
+	var resultado []*T
+	for _, e := range ix.porClave[k] {
+		if slices.Contains(ix.claves(e), k) {
+			resultado = append(resultado, e)
+		}
+	}
+	return resultado
+}
+
+type almacenMemoria struct {
+	clientes    *repoClientesMemoria
+	vehiculos   *repoVehiculosMemoria
+	incidencias *repoIncidenciasMemoria
+	mecanicos   *repoMecanicosMemoria
+	historial   *repoHistorialMemoria
+
+	enTransaccion bool
+}
+
+func nuevoAlmacenMemoria() *almacenMemoria {
+	return &almacenMemoria{
+		clientes:    nuevoRepoClientesMemoria(),
+		vehiculos:   nuevoRepoVehiculosMemoria(),
+		incidencias: nuevoRepoIncidenciasMemoria(),
+		mecanicos:   nuevoRepoMecanicosMemoria(),
+		historial:   &repoHistorialMemoria{},
+	}
+}
+
+func (a *almacenMemoria) Clientes() RepositorioClientes       { return a.clientes }
+func (a *almacenMemoria) Vehiculos() RepositorioVehiculos     { return a.vehiculos }
+func (a *almacenMemoria) Incidencias() RepositorioIncidencias { return a.incidencias }
+func (a *almacenMemoria) Mecanicos() RepositorioMecanicos     { return a.mecanicos }
+func (a *almacenMemoria) Historial() RepositorioHistorial     { return a.historial }
+func (a *almacenMemoria) GuardarTaller() error                { return nil }
+func (a *almacenMemoria) Cerrar() error                       { return nil }
+
+func (a *almacenMemoria) Transaccion(fn func() error) error {
+	if a.enTransaccion {
+		return fn()
+	}
+
+	copia := copiarEstado(a)
+	a.enTransaccion = true
+	confirmada := false
+	// también si fn entra en pánico: el almacén no se queda a medias
+	defer func() {
+		a.enTransaccion = false
+		if !confirmada {
+			copia.restaurar(a)
+		}
+	}()
+	err := fn()
+	confirmada = err == nil
+	return err
+}
+
+func (a *almacenMemoria) Reemplazar(e *estadoTaller) error {
+	nuevo := nuevoAlmacenMemoria()
+	for _, c := range e.clientes {
+		nuevo.clientes.Guardar(c)
+	}
+	for _, v := range e.vehiculos {
+		nuevo.vehiculos.Guardar(v)
+	}
+	for _, inc := range e.incidencias {
+		nuevo.incidencias.Guardar(inc)
+	}
+	for _, m := range e.mecanicos {
+		nuevo.mecanicos.Guardar(m)
+	}
+	for _, ev := range e.historial {
+		nuevo.historial.Registrar(ev)
+	}
+	a.clientes.reemplazar(nuevo.clientes)
+	a.vehiculos.reemplazar(nuevo.vehiculos)
+	a.incidencias.reemplazar(nuevo.incidencias)
+	a.mecanicos.reemplazar(nuevo.mecanicos)
+	a.historial.reemplazar(nuevo.historial)
+	return nil
+}
+
+type repoClientesMemoria struct {
+	mu           sync.RWMutex
+	lista        []*Cliente
+	porID        map[int]*Cliente
+	porMatricula *indice[string, Cliente]
+}
+
+func nuevoRepoClientesMemoria() *repoClientesMemoria {
+	return &repoClientesMemoria{
+		porID: map[int]*Cliente{},
+		porMatricula: nuevoIndice(func(c *Cliente) []string {
+			if c.Vehiculo == nil {
+				return nil
+			}
+			return []string{c.Vehiculo.Matricula}
+		}),
+	}
+}
+
+func (r *repoClientesMemoria) Todos() []*Cliente {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Cliente{}, r.lista...)
+}
+
+func (r *repoClientesMemoria) PorID(id int) *Cliente {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porID[id]
+}
+
+func (r *repoClientesMemoria) PorVehiculo(matricula string) *Cliente {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if encontrados := r.porMatricula.buscar(matricula); len(encontrados) > 0 {
+		return encontrados[0]
+	}
+	return nil
+}
+
+func (r *repoClientesMemoria) Guardar(c *Cliente) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if actual, ok := r.porID[c.ID]; ok {
+		if actual != c {
+			return errYaExiste
+		}
+	} else {
+		r.lista = append(r.lista, c)
+		r.porID[c.ID] = c
+	}
+	r.porMatricula.actualizar(c)
+	return nil
+}
+
+func (r *repoClientesMemoria) Eliminar(c *Cliente) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, actual := range r.lista {
+		if actual == c {
+			r.lista = append(r.lista[:i], r.lista[i+1:]...)
+			delete(r.porID, c.ID)
+			r.porMatricula.quitar(c)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *repoClientesMemoria) reemplazar(otro *repoClientesMemoria) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lista, r.porID, r.porMatricula = otro.lista, otro.porID, otro.porMatricula
+}
+
+type repoVehiculosMemoria struct {
+	mu            sync.RWMutex
+	lista         []*Vehiculo
+	porMatricula  map[string]*Vehiculo
+	porIncidencia *indice[int, Vehiculo]
+	enTaller      *indice[bool, Vehiculo]
+}
+
+func nuevoRepoVehiculosMemoria() *repoVehiculosMemoria {
+	return &repoVehiculosMemoria{
+		porMatricula: map[string]*Vehiculo{},
+		porIncidencia: nuevoIndice(func(v *Vehiculo) []int {
+			ids := make([]int, len(v.Incidencias))
+			for i, inc := range v.Incidencias {
+				ids[i] = inc.ID
+			}
+			return ids
+		}),
+		enTaller: nuevoIndice(func(v *Vehiculo) []bool {
+			if !v.EnTaller {
+				return nil
+			}
+			return []bool{true}
+		}),
+	}
+}
+
+func (r *repoVehiculosMemoria) Todos() []*Vehiculo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Vehiculo{}, r.lista...)
+}
+
+func (r *repoVehiculosMemoria) PorMatricula(matricula string) *Vehiculo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porMatricula[matricula]
+}
+
+func (r *repoVehiculosMemoria) PorIncidencia(id int) *Vehiculo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if encontrados := r.porIncidencia.buscar(id); len(encontrados) > 0 {
+		return encontrados[0]
+	}
+	return nil
+}
+
+func (r *repoVehiculosMemoria) EnTaller() []*Vehiculo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.enTaller.buscar(true)
+}
+
+func (r *repoVehiculosMemoria) Guardar(v *Vehiculo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if actual, ok := r.porMatricula[v.Matricula]; ok {
+		if actual != v {
+			return errYaExiste
+		}
+	} else {
+		r.lista = append(r.lista, v)
+		r.porMatricula[v.Matricula] = v
+	}
+	r.porIncidencia.actualizar(v)
+	r.enTaller.actualizar(v)
+	return nil
+}
+
+func (r *repoVehiculosMemoria) Eliminar(v *Vehiculo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, actual := range r.lista {
+		if actual == v {
+			r.lista = append(r.lista[:i], r.lista[i+1:]...)
+			delete(r.porMatricula, v.Matricula)
+			r.porIncidencia.quitar(v)
+			r.enTaller.quitar(v)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *repoVehiculosMemoria) reemplazar(otro *repoVehiculosMemoria) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lista, r.porMatricula = otro.lista, otro.porMatricula
+	r.porIncidencia, r.enTaller = otro.porIncidencia, otro.enTaller
+}
+
+type repoIncidenciasMemoria struct {
+	mu          sync.RWMutex
+	lista       []*Incidencia
+	porID       map[int]*Incidencia
+	porEstado   *indice[EstadoIncidencia, Incidencia]
+	porMecanico *indice[int, Incidencia]
+}
+
+func nuevoRepoIncidenciasMemoria() *repoIncidenciasMemoria {
+	return &repoIncidenciasMemoria{
+		porID: map[int]*Incidencia{},
+		porEstado: nuevoIndice(func(inc *Incidencia) []EstadoIncidencia {
+			return []EstadoIncidencia{inc.Estado}
+		}),
+		porMecanico: nuevoIndice(func(inc *Incidencia) []int {
+			ids := make([]int, len(inc.Mecanicos))
+			for i, m := range inc.Mecanicos {
+				ids[i] = m.ID
+			}
+			return ids
+		}),
+	}
+}
+
+func (r *repoIncidenciasMemoria) Todas() []*Incidencia {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Incidencia{}, r.lista...)
+}
+
+func (r *repoIncidenciasMemoria) PorID(id int) *Incidencia {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porID[id]
+}
+
+func (r *repoIncidenciasMemoria) PorEstado(estado EstadoIncidencia) []*Incidencia {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porEstado.buscar(estado)
+}
+
+func (r *repoIncidenciasMemoria) PorMecanico(id int) []*Incidencia {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porMecanico.buscar(id)
+}
+
+func (r *repoIncidenciasMemoria) Guardar(inc *Incidencia) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if actual, ok := r.porID[inc.ID]; ok {
+		if actual != inc {
+			return errYaExiste
+		}
+	} else {
+		r.lista = append(r.lista, inc)
+		r.porID[inc.ID] = inc
+	}
+	r.porEstado.actualizar(inc)
+	r.porMecanico.actualizar(inc)
+	return nil
+}
+
+func (r *repoIncidenciasMemoria) Eliminar(inc *Incidencia) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, actual := range r.lista {
+		if actual == inc {
+			r.lista = append(r.lista[:i], r.lista[i+1:]...)
+			delete(r.porID, inc.ID)
+			r.porEstado.quitar(inc)
+			r.porMecanico.quitar(inc)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *repoIncidenciasMemoria) reemplazar(otro *repoIncidenciasMemoria) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lista, r.porID = otro.lista, otro.porID
+	r.porEstado, r.porMecanico = otro.porEstado, otro.porMecanico
+}
+
+type repoMecanicosMemoria struct {
+	mu              sync.RWMutex
+	lista           []*Mecanico
+	porID           map[int]*Mecanico
+	porEspecialidad *indice[TipoIncidencia, Mecanico]
+}
+
+func nuevoRepoMecanicosMemoria() *repoMecanicosMemoria {
+	return &repoMecanicosMemoria{
+		porID: map[int]*Mecanico{},
+		porEspecialidad: nuevoIndice(func(m *Mecanico) []TipoIncidencia {
+			var tipos []TipoIncidencia
+			for _, e := range m.Especialidades {
+				if e.Nivel != "" {
+					tipos = append(tipos, e.Tipo)
+				}
+			}
+			return tipos
+		}),
+	}
+}
+
+func (r *repoMecanicosMemoria) Todos() []*Mecanico {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Mecanico{}, r.lista...)
+}
+
+func (r *repoMecanicosMemoria) PorID(id int) *Mecanico {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porID[id]
+}
+
+func (r *repoMecanicosMemoria) PorEspecialidad(especialidad TipoIncidencia) []*Mecanico {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.porEspecialidad.buscar(especialidad)
+}
+
+func (r *repoMecanicosMemoria) Guardar(m *Mecanico) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if actual, ok := r.porID[m.ID]; ok {
+		if actual != m {
+			return errYaExiste
+		}
+	} else {
+		r.lista = append(r.lista, m)
+		r.porID[m.ID] = m
+	}
+	r.porEspecialidad.actualizar(m)
+	return nil
+}
+
+func (r *repoMecanicosMemoria) Eliminar(m *Mecanico) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, actual := range r.lista {
+		if actual == m {
+			r.lista = append(r.lista[:i], r.lista[i+1:]...)
+			delete(r.porID, m.ID)
+			r.porEspecialidad.quitar(m)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (r *repoMecanicosMemoria) reemplazar(otro *repoMecanicosMemoria) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lista, r.porID, r.porEspecialidad = otro.lista, otro.porID, otro.porEspecialidad
+}
+
+type repoHistorialMemoria struct {
+	mu    sync.RWMutex
+	lista []*Evento
+}
+
+func (r *repoHistorialMemoria) Todos() []*Evento {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]*Evento{}, r.lista...)
+}
+
+// Registrar añade el evento al final; si no tiene ID recibe el siguiente.
+func (r *repoHistorialMemoria) Registrar(e *Evento) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ultimo := 0
+	if n := len(r.lista); n > 0 {
+		ultimo = r.lista[n-1].ID
+	}
+	if e.ID == 0 {
+		e.ID = ultimo + 1
+	} else if e.ID <= ultimo {
+		return errYaExiste
+	}
+	r.lista = append(r.lista, e)
+	return nil
+}
+
+func (r *repoHistorialMemoria) reemplazar(otro *repoHistorialMemoria) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lista = otro.lista
+}
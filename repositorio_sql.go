@@ -0,0 +1,641 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync/atomic"
+	"time"
+)
+
+// Implementación SQL de los repositorios
+//
+// Cada entidad es una fila con sus claves en columnas indexadas y el resto de
+// campos en JSON, con el mismo formato que las instantáneas. Así, al abrir una
+// base de datos antigua se aplican las mismas migraciones de esquema. Los
+// objetos leídos se mantienen en memoria para conservar los punteros entre
+// entidades; las consultas por estado, mecánico, etc. usan los índices.
+
+// driverSQL es el nombre con el que se registra el driver (ver sqlite.go).
+const driverSQL = "sqlite"
+
+var tablasSQL = []string{
+	`CREATE TABLE IF NOT EXISTS meta (clave TEXT PRIMARY KEY, valor TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS clientes (id INTEGER PRIMARY KEY, datos TEXT NOT NULL)`,
+	// incidencia_id es la orden de trabajo en curso (el ID de su primera
+	// incidencia); todas las incidencias del vehículo están en
+	// vehiculo_incidencias.
+	`CREATE TABLE IF NOT EXISTS vehiculos (
+		matricula TEXT PRIMARY KEY,
+		cliente_id INTEGER,
+		incidencia_id INTEGER,
+		en_taller INTEGER NOT NULL,
+		datos TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS vehiculo_incidencias (
+		incidencia_id INTEGER PRIMARY KEY,
+		matricula TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS incidencias (id INTEGER PRIMARY KEY, estado TEXT NOT NULL, datos TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS incidencia_mecanicos (
+		incidencia_id INTEGER NOT NULL,
+		mecanico_id INTEGER NOT NULL,
+		PRIMARY KEY (incidencia_id, mecanico_id))`,
+	// especialidad es la primera de la lista; todas, con su nivel, están en
+	// mecanico_especialidades.
+	`CREATE TABLE IF NOT EXISTS mecanicos (id INTEGER PRIMARY KEY, especialidad TEXT NOT NULL, datos TEXT NOT NULL)`,
+	`CREATE TABLE IF NOT EXISTS mecanico_especialidades (
+		mecanico_id INTEGER NOT NULL,
+		tipo TEXT NOT NULL,
+		nivel TEXT NOT NULL,
+		PRIMARY KEY (mecanico_id, tipo))`,
+	`CREATE TABLE IF NOT EXISTS historial (id INTEGER PRIMARY KEY, fecha TEXT NOT NULL, datos TEXT NOT NULL)`,
+	`CREATE INDEX IF NOT EXISTS vehiculos_cliente ON vehiculos (cliente_id)`,
+	`CREATE INDEX IF NOT EXISTS vehiculos_incidencia ON vehiculos (incidencia_id)`,
+	`CREATE INDEX IF NOT EXISTS vehiculos_en_taller ON vehiculos (en_taller)`,
+	`CREATE INDEX IF NOT EXISTS vehiculo_incidencias_matricula ON vehiculo_incidencias (matricula)`,
+	`CREATE INDEX IF NOT EXISTS incidencias_estado ON incidencias (estado)`,
+	`CREATE INDEX IF NOT EXISTS incidencia_mecanicos_mecanico ON incidencia_mecanicos (mecanico_id)`,
+	`CREATE INDEX IF NOT EXISTS mecanicos_especialidad ON mecanicos (especialidad)`,
+	`CREATE INDEX IF NOT EXISTS mecanico_especialidades_tipo ON mecanico_especialidades (tipo)`,
+	`CREATE INDEX IF NOT EXISTS historial_fecha ON historial (fecha)`,
+}
+
+type almacenSQL struct {
+	db    *sql.DB
+	tx    atomic.Pointer[sql.Tx] // transacción en curso (ver operacion)
+	cache *almacenMemoria
+}
+
+// abrirAlmacenSQL abre (o crea) la base de datos y carga su contenido en el
+// estado global del taller.
+func abrirAlmacenSQL(ruta string) (*almacenSQL, error) {
+	if !slices.Contains(sql.Drivers(), driverSQL) {
+		return nil, errors.New("este ejecutable no incluye SQLite: compílelo con go build -tags sqlite")
+	}
+	db, err := sql.Open(driverSQL, ruta)
+	if err != nil {
+		return nil, err
+	}
+	for _, sentencia := range tablasSQL {
+		if _, err := db.Exec(sentencia); err != nil {
+			db.Close()
+			return nil, err
+		}
+	}
+
+	a := &almacenSQL{db: db, cache: nuevoAlmacenMemoria()}
+	if err := a.cargar(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return a, nil
+}
+
+// ejecutor devuelve la transacción en curso o, si no hay, la base de datos.
+func (a *almacenSQL) ejecutor() interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+} {
+	if tx := a.tx.Load(); tx != nil {
+		return tx
+	}
+	return a.db
+}
+
+// cargar lee todas las filas, las pasa por las migraciones como si fueran
+// una instantánea y reconstruye las entidades en memoria.
+func (a *almacenSQL) cargar() error {
+	meta := map[string]string{}
+	filas, err := a.db.Query(`SELECT clave, valor FROM meta`)
+	if err != nil {
+		return err
+	}
+	for filas.Next() {
+		var clave, valor string
+		if err := filas.Scan(&clave, &valor); err != nil {
+			filas.Close()
+			return err
+		}
+		meta[clave] = valor
+	}
+	filas.Close()
+
+	if meta["version"] == "" {
+		// Base de datos nueva: se inicializa con el estado actual.
+		return a.Reemplazar(estadoActual())
+	}
+
+	generico := map[string]interface{}{
+		"fecha":      time.Now().Format(time.RFC3339),
+		"version":    json.RawMessage(meta["version"]),
+		"taller":     json.RawMessage(meta["taller"]),
+		"contadores": json.RawMessage(meta["contadores"]),
+	}
+	for tabla, clave := range map[string]string{
+		"clientes":    "clientes",
+		"vehiculos":   "vehiculos",
+		"incidencias": "incidencias",
+		"mecanicos":   "mecanicos",
+		"historial":   "historial",
+	} {
+		datos, err := a.leerDatos(tabla)
+		if err != nil {
+			return err
+		}
+		generico[clave] = datos
+	}
+
+	bruto, err := json.Marshal(generico)
+	if err != nil {
+		return err
+	}
+	bruto, aplicadas, err := migrarDatos(bruto)
+	if err != nil {
+		return err
+	}
+	var s snapshot
+	if err := json.Unmarshal(bruto, &s); err != nil {
+		return err
+	}
+	e, err := s.construir()
+	if err != nil {
+		return fmt.Errorf("la base de datos no es coherente: %v", err)
+	}
+
+	aplicarEstado(e)
+	if len(aplicadas) > 0 {
+		// Reescribir las filas en el formato actual.
+		return a.Reemplazar(e)
+	}
+	return a.cache.Reemplazar(e)
+}
+
+func (a *almacenSQL) leerDatos(tabla string) ([]json.RawMessage, error) {
+	filas, err := a.db.Query(`SELECT datos FROM ` + tabla + ` ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer filas.Close()
+
+	lista := []json.RawMessage{}
+	for filas.Next() {
+		var datos string
+		if err := filas.Scan(&datos); err != nil {
+			return nil, err
+		}
+		lista = append(lista, json.RawMessage(datos))
+	}
+	return lista, filas.Err()
+}
+
+// consultarClaves ejecuta una consulta que devuelve una columna de claves.
+func (a *almacenSQL) consultarClaves(consulta string, args ...interface{}) ([]string, error) {
+	filas, err := a.ejecutor().Query(consulta, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer filas.Close()
+
+	var claves []string
+	for filas.Next() {
+		var clave string
+		if err := filas.Scan(&clave); err != nil {
+			return nil, err
+		}
+		claves = append(claves, clave)
+	}
+	return claves, filas.Err()
+}
+
+func aJSON(valor interface{}) string {
+	datos, _ := json.Marshal(valor)
+	return string(datos)
+}
+
+func (a *almacenSQL) Clientes() RepositorioClientes       { return &repoClientesSQL{a} }
+func (a *almacenSQL) Vehiculos() RepositorioVehiculos     { return &repoVehiculosSQL{a} }
+func (a *almacenSQL) Incidencias() RepositorioIncidencias { return &repoIncidenciasSQL{a} }
+func (a *almacenSQL) Mecanicos() RepositorioMecanicos     { return &repoMecanicosSQL{a} }
+func (a *almacenSQL) Historial() RepositorioHistorial     { return &repoHistorialSQL{a} }
+
+func (a *almacenSQL) GuardarTaller() error {
+	valores := map[string]string{
+		"version":    fmt.Sprint(versionEsquema),
+		"taller":     aJSON(tallerAJSON()),
+		"contadores": aJSON(contadoresActuales()),
+	}
+	for clave, valor := range valores {
+		_, err := a.ejecutor().Exec(`INSERT INTO meta (clave, valor) VALUES (?, ?)
+			ON CONFLICT (clave) DO UPDATE SET valor = excluded.valor`, clave, valor)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Transaccion agrupa las escrituras de fn. Si fn falla se deshace la
+// transacción y también los cambios en memoria (ver transaccion.go).
+func (a *almacenSQL) Transaccion(fn func() error) error {
+	if a.tx.Load() != nil {
+		return fn()
+	}
+
+	tx, err := a.db.Begin()
+	if err != nil {
+		return err
+	}
+	copia := copiarEstado(a.cache)
+	a.tx.Store(tx)
+	terminada := false
+	// si fn entra en pánico se deshace todo antes de que siga su camino
+	defer func() {
+		if !terminada {
+			a.tx.Store(nil)
+			tx.Rollback()
+			copia.restaurar(a.cache)
+		}
+	}()
+	err = fn()
+	a.tx.Store(nil)
+	terminada = true
+
+	if err == nil {
+		err = tx.Commit()
+	} else {
+		tx.Rollback()
+	}
+	if err != nil {
+		copia.restaurar(a.cache)
+		// Otro proceso ha modificado la base de datos: se recarga para que
+		// el siguiente intento parta de los datos actuales.
+		var conflicto *errorConflicto
+		if errors.As(err, &conflicto) {
+			if errCarga := a.cargar(); errCarga != nil {
+				return fmt.Errorf("%v (y no se pudo recargar el estado: %v)", err, errCarga)
+			}
+		}
+	}
+	return err
+}
+
+func (a *almacenSQL) Reemplazar(e *estadoTaller) error {
+	return a.Transaccion(func() error {
+		for _, tabla := range []string{"clientes", "vehiculos", "vehiculo_incidencias", "incidencias", "incidencia_mecanicos",
+			"mecanicos", "mecanico_especialidades", "historial"} {
+			if _, err := a.ejecutor().Exec(`DELETE FROM ` + tabla); err != nil {
+				return err
+			}
+		}
+		if err := a.cache.Reemplazar(e); err != nil {
+			return err
+		}
+		for _, c := range e.clientes {
+			if err := a.escribirCliente(c); err != nil {
+				return err
+			}
+		}
+		for _, m := range e.mecanicos {
+			if err := a.escribirMecanico(m); err != nil {
+				return err
+			}
+		}
+		for _, inc := range e.incidencias {
+			if err := a.escribirIncidencia(inc); err != nil {
+				return err
+			}
+		}
+		for _, v := range e.vehiculos {
+			if err := a.escribirVehiculo(v); err != nil {
+				return err
+			}
+		}
+		for _, ev := range e.historial {
+			if err := a.escribirEvento(ev); err != nil {
+				return err
+			}
+		}
+		return a.GuardarTaller()
+	})
+}
+
+func (a *almacenSQL) Cerrar() error {
+	return a.db.Close()
+}
+
+// Las filas sólo se actualizan si la versión guardada es anterior a la que
+// se escribe. Si no es así, otro proceso que comparte la base de datos ha
+// guardado antes la misma entidad y escribirFila devuelve un errorConflicto.
+func condicionVersion(tabla string) string {
+	return ` WHERE coalesce(json_extract(` + tabla + `.datos, '$.version'), 0) < json_extract(excluded.datos, '$.version')`
+}
+
+func (a *almacenSQL) escribirFila(tabla, columnaClave string, clave, entidad interface{}, sentencia string, args ...interface{}) error {
+	resultado, err := a.ejecutor().Exec(sentencia+condicionVersion(tabla), args...)
+	if err != nil {
+		return err
+	}
+	if n, err := resultado.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	var guardado string
+	err = a.ejecutor().QueryRow(`SELECT datos FROM `+tabla+` WHERE `+columnaClave+` = ?`, clave).Scan(&guardado)
+	if err != nil {
+		return err
+	}
+	nombre, textoClave := describirEntidad(entidad)
+	return &errorConflicto{
+		Entidad: nombre,
+		Clave:   textoClave,
+		Cambios: diferencias(camposEntidad(entidad), camposJSON([]byte(guardado))),
+	}
+}
+
+func (a *almacenSQL) escribirCliente(c *Cliente) error {
+	return a.escribirFila("clientes", "id", c.ID, c, `INSERT INTO clientes (id, datos) VALUES (?, ?)
+		ON CONFLICT (id) DO UPDATE SET datos = excluded.datos`, c.ID, aJSON(clienteAJSON(c)))
+}
+
+func (a *almacenSQL) escribirVehiculo(v *Vehiculo) error {
+	vj := vehiculoAJSON(v, a.cache.clientes.PorVehiculo(v.Matricula))
+	err := a.escribirFila("vehiculos", "matricula", v.Matricula, v, `INSERT INTO vehiculos (matricula, cliente_id, incidencia_id, en_taller, datos)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (matricula) DO UPDATE SET cliente_id = excluded.cliente_id,
+			incidencia_id = excluded.incidencia_id, en_taller = excluded.en_taller, datos = excluded.datos`,
+		v.Matricula, nuloSiCero(vj.ClienteID), nuloSiCero(vj.Orden), v.EnTaller, aJSON(vj))
+	if err != nil {
+		return err
+	}
+	if _, err := a.ejecutor().Exec(`DELETE FROM vehiculo_incidencias WHERE matricula = ?`, v.Matricula); err != nil {
+		return err
+	}
+	for _, inc := range v.Incidencias {
+		_, err := a.ejecutor().Exec(`INSERT INTO vehiculo_incidencias (incidencia_id, matricula) VALUES (?, ?)
+			ON CONFLICT (incidencia_id) DO UPDATE SET matricula = excluded.matricula`, inc.ID, v.Matricula)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *almacenSQL) escribirIncidencia(inc *Incidencia) error {
+	err := a.escribirFila("incidencias", "id", inc.ID, inc, `INSERT INTO incidencias (id, estado, datos) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET estado = excluded.estado, datos = excluded.datos`,
+		inc.ID, inc.Estado, aJSON(incidenciaAJSON(inc)))
+	if err != nil {
+		return err
+	}
+	if _, err := a.ejecutor().Exec(`DELETE FROM incidencia_mecanicos WHERE incidencia_id = ?`, inc.ID); err != nil {
+		return err
+	}
+	for _, m := range inc.Mecanicos {
+		_, err := a.ejecutor().Exec(`INSERT INTO incidencia_mecanicos (incidencia_id, mecanico_id) VALUES (?, ?)`,
+			inc.ID, m.ID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *almacenSQL) escribirMecanico(m *Mecanico) error {
+	var principal TipoIncidencia
+	if len(m.Especialidades) > 0 {
+		principal = m.Especialidades[0].Tipo
+	}
+	err := a.escribirFila("mecanicos", "id", m.ID, m, `INSERT INTO mecanicos (id, especialidad, datos) VALUES (?, ?, ?)
+		ON CONFLICT (id) DO UPDATE SET especialidad = excluded.especialidad, datos = excluded.datos`,
+		m.ID, principal, aJSON(mecanicoAJSON(m)))
+	if err != nil {
+		return err
+	}
+	if _, err := a.ejecutor().Exec(`DELETE FROM mecanico_especialidades WHERE mecanico_id = ?`, m.ID); err != nil {
+		return err
+	}
+	for _, e := range m.Especialidades {
+		_, err := a.ejecutor().Exec(`INSERT INTO mecanico_especialidades (mecanico_id, tipo, nivel) VALUES (?, ?, ?)`,
+			m.ID, e.Tipo, e.Nivel)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (a *almacenSQL) escribirEvento(e *Evento) error {
+	_, err := a.ejecutor().Exec(`INSERT INTO historial (id, fecha, datos) VALUES (?, ?, ?)`,
+		e.ID, e.Fecha.Format(time.RFC3339), aJSON(eventoAJSON(e)))
+	return err
+}
+
+func nuloSiCero(n int) interface{} {
+	if n == 0 {
+		return nil
+	}
+	return n
+}
+
+type repoClientesSQL struct{ a *almacenSQL }
+
+func (r *repoClientesSQL) Todos() []*Cliente     { return r.a.cache.clientes.Todos() }
+func (r *repoClientesSQL) PorID(id int) *Cliente { return r.a.cache.clientes.PorID(id) }
+
+// PorVehiculo usa la relación en memoria: es la que se escribe en la fila
+// del vehículo, así que no puede leerse de ella mientras se guarda.
+func (r *repoClientesSQL) PorVehiculo(matricula string) *Cliente {
+	return r.a.cache.clientes.PorVehiculo(matricula)
+}
+
+func (r *repoClientesSQL) Guardar(c *Cliente) error {
+	if actual := r.a.cache.clientes.PorID(c.ID); actual != nil && actual != c {
+		return errYaExiste
+	}
+	if err := r.a.escribirCliente(c); err != nil {
+		return err
+	}
+	return r.a.cache.clientes.Guardar(c)
+}
+
+func (r *repoClientesSQL) Eliminar(c *Cliente) error {
+	if _, err := r.a.ejecutor().Exec(`DELETE FROM clientes WHERE id = ?`, c.ID); err != nil {
+		return err
+	}
+	return r.a.cache.clientes.Eliminar(c)
+}
+
+type repoVehiculosSQL struct{ a *almacenSQL }
+
+func (r *repoVehiculosSQL) Todos() []*Vehiculo { return r.a.cache.vehiculos.Todos() }
+
+func (r *repoVehiculosSQL) PorMatricula(matricula string) *Vehiculo {
+	return r.a.cache.vehiculos.PorMatricula(matricula)
+}
+
+func (r *repoVehiculosSQL) PorIncidencia(id int) *Vehiculo {
+	claves, err := r.a.consultarClaves(`SELECT matricula FROM vehiculo_incidencias WHERE incidencia_id = ?`, id)
+	if err != nil {
+		return r.a.cache.vehiculos.PorIncidencia(id)
+	}
+	for _, matricula := range claves {
+		return r.PorMatricula(matricula)
+	}
+	return nil
+}
+
+func (r *repoVehiculosSQL) EnTaller() []*Vehiculo {
+	claves, err := r.a.consultarClaves(`SELECT matricula FROM vehiculos WHERE en_taller = 1 ORDER BY rowid`)
+	if err != nil {
+		return r.a.cache.vehiculos.EnTaller()
+	}
+	var resultado []*Vehiculo
+	for _, matricula := range claves {
+		if v := r.PorMatricula(matricula); v != nil {
+			resultado = append(resultado, v)
+		}
+	}
+	return resultado
+}
+
+func (r *repoVehiculosSQL) Guardar(v *Vehiculo) error {
+	if actual := r.a.cache.vehiculos.PorMatricula(v.Matricula); actual != nil && actual != v {
+		return errYaExiste
+	}
+	if err := r.a.escribirVehiculo(v); err != nil {
+		return err
+	}
+	return r.a.cache.vehiculos.Guardar(v)
+}
+
+func (r *repoVehiculosSQL) Eliminar(v *Vehiculo) error {
+	if _, err := r.a.ejecutor().Exec(`DELETE FROM vehiculo_incidencias WHERE matricula = ?`, v.Matricula); err != nil {
+		return err
+	}
+	if _, err := r.a.ejecutor().Exec(`DELETE FROM vehiculos WHERE matricula = ?`, v.Matricula); err != nil {
+		return err
+	}
+	return r.a.cache.vehiculos.Eliminar(v)
+}
+
+type repoIncidenciasSQL struct{ a *almacenSQL }
+
+func (r *repoIncidenciasSQL) Todas() []*Incidencia     { return r.a.cache.incidencias.Todas() }
+func (r *repoIncidenciasSQL) PorID(id int) *Incidencia { return r.a.cache.incidencias.PorID(id) }
+
+func (r *repoIncidenciasSQL) PorEstado(estado EstadoIncidencia) []*Incidencia {
+	claves, err := r.a.consultarClaves(`SELECT id FROM incidencias WHERE estado = ? ORDER BY rowid`, estado)
+	if err != nil {
+		return r.a.cache.incidencias.PorEstado(estado)
+	}
+	return r.porClaves(claves)
+}
+
+func (r *repoIncidenciasSQL) PorMecanico(id int) []*Incidencia {
+	claves, err := r.a.consultarClaves(`SELECT i.id FROM incidencias i
+		JOIN incidencia_mecanicos im ON im.incidencia_id = i.id
+		WHERE im.mecanico_id = ? ORDER BY i.rowid`, id)
+	if err != nil {
+		return r.a.cache.incidencias.PorMecanico(id)
+	}
+	return r.porClaves(claves)
+}
+
+func (r *repoIncidenciasSQL) porClaves(claves []string) []*Incidencia {
+	var resultado []*Incidencia
+	for _, clave := range claves {
+		var id int
+		fmt.Sscan(clave, &id)
+		if inc := r.PorID(id); inc != nil {
+			resultado = append(resultado, inc)
+		}
+	}
+	return resultado
+}
+
+func (r *repoIncidenciasSQL) Guardar(inc *Incidencia) error {
+	if actual := r.a.cache.incidencias.PorID(inc.ID); actual != nil && actual != inc {
+		return errYaExiste
+	}
+	if err := r.a.escribirIncidencia(inc); err != nil {
+		return err
+	}
+	return r.a.cache.incidencias.Guardar(inc)
+}
+
+func (r *repoIncidenciasSQL) Eliminar(inc *Incidencia) error {
+	for _, tabla := range []string{"incidencia_mecanicos", "vehiculo_incidencias"} {
+		if _, err := r.a.ejecutor().Exec(`DELETE FROM `+tabla+` WHERE incidencia_id = ?`, inc.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := r.a.ejecutor().Exec(`DELETE FROM incidencias WHERE id = ?`, inc.ID); err != nil {
+		return err
+	}
+	return r.a.cache.incidencias.Eliminar(inc)
+}
+
+type repoMecanicosSQL struct{ a *almacenSQL }
+
+func (r *repoMecanicosSQL) Todos() []*Mecanico     { return r.a.cache.mecanicos.Todos() }
+func (r *repoMecanicosSQL) PorID(id int) *Mecanico { return r.a.cache.mecanicos.PorID(id) }
+
+func (r *repoMecanicosSQL) PorEspecialidad(especialidad TipoIncidencia) []*Mecanico {
+	claves, err := r.a.consultarClaves(`SELECT m.id FROM mecanicos m
+		JOIN mecanico_especialidades e ON e.mecanico_id = m.id WHERE e.tipo = ? ORDER BY m.rowid`, especialidad)
+	if err != nil {
+		return r.a.cache.mecanicos.PorEspecialidad(especialidad)
+	}
+	var resultado []*Mecanico
+	for _, clave := range claves {
+		var id int
+		fmt.Sscan(clave, &id)
+		if m := r.PorID(id); m != nil {
+			resultado = append(resultado, m)
+		}
+	}
+	return resultado
+}
+
+func (r *repoMecanicosSQL) Guardar(m *Mecanico) error {
+	if actual := r.a.cache.mecanicos.PorID(m.ID); actual != nil && actual != m {
+		return errYaExiste
+	}
+	if err := r.a.escribirMecanico(m); err != nil {
+		return err
+	}
+	return r.a.cache.mecanicos.Guardar(m)
+}
+
+func (r *repoMecanicosSQL) Eliminar(m *Mecanico) error {
+	for _, tabla := range []string{"incidencia_mecanicos", "mecanico_especialidades"} {
+		if _, err := r.a.ejecutor().Exec(`DELETE FROM `+tabla+` WHERE mecanico_id = ?`, m.ID); err != nil {
+			return err
+		}
+	}
+	if _, err := r.a.ejecutor().Exec(`DELETE FROM mecanicos WHERE id = ?`, m.ID); err != nil {
+		return err
+	}
+	return r.a.cache.mecanicos.Eliminar(m)
+}
+
+type repoHistorialSQL struct{ a *almacenSQL }
+
+func (r *repoHistorialSQL) Todos() []*Evento { return r.a.cache.historial.Todos() }
+
+// Registrar toma el siguiente ID de la tabla y no de la memoria, porque otro
+// proceso que comparte la base de datos puede haber anotado eventos.
+func (r *repoHistorialSQL) Registrar(e *Evento) error {
+	if e.ID == 0 {
+		err := r.a.ejecutor().QueryRow(`SELECT coalesce(max(id), 0) + 1 FROM historial`).Scan(&e.ID)
+		if err != nil {
+			return err
+		}
+	}
+	if err := r.a.escribirEvento(e); err != nil {
+		return err
+	}
+	return r.a.cache.historial.Registrar(e)
+}
@@ -0,0 +1,297 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// almacenesDePrueba abre cada implementación de Almacen sobre un taller
+// vacío. La de SQLite sólo está si se compila con -tags sqlite.
+func almacenesDePrueba(t *testing.T) map[string]func(t *testing.T) Almacen {
+	return map[string]func(t *testing.T) Almacen{
+		"memoria": func(t *testing.T) Almacen { return nuevoAlmacenMemoria() },
+		"sqlite": func(t *testing.T) Almacen {
+			if !slices.Contains(sql.Drivers(), driverSQL) {
+				t.Skip("compilado sin -tags sqlite")
+			}
+			a, err := abrirAlmacenSQL(filepath.Join(t.TempDir(), "taller.db"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { a.Cerrar() })
+			return a
+		},
+	}
+}
+
+// usarAlmacen deja el taller recién inicializado sobre a mientras dura la
+// prueba.
+func usarAlmacen(t *testing.T, a Almacen) {
+	anterior := almacen
+	inicializarSistema()
+	almacen = a
+	t.Cleanup(func() { almacen = anterior })
+}
+
+func TestRepositoriosBusquedas(t *testing.T) {
+	for nombre, abrir := range almacenesDePrueba(t) {
+		t.Run(nombre, func(t *testing.T) {
+			usarAlmacen(t, abrir(t))
+
+			m1 := &Mecanico{ID: 1, Nombre: "Ana", Activo: true, Especialidades: []Especialidad{
+				{Tipo: tipoMecanica, Nivel: "experto"}, {Tipo: tipoElectrica, Nivel: "básico"}}}
+			m2 := &Mecanico{ID: 2, Nombre: "Luis", Activo: true, Especialidades: []Especialidad{
+				{Tipo: tipoCarroceria, Nivel: "intermedio"}}}
+			i1 := &Incidencia{ID: 1, Tipo: tipoMecanica, Estado: estadoAbierta, Mecanicos: []*Mecanico{m1}}
+			i2 := &Incidencia{ID: 2, Tipo: tipoCarroceria, Estado: estadoEnProceso, Mecanicos: []*Mecanico{m1, m2}}
+			i3 := &Incidencia{ID: 3, Tipo: tipoElectrica, Estado: estadoAbierta}
+			v1 := &Vehiculo{Matricula: "1111AAA", Incidencias: []*Incidencia{i1, i2}, EnTaller: true, NumeroPlaza: 0}
+			v2 := &Vehiculo{Matricula: "2222BBB", Incidencias: []*Incidencia{i3}, NumeroPlaza: -1}
+			c1 := &Cliente{ID: 1, Nombre: "Marta", Vehiculo: v1}
+			c2 := &Cliente{ID: 2, Nombre: "Pedro", Vehiculo: v2}
+			if err := operacion(func() error { return guardar(m1, m2, i1, i2, i3, c1, v1, c2, v2) }); err != nil {
+				t.Fatal(err)
+			}
+
+			// Cada paso modifica las entidades como lo hacen los menús y
+			// comprueba todas las búsquedas con lo que queda guardado.
+			pasos := []struct {
+				nombre          string
+				cambio          func() error
+				porEstado       map[EstadoIncidencia][]int
+				porMecanico     map[int][]int
+				porEspecialidad map[TipoIncidencia][]int
+				enTaller        []string
+				porIncidencia   map[int]string
+				porVehiculo     map[string]int
+			}{
+				{
+					nombre:          "datos iniciales",
+					porEstado:       map[EstadoIncidencia][]int{estadoAbierta: {1, 3}, estadoEnProceso: {2}, estadoCerrada: nil},
+					porMecanico:     map[int][]int{1: {1, 2}, 2: {2}},
+					porEspecialidad: map[TipoIncidencia][]int{tipoMecanica: {1}, tipoElectrica: {1}, tipoCarroceria: {2}},
+					enTaller:        []string{"1111AAA"},
+					porIncidencia:   map[int]string{1: "1111AAA", 2: "1111AAA", 3: "2222BBB", 9: ""},
+					porVehiculo:     map[string]int{"1111AAA": 1, "2222BBB": 2, "9999ZZZ": 0},
+				},
+				{
+					nombre: "cambio de estado",
+					cambio: func() error {
+						i1.Estado = estadoEnProceso
+						i3.Estado = estadoCerrada
+						return guardar(i1, i3)
+					},
+					porEstado: map[EstadoIncidencia][]int{estadoAbierta: nil, estadoEnProceso: {1, 2}, estadoCerrada: {3}},
+				},
+				{
+					nombre: "traspaso de mecánico",
+					cambio: func() error {
+						i2.Mecanicos = []*Mecanico{m2}
+						i3.Mecanicos = []*Mecanico{m1}
+						return guardar(i2, i3)
+					},
+					porMecanico: map[int][]int{1: {1, 3}, 2: {2}},
+				},
+				{
+					nombre: "nueva especialidad",
+					cambio: func() error {
+						m2.Especialidades = append(m2.Especialidades, Especialidad{Tipo: tipoMecanica, Nivel: "básico"})
+						m1.Especialidades = m1.Especialidades[:1]
+						return guardar(m1, m2)
+					},
+					porEspecialidad: map[TipoIncidencia][]int{tipoMecanica: {1, 2}, tipoElectrica: nil, tipoCarroceria: {2}},
+				},
+				{
+					nombre: "entrada y salida del taller",
+					cambio: func() error {
+						v1.EnTaller, v1.NumeroPlaza = false, -1
+						v2.EnTaller, v2.NumeroPlaza = true, 0
+						return guardar(v1, v2)
+					},
+					enTaller: []string{"2222BBB"},
+				},
+				{
+					nombre: "nueva incidencia del vehículo",
+					cambio: func() error {
+						i4 := &Incidencia{ID: 4, Tipo: tipoMecanica, Estado: estadoAbierta, Mecanicos: []*Mecanico{m2}}
+						v1.Incidencias = append(v1.Incidencias, i4)
+						return guardar(i4, v1)
+					},
+					porEstado:     map[EstadoIncidencia][]int{estadoAbierta: {4}},
+					porMecanico:   map[int][]int{2: {2, 4}},
+					porIncidencia: map[int]string{4: "1111AAA"},
+				},
+				{
+					// eliminarVehiculo desvincula al cliente sin guardarlo
+					nombre: "baja de vehículo",
+					cambio: func() error {
+						c2.Vehiculo = nil
+						return almacen.Vehiculos().Eliminar(v2)
+					},
+					enTaller:      []string{},
+					porIncidencia: map[int]string{3: ""},
+					porVehiculo:   map[string]int{"2222BBB": 0, "1111AAA": 1},
+				},
+			}
+
+			for _, paso := range pasos {
+				if paso.cambio != nil {
+					if err := operacion(paso.cambio); err != nil {
+						t.Fatalf("%s: %v", paso.nombre, err)
+					}
+				}
+				consultar(func() {
+					for estado, esperadas := range paso.porEstado {
+						if ids := idsIncidencias(almacen.Incidencias().PorEstado(estado)); !slices.Equal(ids, esperadas) {
+							t.Errorf("%s: PorEstado(%q) = %v, se esperaba %v", paso.nombre, estado, ids, esperadas)
+						}
+					}
+					for id, esperadas := range paso.porMecanico {
+						if ids := idsIncidencias(almacen.Incidencias().PorMecanico(id)); !slices.Equal(ids, esperadas) {
+							t.Errorf("%s: PorMecanico(%d) = %v, se esperaba %v", paso.nombre, id, ids, esperadas)
+						}
+					}
+					for tipo, esperados := range paso.porEspecialidad {
+						var ids []int
+						for _, m := range almacen.Mecanicos().PorEspecialidad(tipo) {
+							ids = append(ids, m.ID)
+						}
+						if !slices.Equal(ids, esperados) {
+							t.Errorf("%s: PorEspecialidad(%q) = %v, se esperaba %v", paso.nombre, tipo, ids, esperados)
+						}
+					}
+					if paso.enTaller != nil {
+						var matriculas []string
+						for _, v := range almacen.Vehiculos().EnTaller() {
+							matriculas = append(matriculas, v.Matricula)
+						}
+						if !slices.Equal(matriculas, paso.enTaller) {
+							t.Errorf("%s: EnTaller() = %v, se esperaba %v", paso.nombre, matriculas, paso.enTaller)
+						}
+					}
+					for id, esperada := range paso.porIncidencia {
+						matricula := ""
+						if v := almacen.Vehiculos().PorIncidencia(id); v != nil {
+							matricula = v.Matricula
+						}
+						if matricula != esperada {
+							t.Errorf("%s: PorIncidencia(%d) = %q, se esperaba %q", paso.nombre, id, matricula, esperada)
+						}
+					}
+					for matricula, esperado := range paso.porVehiculo {
+						id := 0
+						if c := almacen.Clientes().PorVehiculo(matricula); c != nil {
+							id = c.ID
+						}
+						if id != esperado {
+							t.Errorf("%s: PorVehiculo(%q) = cliente %d, se esperaba %d", paso.nombre, matricula, id, esperado)
+						}
+					}
+				})
+			}
+		})
+	}
+}
+
+// Una transacción fallida deja los índices como estaban.
+func TestRepositoriosTransaccionFallida(t *testing.T) {
+	for nombre, abrir := range almacenesDePrueba(t) {
+		t.Run(nombre, func(t *testing.T) {
+			usarAlmacen(t, abrir(t))
+
+			inc := &Incidencia{ID: 1, Tipo: tipoMecanica, Estado: estadoAbierta}
+			if err := operacion(func() error { return guardar(inc) }); err != nil {
+				t.Fatal(err)
+			}
+			err := operacion(func() error {
+				inc.Estado = estadoCerrada
+				if err := guardar(inc); err != nil {
+					return err
+				}
+				return guardar(&Incidencia{ID: 1})
+			})
+			if err == nil {
+				t.Fatal("se esperaba un error al guardar dos incidencias con el mismo ID")
+			}
+			consultar(func() {
+				if ids := idsIncidencias(almacen.Incidencias().PorEstado(estadoAbierta)); !slices.Equal(ids, []int{1}) {
+					t.Errorf("PorEstado(abierta) = %v tras deshacer, se esperaba [1]", ids)
+				}
+				if ids := idsIncidencias(almacen.Incidencias().PorEstado(estadoCerrada)); ids != nil {
+					t.Errorf("PorEstado(cerrada) = %v tras deshacer, se esperaba []", ids)
+				}
+			})
+		})
+	}
+}
+
+// Si una operación entra en pánico sus cambios se deshacen y las siguientes
+// transacciones funcionan con normalidad.
+func TestRepositoriosTransaccionConPanico(t *testing.T) {
+	for nombre, abrir := range almacenesDePrueba(t) {
+		t.Run(nombre, func(t *testing.T) {
+			usarAlmacen(t, abrir(t))
+			contadorIncidencia.fijar(3)
+
+			inc := &Incidencia{ID: 1, Tipo: tipoMecanica, Prioridad: prioridadBaja, Estado: estadoAbierta}
+			if err := operacion(func() error { return guardar(inc) }); err != nil {
+				t.Fatal(err)
+			}
+			func() {
+				defer func() {
+					if recover() == nil {
+						t.Error("el pánico no llegó a quien llamó a operacion")
+					}
+				}()
+				operacion(func() error {
+					inc.Estado = estadoCerrada
+					if err := guardar(inc, &Incidencia{ID: 2, Tipo: tipoMecanica, Prioridad: prioridadBaja, Estado: estadoAbierta}); err != nil {
+						return err
+					}
+					panic("fallo a mitad de la operación")
+				})
+			}()
+			consultar(func() {
+				if inc.Estado != estadoAbierta || inc.Version != 1 {
+					t.Errorf("tras el pánico la incidencia está %q con versión %d", inc.Estado, inc.Version)
+				}
+				if ids := idsIncidencias(almacen.Incidencias().Todas()); !slices.Equal(ids, []int{1}) {
+					t.Errorf("incidencias %v tras el pánico, se esperaba [1]", ids)
+				}
+			})
+
+			// Si la transacción se hubiera quedado abierta, esta no se desharía.
+			err := operacion(func() error {
+				inc.Estado = estadoEnProceso
+				if err := guardar(inc); err != nil {
+					return err
+				}
+				return errors.New("cancelada")
+			})
+			if err == nil {
+				t.Fatal("se esperaba el error de la operación")
+			}
+			if a, ok := almacen.(*almacenSQL); ok {
+				if err := operacion(a.cargar); err != nil {
+					t.Fatal(err)
+				}
+			}
+			consultar(func() {
+				if inc := buscarIncidencia(1); inc == nil || inc.Estado != estadoAbierta {
+					t.Errorf("la operación cancelada dejó la incidencia en %v", inc)
+				}
+			})
+		})
+	}
+}
+
+func idsIncidencias(lista []*Incidencia) []int {
+	var ids []int
+	for _, inc := range lista {
+		ids = append(ids, inc.ID)
+	}
+	return ids
+}
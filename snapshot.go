@@ -0,0 +1,823 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Instantáneas JSON del taller completo y copias de seguridad
+
+type snapshot struct {
+	Version     int              `json:"version"`
+	Fecha       string           `json:"fecha"`
+	Contadores  contadoresJSON   `json:"contadores"`
+	Taller      tallerJSON       `json:"taller"`
+	Clientes    []clienteJSON    `json:"clientes"`
+	Vehiculos   []vehiculoJSON   `json:"vehiculos"`
+	Incidencias []incidenciaJSON `json:"incidencias"`
+	Mecanicos   []mecanicoJSON   `json:"mecanicos"`
+	Historial   []eventoJSON     `json:"historial"`
+}
+
+type contadoresJSON struct {
+	Cliente    int `json:"cliente"`
+	Incidencia int `json:"incidencia"`
+	Mecanico   int `json:"mecanico"`
+}
+
+type tallerJSON struct {
+	PlazasPorMecanico int   `json:"plazas_por_mecanico"`
+	PlazasOcupadas    []int `json:"plazas_ocupadas"`
+}
+
+type clienteJSON struct {
+	ID        int    `json:"id"`
+	Nombre    string `json:"nombre"`
+	Telefono  string `json:"telefono"`
+	Email     string `json:"email"`
+	SinAvisos bool   `json:"sin_avisos"`
+	Version   int    `json:"version"`
+}
+
+type vehiculoJSON struct {
+	Matricula    string `json:"matricula"`
+	ClienteID    int    `json:"cliente_id,omitempty"`
+	Marca        string `json:"marca"`
+	Modelo       string `json:"modelo"`
+	FechaEntrada string `json:"fecha_entrada"`
+	FechaSalida  string `json:"fecha_salida"`
+	Incidencias  []int  `json:"incidencias"`
+	Orden        int    `json:"orden,omitempty"`
+	EnTaller     bool   `json:"en_taller"`
+	NumeroPlaza  int    `json:"numero_plaza"`
+	EntradaPlaza string `json:"entrada_plaza,omitempty"`
+	EstadoPago   string `json:"estado_pago"`
+	RecogidoPor  string `json:"recogido_por"`
+	Version      int    `json:"version"`
+}
+
+type incidenciaJSON struct {
+	ID          int              `json:"id"`
+	Mecanicos   []int            `json:"mecanicos"`
+	Tipo        TipoIncidencia   `json:"tipo"`
+	Prioridad   Prioridad        `json:"prioridad"`
+	Descripcion string           `json:"descripcion"`
+	Estado      EstadoIncidencia `json:"estado"`
+	Orden       int              `json:"orden,omitempty"`
+	Notas       []notaJSON       `json:"notas"`
+	Adjuntos    []adjuntoJSON    `json:"adjuntos"`
+	Version     int              `json:"version"`
+}
+
+type notaJSON struct {
+	Fecha string `json:"fecha"`
+	Autor string `json:"autor"`
+	Texto string `json:"texto"`
+}
+
+type adjuntoJSON struct {
+	Fichero     string `json:"fichero"`
+	Nombre      string `json:"nombre"`
+	Tipo        string `json:"tipo"`
+	Tamano      int64  `json:"tamano"`
+	Fecha       string `json:"fecha"`
+	Autor       string `json:"autor"`
+	Descripcion string `json:"descripcion,omitempty"`
+}
+
+type mecanicoJSON struct {
+	ID             int                `json:"id"`
+	Nombre         string             `json:"nombre"`
+	Especialidades []especialidadJSON `json:"especialidades"`
+	AniosExp       int                `json:"anios_exp"`
+	Activo         bool               `json:"activo"`
+	Horario        []turnoJSON        `json:"horario"`
+	Ausencias      []ausenciaJSON     `json:"ausencias"`
+	Version        int                `json:"version"`
+}
+
+type especialidadJSON struct {
+	Tipo  TipoIncidencia `json:"tipo"`
+	Nivel string         `json:"nivel"`
+}
+
+type turnoJSON struct {
+	Dia     string `json:"dia"` // "lunes", "martes"...
+	Entrada string `json:"entrada"`
+	Salida  string `json:"salida"`
+}
+
+type ausenciaJSON struct {
+	Desde  string `json:"desde"`
+	Hasta  string `json:"hasta"`
+	Motivo string `json:"motivo"`
+}
+
+type eventoJSON struct {
+	ID           int    `json:"id"`
+	Fecha        string `json:"fecha"`
+	Tipo         string `json:"tipo"`
+	Matricula    string `json:"matricula,omitempty"`
+	IncidenciaID int    `json:"incidencia_id,omitempty"`
+	MecanicoID   int    `json:"mecanico_id,omitempty"`
+	Plaza        int    `json:"plaza,omitempty"`
+	Detalle      string `json:"detalle,omitempty"`
+}
+
+// Configuración de las copias de seguridad automáticas. La retención se
+// fija al arrancar con -copias; la del menú sólo dura hasta cerrar.
+var (
+	directorioBackups = "backups"
+	retencionBackups  = 10
+)
+
+// crearSnapshot vuelca el estado actual. Las relaciones se guardan como
+// claves (IDs y matrículas) en lugar de punteros.
+func crearSnapshot() *snapshot {
+	s := &snapshot{
+		Version:     versionEsquema,
+		Fecha:       time.Now().Format(time.RFC3339),
+		Contadores:  contadoresActuales(),
+		Taller:      tallerAJSON(),
+		Clientes:    []clienteJSON{},
+		Vehiculos:   []vehiculoJSON{},
+		Incidencias: []incidenciaJSON{},
+		Mecanicos:   []mecanicoJSON{},
+		Historial:   []eventoJSON{},
+	}
+
+	for _, c := range almacen.Clientes().Todos() {
+		s.Clientes = append(s.Clientes, clienteAJSON(c))
+	}
+	for _, v := range almacen.Vehiculos().Todos() {
+		s.Vehiculos = append(s.Vehiculos, vehiculoAJSON(v, buscarPropietario(v)))
+	}
+	for _, inc := range almacen.Incidencias().Todas() {
+		s.Incidencias = append(s.Incidencias, incidenciaAJSON(inc))
+	}
+	for _, m := range almacen.Mecanicos().Todos() {
+		s.Mecanicos = append(s.Mecanicos, mecanicoAJSON(m))
+	}
+	for _, ev := range almacen.Historial().Todos() {
+		s.Historial = append(s.Historial, eventoAJSON(ev))
+	}
+
+	return s
+}
+
+func contadoresActuales() contadoresJSON {
+	return contadoresJSON{
+		Cliente:    contadorCliente.siguiente(),
+		Incidencia: contadorIncidencia.siguiente(),
+		Mecanico:   contadorMecanico.siguiente(),
+	}
+}
+
+func tallerAJSON() tallerJSON {
+	t := tallerJSON{
+		PlazasPorMecanico: taller.PlazasPorMecanico,
+		PlazasOcupadas:    []int{},
+	}
+	for plaza, ocupada := range taller.PlazasOcupadas {
+		if ocupada {
+			t.PlazasOcupadas = append(t.PlazasOcupadas, plaza)
+		}
+	}
+	sort.Ints(t.PlazasOcupadas)
+	return t
+}
+
+func clienteAJSON(c *Cliente) clienteJSON {
+	return clienteJSON{
+		ID:        c.ID,
+		Nombre:    c.Nombre,
+		Telefono:  c.Telefono,
+		Email:     c.Email,
+		SinAvisos: c.SinAvisos,
+		Version:   c.Version,
+	}
+}
+
+func vehiculoAJSON(v *Vehiculo, propietario *Cliente) vehiculoJSON {
+	vj := vehiculoJSON{
+		Matricula:    v.Matricula,
+		Marca:        v.Marca,
+		Modelo:       v.Modelo,
+		FechaEntrada: v.FechaEntrada,
+		FechaSalida:  v.FechaSalida,
+		EnTaller:     v.EnTaller,
+		NumeroPlaza:  v.NumeroPlaza,
+		EstadoPago:   v.EstadoPago,
+		RecogidoPor:  v.RecogidoPor,
+		Version:      v.Version,
+	}
+	if !v.EntradaPlaza.IsZero() {
+		vj.EntradaPlaza = v.EntradaPlaza.Format(time.RFC3339)
+	}
+	if propietario != nil {
+		vj.ClienteID = propietario.ID
+	}
+	vj.Incidencias = []int{}
+	for _, inc := range v.Incidencias {
+		vj.Incidencias = append(vj.Incidencias, inc.ID)
+	}
+	vj.Orden = v.Orden
+	return vj
+}
+
+func incidenciaAJSON(inc *Incidencia) incidenciaJSON {
+	ij := incidenciaJSON{
+		ID:          inc.ID,
+		Mecanicos:   []int{},
+		Tipo:        inc.Tipo,
+		Prioridad:   inc.Prioridad,
+		Descripcion: inc.Descripcion,
+		Estado:      inc.Estado,
+		Orden:       inc.Orden,
+		Notas:       []notaJSON{},
+		Adjuntos:    []adjuntoJSON{},
+		Version:     inc.Version,
+	}
+	for _, m := range inc.Mecanicos {
+		ij.Mecanicos = append(ij.Mecanicos, m.ID)
+	}
+	for _, n := range inc.Notas {
+		ij.Notas = append(ij.Notas, notaJSON{n.Fecha.Format(time.RFC3339), n.Autor, n.Texto})
+	}
+	for _, a := range inc.Adjuntos {
+		ij.Adjuntos = append(ij.Adjuntos, adjuntoJSON{a.Fichero, a.Nombre, a.Tipo, a.Tamano,
+			a.Fecha.Format(time.RFC3339), a.Autor, a.Descripcion})
+	}
+	return ij
+}
+
+func mecanicoAJSON(m *Mecanico) mecanicoJSON {
+	mj := mecanicoJSON{
+		ID:             m.ID,
+		Nombre:         m.Nombre,
+		Especialidades: []especialidadJSON{},
+		AniosExp:       m.AniosExp,
+		Activo:         m.Activo,
+		Horario:        []turnoJSON{},
+		Ausencias:      []ausenciaJSON{},
+		Version:        m.Version,
+	}
+	for _, e := range m.Especialidades {
+		mj.Especialidades = append(mj.Especialidades, especialidadJSON{e.Tipo, e.Nivel})
+	}
+	for _, t := range m.Horario {
+		mj.Horario = append(mj.Horario, turnoJSON{nombresDias[t.Dia], t.Entrada, t.Salida})
+	}
+	for _, a := range m.Ausencias {
+		mj.Ausencias = append(mj.Ausencias, ausenciaJSON{a.Desde, a.Hasta, a.Motivo})
+	}
+	return mj
+}
+
+func escribirSnapshot(s *snapshot, ruta string) error {
+	datos, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(ruta); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(ruta, datos, 0644)
+}
+
+// leerSnapshot carga una instantánea aplicando en memoria las migraciones
+// necesarias si se guardó con una versión anterior del esquema.
+func leerSnapshot(ruta string) (*snapshot, error) {
+	datos, err := os.ReadFile(ruta)
+	if err != nil {
+		return nil, err
+	}
+
+	datos, _, err = migrarDatos(datos)
+	if err != nil {
+		return nil, err
+	}
+
+	var s snapshot
+	if err := json.Unmarshal(datos, &s); err != nil {
+		return nil, fmt.Errorf("el fichero no es una instantánea válida: %v", err)
+	}
+	return &s, nil
+}
+
+// estadoTaller agrupa un estado completo del taller, ya sea el actual o el
+// reconstruido desde una instantánea antes de sustituir al actual.
+type estadoTaller struct {
+	clientes    []*Cliente
+	vehiculos   []*Vehiculo
+	incidencias []*Incidencia
+	mecanicos   []*Mecanico
+	historial   []*Evento
+	taller      Taller
+	contadores  contadoresJSON
+}
+
+// construir valida la instantánea y reconstruye los punteros entre
+// entidades. Devuelve todos los problemas encontrados a la vez.
+func (s *snapshot) construir() (*estadoTaller, error) {
+	var errs []error
+	fallo := func(formato string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(formato, args...))
+	}
+
+	e := &estadoTaller{
+		clientes:    []*Cliente{},
+		vehiculos:   []*Vehiculo{},
+		incidencias: []*Incidencia{},
+		mecanicos:   []*Mecanico{},
+		historial:   []*Evento{},
+		taller: Taller{
+			Mecanicos:         []*Mecanico{},
+			PlazasPorMecanico: s.Taller.PlazasPorMecanico,
+			PlazasOcupadas:    make(map[int]bool),
+		},
+		contadores: s.Contadores,
+	}
+	if s.Taller.PlazasPorMecanico <= 0 {
+		fallo("taller: plazas por mecánico debe ser mayor que 0")
+	}
+
+	mecanicosPorID := map[int]*Mecanico{}
+	for _, mj := range s.Mecanicos {
+		if _, repetido := mecanicosPorID[mj.ID]; repetido || mj.ID <= 0 {
+			fallo("mecánico %d: ID repetido o no válido", mj.ID)
+			continue
+		}
+		var especialidades []Especialidad
+		for _, ej := range mj.Especialidades {
+			especialidades = append(especialidades, Especialidad{ej.Tipo, ej.Nivel})
+		}
+		if err := validarMecanico(mj.Nombre, especialidades); err != nil {
+			fallo("mecánico %d: %v", mj.ID, err)
+		}
+		if err := comprobarAnios(mj.AniosExp); err != nil {
+			fallo("mecánico %d: %v", mj.ID, err)
+		}
+		var turnos []Turno
+		for _, tj := range mj.Horario {
+			d, ok := diaSemana(tj.Dia)
+			if !ok {
+				fallo("mecánico %d: día %q no válido", mj.ID, tj.Dia)
+			}
+			turnos = append(turnos, Turno{d, tj.Entrada, tj.Salida})
+		}
+		horario, err := normalizarHorario(turnos)
+		if err != nil {
+			fallo("mecánico %d: %v", mj.ID, err)
+		}
+		var ausencias []Ausencia
+		for _, aj := range mj.Ausencias {
+			a, err := validarAusencia(Ausencia{aj.Desde, aj.Hasta, aj.Motivo})
+			if err != nil {
+				fallo("mecánico %d: ausencia: %v", mj.ID, err)
+			}
+			ausencias = append(ausencias, a)
+		}
+		m := &Mecanico{
+			ID:             mj.ID,
+			Nombre:         mj.Nombre,
+			Especialidades: especialidades,
+			AniosExp:       mj.AniosExp,
+			Activo:         mj.Activo,
+			Horario:        horario,
+			Ausencias:      ausencias,
+			Incidencias:    []*Incidencia{},
+			Version:        mj.Version,
+		}
+		mecanicosPorID[m.ID] = m
+		e.mecanicos = append(e.mecanicos, m)
+		e.taller.Mecanicos = append(e.taller.Mecanicos, m)
+		if m.ID >= s.Contadores.Mecanico {
+			fallo("mecánico %d: el contador de mecánicos (%d) no es mayor que el ID", m.ID, s.Contadores.Mecanico)
+		}
+	}
+
+	incidenciasPorID := map[int]*Incidencia{}
+	for _, ij := range s.Incidencias {
+		if _, repetida := incidenciasPorID[ij.ID]; repetida || ij.ID <= 0 {
+			fallo("incidencia %d: ID repetido o no válido", ij.ID)
+			continue
+		}
+		inc := &Incidencia{
+			ID:          ij.ID,
+			Mecanicos:   []*Mecanico{},
+			Tipo:        ij.Tipo,
+			Prioridad:   ij.Prioridad,
+			Descripcion: ij.Descripcion,
+			Estado:      ij.Estado,
+			Orden:       ij.Orden,
+			Version:     ij.Version,
+		}
+		if posicion(tiposIncidencia, inc.Tipo) < 0 {
+			fallo("incidencia %d: tipo %q no válido", inc.ID, inc.Tipo)
+		}
+		if posicion(prioridadesIncidencia, inc.Prioridad) < 0 {
+			fallo("incidencia %d: prioridad %q no válida", inc.ID, inc.Prioridad)
+		}
+		if posicion(estadosIncidencia, inc.Estado) < 0 {
+			fallo("incidencia %d: estado %q no válido", inc.ID, inc.Estado)
+		}
+		for _, nj := range ij.Notas {
+			fecha, err := time.Parse(time.RFC3339, nj.Fecha)
+			if err != nil {
+				fallo("incidencia %d: fecha de nota %q no válida", inc.ID, nj.Fecha)
+			}
+			inc.Notas = append(inc.Notas, Nota{fecha, nj.Autor, nj.Texto})
+		}
+		for _, aj := range ij.Adjuntos {
+			fecha, err := time.Parse(time.RFC3339, aj.Fecha)
+			if err != nil {
+				fallo("incidencia %d: fecha de adjunto %q no válida", inc.ID, aj.Fecha)
+			}
+			a := Adjunto{aj.Fichero, aj.Nombre, aj.Tipo, aj.Tamano, fecha, aj.Autor, aj.Descripcion}
+			if err := adjuntoValido(a); err != nil {
+				fallo("incidencia %d: adjunto: %v", inc.ID, err)
+			}
+			inc.Adjuntos = append(inc.Adjuntos, a)
+		}
+		for _, idMecanico := range ij.Mecanicos {
+			m, ok := mecanicosPorID[idMecanico]
+			if !ok {
+				fallo("incidencia %d: mecánico %d no existe", inc.ID, idMecanico)
+				continue
+			}
+			inc.Mecanicos = append(inc.Mecanicos, m)
+			m.Incidencias = append(m.Incidencias, inc)
+		}
+		incidenciasPorID[inc.ID] = inc
+		e.incidencias = append(e.incidencias, inc)
+		if inc.ID >= s.Contadores.Incidencia {
+			fallo("incidencia %d: el contador de incidencias (%d) no es mayor que el ID", inc.ID, s.Contadores.Incidencia)
+		}
+	}
+
+	clientesPorID := map[int]*Cliente{}
+	for _, cj := range s.Clientes {
+		if _, repetido := clientesPorID[cj.ID]; repetido || cj.ID <= 0 {
+			fallo("cliente %d: ID repetido o no válido", cj.ID)
+			continue
+		}
+		if err := validarCliente(cj.Nombre); err != nil {
+			fallo("cliente %d: %v", cj.ID, err)
+		}
+		if err := comprobarEmail(cj.Email); err != nil {
+			fallo("cliente %d: %v", cj.ID, err)
+		}
+		c := &Cliente{ID: cj.ID, Nombre: cj.Nombre, Telefono: cj.Telefono, Email: cj.Email,
+			SinAvisos: cj.SinAvisos, Version: cj.Version}
+		clientesPorID[c.ID] = c
+		e.clientes = append(e.clientes, c)
+		if c.ID >= s.Contadores.Cliente {
+			fallo("cliente %d: el contador de clientes (%d) no es mayor que el ID", c.ID, s.Contadores.Cliente)
+		}
+	}
+
+	vehiculosPorMatricula := map[string]*Vehiculo{}
+	incidenciaUsada := map[int]string{}
+	plazaUsada := map[int]string{}
+	for _, vj := range s.Vehiculos {
+		if _, repetido := vehiculosPorMatricula[vj.Matricula]; repetido || vj.Matricula == "" {
+			fallo("vehículo %q: matrícula repetida o vacía", vj.Matricula)
+			continue
+		}
+		v := &Vehiculo{
+			Matricula:    vj.Matricula,
+			Marca:        vj.Marca,
+			Modelo:       vj.Modelo,
+			FechaEntrada: vj.FechaEntrada,
+			FechaSalida:  vj.FechaSalida,
+			EnTaller:     vj.EnTaller,
+			NumeroPlaza:  vj.NumeroPlaza,
+			EstadoPago:   vj.EstadoPago,
+			RecogidoPor:  vj.RecogidoPor,
+			Version:      vj.Version,
+		}
+		if _, ok := normalizarValor(vj.EstadoPago, estadosPago); vj.EstadoPago != "" && !ok {
+			fallo("vehículo %s: estado de pago %q no válido", v.Matricula, vj.EstadoPago)
+		}
+		if vj.EntradaPlaza != "" {
+			entrada, err := time.Parse(time.RFC3339, vj.EntradaPlaza)
+			if err != nil {
+				fallo("vehículo %s: entrada en plaza %q no válida", v.Matricula, vj.EntradaPlaza)
+			}
+			v.EntradaPlaza = entrada
+		}
+		if vj.ClienteID != 0 {
+			c, ok := clientesPorID[vj.ClienteID]
+			switch {
+			case !ok:
+				fallo("vehículo %s: cliente %d no existe", v.Matricula, vj.ClienteID)
+			case c.Vehiculo != nil:
+				fallo("vehículo %s: el cliente %d ya tiene el vehículo %s", v.Matricula, c.ID, c.Vehiculo.Matricula)
+			default:
+				c.Vehiculo = v
+			}
+		}
+		for _, id := range vj.Incidencias {
+			inc, ok := incidenciasPorID[id]
+			switch {
+			case !ok:
+				fallo("vehículo %s: incidencia %d no existe", v.Matricula, id)
+			case incidenciaUsada[inc.ID] != "":
+				fallo("vehículo %s: la incidencia %d ya pertenece a %s", v.Matricula, inc.ID, incidenciaUsada[inc.ID])
+			default:
+				v.Incidencias = append(v.Incidencias, inc)
+				incidenciaUsada[inc.ID] = v.Matricula
+			}
+		}
+		v.Orden = vj.Orden
+		if v.Orden != 0 && len(lineasOrden(v, v.Orden)) == 0 {
+			fallo("vehículo %s: la orden de trabajo %d no tiene incidencias", v.Matricula, v.Orden)
+		}
+		if v.EnTaller {
+			if v.NumeroPlaza <= 0 {
+				fallo("vehículo %s: está en el taller sin plaza asignada", v.Matricula)
+			} else if otro := plazaUsada[v.NumeroPlaza]; otro != "" {
+				fallo("vehículo %s: la plaza %d ya la ocupa %s", v.Matricula, v.NumeroPlaza, otro)
+			} else {
+				plazaUsada[v.NumeroPlaza] = v.Matricula
+			}
+		}
+		vehiculosPorMatricula[v.Matricula] = v
+		e.vehiculos = append(e.vehiculos, v)
+	}
+
+	ultimoEvento := 0
+	for _, ej := range s.Historial {
+		ev, err := eventoDesdeJSON(ej)
+		switch {
+		case err != nil:
+			fallo("evento %d: %v", ej.ID, err)
+		case ej.ID <= ultimoEvento:
+			fallo("evento %d: ID repetido o desordenado", ej.ID)
+		default:
+			ultimoEvento = ej.ID
+			e.historial = append(e.historial, ev)
+		}
+	}
+
+	for _, plaza := range s.Taller.PlazasOcupadas {
+		if plaza <= 0 {
+			fallo("taller: plaza %d no válida", plaza)
+			continue
+		}
+		e.taller.PlazasOcupadas[plaza] = true
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return e, nil
+}
+
+func estadoActual() *estadoTaller {
+	return &estadoTaller{
+		clientes:    almacen.Clientes().Todos(),
+		vehiculos:   almacen.Vehiculos().Todos(),
+		incidencias: almacen.Incidencias().Todas(),
+		mecanicos:   almacen.Mecanicos().Todos(),
+		historial:   almacen.Historial().Todos(),
+		taller:      taller,
+		contadores:  contadoresActuales(),
+	}
+}
+
+// aplicarEstado fija la configuración del taller y los contadores. Las
+// entidades las guarda el almacén con Reemplazar.
+func aplicarEstado(e *estadoTaller) {
+	taller = e.taller
+	contadorCliente.fijar(e.contadores.Cliente)
+	contadorIncidencia.fijar(e.contadores.Incidencia)
+	contadorMecanico.fijar(e.contadores.Mecanico)
+	taller.TotalPlazas = calcularTotalPlazas()
+}
+
+// restaurarSnapshot sustituye todo el estado por el de la instantánea. Si la
+// instantánea no es válida el estado actual no se modifica.
+func restaurarSnapshot(s *snapshot) error {
+	e, err := s.construir()
+	if err != nil {
+		return err
+	}
+
+	return operacion(func() error {
+		aplicarEstado(e)
+		return almacen.Reemplazar(e)
+	})
+}
+
+// instantaneaActual toma una instantánea coherente aunque haya operaciones
+// en curso en otros puestos.
+func instantaneaActual() *snapshot {
+	var s *snapshot
+	consultar(func() { s = crearSnapshot() })
+	return s
+}
+
+func hayDatos() bool {
+	return len(almacen.Clientes().Todos()) > 0 || len(almacen.Vehiculos().Todos()) > 0 ||
+		len(almacen.Incidencias().Todas()) > 0 || len(almacen.Mecanicos().Todos()) > 0
+}
+
+// crearBackup guarda una instantánea con marca de tiempo en el directorio de
+// copias y elimina las más antiguas según la retención configurada.
+func crearBackup() (string, error) {
+	nombre := "taller-" + time.Now().Format("20060102-150405.000") + ".json"
+	ruta := filepath.Join(directorioBackups, nombre)
+	if err := escribirSnapshot(instantaneaActual(), ruta); err != nil {
+		return "", err
+	}
+	return ruta, rotarBackups()
+}
+
+// crearBackupAutomatico se llama antes de las operaciones que sustituyen el
+// estado. No hace nada si todavía no hay datos que proteger.
+func crearBackupAutomatico() {
+	if !hayDatos() {
+		return
+	}
+	ruta, err := crearBackup()
+	if err != nil {
+		fmt.Println("Aviso: no se pudo crear la copia de seguridad:", err)
+		return
+	}
+	fmt.Println("Copia de seguridad guardada en", ruta)
+}
+
+func listarBackups() ([]string, error) {
+	rutas, err := filepath.Glob(filepath.Join(directorioBackups, "taller-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(rutas)
+	return rutas, nil
+}
+
+func rotarBackups() error {
+	if retencionBackups <= 0 {
+		return nil
+	}
+	rutas, err := listarBackups()
+	if err != nil {
+		return err
+	}
+	for len(rutas) > retencionBackups {
+		if err := os.Remove(rutas[0]); err != nil {
+			return err
+		}
+		rutas = rutas[1:]
+	}
+	return nil
+}
+
+// Funciones de menú
+
+func exportarSnapshot() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== EXPORTAR INSTANTÁNEA JSON ===")
+
+	fmt.Print("Fichero de destino (vacío para \"taller.json\"): ")
+	ruta, _ := reader.ReadString('\n')
+	ruta = strings.TrimSpace(ruta)
+	if ruta == "" {
+		ruta = "taller.json"
+	}
+
+	if err := escribirSnapshot(instantaneaActual(), ruta); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nInstantánea guardada en", ruta)
+	pausar()
+}
+
+func importarSnapshot() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== IMPORTAR INSTANTÁNEA JSON ===")
+	fmt.Println("Atención: se sustituirán todos los datos actuales")
+
+	fmt.Print("\nFichero a importar: ")
+	ruta, _ := reader.ReadString('\n')
+	ruta = strings.TrimSpace(ruta)
+
+	s, err := leerSnapshot(ruta)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	if _, err := s.construir(); err != nil {
+		fmt.Println("Error: la instantánea no es válida:")
+		for _, linea := range strings.Split(err.Error(), "\n") {
+			fmt.Println(" -", linea)
+		}
+		pausar()
+		return
+	}
+
+	fmt.Printf("\nInstantánea del %s: %d clientes, %d vehículos, %d incidencias, %d mecánicos\n",
+		s.Fecha, len(s.Clientes), len(s.Vehiculos), len(s.Incidencias), len(s.Mecanicos))
+	fmt.Print("¿Confirmar importación? (S/N): ")
+	var respuesta string
+	fmt.Scanln(&respuesta)
+	if strings.ToUpper(respuesta) != "S" {
+		fmt.Println("Importación cancelada")
+		pausar()
+		return
+	}
+
+	crearBackupAutomatico()
+	if err := restaurarSnapshot(s); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nInstantánea importada exitosamente")
+	pausar()
+}
+
+func crearBackupManual() {
+	limpiarPantalla()
+	fmt.Println("=== CREAR COPIA DE SEGURIDAD ===")
+
+	ruta, err := crearBackup()
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nCopia de seguridad guardada en", ruta)
+	pausar()
+}
+
+func visualizarBackups() {
+	limpiarPantalla()
+	fmt.Println("=== COPIAS DE SEGURIDAD ===")
+
+	rutas, err := listarBackups()
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Printf("Directorio: %s (se conservan las %d más recientes)\n\n", directorioBackups, retencionBackups)
+	if len(rutas) == 0 {
+		fmt.Println("No hay copias de seguridad")
+	}
+	for _, ruta := range rutas {
+		fmt.Println(filepath.Base(ruta))
+	}
+
+	pausar()
+}
+
+func configurarRetencionBackups() {
+	limpiarPantalla()
+	fmt.Println("=== CONFIGURAR RETENCIÓN DE COPIAS ===")
+
+	fmt.Printf("Retención actual: %d copias\n", retencionBackups)
+	fmt.Print("Número de copias a conservar (0 para no borrar nunca): ")
+	var texto string
+	fmt.Scanln(&texto)
+
+	n, err := strconv.Atoi(texto)
+	if err != nil || n < 0 {
+		fmt.Println("Error: Valor no válido")
+		pausar()
+		return
+	}
+
+	retencionBackups = n
+	if err := rotarBackups(); err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+
+	fmt.Println("\nRetención actualizada hasta cerrar el programa (use -copias para fijarla al arrancar)")
+	pausar()
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tallerDePrueba da de alta un cliente con su vehículo en plaza, dos
+// incidencias, una de ellas con mecánico y nota, y un mecánico ausente.
+func tallerDePrueba(t *testing.T) {
+	t.Helper()
+	contadorCliente.fijar(1)
+	contadorIncidencia.fijar(1)
+	contadorMecanico.fijar(1)
+	c, err := registrarCliente(0, "Marta", "600000000", "marta@ejemplo.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := registrarVehiculo(c, "1234BCD", "Seat", "Ibiza", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := registrarMecanico(0, "Ana", []Especialidad{{Tipo: tipoMecanica, Nivel: "experto"}}, 5, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ausente, err := registrarMecanico(0, "Luis", []Especialidad{{Tipo: tipoElectrica, Nivel: "básico"}}, 1, nil, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := anadirAusencia(ausente, Ausencia{Desde: "01/03/2030", Hasta: "05/03/2030", Motivo: "vacaciones"}); err != nil {
+		t.Fatal(err)
+	}
+	inc, err := registrarIncidencia(0, v, string(tipoMecanica), string(prioridadAlta), "frenos", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := registrarIncidencia(0, v, string(tipoElectrica), string(prioridadBaja), "luces", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := asignarMecanico(inc, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := anadirNota(inc, "Ana", "pastillas pedidas"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ingresarVehiculo(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// textoInstantanea es la instantánea en JSON sin la fecha en que se tomó,
+// para comparar dos estados.
+func textoInstantanea(t *testing.T, s *snapshot) string {
+	t.Helper()
+	copia := *s
+	copia.Fecha = ""
+	datos, err := json.Marshal(copia)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(datos)
+}
+
+// Una instantánea exportada se importa en un taller vacío con el mismo
+// estado; las que no son coherentes se rechazan sin tocar el actual.
+func TestInstantaneaIdaYVuelta(t *testing.T) {
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	tallerDePrueba(t)
+	original := instantaneaActual()
+	ruta := filepath.Join(t.TempDir(), "taller.json")
+	if err := escribirSnapshot(original, ruta); err != nil {
+		t.Fatal(err)
+	}
+
+	usarAlmacen(t, nuevoAlmacenMemoria())
+	s, err := leerSnapshot(ruta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := restaurarSnapshot(s); err != nil {
+		t.Fatal(err)
+	}
+	importado := instantaneaActual()
+	if a, b := textoInstantanea(t, original), textoInstantanea(t, importado); a != b {
+		t.Fatalf("la instantánea cambia al importarla:\n%s\n%s", a, b)
+	}
+	consultar(func() {
+		v := buscarVehiculo("1234BCD")
+		m := buscarMecanico(1)
+		if v == nil || m == nil || len(v.Incidencias) != 2 || len(v.Incidencias[0].Mecanicos) != 1 ||
+			v.Incidencias[0].Mecanicos[0] != m || len(m.Incidencias) != 1 || m.Incidencias[0] != v.Incidencias[0] {
+			t.Error("las relaciones entre vehículo, incidencias y mecánicos no se reconstruyen")
+		}
+		if !v.EnTaller || !taller.PlazasOcupadas[v.NumeroPlaza] {
+			t.Errorf("el vehículo no ocupa su plaza %d", v.NumeroPlaza)
+		}
+	})
+
+	casos := []struct {
+		nombre  string
+		cambiar func(s *snapshot)
+		error   string
+	}{
+		{"mecánico inexistente", func(s *snapshot) { s.Incidencias[0].Mecanicos = []int{99} }, "mecánico 99 no existe"},
+		{"incidencia repetida", func(s *snapshot) { s.Incidencias = append(s.Incidencias, s.Incidencias[0]) }, "ID repetido"},
+		{"contador atrasado", func(s *snapshot) { s.Contadores.Incidencia = 1 }, "contador de incidencias"},
+		{"cliente inexistente", func(s *snapshot) { s.Vehiculos[0].ClienteID = 99 }, "cliente 99 no existe"},
+		{"estado desconocido", func(s *snapshot) { s.Incidencias[1].Estado = "perdida" }, "estado \"perdida\" no válido"},
+		{"plaza no válida", func(s *snapshot) { s.Taller.PlazasOcupadas = append(s.Taller.PlazasOcupadas, 0) }, "plaza 0 no válida"},
+	}
+	for _, caso := range casos {
+		var s snapshot
+		datos, _ := json.Marshal(original)
+		json.Unmarshal(datos, &s)
+		caso.cambiar(&s)
+		ruta := filepath.Join(t.TempDir(), "invalida.json")
+		if err := escribirSnapshot(&s, ruta); err != nil {
+			t.Fatal(err)
+		}
+		leida, err := leerSnapshot(ruta)
+		if err == nil {
+			err = restaurarSnapshot(leida)
+		}
+		if err == nil || !strings.Contains(err.Error(), caso.error) {
+			t.Errorf("%s: error %v, se esperaba uno que dijera %q", caso.nombre, err, caso.error)
+		}
+		if textoInstantanea(t, instantaneaActual()) != textoInstantanea(t, importado) {
+			t.Fatalf("%s: la importación rechazada modificó el estado", caso.nombre)
+		}
+	}
+
+	noJSON := filepath.Join(t.TempDir(), "roto.json")
+	if err := os.WriteFile(noJSON, []byte("{no es json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := leerSnapshot(noJSON); err == nil {
+		t.Error("se leyó como instantánea un fichero que no es JSON")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build sqlite
+
+package main
+
+// Registra el driver SQLite (Go puro, sin cgo) usado por el almacén SQL.
+// Se incluye compilando con: go build -tags sqlite
+
+import _ "modernc.org/sqlite"
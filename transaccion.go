@@ -0,0 +1,87 @@
+package main
+
+// Deshacer cambios en memoria
+//
+// Las operaciones modifican directamente las entidades, que están enlazadas
+// entre sí por punteros. Para que una transacción fallida no deje cambios a
+// medias, antes de empezar se copia el valor de cada entidad y, si algo
+// falla, se vuelve a escribir sobre los mismos punteros. Así quien tenga una
+// referencia a una entidad sigue viendo el estado correcto.
+
+type copiaEstado struct {
+	clientes    map[*Cliente]Cliente
+	vehiculos   map[*Vehiculo]Vehiculo
+	incidencias map[*Incidencia]Incidencia
+	mecanicos   map[*Mecanico]Mecanico
+	// entidades existentes (en orden), historial, taller y contadores
+	estado estadoTaller
+}
+
+// copiarEstado guarda el estado completo del almacén y del taller. Su coste
+// es proporcional al número de entidades, que en un taller es pequeño.
+func copiarEstado(a *almacenMemoria) *copiaEstado {
+	copia := &copiaEstado{
+		clientes:    map[*Cliente]Cliente{},
+		vehiculos:   map[*Vehiculo]Vehiculo{},
+		incidencias: map[*Incidencia]Incidencia{},
+		mecanicos:   map[*Mecanico]Mecanico{},
+		estado: estadoTaller{
+			clientes:    a.clientes.Todos(),
+			vehiculos:   a.vehiculos.Todos(),
+			incidencias: a.incidencias.Todas(),
+			mecanicos:   a.mecanicos.Todos(),
+			historial:   a.historial.Todos(),
+			taller:      copiarTaller(taller),
+			contadores:  contadoresActuales(),
+		},
+	}
+
+	for _, c := range copia.estado.clientes {
+		copia.clientes[c] = *c
+	}
+	for _, v := range copia.estado.vehiculos {
+		copia.vehiculos[v] = *v
+	}
+	for _, inc := range copia.estado.incidencias {
+		valor := *inc
+		valor.Mecanicos = append([]*Mecanico{}, inc.Mecanicos...)
+		copia.incidencias[inc] = valor
+	}
+	for _, m := range copia.estado.mecanicos {
+		valor := *m
+		valor.Incidencias = append([]*Incidencia{}, m.Incidencias...)
+		copia.mecanicos[m] = valor
+	}
+	return copia
+}
+
+// restaurar devuelve el almacén y el taller al estado copiado.
+func (copia *copiaEstado) restaurar(a *almacenMemoria) {
+	for c, valor := range copia.clientes {
+		*c = valor
+	}
+	for v, valor := range copia.vehiculos {
+		*v = valor
+	}
+	for inc, valor := range copia.incidencias {
+		*inc = valor
+	}
+	for m, valor := range copia.mecanicos {
+		*m = valor
+	}
+
+	e := copia.estado
+	e.taller = copiarTaller(copia.estado.taller)
+	aplicarEstado(&e)
+	a.Reemplazar(&e)
+}
+
+func copiarTaller(t Taller) Taller {
+	copia := t
+	copia.Mecanicos = append([]*Mecanico{}, t.Mecanicos...)
+	copia.PlazasOcupadas = make(map[int]bool, len(t.PlazasOcupadas))
+	for plaza, ocupada := range t.PlazasOcupadas {
+		copia.PlazasOcupadas[plaza] = ocupada
+	}
+	return copia
+}
@@ -0,0 +1,740 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Interfaz a pantalla completa
+//
+// Alternativa a los menús clásicos: pestañas con tablas navegables con las
+// flechas, filtro en línea, panel de detalle y formularios con validación por
+// campo. Como limpiarPantalla, usa herramientas del sistema (stty) en lugar
+// de bibliotecas externas, y dibuja con secuencias ANSI. Las vistas están en
+// tui_vistas.go.
+
+// Secuencias ANSI
+const (
+	ansiNormal     = "\x1b[0m"
+	ansiNegrita    = "\x1b[1m"
+	ansiInverso    = "\x1b[7m"
+	ansiRojo       = "\x1b[31m"
+	ansiVerde      = "\x1b[32m"
+	ansiAmarillo   = "\x1b[33m"
+	ansiTenue      = "\x1b[2m"
+	ansiInicio     = "\x1b[H"
+	ansiBorrarFin  = "\x1b[K"
+	ansiOcultarCur = "\x1b[?25l"
+	ansiMostrarCur = "\x1b[?25h"
+	ansiPantallaAl = "\x1b[?1049h" // pantalla alternativa
+	ansiPantallaNo = "\x1b[?1049l"
+)
+
+// Teclas
+const (
+	teclaCaracter = iota
+	teclaArriba
+	teclaAbajo
+	teclaIzquierda
+	teclaDerecha
+	teclaRePag
+	teclaAvPag
+	teclaInicio
+	teclaFin
+	teclaEnter
+	teclaEsc
+	teclaTab
+	teclaTabAtras
+	teclaRetroceso
+	teclaCtrlC
+)
+
+type tecla struct {
+	codigo   int
+	caracter rune
+}
+
+// terminalTUI pone el terminal en modo crudo y lo restaura al salir.
+type terminalTUI struct {
+	estadoStty string
+}
+
+func stty(argumentos ...string) (string, error) {
+	cmd := exec.Command("stty", argumentos...)
+	cmd.Stdin = os.Stdin
+	salida, err := cmd.Output()
+	return strings.TrimSpace(string(salida)), err
+}
+
+func abrirTerminal() (*terminalTUI, error) {
+	estado, err := stty("-g")
+	if err != nil {
+		return nil, errors.New("la interfaz a pantalla completa necesita un terminal compatible (stty)")
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, err
+	}
+	fmt.Print(ansiPantallaAl + ansiOcultarCur)
+	return &terminalTUI{estadoStty: estado}, nil
+}
+
+func (t *terminalTUI) cerrar() {
+	fmt.Print(ansiNormal + ansiMostrarCur + ansiPantallaNo)
+	stty(t.estadoStty)
+}
+
+// tamano devuelve filas y columnas del terminal (24x80 si no se sabe).
+func (t *terminalTUI) tamano() (int, int) {
+	salida, err := stty("size")
+	if err == nil {
+		partes := strings.Fields(salida)
+		if len(partes) == 2 {
+			filas, err1 := strconv.Atoi(partes[0])
+			columnas, err2 := strconv.Atoi(partes[1])
+			if err1 == nil && err2 == nil && filas > 0 && columnas > 0 {
+				return filas, columnas
+			}
+		}
+	}
+	return 24, 80
+}
+
+// leerTeclas espera a que se pulse algo y devuelve las teclas leídas. Una
+// secuencia de escape llega entera en la misma lectura.
+func (t *terminalTUI) leerTeclas() ([]tecla, error) {
+	buf := make([]byte, 64)
+	n, err := os.Stdin.Read(buf)
+	if err != nil {
+		return nil, err
+	}
+	return interpretarTeclas(buf[:n]), nil
+}
+
+var secuenciasEscape = map[string]int{
+	"[A": teclaArriba, "[B": teclaAbajo, "[C": teclaDerecha, "[D": teclaIzquierda,
+	"OA": teclaArriba, "OB": teclaAbajo, "OC": teclaDerecha, "OD": teclaIzquierda,
+	"[5~": teclaRePag, "[6~": teclaAvPag, "[H": teclaInicio, "[F": teclaFin,
+	"[1~": teclaInicio, "[4~": teclaFin, "[Z": teclaTabAtras,
+}
+
+func interpretarTeclas(datos []byte) []tecla {
+	var teclas []tecla
+	for len(datos) > 0 {
+		if datos[0] == 27 {
+			if len(datos) == 1 {
+				return append(teclas, tecla{codigo: teclaEsc})
+			}
+			resto := string(datos[1:])
+			reconocida := false
+			for secuencia, codigo := range secuenciasEscape {
+				if strings.HasPrefix(resto, secuencia) {
+					teclas = append(teclas, tecla{codigo: codigo})
+					datos = datos[1+len(secuencia):]
+					reconocida = true
+					break
+				}
+			}
+			if !reconocida {
+				// Secuencia desconocida: se descarta entera.
+				return append(teclas, tecla{codigo: teclaEsc})
+			}
+			continue
+		}
+
+		switch datos[0] {
+		case '\r', '\n':
+			teclas = append(teclas, tecla{codigo: teclaEnter})
+		case '\t':
+			teclas = append(teclas, tecla{codigo: teclaTab})
+		case 127, 8:
+			teclas = append(teclas, tecla{codigo: teclaRetroceso})
+		case 3:
+			teclas = append(teclas, tecla{codigo: teclaCtrlC})
+		default:
+			r, tam := utf8.DecodeRune(datos)
+			if r >= ' ' && r != utf8.RuneError {
+				teclas = append(teclas, tecla{codigo: teclaCaracter, caracter: r})
+			}
+			datos = datos[tam:]
+			continue
+		}
+		datos = datos[1:]
+	}
+	return teclas
+}
+
+// ajustar recorta o rellena el texto hasta ocupar exactamente ancho columnas.
+func ajustar(texto string, ancho int) string {
+	if ancho <= 0 {
+		return ""
+	}
+	texto = strings.NewReplacer("\n", " ", "\r", " ", "\t", " ").Replace(texto)
+	n := utf8.RuneCountInString(texto)
+	if n <= ancho {
+		return texto + strings.Repeat(" ", ancho-n)
+	}
+	runas := []rune(texto)
+	return string(runas[:ancho-1]) + "…"
+}
+
+// Estado de la interfaz
+
+type pantallaTUI struct {
+	terminal *terminalTUI
+	vistas   []*vistaTUI
+	actual   int
+
+	seleccion      map[int]int // fila seleccionada en cada pestaña
+	desplazamiento map[int]int
+	filtro         map[int]string
+	editandoFiltro bool
+
+	formulario *formularioTUI
+	mensaje    string
+	esError    bool
+	salir      bool
+}
+
+// ejecutarTUI abre la interfaz a pantalla completa hasta que el usuario sale.
+func ejecutarTUI() error {
+	terminal, err := abrirTerminal()
+	if err != nil {
+		return err
+	}
+	defer terminal.cerrar()
+
+	p := &pantallaTUI{
+		terminal:       terminal,
+		vistas:         vistasTUI(),
+		seleccion:      map[int]int{},
+		desplazamiento: map[int]int{},
+		filtro:         map[int]string{},
+	}
+	for !p.salir {
+		p.dibujar()
+		teclas, err := terminal.leerTeclas()
+		if err != nil {
+			return err
+		}
+		for _, t := range teclas {
+			p.pulsar(t)
+		}
+	}
+	return nil
+}
+
+func (p *pantallaTUI) informar(mensaje string, err error) {
+	if err != nil {
+		p.mensaje, p.esError = "Error: "+err.Error(), true
+		var conflicto *errorConflicto
+		if errors.As(err, &conflicto) {
+			var campos []string
+			for _, c := range conflicto.Cambios {
+				campos = append(campos, fmt.Sprintf("%s: %q -> %q", c.Campo, c.Antes, c.Ahora))
+			}
+			if len(campos) > 0 {
+				p.mensaje += " (" + strings.Join(campos, ", ") + ")"
+			}
+		}
+		return
+	}
+	p.mensaje, p.esError = mensaje, false
+}
+
+// filasVisibles aplica el filtro de la pestaña actual.
+func (p *pantallaTUI) filasVisibles(filas []filaTUI) []filaTUI {
+	filtro := quitarTildes(strings.ToLower(p.filtro[p.actual]))
+	if filtro == "" {
+		return filas
+	}
+	var visibles []filaTUI
+	for _, f := range filas {
+		texto := quitarTildes(strings.ToLower(strings.Join(f.celdas, " ")))
+		if strings.Contains(texto, filtro) {
+			visibles = append(visibles, f)
+		}
+	}
+	return visibles
+}
+
+// filaSeleccionada devuelve la clave de la fila seleccionada ("" si no hay).
+func (p *pantallaTUI) filaSeleccionada() string {
+	var filas []filaTUI
+	consultar(func() { filas = p.filasVisibles(p.vistas[p.actual].filas()) })
+	i := p.seleccion[p.actual]
+	if i < 0 || i >= len(filas) {
+		return ""
+	}
+	return filas[i].clave
+}
+
+func (p *pantallaTUI) pulsar(t tecla) {
+	if p.formulario != nil {
+		p.pulsarFormulario(t)
+		return
+	}
+	if p.editandoFiltro {
+		p.pulsarFiltro(t)
+		return
+	}
+
+	vista := p.vistas[p.actual]
+	switch t.codigo {
+	case teclaCtrlC:
+		p.salir = true
+	case teclaIzquierda, teclaTabAtras:
+		p.actual = (p.actual + len(p.vistas) - 1) % len(p.vistas)
+		p.mensaje = ""
+	case teclaDerecha, teclaTab:
+		p.actual = (p.actual + 1) % len(p.vistas)
+		p.mensaje = ""
+	case teclaArriba:
+		p.seleccion[p.actual]--
+	case teclaAbajo:
+		p.seleccion[p.actual]++
+	case teclaRePag:
+		p.seleccion[p.actual] -= 10
+	case teclaAvPag:
+		p.seleccion[p.actual] += 10
+	case teclaInicio:
+		p.seleccion[p.actual] = 0
+	case teclaFin:
+		p.seleccion[p.actual] = 1 << 30
+	case teclaEsc:
+		p.filtro[p.actual] = ""
+		p.mensaje = ""
+	case teclaCaracter:
+		switch {
+		case t.caracter == 'q':
+			p.salir = true
+		case t.caracter == '/':
+			p.editandoFiltro = true
+		case t.caracter >= '1' && t.caracter <= '9':
+			if i := int(t.caracter - '1'); i < len(p.vistas) {
+				p.actual = i
+				p.mensaje = ""
+			}
+		default:
+			for _, accion := range vista.acciones {
+				if accion.tecla == t.caracter {
+					p.ejecutarAccion(accion)
+					break
+				}
+			}
+		}
+	}
+}
+
+func (p *pantallaTUI) ejecutarAccion(accion accionTUI) {
+	clave := p.filaSeleccionada()
+	if accion.conFila && clave == "" {
+		p.informar("", errors.New("no hay ninguna fila seleccionada"))
+		return
+	}
+	formulario, mensaje, err := accion.ejecutar(clave)
+	if formulario != nil {
+		p.formulario = formulario
+		p.mensaje = ""
+		return
+	}
+	p.informar(mensaje, err)
+}
+
+func (p *pantallaTUI) pulsarFiltro(t tecla) {
+	filtro := p.filtro[p.actual]
+	switch t.codigo {
+	case teclaEnter:
+		p.editandoFiltro = false
+	case teclaEsc:
+		p.editandoFiltro = false
+		filtro = ""
+	case teclaRetroceso:
+		if runas := []rune(filtro); len(runas) > 0 {
+			filtro = string(runas[:len(runas)-1])
+		}
+	case teclaCaracter:
+		filtro += string(t.caracter)
+	case teclaCtrlC:
+		p.salir = true
+	}
+	p.filtro[p.actual] = filtro
+	p.seleccion[p.actual] = 0
+}
+
+// Dibujo
+
+func (p *pantallaTUI) dibujar() {
+	alto, ancho := p.terminal.tamano()
+	var lineas []string
+
+	// Pestañas
+	var pestanas strings.Builder
+	usado := 0
+	for i, v := range p.vistas {
+		etiqueta := fmt.Sprintf(" %d %s ", i+1, v.nombre)
+		if i == p.actual {
+			pestanas.WriteString(ansiInverso + etiqueta + ansiNormal)
+		} else {
+			pestanas.WriteString(etiqueta)
+		}
+		usado += utf8.RuneCountInString(etiqueta)
+	}
+	titulo := " TALLER MECÁNICO "
+	if hueco := ancho - usado - utf8.RuneCountInString(titulo); hueco > 0 {
+		pestanas.WriteString(strings.Repeat(" ", hueco) + ansiNegrita + titulo + ansiNormal)
+	}
+	lineas = append(lineas, pestanas.String())
+
+	cuerpo := alto - 3 // pestañas, línea de estado y ayuda
+	if p.formulario != nil {
+		lineas = append(lineas, p.formulario.dibujar(cuerpo, ancho)...)
+	} else {
+		lineas = append(lineas, p.dibujarVista(cuerpo, ancho)...)
+	}
+
+	// Mensaje y ayuda
+	switch {
+	case p.mensaje != "" && p.esError:
+		lineas = append(lineas, ansiRojo+ajustar(p.mensaje, ancho)+ansiNormal)
+	case p.mensaje != "":
+		lineas = append(lineas, ansiVerde+ajustar(p.mensaje, ancho)+ansiNormal)
+	default:
+		lineas = append(lineas, "")
+	}
+	lineas = append(lineas, ansiInverso+ajustar(p.ayuda(), ancho)+ansiNormal)
+
+	var b strings.Builder
+	b.WriteString(ansiInicio)
+	for i, linea := range lineas {
+		b.WriteString(linea + ansiBorrarFin)
+		if i < len(lineas)-1 {
+			b.WriteString("\r\n")
+		}
+	}
+	os.Stdout.WriteString(b.String())
+}
+
+func (p *pantallaTUI) ayuda() string {
+	if p.formulario != nil {
+		return " ↑/↓ campo  ←/→ opción  Enter siguiente/guardar  Esc cancelar"
+	}
+	if p.editandoFiltro {
+		return " Escriba para filtrar  Enter aceptar  Esc quitar filtro"
+	}
+	ayuda := " ←/→ pestaña  ↑/↓ mover  / filtrar"
+	for _, accion := range p.vistas[p.actual].acciones {
+		ayuda += fmt.Sprintf("  %c %s", accion.tecla, accion.nombre)
+	}
+	return ayuda + "  q salir"
+}
+
+// dibujarVista compone la tabla de la pestaña actual y el panel de detalle.
+func (p *pantallaTUI) dibujarVista(alto, ancho int) []string {
+	vista := p.vistas[p.actual]
+	var filas []filaTUI
+	var detalle []string
+
+	altoDetalle := alto / 3
+	if altoDetalle > 10 {
+		altoDetalle = 10
+	}
+	altoTabla := alto - altoDetalle - 2 // línea de filtro y cabecera
+
+	consultar(func() {
+		filas = p.filasVisibles(vista.filas())
+		sel := p.seleccion[p.actual]
+		if sel >= len(filas) {
+			sel = len(filas) - 1
+		}
+		if sel < 0 {
+			sel = 0
+		}
+		p.seleccion[p.actual] = sel
+		if sel < len(filas) {
+			detalle = vista.detalle(filas[sel].clave)
+		}
+	})
+
+	var lineas []string
+	filtro := p.filtro[p.actual]
+	switch {
+	case p.editandoFiltro:
+		lineas = append(lineas, ajustar(fmt.Sprintf(" Filtro: %s_", filtro), ancho))
+	case filtro != "":
+		lineas = append(lineas, ajustar(fmt.Sprintf(" Filtro: %s (%d resultados, Esc para quitarlo)", filtro, len(filas)), ancho))
+	default:
+		lineas = append(lineas, ajustar(fmt.Sprintf(" %d registros", len(filas)), ancho))
+	}
+
+	anchos := vista.anchosColumnas(ancho)
+	lineas = append(lineas, ansiNegrita+vista.formatearFila(vista.titulosColumnas(), anchos, ancho)+ansiNormal)
+
+	sel := p.seleccion[p.actual]
+	inicio := p.desplazamiento[p.actual]
+	if sel < inicio {
+		inicio = sel
+	}
+	if sel >= inicio+altoTabla {
+		inicio = sel - altoTabla + 1
+	}
+	p.desplazamiento[p.actual] = inicio
+
+	for i := 0; i < altoTabla; i++ {
+		n := inicio + i
+		switch {
+		case n < len(filas) && n == sel:
+			lineas = append(lineas, ansiInverso+vista.formatearFila(filas[n].celdas, anchos, ancho)+ansiNormal)
+		case n < len(filas):
+			lineas = append(lineas, vista.formatearFila(filas[n].celdas, anchos, ancho))
+		case n == 0:
+			lineas = append(lineas, ansiTenue+ajustar(" (sin resultados)", ancho)+ansiNormal)
+		default:
+			lineas = append(lineas, "")
+		}
+	}
+
+	lineas = append(lineas, ansiTenue+ajustar(strings.Repeat("─", 2)+" Detalle "+strings.Repeat("─", ancho), ancho)+ansiNormal)
+	for i := 0; i < altoDetalle-1; i++ {
+		if i < len(detalle) {
+			lineas = append(lineas, ajustar(" "+detalle[i], ancho))
+		} else {
+			lineas = append(lineas, "")
+		}
+	}
+	return lineas
+}
+
+// Vistas, acciones y formularios
+
+type columnaTUI struct {
+	titulo string
+	ancho  int // 0: ocupa el espacio que sobre
+}
+
+type filaTUI struct {
+	clave  string
+	celdas []string
+}
+
+type accionTUI struct {
+	tecla    rune
+	nombre   string
+	conFila  bool // necesita una fila seleccionada
+	ejecutar func(clave string) (*formularioTUI, string, error)
+}
+
+// vistaTUI es una pestaña. filas y detalle se llaman dentro de consultar.
+type vistaTUI struct {
+	nombre   string
+	columnas []columnaTUI
+	filas    func() []filaTUI
+	detalle  func(clave string) []string
+	acciones []accionTUI
+}
+
+func (v *vistaTUI) titulosColumnas() []string {
+	var titulos []string
+	for _, c := range v.columnas {
+		titulos = append(titulos, c.titulo)
+	}
+	return titulos
+}
+
+func (v *vistaTUI) anchosColumnas(ancho int) []int {
+	anchos := make([]int, len(v.columnas))
+	libre := ancho - 1 - 2*(len(v.columnas)-1)
+	flexibles := 0
+	for i, c := range v.columnas {
+		anchos[i] = c.ancho
+		libre -= c.ancho
+		if c.ancho == 0 {
+			flexibles++
+		}
+	}
+	for i, c := range v.columnas {
+		if c.ancho == 0 && flexibles > 0 {
+			anchos[i] = libre / flexibles
+			if anchos[i] < 5 {
+				anchos[i] = 5
+			}
+		}
+	}
+	return anchos
+}
+
+func (v *vistaTUI) formatearFila(celdas []string, anchos []int, ancho int) string {
+	partes := make([]string, len(anchos))
+	for i := range anchos {
+		celda := ""
+		if i < len(celdas) {
+			celda = celdas[i]
+		}
+		partes[i] = ajustar(celda, anchos[i])
+	}
+	return ajustar(" "+strings.Join(partes, "  "), ancho)
+}
+
+type campoTUI struct {
+	etiqueta string
+	valor    string
+	opciones []string // si tiene, ←/→ recorre los valores válidos
+	validar  func(valor string) error
+	error    string
+}
+
+type formularioTUI struct {
+	titulo string
+	campos []*campoTUI
+	activo int
+	// enviar recibe los valores en el orden de los campos y devuelve el
+	// mensaje que se mostrará si todo va bien.
+	enviar func(valores []string) (string, error)
+	error  string
+}
+
+func (p *pantallaTUI) pulsarFormulario(t tecla) {
+	f := p.formulario
+	campo := f.campos[f.activo]
+	switch t.codigo {
+	case teclaCtrlC:
+		p.salir = true
+	case teclaEsc:
+		p.formulario = nil
+		p.mensaje = "Operación cancelada"
+		p.esError = false
+	case teclaArriba, teclaTabAtras:
+		if f.activo > 0 {
+			f.activo--
+		}
+	case teclaAbajo, teclaTab:
+		if f.validarCampo(campo) && f.activo < len(f.campos)-1 {
+			f.activo++
+		}
+	case teclaIzquierda, teclaDerecha:
+		if len(campo.opciones) > 0 {
+			paso := 1
+			if t.codigo == teclaIzquierda {
+				paso = len(campo.opciones) - 1
+			}
+			actual := -1
+			for i, o := range campo.opciones {
+				if o == campo.valor {
+					actual = i
+				}
+			}
+			campo.valor = campo.opciones[(actual+paso+len(campo.opciones))%len(campo.opciones)]
+			campo.error = ""
+		}
+	case teclaRetroceso:
+		if runas := []rune(campo.valor); len(runas) > 0 {
+			campo.valor = string(runas[:len(runas)-1])
+		}
+		campo.error = ""
+	case teclaCaracter:
+		campo.valor += string(t.caracter)
+		campo.error = ""
+	case teclaEnter:
+		if !f.validarCampo(campo) {
+			return
+		}
+		if f.activo < len(f.campos)-1 {
+			f.activo++
+			return
+		}
+		p.enviarFormulario()
+	}
+}
+
+func (f *formularioTUI) validarCampo(c *campoTUI) bool {
+	c.error = ""
+	if c.validar != nil {
+		if err := c.validar(strings.TrimSpace(c.valor)); err != nil {
+			c.error = err.Error()
+			return false
+		}
+	}
+	return true
+}
+
+func (p *pantallaTUI) enviarFormulario() {
+	f := p.formulario
+	valores := make([]string, len(f.campos))
+	for i, c := range f.campos {
+		if !f.validarCampo(c) {
+			f.activo = i
+			return
+		}
+		valores[i] = strings.TrimSpace(c.valor)
+	}
+
+	mensaje, err := f.enviar(valores)
+	if err != nil {
+		var conflicto *errorConflicto
+		if errors.As(err, &conflicto) {
+			// Los datos del formulario ya no son válidos: se cierra y se
+			// muestra qué ha cambiado.
+			p.formulario = nil
+			p.informar("", err)
+			return
+		}
+		f.error = err.Error()
+		return
+	}
+	p.formulario = nil
+	p.informar(mensaje, nil)
+}
+
+func (f *formularioTUI) dibujar(alto, ancho int) []string {
+	lineas := []string{
+		"",
+		ansiNegrita + ajustar("  "+f.titulo, ancho) + ansiNormal,
+		"",
+	}
+	anchoEtiqueta := 0
+	for _, c := range f.campos {
+		if n := utf8.RuneCountInString(c.etiqueta); n > anchoEtiqueta {
+			anchoEtiqueta = n
+		}
+	}
+
+	for i, c := range f.campos {
+		valor := c.valor
+		if i == f.activo {
+			valor += "_"
+		}
+		linea := "  " + ajustar(c.etiqueta, anchoEtiqueta) + " : "
+		resto := ancho - utf8.RuneCountInString(linea)
+		if i == f.activo {
+			lineas = append(lineas, linea+ansiInverso+ajustar(valor, resto)+ansiNormal)
+		} else {
+			lineas = append(lineas, linea+ajustar(valor, resto))
+		}
+
+		indicacion := ""
+		if len(c.opciones) > 0 {
+			indicacion = "(" + strings.Join(c.opciones, " / ") + ")"
+		}
+		sangria := strings.Repeat(" ", anchoEtiqueta+5)
+		switch {
+		case c.error != "":
+			lineas = append(lineas, ansiRojo+ajustar(sangria+c.error, ancho)+ansiNormal)
+		case indicacion != "":
+			lineas = append(lineas, ansiTenue+ajustar(sangria+indicacion, ancho)+ansiNormal)
+		default:
+			lineas = append(lineas, "")
+		}
+	}
+
+	if f.error != "" {
+		lineas = append(lineas, "", ansiRojo+ajustar("  Error: "+f.error, ancho)+ansiNormal)
+	}
+	for len(lineas) < alto {
+		lineas = append(lineas, "")
+	}
+	return lineas[:alto]
+}
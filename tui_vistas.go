@@ -0,0 +1,904 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Pestañas de la interfaz a pantalla completa (ver tui.go)
+
+func vistasTUI() []*vistaTUI {
+	return []*vistaTUI{
+		vistaClientesTUI(),
+		vistaVehiculosTUI(),
+		vistaIncidenciasTUI(),
+		vistaMecanicosTUI(),
+		vistaPlazasTUI(),
+	}
+}
+
+// Validaciones de campos sueltos
+
+func campoObligatorio(valor string) error {
+	if valor == "" {
+		return errors.New("este campo es obligatorio")
+	}
+	return nil
+}
+
+func campoHorario(valor string) error {
+	_, err := leerHorario(valor)
+	return err
+}
+
+func campoEmail(valor string) error {
+	return comprobarEmail(valor)
+}
+
+func campoEntero(valor string) error {
+	if _, err := strconv.Atoi(valor); err != nil {
+		return errors.New("debe ser un número entero")
+	}
+	return nil
+}
+
+func campoCatalogo[T ~string](catalogo []T) func(string) error {
+	return func(valor string) error {
+		if _, ok := normalizarValor(valor, catalogo); !ok {
+			return fmt.Errorf("valores válidos: %s", strings.Join(textosCatalogo(catalogo), ", "))
+		}
+		return nil
+	}
+}
+
+func textoSiNo(valor bool) string {
+	if valor {
+		return "Sí"
+	}
+	return "No"
+}
+
+func idsMecanicos(mecanicos []*Mecanico) string {
+	var nombres []string
+	for _, m := range mecanicos {
+		nombres = append(nombres, m.Nombre)
+	}
+	return strings.Join(nombres, ", ")
+}
+
+// Clientes
+
+func vistaClientesTUI() *vistaTUI {
+	return &vistaTUI{
+		nombre: "Clientes",
+		columnas: []columnaTUI{
+			{"ID", 4}, {"Nombre", 22}, {"Teléfono", 11}, {"Email", 24}, {"Vehículo", 0},
+		},
+		filas: func() []filaTUI {
+			var filas []filaTUI
+			for _, c := range almacen.Clientes().Todos() {
+				vehiculo := ""
+				if c.Vehiculo != nil {
+					vehiculo = c.Vehiculo.Matricula + " " + c.Vehiculo.Marca + " " + c.Vehiculo.Modelo
+				}
+				filas = append(filas, filaTUI{strconv.Itoa(c.ID),
+					[]string{strconv.Itoa(c.ID), c.Nombre, c.Telefono, c.Email, vehiculo}})
+			}
+			return filas
+		},
+		detalle: func(clave string) []string {
+			id, _ := strconv.Atoi(clave)
+			c := buscarCliente(id)
+			if c == nil {
+				return nil
+			}
+			lineas := []string{
+				fmt.Sprintf("Cliente %d: %s", c.ID, c.Nombre),
+				fmt.Sprintf("Teléfono: %s   Email: %s", c.Telefono, c.Email),
+			}
+			if v := c.Vehiculo; v != nil {
+				lineas = append(lineas, fmt.Sprintf("Vehículo: %s %s (%s), entrada %s", v.Marca, v.Modelo, v.Matricula, v.FechaEntrada))
+				if v.EnTaller {
+					lineas = append(lineas, fmt.Sprintf("En taller, plaza %d", v.NumeroPlaza))
+				}
+				for _, inc := range lineasOrden(v, v.Orden) {
+					lineas = append(lineas, fmt.Sprintf("Incidencia %d: %s (%s, %s)", inc.ID, inc.Descripcion, inc.Tipo, inc.Estado))
+				}
+			} else {
+				lineas = append(lineas, "Sin vehículo asociado")
+			}
+			return lineas
+		},
+		acciones: []accionTUI{
+			{'n', "nuevo", false, func(string) (*formularioTUI, string, error) {
+				return formularioCliente(nil), "", nil
+			}},
+			{'e', "editar", true, func(clave string) (*formularioTUI, string, error) {
+				id, _ := strconv.Atoi(clave)
+				c := buscarCliente(id)
+				if c == nil {
+					return nil, "", errors.New("cliente no encontrado")
+				}
+				return formularioCliente(c), "", nil
+			}},
+		},
+	}
+}
+
+// formularioCliente da de alta un cliente o, si se indica, modifica uno
+// existente comprobando que nadie lo haya cambiado mientras tanto.
+func formularioCliente(cliente *Cliente) *formularioTUI {
+	f := &formularioTUI{
+		titulo: "Nuevo cliente",
+		campos: []*campoTUI{
+			{etiqueta: "Nombre", validar: campoObligatorio},
+			{etiqueta: "Teléfono"},
+			{etiqueta: "Email", validar: campoEmail},
+		},
+		enviar: func(v []string) (string, error) {
+			c, err := registrarCliente(0, v[0], v[1], v[2])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Cliente creado con ID %d", c.ID), nil
+		},
+	}
+	if cliente == nil {
+		return f
+	}
+
+	var leido Cliente
+	consultar(func() { leido = *cliente })
+	f.titulo = fmt.Sprintf("Modificar cliente %d", leido.ID)
+	f.campos[0].valor, f.campos[1].valor, f.campos[2].valor = leido.Nombre, leido.Telefono, leido.Email
+	f.enviar = func(v []string) (string, error) {
+		err := operacion(func() error {
+			if err := comprobarVersion(&leido, cliente); err != nil {
+				return err
+			}
+			cliente.Nombre, cliente.Telefono, cliente.Email = v[0], v[1], v[2]
+			return guardar(cliente)
+		})
+		return "Cliente modificado", err
+	}
+	return f
+}
+
+// Vehículos
+
+func vistaVehiculosTUI() *vistaTUI {
+	return &vistaTUI{
+		nombre: "Vehículos",
+		columnas: []columnaTUI{
+			{"Matrícula", 9}, {"Marca", 12}, {"Modelo", 12}, {"Cliente", 18}, {"Taller", 8}, {"Incidencias", 0},
+		},
+		filas: func() []filaTUI {
+			var filas []filaTUI
+			for _, v := range almacen.Vehiculos().Todos() {
+				cliente, taller, incidencia := "", "-", ""
+				if c := buscarPropietario(v); c != nil {
+					cliente = c.Nombre
+				}
+				if v.EnTaller {
+					taller = fmt.Sprintf("Plaza %d", v.NumeroPlaza)
+				}
+				incidencia = resumenOrden(lineasOrden(v, v.Orden))
+				filas = append(filas, filaTUI{v.Matricula,
+					[]string{v.Matricula, v.Marca, v.Modelo, cliente, taller, incidencia}})
+			}
+			return filas
+		},
+		detalle: func(clave string) []string {
+			v := buscarVehiculo(clave)
+			if v == nil {
+				return nil
+			}
+			lineas := []string{
+				fmt.Sprintf("Vehículo %s: %s %s", v.Matricula, v.Marca, v.Modelo),
+				fmt.Sprintf("Entrada: %s   Salida estimada: %s", v.FechaEntrada, v.FechaSalida),
+			}
+			if v.RecogidoPor != "" {
+				lineas[1] = fmt.Sprintf("Entrada: %s   Salida: %s", v.FechaEntrada, v.FechaSalida)
+				lineas = append(lineas, fmt.Sprintf("Recogido por %s, pago %s", v.RecogidoPor, v.EstadoPago))
+			}
+			if c := buscarPropietario(v); c != nil {
+				lineas = append(lineas, fmt.Sprintf("Cliente: %s (%s)", c.Nombre, c.Telefono))
+			}
+			if v.EnTaller {
+				lineas = append(lineas, fmt.Sprintf("En taller, plaza %d", v.NumeroPlaza))
+			} else {
+				lineas = append(lineas, "Fuera del taller")
+			}
+			if v.Orden != 0 {
+				lineas = append(lineas, fmt.Sprintf("Orden de trabajo %d:", v.Orden))
+			}
+			for _, inc := range lineasOrden(v, v.Orden) {
+				lineas = append(lineas, fmt.Sprintf("  Incidencia %d: %s", inc.ID, inc.Descripcion))
+				lineas = append(lineas, fmt.Sprintf("  Tipo %s, prioridad %s, estado %s", inc.Tipo, inc.Prioridad, inc.Estado))
+				if len(inc.Mecanicos) > 0 {
+					lineas = append(lineas, "  Mecánicos: "+idsMecanicos(inc.Mecanicos))
+				}
+			}
+			return lineas
+		},
+		acciones: []accionTUI{
+			{'n', "nuevo", false, func(string) (*formularioTUI, string, error) {
+				return formularioVehiculo(), "", nil
+			}},
+			{'t', "al taller", true, func(clave string) (*formularioTUI, string, error) {
+				v := buscarVehiculo(clave)
+				if v == nil {
+					return nil, "", errors.New("vehículo no encontrado")
+				}
+				plaza, err := ingresarVehiculo(v)
+				return nil, fmt.Sprintf("Vehículo %s asignado a la plaza %d", clave, plaza), err
+			}},
+			{'e', "entregar", true, formularioEntregarVehiculo},
+		},
+	}
+}
+
+func formularioEntregarVehiculo(clave string) (*formularioTUI, string, error) {
+	v := buscarVehiculo(clave)
+	if v == nil {
+		return nil, "", errors.New("vehículo no encontrado")
+	}
+	propietario := ""
+	consultar(func() {
+		if c := buscarPropietario(v); c != nil {
+			propietario = c.Nombre
+		}
+	})
+	return &formularioTUI{
+		titulo: "Entregar el vehículo " + clave,
+		campos: []*campoTUI{
+			{etiqueta: "Recogido por", valor: propietario, validar: campoObligatorio},
+			{etiqueta: "Pago", valor: estadosPago[0], opciones: estadosPago, validar: campoCatalogo(estadosPago)},
+		},
+		enviar: func(valores []string) (string, error) {
+			if err := entregarVehiculo(v, valores[1], valores[0]); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Vehículo %s entregado; la plaza queda libre", clave), nil
+		},
+	}, "", nil
+}
+
+func formularioVehiculo() *formularioTUI {
+	return &formularioTUI{
+		titulo: "Nuevo vehículo",
+		campos: []*campoTUI{
+			{etiqueta: "ID del cliente", validar: func(valor string) error {
+				if err := campoEntero(valor); err != nil {
+					return err
+				}
+				id, _ := strconv.Atoi(valor)
+				var err error
+				consultar(func() {
+					c := buscarCliente(id)
+					switch {
+					case c == nil:
+						err = errors.New("cliente no encontrado")
+					case c.Vehiculo != nil:
+						err = errors.New("el cliente ya tiene un vehículo asociado")
+					}
+				})
+				return err
+			}},
+			{etiqueta: "Matrícula", validar: func(valor string) error {
+				if err := campoObligatorio(valor); err != nil {
+					return err
+				}
+				if buscarVehiculo(valor) != nil {
+					return errors.New("ya existe un vehículo con esa matrícula")
+				}
+				return nil
+			}},
+			{etiqueta: "Marca"},
+			{etiqueta: "Modelo"},
+		},
+		enviar: func(v []string) (string, error) {
+			id, _ := strconv.Atoi(v[0])
+			if _, err := registrarVehiculo(buscarCliente(id), v[1], v[2], v[3], ""); err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Vehículo %s creado", v[1]), nil
+		},
+	}
+}
+
+// Incidencias
+
+func vistaIncidenciasTUI() *vistaTUI {
+	return &vistaTUI{
+		nombre: "Incidencias",
+		columnas: []columnaTUI{
+			{"ID", 4}, {"Matrícula", 9}, {"Tipo", 10}, {"Prioridad", 9}, {"Estado", 10}, {"Mecánicos", 18}, {"Descripción", 0},
+		},
+		filas: func() []filaTUI {
+			var filas []filaTUI
+			for _, inc := range almacen.Incidencias().Todas() {
+				matricula := ""
+				if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+					matricula = v.Matricula
+				}
+				filas = append(filas, filaTUI{strconv.Itoa(inc.ID),
+					[]string{strconv.Itoa(inc.ID), matricula, string(inc.Tipo), string(inc.Prioridad), string(inc.Estado),
+						idsMecanicos(inc.Mecanicos), inc.Descripcion}})
+			}
+			return filas
+		},
+		detalle: func(clave string) []string {
+			id, _ := strconv.Atoi(clave)
+			inc := buscarIncidencia(id)
+			if inc == nil {
+				return nil
+			}
+			lineas := []string{
+				fmt.Sprintf("Incidencia %d: %s", inc.ID, inc.Descripcion),
+				fmt.Sprintf("Tipo %s, prioridad %s, estado %s", inc.Tipo, inc.Prioridad, inc.Estado),
+			}
+			if v := almacen.Vehiculos().PorIncidencia(inc.ID); v != nil {
+				lineas = append(lineas, fmt.Sprintf("Vehículo: %s %s (%s)", v.Marca, v.Modelo, v.Matricula))
+			}
+			if len(inc.Mecanicos) > 0 {
+				lineas = append(lineas, "Mecánicos: "+idsMecanicos(inc.Mecanicos))
+			} else {
+				lineas = append(lineas, "Sin mecánicos asignados")
+			}
+			for _, n := range inc.Notas {
+				lineas = append(lineas, "Nota: "+textoNota(n))
+			}
+			for i, a := range inc.Adjuntos {
+				lineas = append(lineas, fmt.Sprintf("Adjunto %d: %s", i+1, textoAdjunto(a)))
+			}
+			return lineas
+		},
+		acciones: []accionTUI{
+			{'n', "nueva", false, func(string) (*formularioTUI, string, error) {
+				return formularioIncidencia(), "", nil
+			}},
+			{'e', "editar", true, func(clave string) (*formularioTUI, string, error) {
+				return formularioEditarIncidencia(clave)
+			}},
+			{'s', "estado", true, func(clave string) (*formularioTUI, string, error) {
+				return formularioEstadoIncidencia(clave)
+			}},
+			{'m', "asignar mecánico", true, func(clave string) (*formularioTUI, string, error) {
+				return formularioAsignarMecanico(clave)
+			}},
+			{'d', "retirar mecánico", true, formularioRetirarMecanico},
+			{'t', "traspasar", true, formularioTraspasarIncidencia},
+			{'a', "nota", true, formularioNotaIncidencia},
+			{'f', "adjuntar", true, formularioAdjuntarFichero},
+		},
+	}
+}
+
+func formularioIncidencia() *formularioTUI {
+	return &formularioTUI{
+		titulo: "Nueva incidencia",
+		campos: []*campoTUI{
+			{etiqueta: "Matrícula", validar: func(valor string) error {
+				var err error
+				consultar(func() {
+					if buscarVehiculo(valor) == nil {
+						err = errors.New("vehículo no encontrado")
+					}
+				})
+				return err
+			}},
+			{etiqueta: "Tipo", valor: string(tiposIncidencia[0]), opciones: textosCatalogo(tiposIncidencia), validar: campoCatalogo(tiposIncidencia)},
+			{etiqueta: "Prioridad", valor: string(prioridadMedia), opciones: textosCatalogo(prioridadesIncidencia), validar: campoCatalogo(prioridadesIncidencia)},
+			{etiqueta: "Descripción", validar: campoObligatorio},
+		},
+		enviar: func(v []string) (string, error) {
+			inc, err := registrarIncidencia(0, buscarVehiculo(v[0]), v[1], v[2], v[3], string(estadoAbierta))
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Incidencia creada con ID %d", inc.ID), nil
+		},
+	}
+}
+
+func formularioEditarIncidencia(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+
+	var leido Incidencia
+	consultar(func() { leido = *incidencia })
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Modificar incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Descripción", valor: leido.Descripcion, validar: campoObligatorio},
+			{etiqueta: "Prioridad", valor: string(leido.Prioridad), opciones: textosCatalogo(prioridadesIncidencia), validar: campoCatalogo(prioridadesIncidencia)},
+		},
+		enviar: func(v []string) (string, error) {
+			prioridad, _ := normalizarValor(v[1], prioridadesIncidencia)
+			err := operacion(func() error {
+				if err := comprobarVersion(&leido, incidencia); err != nil {
+					return err
+				}
+				incidencia.Descripcion = v[0]
+				incidencia.Prioridad = prioridad
+				return guardar(incidencia)
+			})
+			return "Incidencia modificada", err
+		},
+	}, "", nil
+}
+
+func formularioEstadoIncidencia(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+
+	var estado string
+	consultar(func() { estado = string(incidencia.Estado) })
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Cambiar estado de la incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Estado", valor: estado, opciones: textosCatalogo(estadosIncidencia), validar: campoCatalogo(estadosIncidencia)},
+		},
+		enviar: func(v []string) (string, error) {
+			if err := cambiarEstado(incidencia, v[0]); err != nil {
+				return "", err
+			}
+			return "Estado cambiado", nil
+		},
+	}, "", nil
+}
+
+func formularioAsignarMecanico(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+
+	var disponibles []string
+	consultar(func() {
+		for _, m := range almacen.Mecanicos().PorEspecialidad(incidencia.Tipo) {
+			if validarAsignacion(incidencia, m) == nil {
+				disponibles = append(disponibles, strconv.Itoa(m.ID))
+			}
+		}
+	})
+	if len(disponibles) == 0 {
+		return nil, "", fmt.Errorf("no hay mecánicos disponibles con la especialidad %s y nivel %s o superior",
+			incidencia.Tipo, nivelMinimo[incidencia.Prioridad])
+	}
+
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Asignar mecánico a la incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "ID del mecánico", valor: disponibles[0], opciones: disponibles, validar: func(valor string) error {
+				if err := campoEntero(valor); err != nil {
+					return err
+				}
+				idMecanico, _ := strconv.Atoi(valor)
+				m := buscarMecanico(idMecanico)
+				if m == nil {
+					return errors.New("mecánico no encontrado")
+				}
+				var err error
+				consultar(func() { err = validarAsignacion(incidencia, m) })
+				return err
+			}},
+		},
+		enviar: func(v []string) (string, error) {
+			idMecanico, _ := strconv.Atoi(v[0])
+			m := buscarMecanico(idMecanico)
+			if err := asignarMecanico(incidencia, m); err != nil {
+				return "", err
+			}
+			var aviso string
+			consultar(func() { aviso = avisoSobrecarga(m) })
+			if aviso != "" {
+				return "Mecánico asignado; " + aviso, nil
+			}
+			return "Mecánico asignado", nil
+		},
+	}, "", nil
+}
+
+// asignadosIncidencia devuelve los IDs de los mecánicos de la incidencia.
+func asignadosIncidencia(incidencia *Incidencia) ([]string, error) {
+	var asignados []string
+	consultar(func() {
+		for _, m := range incidencia.Mecanicos {
+			asignados = append(asignados, strconv.Itoa(m.ID))
+		}
+	})
+	if len(asignados) == 0 {
+		return nil, errors.New("la incidencia no tiene mecánicos asignados")
+	}
+	return asignados, nil
+}
+
+func formularioRetirarMecanico(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+	asignados, err := asignadosIncidencia(incidencia)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Retirar mecánico de la incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "ID del mecánico", valor: asignados[0], opciones: asignados, validar: campoEntero},
+			{etiqueta: "Motivo", validar: campoObligatorio},
+		},
+		enviar: func(v []string) (string, error) {
+			idMecanico, _ := strconv.Atoi(v[0])
+			m := buscarMecanico(idMecanico)
+			if m == nil {
+				return "", errors.New("mecánico no encontrado")
+			}
+			if err := desasignarMecanico(incidencia, m, v[1]); err != nil {
+				return "", err
+			}
+			return "Mecánico retirado", nil
+		},
+	}, "", nil
+}
+
+func formularioTraspasarIncidencia(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+	asignados, err := asignadosIncidencia(incidencia)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var candidatos []string
+	consultar(func() {
+		carga := map[*Mecanico]int{}
+		for _, m := range almacen.Mecanicos().Todos() {
+			carga[m] = cargaMecanico(m)
+		}
+		for _, m := range candidatosPorCarga(incidencia, nil, carga) {
+			candidatos = append(candidatos, strconv.Itoa(m.ID))
+		}
+	})
+	if len(candidatos) == 0 {
+		return nil, "", errors.New("nadie más puede atender hoy esta incidencia")
+	}
+
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Traspasar la incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Lo deja el mecánico", valor: asignados[0], opciones: asignados, validar: campoEntero},
+			{etiqueta: "Lo recibe el mecánico", valor: candidatos[0], opciones: candidatos, validar: campoEntero},
+			{etiqueta: "Motivo", validar: campoObligatorio},
+		},
+		enviar: func(v []string) (string, error) {
+			idDesde, _ := strconv.Atoi(v[0])
+			idHacia, _ := strconv.Atoi(v[1])
+			desde, hacia := buscarMecanico(idDesde), buscarMecanico(idHacia)
+			if desde == nil || hacia == nil {
+				return "", errors.New("mecánico no encontrado")
+			}
+			if err := traspasarIncidencia(incidencia, desde, hacia, v[2]); err != nil {
+				return "", err
+			}
+			var aviso string
+			consultar(func() { aviso = avisoSobrecarga(hacia) })
+			if aviso != "" {
+				return "Incidencia traspasada; " + aviso, nil
+			}
+			return "Incidencia traspasada", nil
+		},
+	}, "", nil
+}
+
+func formularioNotaIncidencia(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Nota en la incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Autor", validar: campoObligatorio},
+			{etiqueta: "Nota", validar: campoObligatorio},
+		},
+		enviar: func(v []string) (string, error) {
+			if err := anadirNota(incidencia, v[0], v[1]); err != nil {
+				return "", err
+			}
+			return "Nota añadida", nil
+		},
+	}, "", nil
+}
+
+func formularioAdjuntarFichero(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	incidencia := buscarIncidencia(id)
+	if incidencia == nil {
+		return nil, "", errors.New("incidencia no encontrada")
+	}
+
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Adjuntar un fichero a la incidencia %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Autor", validar: campoObligatorio},
+			{etiqueta: "Fichero", validar: campoObligatorio},
+			{etiqueta: "Descripción"},
+		},
+		enviar: func(v []string) (string, error) {
+			a, err := adjuntarFichero(incidencia, v[0], v[1], v[2])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Adjuntado %s (%s)", a.Nombre, textoTamano(a.Tamano)), nil
+		},
+	}, "", nil
+}
+
+// Mecánicos
+
+func vistaMecanicosTUI() *vistaTUI {
+	return &vistaTUI{
+		nombre: "Mecánicos",
+		columnas: []columnaTUI{
+			{"ID", 4}, {"Nombre", 22}, {"Especialidades", 28}, {"Exp.", 4}, {"Estado", 7}, {"Incidencias", 0},
+		},
+		filas: func() []filaTUI {
+			var filas []filaTUI
+			for _, m := range almacen.Mecanicos().Todos() {
+				estado := situacionMecanico(m, time.Now())
+				var ids []string
+				for _, inc := range m.Incidencias {
+					ids = append(ids, "#"+strconv.Itoa(inc.ID))
+				}
+				filas = append(filas, filaTUI{strconv.Itoa(m.ID),
+					[]string{strconv.Itoa(m.ID), m.Nombre, textoEspecialidades(m.Especialidades), strconv.Itoa(m.AniosExp), estado,
+						strings.Join(ids, " ")}})
+			}
+			return filas
+		},
+		detalle: func(clave string) []string {
+			id, _ := strconv.Atoi(clave)
+			m := buscarMecanico(id)
+			if m == nil {
+				return nil
+			}
+			lineas := []string{
+				fmt.Sprintf("Mecánico %d: %s", m.ID, m.Nombre),
+				fmt.Sprintf("Especialidades: %s", textoEspecialidades(m.Especialidades)),
+				fmt.Sprintf("%d años de experiencia, activo: %s", m.AniosExp, textoSiNo(m.Activo)),
+				fmt.Sprintf("Horario: %s", textoHorario(m.Horario)),
+				fmt.Sprintf("Carga de trabajo: %s", textoCarga(cargaMecanico(m))),
+			}
+			if motivo := motivoNoDisponible(m, time.Now()); motivo != "" {
+				lineas = append(lineas, "Hoy no trabaja: "+motivo)
+			}
+			for _, a := range m.Ausencias {
+				lineas = append(lineas, "Ausencia: "+textoAusencia(a))
+			}
+			for _, inc := range m.Incidencias {
+				lineas = append(lineas, fmt.Sprintf("Incidencia %d (%s, %s): %s", inc.ID, inc.Prioridad, inc.Estado, inc.Descripcion))
+			}
+			return lineas
+		},
+		acciones: []accionTUI{
+			{'n', "nuevo", false, func(string) (*formularioTUI, string, error) {
+				return formularioMecanico(), "", nil
+			}},
+			{'b', "alta/baja", true, func(clave string) (*formularioTUI, string, error) {
+				id, _ := strconv.Atoi(clave)
+				m := buscarMecanico(id)
+				if m == nil {
+					return nil, "", errors.New("mecánico no encontrado")
+				}
+				if err := cambiarAltaMecanico(m); err != nil {
+					return nil, "", err
+				}
+				var activo bool
+				consultar(func() { activo = m.Activo })
+				if activo {
+					return nil, "Mecánico dado de alta", nil
+				}
+				return nil, "Mecánico dado de baja", nil
+			}},
+			{'h', "horario", true, formularioHorarioMecanico},
+			{'u', "ausencia", true, formularioAusenciaMecanico},
+			{'p', "pasar incidencias", true, formularioTraspasarPendientes},
+		},
+	}
+}
+
+func formularioMecanico() *formularioTUI {
+	return &formularioTUI{
+		titulo: "Nuevo mecánico",
+		campos: []*campoTUI{
+			{etiqueta: "Nombre", validar: campoObligatorio},
+			{etiqueta: "Especialidades", valor: string(tiposIncidencia[0]) + ":" + nivelesEspecialidad[0], validar: func(valor string) error {
+				_, err := leerEspecialidades(valor)
+				return err
+			}},
+			{etiqueta: "Años de experiencia", valor: "0", validar: func(valor string) error {
+				if n, err := strconv.Atoi(valor); err != nil || n < 0 {
+					return errors.New("debe ser un número entero mayor o igual que 0")
+				}
+				return nil
+			}},
+			{etiqueta: "Horario", valor: formatearHorario(horarioHabitual()), validar: campoHorario},
+		},
+		enviar: func(v []string) (string, error) {
+			anios, _ := strconv.Atoi(v[2])
+			especialidades, err := leerEspecialidades(v[1])
+			if err != nil {
+				return "", err
+			}
+			horario, err := leerHorario(v[3])
+			if err != nil {
+				return "", err
+			}
+			m, err := registrarMecanico(0, v[0], especialidades, anios, horario, true)
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("Mecánico creado con ID %d", m.ID), nil
+		},
+	}
+}
+
+func formularioHorarioMecanico(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	m := buscarMecanico(id)
+	if m == nil {
+		return nil, "", errors.New("mecánico no encontrado")
+	}
+
+	var horario string
+	consultar(func() { horario = formatearHorario(m.Horario) })
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Horario del mecánico %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Horario", valor: horario, validar: campoHorario},
+		},
+		enviar: func(v []string) (string, error) {
+			turnos, err := leerHorario(v[0])
+			if err != nil {
+				return "", err
+			}
+			return "Horario cambiado", cambiarHorario(m, turnos)
+		},
+	}, "", nil
+}
+
+func formularioAusenciaMecanico(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	m := buscarMecanico(id)
+	if m == nil {
+		return nil, "", errors.New("mecánico no encontrado")
+	}
+
+	campoFecha := func(valor string) error {
+		_, err := leerFecha(valor)
+		return err
+	}
+	hoy := obtenerFechaActual()
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Nueva ausencia del mecánico %d", id),
+		campos: []*campoTUI{
+			{etiqueta: "Desde", valor: hoy, validar: campoFecha},
+			{etiqueta: "Hasta", valor: hoy, validar: campoFecha},
+			{etiqueta: "Motivo", valor: motivosAusencia[0], opciones: motivosAusencia, validar: campoCatalogo(motivosAusencia)},
+		},
+		enviar: func(v []string) (string, error) {
+			if err := anadirAusencia(m, Ausencia{v[0], v[1], v[2]}); err != nil {
+				return "", err
+			}
+			return "Ausencia anotada", nil
+		},
+	}, "", nil
+}
+
+func formularioTraspasarPendientes(clave string) (*formularioTUI, string, error) {
+	id, _ := strconv.Atoi(clave)
+	m := buscarMecanico(id)
+	if m == nil {
+		return nil, "", errors.New("mecánico no encontrado")
+	}
+	var pendientes int
+	consultar(func() { pendientes = pendientesMecanico(m) })
+	if pendientes == 0 {
+		return nil, "", errors.New("el mecánico no tiene incidencias pendientes")
+	}
+
+	return &formularioTUI{
+		titulo: fmt.Sprintf("Traspasar las %d incidencia(s) pendiente(s) del mecánico %d", pendientes, id),
+		campos: []*campoTUI{
+			{etiqueta: "Al mecánico (vacío = repartir)", validar: func(valor string) error {
+				if valor == "" {
+					return nil
+				}
+				return campoEntero(valor)
+			}},
+			{etiqueta: "Motivo", validar: campoObligatorio},
+		},
+		enviar: func(v []string) (string, error) {
+			var destino *Mecanico
+			if v[0] != "" {
+				idDestino, _ := strconv.Atoi(v[0])
+				if destino = buscarMecanico(idDestino); destino == nil {
+					return "", errors.New("mecánico no encontrado")
+				}
+			}
+			movimientos, err := traspasarPendientes(m, destino, v[1])
+			if err != nil {
+				return "", err
+			}
+			return fmt.Sprintf("%d incidencia(s) traspasada(s)", len(movimientos)), nil
+		},
+	}, "", nil
+}
+
+// Plazas
+
+func vistaPlazasTUI() *vistaTUI {
+	return &vistaTUI{
+		nombre: "Plazas",
+		columnas: []columnaTUI{
+			{"Plaza", 5}, {"Estado", 8}, {"Matrícula", 9}, {"Vehículo", 22}, {"Incidencias", 0},
+		},
+		filas: func() []filaTUI {
+			ocupantes := map[int]*Vehiculo{}
+			for _, v := range almacen.Vehiculos().EnTaller() {
+				ocupantes[v.NumeroPlaza] = v
+			}
+			var filas []filaTUI
+			for i := 1; i <= ultimaPlaza(); i++ {
+				celdas := []string{strconv.Itoa(i), "Libre", "", "", ""}
+				if v := ocupantes[i]; v != nil {
+					celdas[1], celdas[2], celdas[3] = "Ocupada", v.Matricula, v.Marca+" "+v.Modelo
+					if lineas := lineasOrden(v, v.Orden); len(lineas) > 0 {
+						celdas[4] = fmt.Sprintf("%s (%s, %s)", resumenOrden(lineas), prioridadOrden(lineas), estadoOrden(lineas))
+					}
+				}
+				filas = append(filas, filaTUI{strconv.Itoa(i), celdas})
+			}
+			return filas
+		},
+		detalle: func(clave string) []string {
+			plaza, _ := strconv.Atoi(clave)
+			lineas := []string{fmt.Sprintf("Plaza %d de %d (%d ocupadas)", plaza, calcularTotalPlazas(), contarPlazasOcupadas())}
+			for _, v := range almacen.Vehiculos().EnTaller() {
+				if v.NumeroPlaza != plaza {
+					continue
+				}
+				lineas = append(lineas, fmt.Sprintf("Vehículo: %s %s (%s), entrada %s", v.Marca, v.Modelo, v.Matricula, v.FechaEntrada))
+				if c := buscarPropietario(v); c != nil {
+					lineas = append(lineas, fmt.Sprintf("Cliente: %s (%s)", c.Nombre, c.Telefono))
+				}
+				for _, inc := range lineasOrden(v, v.Orden) {
+					if len(inc.Mecanicos) > 0 {
+						lineas = append(lineas, fmt.Sprintf("Mecánicos de la incidencia %d: %s", inc.ID, idsMecanicos(inc.Mecanicos)))
+					}
+				}
+			}
+			return lineas
+		},
+	}
+}
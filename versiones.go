@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Control de concurrencia optimista
+//
+// Cada entidad lleva un número de versión que guardar incrementa. Quien lee
+// una entidad para modificarla más tarde (un menú que espera a que el
+// usuario escriba, un formulario web...) se queda con una copia; si al
+// guardar la versión ya no coincide es que otro puesto la ha cambiado
+// entretanto. En ese caso no se guarda nada y se devuelve un errorConflicto
+// con los campos que han cambiado, para que el usuario los revise y vuelva a
+// intentarlo.
+
+type cambioCampo struct {
+	Campo string
+	Antes string // valor en la copia del usuario
+	Ahora string // valor guardado por el otro puesto
+}
+
+type errorConflicto struct {
+	Entidad string
+	Clave   string
+	Cambios []cambioCampo
+}
+
+func (e *errorConflicto) Error() string {
+	return fmt.Sprintf("otro usuario ha modificado %s %s mientras se editaba", e.Entidad, e.Clave)
+}
+
+// comprobarVersion compara la copia leída por el usuario con la entidad
+// actual. Ambas deben ser punteros del mismo tipo de entidad.
+func comprobarVersion(leida, actual interface{}) error {
+	if versionEntidad(leida) == versionEntidad(actual) {
+		return nil
+	}
+	entidad, clave := describirEntidad(actual)
+	return &errorConflicto{
+		Entidad: entidad,
+		Clave:   clave,
+		Cambios: diferencias(camposEntidad(leida), camposEntidad(actual)),
+	}
+}
+
+// incrementarVersion se llama al guardar cada entidad.
+func incrementarVersion(entidad interface{}) {
+	switch e := entidad.(type) {
+	case *Cliente:
+		e.Version++
+	case *Vehiculo:
+		e.Version++
+	case *Incidencia:
+		e.Version++
+	case *Mecanico:
+		e.Version++
+	}
+}
+
+func versionEntidad(entidad interface{}) int {
+	switch e := entidad.(type) {
+	case *Cliente:
+		return e.Version
+	case *Vehiculo:
+		return e.Version
+	case *Incidencia:
+		return e.Version
+	case *Mecanico:
+		return e.Version
+	}
+	return 0
+}
+
+func describirEntidad(entidad interface{}) (string, string) {
+	switch e := entidad.(type) {
+	case *Cliente:
+		return "el cliente", fmt.Sprint(e.ID)
+	case *Vehiculo:
+		return "el vehículo", e.Matricula
+	case *Incidencia:
+		return "la incidencia", fmt.Sprint(e.ID)
+	case *Mecanico:
+		return "el mecánico", fmt.Sprint(e.ID)
+	}
+	return "el registro", ""
+}
+
+// camposEntidad devuelve los campos de la entidad con los mismos nombres
+// que en las instantáneas, sin la versión.
+func camposEntidad(entidad interface{}) map[string]interface{} {
+	var dto interface{}
+	switch e := entidad.(type) {
+	case *Cliente:
+		dto = clienteAJSON(e)
+	case *Vehiculo:
+		dto = vehiculoAJSON(e, buscarPropietario(e))
+	case *Incidencia:
+		dto = incidenciaAJSON(e)
+	case *Mecanico:
+		dto = mecanicoAJSON(e)
+	}
+	return camposJSON([]byte(aJSON(dto)))
+}
+
+func camposJSON(datos []byte) map[string]interface{} {
+	campos := map[string]interface{}{}
+	json.Unmarshal(datos, &campos)
+	delete(campos, "version")
+	return campos
+}
+
+// diferencias lista, ordenados por nombre, los campos con distinto valor.
+func diferencias(antes, ahora map[string]interface{}) []cambioCampo {
+	nombres := map[string]bool{}
+	for campo := range antes {
+		nombres[campo] = true
+	}
+	for campo := range ahora {
+		nombres[campo] = true
+	}
+
+	var cambios []cambioCampo
+	for campo := range nombres {
+		a, b := formatearCampo(antes[campo]), formatearCampo(ahora[campo])
+		if a != b {
+			cambios = append(cambios, cambioCampo{Campo: campo, Antes: a, Ahora: b})
+		}
+	}
+	sort.Slice(cambios, func(i, j int) bool { return cambios[i].Campo < cambios[j].Campo })
+	return cambios
+}
+
+func formatearCampo(valor interface{}) string {
+	if valor == nil {
+		return ""
+	}
+	if texto, ok := valor.(string); ok {
+		return texto
+	}
+	return aJSON(valor)
+}
+
+// mostrarConflicto explica al usuario qué ha cambiado si err es un
+// conflicto de versiones.
+func mostrarConflicto(err error) {
+	var conflicto *errorConflicto
+	if !errors.As(err, &conflicto) {
+		return
+	}
+
+	if len(conflicto.Cambios) > 0 {
+		fmt.Println("\nCambios hechos por el otro usuario:")
+		for _, c := range conflicto.Cambios {
+			fmt.Printf("  %s: %q -> %q\n", c.Campo, c.Antes, c.Ahora)
+		}
+	}
+	fmt.Println("\nNo se ha guardado nada. Revise los datos actuales y vuelva a intentarlo.")
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// comprobarConflicto verifica que err es un errorConflicto del cliente con
+// exactamente los cambios indicados.
+func comprobarConflicto(t *testing.T, err error, id string, cambios []cambioCampo) {
+	t.Helper()
+	var conflicto *errorConflicto
+	if !errors.As(err, &conflicto) {
+		t.Fatalf("error %v, se esperaba un conflicto de versiones", err)
+	}
+	if conflicto.Entidad != "el cliente" || conflicto.Clave != id || !slices.Equal(conflicto.Cambios, cambios) {
+		t.Errorf("conflicto en %s %s con cambios %v, se esperaba el cliente %s con %v",
+			conflicto.Entidad, conflicto.Clave, conflicto.Cambios, id, cambios)
+	}
+}
+
+// Quien edita una copia que otro puesto ha modificado entretanto recibe un
+// conflicto con lo que cambió, y no se guarda nada.
+func TestConflictoAlEditarCopia(t *testing.T) {
+	for nombre, abrir := range almacenesDePrueba(t) {
+		t.Run(nombre, func(t *testing.T) {
+			usarAlmacen(t, abrir(t))
+			cliente, err := registrarCliente(0, "Marta", "600000000", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			var leido Cliente
+			consultar(func() { leido = *cliente })
+
+			// otro puesto cambia el teléfono
+			if err := operacion(func() error {
+				cliente.Telefono = "611111111"
+				return guardar(cliente)
+			}); err != nil {
+				t.Fatal(err)
+			}
+
+			err = operacion(func() error {
+				if err := comprobarVersion(&leido, cliente); err != nil {
+					return err
+				}
+				cliente.Nombre = "Marta López"
+				return guardar(cliente)
+			})
+			comprobarConflicto(t, err, fmt.Sprint(cliente.ID), []cambioCampo{{Campo: "telefono", Antes: "600000000", Ahora: "611111111"}})
+			consultar(func() {
+				if cliente.Nombre != "Marta" || cliente.Version != leido.Version+1 {
+					t.Errorf("tras el conflicto el cliente es %q con versión %d", cliente.Nombre, cliente.Version)
+				}
+			})
+		})
+	}
+}
+
+// Dos procesos con la misma base de datos: el que guarda con una versión
+// atrasada recibe el conflicto y recarga los datos del otro.
+func TestConflictoEntreProcesos(t *testing.T) {
+	if !slices.Contains(sql.Drivers(), driverSQL) {
+		t.Skip("compilado sin -tags sqlite")
+	}
+	ruta := filepath.Join(t.TempDir(), "taller.db")
+	abrir := func() *almacenSQL {
+		a, err := abrirAlmacenSQL(ruta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { a.Cerrar() })
+		return a
+	}
+	uno := abrir()
+	usarAlmacen(t, uno)
+	nuevo, err := registrarCliente(0, "Marta", "600000000", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := nuevo.ID
+	otro := abrir()
+
+	almacen = uno
+	if err := operacion(func() error {
+		c := buscarCliente(id)
+		c.Telefono = "611111111"
+		return guardar(c)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	almacen = otro
+	err = operacion(func() error {
+		c := buscarCliente(id)
+		c.Nombre = "Marta López"
+		return guardar(c)
+	})
+	comprobarConflicto(t, err, fmt.Sprint(id), []cambioCampo{
+		{Campo: "nombre", Antes: "Marta López", Ahora: "Marta"},
+		{Campo: "telefono", Antes: "600000000", Ahora: "611111111"},
+	})
+	consultar(func() {
+		c := buscarCliente(id)
+		if c.Nombre != "Marta" || c.Telefono != "611111111" || c.Version != 2 {
+			t.Errorf("tras recargar el cliente es %q, %s, versión %d", c.Nombre, c.Telefono, c.Version)
+		}
+	})
+
+	// con los datos recargados el segundo intento se guarda
+	if err := operacion(func() error {
+		c := buscarCliente(id)
+		c.Nombre = "Marta López"
+		return guardar(c)
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Servidor web
+//
+// Se arranca con -web y atiende mientras se usan los menús de consola. No
+// necesita nada externo: las plantillas van dentro del ejecutable y todas
+// las páginas leen y modifican el estado con las mismas funciones que los
+// menús. Las páginas de recepción están en recepcion.go.
+
+//go:embed plantillas/*.html plantillas/*.md plantillas/*.txt
+var ficherosPlantillas embed.FS
+
+var plantillas = template.Must(template.ParseFS(ficherosPlantillas, "plantillas/*.html"))
+
+func manejadorWeb() http.Handler {
+	mux := http.NewServeMux()
+	registrarRutasRecepcion(mux)
+	mux.HandleFunc("GET /panel", paginaPanel)
+	mux.HandleFunc("GET /panel/plazas", fragmentoPlazas)
+	mux.HandleFunc("GET /panel/eventos", eventosPanel)
+	mux.HandleFunc("GET /informes.json", informeJSON)
+	mux.HandleFunc("GET /reportes/{nombre}", reporteWeb)
+	mux.HandleFunc("GET /webhooks/entregas", entregasWebhookWeb)
+	mux.HandleFunc("POST /webhooks/{id}/prueba", probarWebhookWeb)
+	// Los formularios sólo se aceptan desde las propias páginas.
+	return http.NewCrossOriginProtection().Handler(mux)
+}
+
+// iniciarServidorWeb empieza a escuchar en la dirección indicada y atiende
+// en segundo plano. Devuelve la dirección real (útil con el puerto 0).
+func iniciarServidorWeb(direccion string) (string, error) {
+	escucha, err := net.Listen("tcp", direccion)
+	if err != nil {
+		return "", err
+	}
+	go http.Serve(escucha, manejadorWeb())
+	return escucha.Addr().String(), nil
+}
+
+// renderizar ejecuta la plantilla entera antes de escribir nada, para poder
+// devolver un error 500 limpio si falla.
+func renderizar(w http.ResponseWriter, nombre string, datos interface{}) {
+	var b bytes.Buffer
+	if err := plantillas.ExecuteTemplate(&b, nombre, datos); err != nil {
+		http.Error(w, "Error al generar la página: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	b.WriteTo(w)
+}
+
+// Panel en directo (ver panel.go)
+
+func paginaPanel(w http.ResponseWriter, r *http.Request) {
+	renderizar(w, "panel.html", datosPanel())
+}
+
+func fragmentoPlazas(w http.ResponseWriter, r *http.Request) {
+	renderizar(w, "plazas", datosPanel())
+}
+
+// eventosPanel avisa al navegador (server-sent events) de cada cambio del
+// taller y, cada refrescoPanel, para que actualice el tiempo en plaza.
+func eventosPanel(w http.ResponseWriter, r *http.Request) {
+	vaciador, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "el servidor no admite eventos", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	reloj := time.NewTicker(refrescoPanel)
+	defer reloj.Stop()
+	for {
+		aviso := cambios.esperar()
+		if _, err := fmt.Fprint(w, "data: cambio\n\n"); err != nil {
+			return
+		}
+		vaciador.Flush()
+		select {
+		case <-aviso:
+		case <-reloj.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
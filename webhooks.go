@@ -0,0 +1,530 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Webhooks
+//
+// Otros programas (contabilidad, CRM...) se suscriben a los eventos del
+// taller y reciben cada uno como un POST con JSON. Las operaciones anotan
+// los eventos con emitirWebhook mientras trabajan; operacion los publica
+// sólo si la transacción termina bien, así que nunca se anuncia un cambio
+// que no llegó a guardarse. Las suscripciones se guardan en un fichero JSON
+// (-webhooks) y las entregas se hacen en segundo plano, con reintentos.
+//
+// Cada petición lleva las cabeceras X-Taller-Evento, X-Taller-Entrega,
+// X-Taller-Fecha (segundos Unix) y X-Taller-Firma, que es
+// "sha256=" + HMAC-SHA256 en hexadecimal, con el secreto de la suscripción,
+// de fecha + "." + cuerpo. Quien recibe debe calcularla igual y rechazar las
+// fechas demasiado antiguas.
+
+// Tipos de evento que se pueden suscribir
+const (
+	webhookClienteCreado       = "cliente.creado"
+	webhookIncidenciaCreada    = "incidencia.creada"
+	webhookIncidenciaEstado    = "incidencia.estado"
+	webhookIncidenciaAsignada  = "incidencia.asignada"
+	webhookIncidenciaRetirada  = "incidencia.desasignada"
+	webhookVehiculoEntrada     = "vehiculo.entrada"
+	webhookVehiculoSalida      = "vehiculo.salida"
+	webhookPrueba              = "prueba"
+	maxRegistroEntregasWebhook = 200
+)
+
+var tiposWebhook = []string{webhookClienteCreado, webhookIncidenciaCreada, webhookIncidenciaEstado,
+	webhookIncidenciaAsignada, webhookIncidenciaRetirada, webhookVehiculoEntrada, webhookVehiculoSalida}
+
+// tipoWebhookEvento traduce los eventos del historial (ver historial.go).
+var tipoWebhookEvento = map[string]string{
+	eventoApertura:      webhookIncidenciaCreada,
+	eventoEstado:        webhookIncidenciaEstado,
+	eventoAsignacion:    webhookIncidenciaAsignada,
+	eventoDesasignacion: webhookIncidenciaRetirada,
+	eventoEntradaPlaza:  webhookVehiculoEntrada,
+	eventoSalidaPlaza:   webhookVehiculoSalida,
+}
+
+// reintentosWebhooks son las esperas antes de cada reintento.
+var reintentosWebhooks = []time.Duration{10 * time.Second, time.Minute, 5 * time.Minute, 30 * time.Minute}
+
+type suscripcionWebhook struct {
+	ID      int      `json:"id"`
+	URL     string   `json:"url"`
+	Secreto string   `json:"secreto"`
+	Eventos []string `json:"eventos"` // vacío = todos
+	Activa  bool     `json:"activa"`
+}
+
+func (s *suscripcionWebhook) recibe(tipo string) bool {
+	if !s.Activa {
+		return false
+	}
+	if len(s.Eventos) == 0 || tipo == webhookPrueba {
+		return true
+	}
+	for _, e := range s.Eventos {
+		if e == tipo {
+			return true
+		}
+	}
+	return false
+}
+
+type eventoWebhook struct {
+	ID    string      `json:"id"`
+	Tipo  string      `json:"tipo"`
+	Fecha time.Time   `json:"fecha"`
+	Datos interface{} `json:"datos"`
+}
+
+// entregaWebhook es un intento de entrega, tal y como queda en el registro.
+type entregaWebhook struct {
+	Fecha         time.Time `json:"fecha"`
+	SuscripcionID int       `json:"suscripcion_id"`
+	EventoID      string    `json:"evento_id"`
+	Tipo          string    `json:"tipo"`
+	Intento       int       `json:"intento"`
+	Codigo        int       `json:"codigo,omitempty"` // estado HTTP de la respuesta
+	Error         string    `json:"error,omitempty"`
+	Entregado     bool      `json:"entregado"`
+}
+
+type gestorWebhooks struct {
+	mu            sync.Mutex
+	ruta          string // fichero de suscripciones; vacío = sólo en memoria
+	suscripciones []*suscripcionWebhook
+	registro      []entregaWebhook // el más reciente al final
+	reintentos    []time.Duration  // ver reintentosWebhooks
+}
+
+var webhooks = &gestorWebhooks{reintentos: reintentosWebhooks}
+
+// salientes son los eventos de la operación en curso (ver operacion).
+var salientes []*eventoWebhook
+
+// emitirWebhook anota un evento para publicarlo cuando la operación en curso
+// termine bien. Sólo se llama dentro de operacion.
+func emitirWebhook(tipo string, datos interface{}) {
+	salientes = append(salientes, &eventoWebhook{ID: idAleatorio(), Tipo: tipo, Fecha: time.Now(), Datos: datos})
+}
+
+// emitirEvento anuncia un evento del historial con los datos de la
+// incidencia y del vehículo a los que se refiere.
+func emitirEvento(e *Evento) {
+	tipo, ok := tipoWebhookEvento[e.Tipo]
+	if !ok {
+		return
+	}
+	datos := map[string]interface{}{"evento": eventoAJSON(e)}
+	if inc := almacen.Incidencias().PorID(e.IncidenciaID); inc != nil {
+		datos["incidencia"] = incidenciaAJSON(inc)
+	}
+	if v := almacen.Vehiculos().PorMatricula(e.Matricula); v != nil {
+		datos["vehiculo"] = vehiculoAJSON(v, buscarPropietario(v))
+	}
+	emitirWebhook(tipo, datos)
+}
+
+func idAleatorio() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// cargar lee las suscripciones del fichero, si existe.
+func (g *gestorWebhooks) cargar(ruta string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.ruta = ruta
+	datos, err := os.ReadFile(ruta)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(datos, &g.suscripciones)
+}
+
+// guardar escribe las suscripciones; quien llama tiene g.mu.
+func (g *gestorWebhooks) guardar() error {
+	if g.ruta == "" {
+		return nil
+	}
+	datos, err := json.MarshalIndent(g.suscripciones, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(g.ruta, datos, 0600)
+}
+
+// suscripcion devuelve una copia de la suscripción con ese ID, si existe.
+func (g *gestorWebhooks) suscripcion(id int) (suscripcionWebhook, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, s := range g.suscripciones {
+		if s.ID == id {
+			return *s, true
+		}
+	}
+	return suscripcionWebhook{}, false
+}
+
+func (g *gestorWebhooks) lista() []suscripcionWebhook {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	var lista []suscripcionWebhook
+	for _, s := range g.suscripciones {
+		lista = append(lista, *s)
+	}
+	return lista
+}
+
+func (g *gestorWebhooks) anadir(url string, eventos []string) (*suscripcionWebhook, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return nil, fmt.Errorf("la URL %q debe empezar por http:// o https://", url)
+	}
+	for _, e := range eventos {
+		valido := false
+		for _, t := range tiposWebhook {
+			valido = valido || e == t
+		}
+		if !valido {
+			return nil, fmt.Errorf("evento %q no válido", e)
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	id := 1
+	for _, s := range g.suscripciones {
+		if s.ID >= id {
+			id = s.ID + 1
+		}
+	}
+	s := &suscripcionWebhook{ID: id, URL: url, Secreto: idAleatorio(), Eventos: eventos, Activa: true}
+	g.suscripciones = append(g.suscripciones, s)
+	if err := g.guardar(); err != nil {
+		g.suscripciones = g.suscripciones[:len(g.suscripciones)-1]
+		return nil, err
+	}
+	copia := *s
+	return &copia, nil
+}
+
+// modificar aplica fn a la suscripción (o la elimina si fn devuelve false) y
+// guarda el fichero.
+func (g *gestorWebhooks) modificar(id int, fn func(s *suscripcionWebhook) bool) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for i, s := range g.suscripciones {
+		if s.ID != id {
+			continue
+		}
+		antes := append([]*suscripcionWebhook{}, g.suscripciones...)
+		copia := *s
+		if fn(&copia) {
+			g.suscripciones[i] = &copia
+		} else {
+			g.suscripciones = append(g.suscripciones[:i:i], g.suscripciones[i+1:]...)
+		}
+		if err := g.guardar(); err != nil {
+			g.suscripciones = antes
+			return err
+		}
+		return nil
+	}
+	return fmt.Errorf("no existe la suscripción %d", id)
+}
+
+// publicar entrega los eventos a las suscripciones que los reciben.
+func (g *gestorWebhooks) publicar(eventos []*eventoWebhook) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, e := range eventos {
+		for _, s := range g.suscripciones {
+			if s.recibe(e.Tipo) {
+				go g.entregar(s.ID, e, 1)
+			}
+		}
+	}
+}
+
+// probar envía un evento de prueba a la suscripción y espera el resultado.
+func (g *gestorWebhooks) probar(id int) (entregaWebhook, error) {
+	s, ok := g.suscripcion(id)
+	if !ok {
+		return entregaWebhook{}, fmt.Errorf("no existe la suscripción %d", id)
+	}
+	e := &eventoWebhook{ID: idAleatorio(), Tipo: webhookPrueba, Fecha: time.Now(),
+		Datos: map[string]string{"mensaje": "Evento de prueba del taller"}}
+	return g.enviar(s, e, 1), nil
+}
+
+// entregar envía el evento y, si falla, lo vuelve a intentar más tarde. La
+// suscripción se busca de nuevo en cada intento: si entretanto se ha
+// eliminado o desactivado ya no se envía, y si ha cambiado se usa la nueva.
+func (g *gestorWebhooks) entregar(id int, e *eventoWebhook, intento int) {
+	s, ok := g.suscripcion(id)
+	if !ok || !s.recibe(e.Tipo) {
+		return
+	}
+	r := g.enviar(s, e, intento)
+	if !r.Entregado && intento <= len(g.reintentos) {
+		time.AfterFunc(g.reintentos[intento-1], func() { g.entregar(id, e, intento+1) })
+	}
+}
+
+// enviar hace un intento y lo anota en el registro.
+func (g *gestorWebhooks) enviar(s suscripcionWebhook, e *eventoWebhook, intento int) entregaWebhook {
+	r := entregaWebhook{Fecha: time.Now(), SuscripcionID: s.ID, EventoID: e.ID, Tipo: e.Tipo, Intento: intento}
+	cuerpo, err := json.Marshal(e)
+	if err == nil {
+		var peticion *http.Request
+		peticion, err = http.NewRequest(http.MethodPost, s.URL, bytes.NewReader(cuerpo))
+		if err == nil {
+			fecha := strconv.FormatInt(time.Now().Unix(), 10)
+			peticion.Header.Set("Content-Type", "application/json")
+			peticion.Header.Set("X-Taller-Evento", e.Tipo)
+			peticion.Header.Set("X-Taller-Entrega", e.ID)
+			peticion.Header.Set("X-Taller-Fecha", fecha)
+			peticion.Header.Set("X-Taller-Firma", firmarWebhook(s.Secreto, fecha, cuerpo))
+			var respuesta *http.Response
+			respuesta, err = clienteHTTPAvisos.Do(peticion)
+			if err == nil {
+				respuesta.Body.Close()
+				r.Codigo = respuesta.StatusCode
+				if respuesta.StatusCode/100 != 2 {
+					err = fmt.Errorf("respuesta %s", respuesta.Status)
+				}
+			}
+		}
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	r.Entregado = err == nil
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.registro = append(g.registro, r)
+	if len(g.registro) > maxRegistroEntregasWebhook {
+		g.registro = g.registro[len(g.registro)-maxRegistroEntregasWebhook:]
+	}
+	return r
+}
+
+func firmarWebhook(secreto, fecha string, cuerpo []byte) string {
+	mac := hmac.New(sha256.New, []byte(secreto))
+	mac.Write([]byte(fecha + "."))
+	mac.Write(cuerpo)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (g *gestorWebhooks) entregas() []entregaWebhook {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]entregaWebhook{}, g.registro...)
+}
+
+// Web: registro de entregas y envío de prueba
+
+func entregasWebhookWeb(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(webhooks.entregas())
+}
+
+func probarWebhookWeb(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.PathValue("id"))
+	resultado, err := webhooks.probar(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(resultado)
+}
+
+// Funciones de menú
+
+func menuWebhooks() {
+	for {
+		limpiarPantalla()
+		fmt.Println("=== WEBHOOKS ===")
+		fmt.Println("1. Listar suscripciones")
+		fmt.Println("2. Añadir suscripción")
+		fmt.Println("3. Eliminar suscripción")
+		fmt.Println("4. Activar/desactivar suscripción")
+		fmt.Println("5. Enviar evento de prueba")
+		fmt.Println("6. Registro de entregas")
+		fmt.Println("0. Volver al menú principal")
+
+		var opcion int
+		fmt.Print("\nSeleccione una opción: ")
+		fmt.Scanf("%d", &opcion)
+		fmt.Scanln()
+
+		switch opcion {
+		case 1:
+			listarSuscripcionesWebhook()
+		case 2:
+			anadirSuscripcionWebhook()
+		case 3, 4:
+			modificarSuscripcionWebhook(opcion == 3)
+		case 5:
+			probarSuscripcionWebhook()
+		case 6:
+			verEntregasWebhook()
+		case 0:
+			return
+		default:
+			fmt.Println("Opción inválida")
+			pausar()
+		}
+	}
+}
+
+func listarSuscripcionesWebhook() {
+	limpiarPantalla()
+	fmt.Println("=== SUSCRIPCIONES ===")
+	lista := webhooks.lista()
+	if len(lista) == 0 {
+		fmt.Println("No hay suscripciones")
+		pausar()
+		return
+	}
+	var filas [][]string
+	for _, s := range lista {
+		eventos, estado := "todos", "Activa"
+		if len(s.Eventos) > 0 {
+			eventos = strings.Join(s.Eventos, ", ")
+		}
+		if !s.Activa {
+			estado = "Desactivada"
+		}
+		filas = append(filas, []string{strconv.Itoa(s.ID), s.URL, eventos, estado})
+	}
+	imprimirTabla(os.Stdout, []string{"ID", "URL", "Eventos", "Estado"}, filas)
+	pausar()
+}
+
+func anadirSuscripcionWebhook() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== AÑADIR SUSCRIPCIÓN ===")
+	url := leerCriterio(reader, "URL: ")
+	fmt.Println("Eventos disponibles:", strings.Join(tiposWebhook, ", "))
+	var eventos []string
+	for _, e := range strings.Split(leerCriterio(reader, "Eventos separados por comas (vacío = todos): "), ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			eventos = append(eventos, e)
+		}
+	}
+
+	s, err := webhooks.anadir(url, eventos)
+	if err != nil {
+		fmt.Println("Error:", err)
+		pausar()
+		return
+	}
+	fmt.Printf("\nSuscripción creada con ID %d\n", s.ID)
+	fmt.Println("Secreto para comprobar las firmas:", s.Secreto)
+	pausar()
+}
+
+// modificarSuscripcionWebhook elimina la suscripción o cambia si está activa.
+func modificarSuscripcionWebhook(eliminar bool) {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	if eliminar {
+		fmt.Println("=== ELIMINAR SUSCRIPCIÓN ===")
+	} else {
+		fmt.Println("=== ACTIVAR/DESACTIVAR SUSCRIPCIÓN ===")
+	}
+	id, err := strconv.Atoi(leerCriterio(reader, "ID de la suscripción: "))
+	if err != nil {
+		fmt.Println("Error: ID no válido")
+		pausar()
+		return
+	}
+	activa := false
+	err = webhooks.modificar(id, func(s *suscripcionWebhook) bool {
+		s.Activa = !s.Activa
+		activa = s.Activa
+		return !eliminar
+	})
+	switch {
+	case err != nil:
+		fmt.Println("Error:", err)
+	case eliminar:
+		fmt.Println("Suscripción eliminada")
+	case activa:
+		fmt.Println("Suscripción activada")
+	default:
+		fmt.Println("Suscripción desactivada")
+	}
+	pausar()
+}
+
+func probarSuscripcionWebhook() {
+	limpiarPantalla()
+	reader := bufio.NewReader(os.Stdin)
+
+	fmt.Println("=== ENVIAR EVENTO DE PRUEBA ===")
+	id, err := strconv.Atoi(leerCriterio(reader, "ID de la suscripción: "))
+	if err != nil {
+		fmt.Println("Error: ID no válido")
+		pausar()
+		return
+	}
+	r, err := webhooks.probar(id)
+	switch {
+	case err != nil:
+		fmt.Println("Error:", err)
+	case r.Entregado:
+		fmt.Printf("Entregado (respuesta %d)\n", r.Codigo)
+	default:
+		fmt.Println("Error:", r.Error)
+	}
+	pausar()
+}
+
+func verEntregasWebhook() {
+	limpiarPantalla()
+	fmt.Println("=== REGISTRO DE ENTREGAS ===")
+	registro := webhooks.entregas()
+	if len(registro) == 0 {
+		fmt.Println("Todavía no se ha entregado ningún evento")
+		pausar()
+		return
+	}
+	var filas [][]string
+	for i := len(registro) - 1; i >= 0; i-- {
+		r := registro[i]
+		resultado := "Entregado"
+		if !r.Entregado {
+			resultado = "Error: " + r.Error
+		}
+		filas = append(filas, []string{r.Fecha.Format("02/01/2006 15:04:05"), strconv.Itoa(r.SuscripcionID),
+			r.Tipo, r.EventoID, strconv.Itoa(r.Intento), resultado})
+	}
+	imprimirTabla(os.Stdout, []string{"Fecha", "Suscripción", "Evento", "ID del evento", "Intento", "Resultado"}, filas)
+	pausar()
+}
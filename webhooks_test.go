@@ -0,0 +1,163 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// peticionWebhook es una petición que llegó al receptor de prueba.
+type peticionWebhook struct {
+	llegada   time.Time
+	cabeceras http.Header
+	cuerpo    []byte
+}
+
+// receptorWebhook levanta un servidor que responde con error a las primeras
+// peticiones (fallos) y bien a las demás; devuelve su URL y las peticiones
+// que recibe.
+func receptorWebhook(t *testing.T, fallos int) (string, chan peticionWebhook) {
+	var mu sync.Mutex
+	var n int
+	recibidas := make(chan peticionWebhook, 20)
+	servidor := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		n++
+		falla := n <= fallos
+		mu.Unlock()
+		if falla {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		recibidas <- peticionWebhook{time.Now(), r.Header.Clone(), cuerpo}
+	}))
+	t.Cleanup(servidor.Close)
+	return servidor.URL, recibidas
+}
+
+// siguientePeticion espera la próxima petición; false si no llega.
+func siguientePeticion(recibidas chan peticionWebhook, espera time.Duration) (peticionWebhook, bool) {
+	select {
+	case p := <-recibidas:
+		return p, true
+	case <-time.After(espera):
+		return peticionWebhook{}, false
+	}
+}
+
+// Los reintentos pendientes se abandonan si la suscripción se desactiva o se
+// elimina entretanto.
+func TestWebhookReintentoSuscripcionRetirada(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		cambiar func(s *suscripcionWebhook) bool
+	}{
+		{"desactivada", func(s *suscripcionWebhook) bool { s.Activa = false; return true }},
+		{"eliminada", func(s *suscripcionWebhook) bool { return false }},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			url, recibidas := receptorWebhook(t, 1)
+			g := &gestorWebhooks{reintentos: []time.Duration{100 * time.Millisecond, 100 * time.Millisecond}}
+			s, err := g.anadir(url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			g.publicar([]*eventoWebhook{{ID: idAleatorio(), Tipo: webhookClienteCreado, Fecha: time.Now()}})
+			if _, ok := siguientePeticion(recibidas, time.Second); !ok {
+				t.Fatal("no llegó el primer intento")
+			}
+			if err := g.modificar(s.ID, caso.cambiar); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := siguientePeticion(recibidas, 400*time.Millisecond); ok {
+				t.Error("se reintentó la entrega a una suscripción " + caso.nombre)
+			}
+			if n := len(g.entregas()); n != 1 {
+				t.Errorf("%d entregas en el registro, se esperaba sólo el primer intento", n)
+			}
+		})
+	}
+}
+
+// Cada intento lleva la firma HMAC-SHA256 de fecha + "." + cuerpo con el
+// secreto de la suscripción, y los reintentos siguen las esperas indicadas
+// hasta entregar el evento o agotarlas.
+func TestWebhookFirmaYReintentos(t *testing.T) {
+	esperas := []time.Duration{30 * time.Millisecond, 60 * time.Millisecond, 90 * time.Millisecond}
+	casos := []struct {
+		nombre     string
+		fallos     int
+		peticiones int
+	}{
+		{"entregado al tercer intento", 2, 3},
+		{"reintentos agotados", 10, len(esperas) + 1},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			url, recibidas := receptorWebhook(t, caso.fallos)
+			g := &gestorWebhooks{reintentos: esperas}
+			s, err := g.anadir(url, []string{webhookIncidenciaEstado})
+			if err != nil {
+				t.Fatal(err)
+			}
+			evento := &eventoWebhook{ID: idAleatorio(), Tipo: webhookIncidenciaEstado, Fecha: time.Now(),
+				Datos: map[string]string{"estado": "en proceso"}}
+			// el primero no llega: la suscripción no lo incluye
+			g.publicar([]*eventoWebhook{{ID: idAleatorio(), Tipo: webhookClienteCreado, Fecha: time.Now()}, evento})
+
+			var anterior time.Time
+			for i := 0; i < caso.peticiones; i++ {
+				p, ok := siguientePeticion(recibidas, time.Second)
+				if !ok {
+					t.Fatalf("no llegó el intento %d", i+1)
+				}
+				if p.cabeceras.Get("X-Taller-Evento") != webhookIncidenciaEstado || p.cabeceras.Get("X-Taller-Entrega") != evento.ID {
+					t.Errorf("intento %d: evento %q, entrega %q", i+1, p.cabeceras.Get("X-Taller-Evento"), p.cabeceras.Get("X-Taller-Entrega"))
+				}
+				fecha := p.cabeceras.Get("X-Taller-Fecha")
+				if segundos, err := strconv.ParseInt(fecha, 10, 64); err != nil || time.Since(time.Unix(segundos, 0)) > time.Minute {
+					t.Errorf("intento %d: fecha %q", i+1, fecha)
+				}
+				mac := hmac.New(sha256.New, []byte(s.Secreto))
+				mac.Write([]byte(fecha + "." + string(p.cuerpo)))
+				if firma := "sha256=" + hex.EncodeToString(mac.Sum(nil)); !hmac.Equal([]byte(firma), []byte(p.cabeceras.Get("X-Taller-Firma"))) {
+					t.Errorf("intento %d: firma %q, se esperaba %q", i+1, p.cabeceras.Get("X-Taller-Firma"), firma)
+				}
+				var cuerpo eventoWebhook
+				if err := json.Unmarshal(p.cuerpo, &cuerpo); err != nil || cuerpo.ID != evento.ID {
+					t.Errorf("intento %d: cuerpo %s", i+1, p.cuerpo)
+				}
+				if i > 0 && p.llegada.Sub(anterior) < esperas[i-1] {
+					t.Errorf("el intento %d llegó %v después del anterior, antes de la espera de %v", i+1, p.llegada.Sub(anterior), esperas[i-1])
+				}
+				anterior = p.llegada
+			}
+			if _, ok := siguientePeticion(recibidas, 2*esperas[len(esperas)-1]); ok {
+				t.Error("llegó un intento de más")
+			}
+
+			registro := g.entregas()
+			if len(registro) != caso.peticiones {
+				t.Fatalf("%d entregas en el registro, se esperaban %d", len(registro), caso.peticiones)
+			}
+			for i, r := range registro {
+				entregado := caso.fallos < caso.peticiones && i == len(registro)-1
+				if r.Intento != i+1 || r.Entregado != entregado || r.SuscripcionID != s.ID || r.EventoID != evento.ID {
+					t.Errorf("entrega %d: %+v", i+1, r)
+				}
+				if !entregado && (r.Codigo != http.StatusInternalServerError || r.Error == "") {
+					t.Errorf("entrega %d: código %d, error %q", i+1, r.Codigo, r.Error)
+				}
+			}
+		})
+	}
+}